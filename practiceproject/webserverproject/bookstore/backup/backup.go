@@ -0,0 +1,195 @@
+package backup
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	"io"
+	"sort"
+	"time"
+)
+
+// Version is the format version written by Write. Read accepts backups up
+// to this version. Version 2 added the lending data.
+const Version = 2
+
+var (
+	ErrChecksum = errors.New("backup: checksum mismatch")
+	ErrVersion  = errors.New("backup: unsupported version")
+)
+
+// Backup is a versioned and checksummed snapshot of a store.
+type Backup struct {
+	Version   int            `json:"version"`
+	CreatedAt time.Time      `json:"created_at"`
+	Provider  string         `json:"provider"`
+	Checksum  string         `json:"checksum"` // 数据部分的sha256摘要
+	Data      store.Snapshot `json:"data"`
+}
+
+// Take makes a backup of s, with its lending data if it implements
+// store.LendingStore. The backup is consistent if s implements
+// store.Snapshotter, or, for the books only, store.TxStore.
+func Take(s store.Store, provider string) (*Backup, error) {
+	snap, err := snapshot(s)
+	if err != nil {
+		return nil, err
+	}
+
+	sortSnapshot(&snap)
+	sum, err := checksum(&snap)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Backup{
+		Version:   Version,
+		CreatedAt: time.Now().UTC(),
+		Provider:  provider,
+		Checksum:  sum,
+		Data:      snap,
+	}, nil
+}
+
+// snapshot copies the content of s, see Take.
+func snapshot(s store.Store) (store.Snapshot, error) {
+	var snap store.Snapshot
+	var err error
+
+	switch ss := s.(type) {
+	case store.Snapshotter:
+		return ss.Snapshot()
+	case store.TxStore:
+		err = ss.Transact(func(tx store.Tx) error {
+			snap.Books, err = tx.GetAll()
+			return err
+		})
+	default:
+		snap.Books, err = s.GetAll()
+	}
+	if err == nil {
+		err = takeCatalog(s, &snap)
+	}
+	if err == nil {
+		err = takeLending(s, &snap)
+	}
+	return snap, err
+}
+
+func takeCatalog(s store.Store, snap *store.Snapshot) error {
+	cs, ok := s.(store.CatalogStore)
+	if !ok {
+		return nil
+	}
+
+	var err error
+	if snap.Authors, err = cs.GetAllAuthors(); err != nil {
+		return err
+	}
+	snap.Presses, err = cs.GetAllPresses()
+	return err
+}
+
+func takeLending(s store.Store, snap *store.Snapshot) error {
+	ls, ok := s.(store.LendingStore)
+	if !ok {
+		return nil
+	}
+
+	var err error
+	if snap.Members, err = ls.GetAllMembers(); err != nil {
+		return err
+	}
+	if snap.Loans, err = ls.GetAllLoans(); err != nil {
+		return err
+	}
+	for _, book := range snap.Books {
+		inv, err := ls.GetInventory(book.Id)
+		if err != nil {
+			return err
+		}
+		if inv.Total > 0 || inv.OnLoan > 0 || inv.Held > 0 {
+			snap.Inventories = append(snap.Inventories, inv)
+		}
+		queue, err := ls.GetReservations(book.Id)
+		if err != nil {
+			return err
+		}
+		snap.Reservations = append(snap.Reservations, queue...)
+	}
+	return nil
+}
+
+func sortSnapshot(snap *store.Snapshot) {
+	sort.Slice(snap.Books, func(i, j int) bool { return snap.Books[i].Id < snap.Books[j].Id })
+	sort.Slice(snap.Authors, func(i, j int) bool { return snap.Authors[i].Id < snap.Authors[j].Id })
+	sort.Slice(snap.Presses, func(i, j int) bool { return snap.Presses[i].Id < snap.Presses[j].Id })
+	sort.Slice(snap.Inventories, func(i, j int) bool { return snap.Inventories[i].BookId < snap.Inventories[j].BookId })
+	sort.Slice(snap.Members, func(i, j int) bool { return snap.Members[i].Id < snap.Members[j].Id })
+	sort.Slice(snap.Loans, func(i, j int) bool { return snap.Loans[i].Id < snap.Loans[j].Id })
+	// 保持同一图书的预约队列顺序
+	sort.SliceStable(snap.Reservations, func(i, j int) bool { return snap.Reservations[i].BookId < snap.Reservations[j].BookId })
+}
+
+func checksum(snap *store.Snapshot) (string, error) {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// Write writes b to w as JSON, gzip compressed if compress is true.
+func Write(w io.Writer, b *Backup, compress bool) error {
+	if !compress {
+		return json.NewEncoder(w).Encode(b)
+	}
+
+	zw := gzip.NewWriter(w)
+	if err := json.NewEncoder(zw).Encode(b); err != nil {
+		zw.Close()
+		return err
+	}
+	return zw.Close()
+}
+
+// Read reads a backup written by Write, compressed or not, and verifies
+// its version and checksum.
+func Read(r io.Reader) (*Backup, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(2)
+
+	var src io.Reader = br
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b { // gzip魔数
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		src = zr
+	}
+
+	var b Backup
+	if err := json.NewDecoder(src).Decode(&b); err != nil {
+		return nil, fmt.Errorf("backup: %w", err)
+	}
+
+	if b.Version < 1 || b.Version > Version {
+		return nil, fmt.Errorf("%w %d", ErrVersion, b.Version)
+	}
+
+	sum, err := checksum(&b.Data)
+	if err != nil {
+		return nil, err
+	}
+	if sum != b.Checksum {
+		return nil, ErrChecksum
+	}
+	return &b, nil
+}
@@ -0,0 +1,209 @@
+package backup_test
+
+import (
+	"bytes"
+	"errors"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/backup"
+	memstore "github.com/Kate-liu/GoBeginner/webserverproject/bookstore/internal/store"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	"reflect"
+	"testing"
+)
+
+func newStore(t *testing.T) *memstore.MemStore {
+	ms := memstore.NewMemStore()
+	ms.CreateAuthor(&store.Author{Id: "a1", Name: "Rob Pike"})
+	ms.CreatePress(&store.Press{Id: "p1", Name: "Addison-Wesley"})
+	for _, book := range []store.Book{
+		{Id: "1", Name: "The Go Programming Language", AuthorIds: []string{"a1"}, PressId: "p1"},
+		{Id: "2", Name: "The Practice of Programming", AuthorIds: []string{"a1"}},
+	} {
+		book := book
+		if err := ms.Create(&book); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ms
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		b, err := backup.Take(newStore(t), "mem")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		if err = backup.Write(&buf, b, compress); err != nil {
+			t.Fatal(err)
+		}
+		if compress && buf.Bytes()[0] != 0x1f {
+			t.Errorf("want gzip data, actual %q", buf.Bytes()[:2])
+		}
+
+		got, err := backup.Read(&buf)
+		if err != nil {
+			t.Fatalf("want nil, actual %s", err.Error())
+		}
+		if !reflect.DeepEqual(got.Data, b.Data) {
+			t.Errorf("want %v, actual %v", b.Data, got.Data)
+		}
+	}
+}
+
+func TestReadChecksum(t *testing.T) {
+	b, _ := backup.Take(newStore(t), "mem")
+
+	var buf bytes.Buffer
+	backup.Write(&buf, b, false)
+	data := bytes.Replace(buf.Bytes(), []byte("Rob Pike"), []byte("Ken Thompson"), 1)
+
+	if _, err := backup.Read(bytes.NewReader(data)); err != backup.ErrChecksum {
+		t.Errorf("want %v, actual %v", backup.ErrChecksum, err)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	b, _ := backup.Take(newStore(t), "mem")
+
+	dst := memstore.NewMemStore()
+	dst.CreateAuthor(&store.Author{Id: "a9", Name: "Brian Kernighan"})
+	dst.Create(&store.Book{Id: "9", Name: "Unix", AuthorIds: []string{"a9"}})
+	dst.Create(&store.Book{Id: "2", Name: "Old Name"})
+
+	changes, err := backup.Diff(dst, b, backup.Replace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var diff []string
+	for _, c := range changes {
+		diff = append(diff, c.String())
+	}
+	want := []string{"+ author a1", "+ press p1", "- book 9", "+ book 1", "~ book 2", "- author a9"}
+	if !reflect.DeepEqual(diff, want) {
+		t.Errorf("want %v, actual %v", want, diff)
+	}
+
+	// Diff不修改存储
+	if _, err = dst.Get("9"); err != nil {
+		t.Errorf("want nil, actual %s", err.Error())
+	}
+
+	if _, err = backup.Restore(dst, b, backup.Merge); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = dst.Get("9"); err != nil {
+		t.Errorf("merge: want nil, actual %s", err.Error())
+	}
+
+	if _, err = backup.Restore(dst, b, backup.Replace); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := backup.Take(dst, "mem")
+	if !reflect.DeepEqual(after.Data, b.Data) {
+		t.Errorf("replace: want %v, actual %v", b.Data, after.Data)
+	}
+}
+
+func TestLending(t *testing.T) {
+	src := newStore(t)
+	src.SetInventory("1", 1)
+	src.CreateMember(&store.Member{Id: "m1", Name: "Tom"})
+	src.CreateMember(&store.Member{Id: "m2", Name: "Jerry"})
+	if _, err := src.Borrow("1", "m1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := src.Reserve("1", "m2"); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := backup.Take(src, "mem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Data.Inventories) != 1 || len(b.Data.Members) != 2 || len(b.Data.Loans) != 1 || len(b.Data.Reservations) != 1 {
+		t.Fatalf("want the lending data, actual %+v", b.Data)
+	}
+
+	dst := memstore.NewMemStore()
+	if _, err = backup.Restore(dst, b, backup.Replace); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := backup.Take(dst, "mem")
+	if !reflect.DeepEqual(after.Data, b.Data) {
+		t.Errorf("want %v, actual %v", b.Data, after.Data)
+	}
+
+	// 恢复的借阅可以归还，新借阅不与其重复
+	if _, err = dst.Return(b.Data.Loans[0].Id); err != nil {
+		t.Errorf("want nil, actual %v", err)
+	}
+	loan, err := dst.Borrow("1", "m2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loan.Id == b.Data.Loans[0].Id {
+		t.Errorf("want a new loan id, actual %s", loan.Id)
+	}
+}
+
+func TestRestoreReplacesEntries(t *testing.T) {
+	b, _ := backup.Take(newStore(t), "mem")
+
+	// 备份中的图书整体覆盖存储中的图书，包括空的字段
+	dst := newStore(t)
+	dst.Update(&store.Book{Id: "2", Press: "Prentice Hall", CoverURL: "/book/2/cover"})
+	if _, err := backup.Restore(dst, b, backup.Merge); err != nil {
+		t.Fatal(err)
+	}
+	if book, _ := dst.Get("2"); book.Press != "" || book.CoverURL != "" {
+		t.Errorf("want the fields cleared, actual %+v", book)
+	}
+}
+
+func TestRestoreFailure(t *testing.T) {
+	b, _ := backup.Take(newStore(t), "mem")
+	b.Data.Books = append(b.Data.Books, store.Book{Id: "3", AuthorIds: []string{"missing"}})
+
+	dst := memstore.NewMemStore()
+	dst.Create(&store.Book{Id: "9"})
+	if _, err := backup.Restore(dst, b, backup.Replace); !errors.Is(err, store.ErrReference) {
+		t.Errorf("want %v, actual %v", store.ErrReference, err)
+	}
+
+	// 失败的恢复不修改存储
+	after, _ := backup.Take(dst, "mem")
+	if len(after.Data.Books) != 1 || after.Data.Books[0].Id != "9" || len(after.Data.Authors) != 0 {
+		t.Errorf("want the store unchanged, actual %+v", after.Data)
+	}
+}
+
+func TestRestoreMergeLendingConflict(t *testing.T) {
+	src := newStore(t)
+	src.SetInventory("1", 1)
+	src.CreateMember(&store.Member{Id: "m1"})
+	src.Borrow("1", "m1")
+	b, _ := backup.Take(src, "mem")
+
+	// 目标存储借出两本，合并后loan-2仍在，而库存只记一本借出
+	dst := newStore(t)
+	dst.SetInventory("1", 2)
+	dst.CreateMember(&store.Member{Id: "m2"})
+	dst.CreateMember(&store.Member{Id: "m3"})
+	dst.Borrow("1", "m2")
+	dst.Borrow("1", "m3")
+	before, _ := backup.Take(dst, "mem")
+
+	if _, err := backup.Restore(dst, b, backup.Merge); !errors.Is(err, store.ErrLendingData) {
+		t.Errorf("want %v, actual %v", store.ErrLendingData, err)
+	}
+	after, _ := backup.Take(dst, "mem")
+	if !reflect.DeepEqual(before.Data, after.Data) {
+		t.Errorf("want the store unchanged, actual %+v", after.Data)
+	}
+
+	// 替换恢复不受影响
+	if _, err := backup.Restore(dst, b, backup.Replace); err != nil {
+		t.Errorf("want nil, actual %v", err)
+	}
+}
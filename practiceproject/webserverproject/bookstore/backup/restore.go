@@ -0,0 +1,236 @@
+package backup
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+)
+
+type Mode string
+
+const (
+	// Merge creates the entries of the backup that are missing in the
+	// store and replaces the ones that differ, keeping the others. The
+	// restore fails with store.ErrLendingData if the merged inventories
+	// do not match the merged loans and reservations.
+	Merge Mode = "merge"
+	// Replace also deletes the entries of the store that are not in the
+	// backup.
+	Replace Mode = "replace"
+)
+
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+// kinds are the kinds of entries of a snapshot, each one only refers to
+// the kinds before it.
+var kinds = []string{"author", "press", "book", "member", "inventory", "loan", "reservation"}
+
+// Change is a difference between a backup and a store.
+type Change struct {
+	Kind   string `json:"kind"`   // kinds中的一种
+	Action string `json:"action"` // create, update 或 delete
+	Id     string `json:"id"`     // 预约的ID为"图书ID/读者ID"
+}
+
+func (c Change) String() string {
+	sign := map[string]string{ActionCreate: "+", ActionUpdate: "~", ActionDelete: "-"}[c.Action]
+	return fmt.Sprintf("%s %s %s", sign, c.Kind, c.Id)
+}
+
+// entry is an author, press, book or lending entry of a snapshot.
+type entry struct {
+	id    string
+	value interface{}
+}
+
+// entries returns the entries of snap by kind.
+func entries(snap *store.Snapshot) map[string][]entry {
+	es := make(map[string][]entry)
+	add := func(kind, id string, value interface{}) {
+		es[kind] = append(es[kind], entry{id, value})
+	}
+	for _, a := range snap.Authors {
+		add("author", a.Id, a)
+	}
+	for _, p := range snap.Presses {
+		add("press", p.Id, p)
+	}
+	for _, book := range snap.Books {
+		add("book", book.Id, book)
+	}
+	for _, m := range snap.Members {
+		add("member", m.Id, m)
+	}
+	for _, inv := range snap.Inventories {
+		add("inventory", inv.BookId, inv)
+	}
+	for _, l := range snap.Loans {
+		add("loan", l.Id, l)
+	}
+	for _, r := range snap.Reservations {
+		add("reservation", r.BookId+"/"+r.MemberId, r)
+	}
+	return es
+}
+
+// addEntry appends the value of e to snap.
+func addEntry(snap *store.Snapshot, e entry) {
+	switch v := e.value.(type) {
+	case store.Author:
+		snap.Authors = append(snap.Authors, v)
+	case store.Press:
+		snap.Presses = append(snap.Presses, v)
+	case store.Book:
+		snap.Books = append(snap.Books, v)
+	case store.Member:
+		snap.Members = append(snap.Members, v)
+	case store.Inventory:
+		snap.Inventories = append(snap.Inventories, v)
+	case store.Loan:
+		snap.Loans = append(snap.Loans, v)
+	case store.Reservation:
+		snap.Reservations = append(snap.Reservations, v)
+	}
+}
+
+// Diff returns the changes that restoring b into s with the given mode
+// would make: authors and presses first, then books and lending data, and
+// deletions of authors and presses last.
+func Diff(s store.Store, b *Backup, mode Mode) ([]Change, error) {
+	if err := check(s, b, mode); err != nil {
+		return nil, err
+	}
+
+	current, err := snapshot(s)
+	if err != nil {
+		return nil, err
+	}
+	return diff(&current, &b.Data, mode), nil
+}
+
+// check returns an error if b cannot be restored into s with mode.
+func check(s store.Store, b *Backup, mode Mode) error {
+	if mode != Merge && mode != Replace {
+		return fmt.Errorf("backup: unknown restore mode %q", mode)
+	}
+	if _, ok := s.(store.CatalogStore); !ok && (len(b.Data.Authors) > 0 || len(b.Data.Presses) > 0) {
+		return fmt.Errorf("backup: %w: authors and presses", store.ErrNotSupported)
+	}
+	lending := len(b.Data.Inventories) > 0 || len(b.Data.Members) > 0 ||
+		len(b.Data.Loans) > 0 || len(b.Data.Reservations) > 0
+	if _, ok := s.(store.LendingStore); !ok && lending {
+		return fmt.Errorf("backup: %w: lending", store.ErrNotSupported)
+	}
+	return nil
+}
+
+func diff(current, want *store.Snapshot, mode Mode) []Change {
+	cur, es := entries(current), entries(want)
+
+	var head, body, tail []Change
+	for _, kind := range kinds {
+		existing := make(map[string]interface{})
+		for _, e := range cur[kind] {
+			existing[e.id] = e.value
+		}
+
+		var puts, deletes []Change
+		for _, e := range es[kind] {
+			if action := diffAction(existing, e.id, e.value); action != "" {
+				puts = append(puts, Change{Kind: kind, Action: action, Id: e.id})
+			}
+			delete(existing, e.id)
+		}
+		if mode == Replace {
+			for _, e := range cur[kind] {
+				if _, ok := existing[e.id]; ok {
+					deletes = append(deletes, Change{Kind: kind, Action: ActionDelete, Id: e.id})
+				}
+			}
+		}
+
+		// 作者与出版社被其他条目引用，最先创建，最后删除
+		if kind == "author" || kind == "press" {
+			head = append(head, puts...)
+			tail = append(tail, deletes...)
+			continue
+		}
+		body = append(body, deletes...)
+		body = append(body, puts...)
+	}
+
+	changes := append(head, body...)
+	return append(changes, tail...)
+}
+
+// diffAction returns the action turning current[id] into want, or "" if
+// they are equal. Entries are compared by their JSON encoding, as read
+// back from a backup file.
+func diffAction(current map[string]interface{}, id string, want interface{}) string {
+	v, ok := current[id]
+	if !ok {
+		return ActionCreate
+	}
+	a, _ := json.Marshal(v)
+	b, _ := json.Marshal(want)
+	if bytes.Equal(a, b) {
+		return ""
+	}
+	return ActionUpdate
+}
+
+// merge returns the content of a store holding current after restoring
+// want into it with mode. The entries of want replace those of current
+// with the same id as a whole.
+func merge(current, want *store.Snapshot, mode Mode) store.Snapshot {
+	if mode == Replace {
+		return *want
+	}
+
+	cur, es := entries(current), entries(want)
+	var snap store.Snapshot
+	for _, kind := range kinds {
+		replaced := make(map[string]bool)
+		for _, e := range es[kind] {
+			replaced[e.id] = true
+		}
+		for _, e := range cur[kind] {
+			if !replaced[e.id] {
+				addEntry(&snap, e)
+			}
+		}
+		for _, e := range es[kind] {
+			addEntry(&snap, e)
+		}
+	}
+	return snap
+}
+
+// Restore applies the changes returned by Diff to s. The whole content of
+// s is replaced at once through store.Restorer, so a failure leaves s
+// unchanged, and an entry of the backup replaces the one of the store
+// instead of being merged into it.
+func Restore(s store.Store, b *Backup, mode Mode) ([]Change, error) {
+	if err := check(s, b, mode); err != nil {
+		return nil, err
+	}
+	rs, ok := s.(store.Restorer)
+	if !ok {
+		return nil, fmt.Errorf("backup: %w: atomic restore", store.ErrNotSupported)
+	}
+
+	var changes []Change
+	err := rs.Restore(func(current store.Snapshot) (store.Snapshot, error) {
+		changes = diff(&current, &b.Data, mode)
+		return merge(&current, &b.Data, mode), nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("backup: %w", err)
+	}
+	return changes, nil
+}
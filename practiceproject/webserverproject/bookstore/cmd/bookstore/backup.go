@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/backup"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The backup and restore subcommands work on a running server through its
+// /admin/backup and /admin/restore endpoints, the stores of the providers
+// live in the memory of the server process.
+
+// adminRequest sends a request to the admin endpoint path of the server
+// and returns the body of its response, the caller must close it.
+func adminRequest(server, token, method, path string, body io.Reader) (io.ReadCloser, error) {
+	req, err := http.NewRequest(method, strings.TrimSuffix(server, "/")+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("server replied %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp.Body, nil
+}
+
+// runBackup writes a backup of the store of a running server to a file.
+func runBackup(args []string) {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	server := fs.String("server", "http://localhost:8080", "url of the server to back up")
+	token := fs.String("token", "", "admin token of the server")
+	out := fs.String("out", "", "backup file to write")
+	compress := fs.Bool("gzip", false, "gzip the backup file")
+	fs.Parse(args)
+
+	if *out == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	body, err := adminRequest(*server, *token, "GET", "/admin/backup", nil)
+	if err != nil {
+		log.Fatal("take backup failed: ", err)
+	}
+	b, err := backup.Read(body) // 校验服务端生成的备份
+	body.Close()
+	if err != nil {
+		log.Fatal("take backup failed: ", err)
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = backup.Write(f, b, *compress); err != nil {
+		f.Close()
+		log.Fatal("write backup failed: ", err)
+	}
+	if err = f.Close(); err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("backup of %d books, %d authors, %d presses, %d members and %d loans written to %s",
+		len(b.Data.Books), len(b.Data.Authors), len(b.Data.Presses), len(b.Data.Members), len(b.Data.Loans), *out)
+}
+
+// runRestore restores a backup file into the store of a running server,
+// or only prints the changes it would make with -dry-run.
+func runRestore(args []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	server := fs.String("server", "http://localhost:8080", "url of the server to restore")
+	token := fs.String("token", "", "admin token of the server")
+	in := fs.String("in", "", "backup file to read")
+	mode := fs.String("mode", string(backup.Merge), "restore mode, merge or replace")
+	dryRun := fs.Bool("dry-run", false, "print the changes without applying them")
+	fs.Parse(args)
+
+	if *in == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	f, err := os.Open(*in)
+	if err != nil {
+		log.Fatal(err)
+	}
+	b, err := backup.Read(f)
+	f.Close()
+	if err != nil {
+		log.Fatal("read backup failed: ", err)
+	}
+
+	var body bytes.Buffer
+	if err = backup.Write(&body, b, false); err != nil {
+		log.Fatal(err)
+	}
+	query := url.Values{"mode": {*mode}, "dry_run": {strconv.FormatBool(*dryRun)}}
+
+	rc, err := adminRequest(*server, *token, "POST", "/admin/restore?"+query.Encode(), &body)
+	if err != nil {
+		log.Fatal("restore failed: ", err)
+	}
+	var resp struct {
+		Changes []backup.Change `json:"changes"`
+	}
+	err = json.NewDecoder(rc).Decode(&resp)
+	rc.Close()
+	if err != nil {
+		log.Fatal("restore failed: ", err)
+	}
+
+	for _, c := range resp.Changes {
+		fmt.Println(c)
+	}
+	if *dryRun {
+		log.Printf("dry run: %d changes not applied", len(resp.Changes))
+		return
+	}
+	log.Printf("%d changes applied from %s", len(resp.Changes), *in)
+}
@@ -1,49 +1,37 @@
 package main
 
 import (
-	"context"
+	"fmt"
 	_ "github.com/Kate-liu/GoBeginner/webserverproject/bookstore/internal/store"
-	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/server"
-	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store/factory"
-	"log"
 	"os"
-	"os/signal"
-	"syscall"
-	"time"
+	"strings"
 )
 
-func main() {
-	s, err := factory.New("mem") // 创建图书数据存储模块实例
-	if err != nil {
-		panic(err)
-	}
+const usage = `usage: bookstore [command] [flags]
 
-	srv := server.NewBookStoreServer(":8080", s) // 创建http服务实例
+commands:
+  serve    run the http service (default)
+  backup   write a backup of the store of a running server to a file
+  restore  restore a backup file into the store of a running server
 
-	errChan, err := srv.ListenAndServe() // 运行http服务
-	if err != nil {
-		log.Println("web server start failed:", err)
-		return
-	}
-	log.Println("web server start ok")
+run "bookstore <command> -h" for the flags of a command.
+`
 
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
-
-	select { // 监视来自errChan以及c的事件
-	case err = <-errChan:
-		log.Println("web server run failed:", err)
-		return
-	case <-c:
-		log.Println("bookstore program is exiting...")
-		ctx, cf := context.WithTimeout(context.Background(), time.Second)
-		defer cf()
-		err = srv.Shutdown(ctx) // 优雅关闭http服务实例
+func main() {
+	cmd, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
 	}
 
-	if err != nil {
-		log.Println("bookstore program exit error:", err)
-		return
+	switch cmd {
+	case "serve":
+		serve(args)
+	case "backup":
+		runBackup(args)
+	case "restore":
+		runRestore(args)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
 	}
-	log.Println("bookstore program exit ok")
 }
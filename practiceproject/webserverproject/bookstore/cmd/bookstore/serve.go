@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"flag"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/server"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/server/middleware"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/server/tenant"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store/blob/local"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store/factory"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store/fault"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// serve runs the http service, it is the default subcommand.
+func serve(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", ":8080", "http listen address")
+	provider := fs.String("provider", "mem", "store provider")
+	leaderLogSize := fs.Int("leader-log", 0, "run as replication leader keeping this many log entries, 0 disables; turns lending off")
+	follow := fs.String("follow", "", "run as replication follower of the leader at this url; turns lending off")
+	forwardWrites := fs.Bool("forward-writes", false, "forward writes received by a follower to its leader")
+	validate := fs.Bool("validate", false, "validate requests against the openapi specification")
+	adminToken := fs.String("admin-token", "", "bearer token of the admin endpoints under /admin, required by -tenancy, -fault-injection and -console")
+	tenancy := fs.Bool("tenancy", false, "serve a separate catalog to each tenant, managed under /admin/tenant with the admin token")
+	trustTenantHeader := fs.Bool("trust-tenant-header", false, "take the tenant from the X-Tenant header of requests without a token")
+	faults := fs.Bool("fault-injection", false, "enable the fault injection endpoints under /admin/faults, for testing only")
+	handlerTimeout := fs.Duration("handler-timeout", 0, "reply 503 to requests not handled within this duration, 0 disables")
+	corsOrigins := fs.String("cors-origins", "", "comma separated origins allowed to make cross-origin requests, * for any")
+	compress := fs.Bool("compress", false, "compress responses with brotli or gzip")
+	securityHeaders := fs.Bool("security-headers", false, "add security headers such as X-Content-Type-Options to responses")
+	tcpAddr := fs.String("tcp-addr", "", "also serve books over the binary tcp protocol at this address")
+	adminConsole := fs.Bool("console", false, "serve the html book management pages under /admin, signed in with the admin or tenant token")
+	fs.Parse(args)
+
+	s, err := factory.New(*provider) // 创建图书数据存储模块实例
+	if err != nil {
+		panic(err)
+	}
+
+	blobs, err := local.New("./blobs") // 创建封面图片存储模块实例
+	if err != nil {
+		panic(err)
+	}
+
+	opts := []server.Option{server.WithBlobStore(blobs)}
+	if *leaderLogSize > 0 {
+		opts = append(opts, server.WithLeader(*leaderLogSize))
+	}
+	if *validate {
+		opts = append(opts, server.WithRequestValidation())
+	}
+	if (*tenancy || *faults || *adminConsole) && *adminToken == "" {
+		log.Fatal("-tenancy, -fault-injection and -console require -admin-token")
+	}
+	if *adminToken != "" {
+		opts = append(opts, server.WithAdminToken(*adminToken))
+	}
+	if *tenancy {
+		opts = append(opts, server.WithTenancy(tenant.NewRegistry(), *adminToken))
+		if *trustTenantHeader {
+			opts = append(opts, server.WithTenantHeader())
+		}
+	}
+	if *faults {
+		opts = append(opts, server.WithFaultInjection(fault.NewInjector()))
+	}
+	if *handlerTimeout > 0 {
+		opts = append(opts, server.WithHandlerTimeout(*handlerTimeout))
+	}
+	if *corsOrigins != "" {
+		opts = append(opts, server.WithCORS(middleware.CORSOptions{
+			AllowedOrigins: strings.Split(*corsOrigins, ","),
+			MaxAge:         10 * time.Minute,
+		}))
+	}
+	if *compress {
+		opts = append(opts, server.WithCompression(middleware.CompressOptions{}))
+	}
+	if *securityHeaders {
+		opts = append(opts, server.WithSecurityHeaders(middleware.DefaultSecurityOptions))
+	}
+	if *tcpAddr != "" {
+		opts = append(opts, server.WithTCP(*tcpAddr))
+	}
+	if *adminConsole {
+		opts = append(opts, server.WithConsole())
+	}
+	if *follow != "" {
+		opts = append(opts, server.WithFollower(*follow, *forwardWrites))
+	}
+	if *leaderLogSize > 0 || *follow != "" {
+		opts = append(opts, server.WithoutLending()) // 借阅数据不参与复制
+	}
+
+	srv, err := server.NewBookStoreServer(*addr, s, opts...) // 创建http服务实例
+	if err != nil {
+		log.Fatal(err)
+	}
+	expvar.Publish("replication", expvar.Func(srv.ReplicationStatus))
+
+	errChan, err := srv.ListenAndServe() // 运行http服务
+	if err != nil {
+		log.Println("web server start failed:", err)
+		return
+	}
+	log.Println("web server start ok")
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+
+	select { // 监视来自errChan以及c的事件
+	case err = <-errChan:
+		log.Println("web server run failed:", err)
+		return
+	case <-c:
+		log.Println("bookstore program is exiting...")
+		ctx, cf := context.WithTimeout(context.Background(), time.Second)
+		defer cf()
+		err = srv.Shutdown(ctx) // 优雅关闭http服务实例
+	}
+
+	if err != nil {
+		log.Println("bookstore program exit error:", err)
+		return
+	}
+	log.Println("bookstore program exit ok")
+}
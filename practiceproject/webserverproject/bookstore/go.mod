@@ -2,4 +2,10 @@ module github.com/Kate-liu/GoBeginner/webserverproject/bookstore
 
 go 1.16
 
-require github.com/gorilla/mux v1.8.0
+require (
+	github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver v0.0.0
+	github.com/andybalholm/brotli v1.0.2
+	github.com/gorilla/mux v1.8.0
+)
+
+replace github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver => ../../webtcpserver/tcpserver
@@ -0,0 +1,176 @@
+package store
+
+import (
+	mystore "github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+)
+
+// checkRefs checks that the authors and the press referred to by book
+// exist. The caller must hold the lock of ms.
+func (ms *MemStore) checkRefs(book *mystore.Book) error {
+	for _, id := range book.AuthorIds {
+		if _, ok := ms.authors[id]; !ok {
+			return mystore.ErrReference
+		}
+	}
+
+	if book.PressId != "" {
+		if _, ok := ms.presses[book.PressId]; !ok {
+			return mystore.ErrReference
+		}
+	}
+	return nil
+}
+
+// CreateAuthor creates a new Author in the store.
+func (ms *MemStore) CreateAuthor(author *mystore.Author) error {
+	ms.Lock()
+	defer ms.Unlock()
+
+	if _, ok := ms.authors[author.Id]; ok {
+		return mystore.ErrExist
+	}
+
+	nAuthor := *author
+	ms.authors[author.Id] = &nAuthor
+	return nil
+}
+
+// UpdateAuthor updates the existed Author in the store.
+func (ms *MemStore) UpdateAuthor(author *mystore.Author) error {
+	ms.Lock()
+	defer ms.Unlock()
+
+	oldAuthor, ok := ms.authors[author.Id]
+	if !ok {
+		return mystore.ErrNotFound
+	}
+
+	nAuthor := *oldAuthor
+	if author.Name != "" {
+		nAuthor.Name = author.Name
+	}
+	ms.authors[author.Id] = &nAuthor
+	return nil
+}
+
+// GetAuthor retrieves an author from the store, by id.
+func (ms *MemStore) GetAuthor(id string) (mystore.Author, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
+	a, ok := ms.authors[id]
+	if ok {
+		return *a, nil
+	}
+	return mystore.Author{}, mystore.ErrNotFound
+}
+
+// GetAllAuthors returns all the authors in the store, in arbitrary order.
+func (ms *MemStore) GetAllAuthors() ([]mystore.Author, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
+	allAuthors := make([]mystore.Author, 0, len(ms.authors))
+	for _, a := range ms.authors {
+		allAuthors = append(allAuthors, *a)
+	}
+	return allAuthors, nil
+}
+
+// DeleteAuthor deletes the author with the given id. An author that is
+// still referred to by a book can not be deleted.
+func (ms *MemStore) DeleteAuthor(id string) error {
+	ms.Lock()
+	defer ms.Unlock()
+
+	if _, ok := ms.authors[id]; !ok {
+		return mystore.ErrNotFound
+	}
+
+	for _, book := range ms.books {
+		for _, authorId := range book.AuthorIds {
+			if authorId == id {
+				return mystore.ErrInUse
+			}
+		}
+	}
+
+	delete(ms.authors, id)
+	return nil
+}
+
+// CreatePress creates a new Press in the store.
+func (ms *MemStore) CreatePress(press *mystore.Press) error {
+	ms.Lock()
+	defer ms.Unlock()
+
+	if _, ok := ms.presses[press.Id]; ok {
+		return mystore.ErrExist
+	}
+
+	nPress := *press
+	ms.presses[press.Id] = &nPress
+	return nil
+}
+
+// UpdatePress updates the existed Press in the store.
+func (ms *MemStore) UpdatePress(press *mystore.Press) error {
+	ms.Lock()
+	defer ms.Unlock()
+
+	oldPress, ok := ms.presses[press.Id]
+	if !ok {
+		return mystore.ErrNotFound
+	}
+
+	nPress := *oldPress
+	if press.Name != "" {
+		nPress.Name = press.Name
+	}
+	ms.presses[press.Id] = &nPress
+	return nil
+}
+
+// GetPress retrieves a press from the store, by id.
+func (ms *MemStore) GetPress(id string) (mystore.Press, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
+	p, ok := ms.presses[id]
+	if ok {
+		return *p, nil
+	}
+	return mystore.Press{}, mystore.ErrNotFound
+}
+
+// GetAllPresses returns all the presses in the store, in arbitrary order.
+func (ms *MemStore) GetAllPresses() ([]mystore.Press, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
+	allPresses := make([]mystore.Press, 0, len(ms.presses))
+	for _, p := range ms.presses {
+		allPresses = append(allPresses, *p)
+	}
+	return allPresses, nil
+}
+
+// DeletePress deletes the press with the given id. A press that still has
+// books can not be deleted.
+func (ms *MemStore) DeletePress(id string) error {
+	ms.Lock()
+	defer ms.Unlock()
+
+	if _, ok := ms.presses[id]; !ok {
+		return mystore.ErrNotFound
+	}
+
+	for _, book := range ms.books {
+		if book.PressId == id {
+			return mystore.ErrInUse
+		}
+	}
+
+	delete(ms.presses, id)
+	return nil
+}
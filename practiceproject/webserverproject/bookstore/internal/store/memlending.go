@@ -0,0 +1,411 @@
+package store
+
+import (
+	"fmt"
+	mystore "github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	"sort"
+)
+
+// checkLent returns ErrInUse if copies of the book are lent or held.
+// The caller must hold the lock of ms.
+func (ms *MemStore) checkLent(bookId string) error {
+	inv, ok := ms.inventories[bookId]
+	if ok && (inv.OnLoan > 0 || inv.Held > 0) {
+		return mystore.ErrInUse
+	}
+	return nil
+}
+
+// dropLending removes the inventory and the reservations of a deleted book.
+// The caller must hold the lock of ms.
+func (ms *MemStore) dropLending(bookId string) {
+	delete(ms.inventories, bookId)
+	delete(ms.reservations, bookId)
+}
+
+// promote holds the available copies of the book for the members waiting
+// in its reservation queue. The caller must hold the lock of ms.
+func (ms *MemStore) promote(inv *mystore.Inventory) {
+	for _, r := range ms.reservations[inv.BookId] {
+		if inv.Available == 0 {
+			return
+		}
+		if !r.Ready {
+			r.Ready = true
+			inv.Held++
+			inv.Available--
+		}
+	}
+}
+
+// SetInventory sets the number of copies of the book.
+func (ms *MemStore) SetInventory(bookId string, total int) (mystore.Inventory, error) {
+	ms.Lock()
+	defer ms.Unlock()
+
+	if _, ok := ms.books[bookId]; !ok {
+		return mystore.Inventory{}, mystore.ErrNotFound
+	}
+	if total < 0 {
+		return mystore.Inventory{}, fmt.Errorf("invalid total %d", total)
+	}
+
+	inv, ok := ms.inventories[bookId]
+	if !ok {
+		inv = &mystore.Inventory{BookId: bookId}
+		ms.inventories[bookId] = inv
+	}
+
+	if total < inv.OnLoan+inv.Held {
+		return *inv, mystore.ErrInUse
+	}
+
+	inv.Total = total
+	inv.Available = total - inv.OnLoan - inv.Held
+	ms.promote(inv)
+	return *inv, nil
+}
+
+// GetInventory retrieves the inventory of the book. A book without
+// inventory has no copies.
+func (ms *MemStore) GetInventory(bookId string) (mystore.Inventory, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
+	if _, ok := ms.books[bookId]; !ok {
+		return mystore.Inventory{}, mystore.ErrNotFound
+	}
+
+	inv, ok := ms.inventories[bookId]
+	if !ok {
+		return mystore.Inventory{BookId: bookId}, nil
+	}
+	return *inv, nil
+}
+
+// CreateMember creates a new Member in the store.
+func (ms *MemStore) CreateMember(member *mystore.Member) error {
+	ms.Lock()
+	defer ms.Unlock()
+
+	if _, ok := ms.members[member.Id]; ok {
+		return mystore.ErrExist
+	}
+
+	nMember := *member
+	ms.members[member.Id] = &nMember
+	return nil
+}
+
+// GetMember retrieves a member from the store, by id.
+func (ms *MemStore) GetMember(id string) (mystore.Member, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
+	m, ok := ms.members[id]
+	if ok {
+		return *m, nil
+	}
+	return mystore.Member{}, mystore.ErrNotFound
+}
+
+// GetAllMembers returns all the members in the store, in arbitrary order.
+func (ms *MemStore) GetAllMembers() ([]mystore.Member, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
+	allMembers := make([]mystore.Member, 0, len(ms.members))
+	for _, m := range ms.members {
+		allMembers = append(allMembers, *m)
+	}
+	return allMembers, nil
+}
+
+// DeleteMember deletes the member with the given id. A member with active
+// loans can not be deleted, the reservations of the member are cancelled.
+func (ms *MemStore) DeleteMember(id string) error {
+	ms.Lock()
+	defer ms.Unlock()
+
+	if _, ok := ms.members[id]; !ok {
+		return mystore.ErrNotFound
+	}
+
+	for _, l := range ms.loans {
+		if l.MemberId == id && l.Active() {
+			return mystore.ErrInUse
+		}
+	}
+
+	for bookId := range ms.reservations {
+		ms.cancelReservation(bookId, id)
+	}
+	delete(ms.members, id)
+	return nil
+}
+
+// GetMemberLoans returns all the loans of the member, oldest first.
+func (ms *MemStore) GetMemberLoans(id string) ([]mystore.Loan, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
+	if _, ok := ms.members[id]; !ok {
+		return nil, mystore.ErrNotFound
+	}
+	return ms.filterLoans(func(l *mystore.Loan) bool {
+		return l.MemberId == id
+	}), nil
+}
+
+// Borrow lends a copy of the book to the member. A member who is first in
+// the reservation queue gets the copy held for them.
+func (ms *MemStore) Borrow(bookId, memberId string) (mystore.Loan, error) {
+	ms.Lock()
+	defer ms.Unlock()
+
+	if _, ok := ms.books[bookId]; !ok {
+		return mystore.Loan{}, mystore.ErrNotFound
+	}
+	if _, ok := ms.members[memberId]; !ok {
+		return mystore.Loan{}, mystore.ErrNotFound
+	}
+
+	for _, l := range ms.loans {
+		if l.BookId == bookId && l.MemberId == memberId && l.Active() {
+			return mystore.Loan{}, mystore.ErrExist
+		}
+	}
+
+	inv, ok := ms.inventories[bookId]
+	if !ok {
+		return mystore.Loan{}, mystore.ErrUnavailable
+	}
+
+	r := ms.findReservation(bookId, memberId)
+	switch {
+	case r != nil && r.Ready:
+		inv.Held--
+	case inv.Available > 0:
+		inv.Available--
+	default:
+		return mystore.Loan{}, mystore.ErrUnavailable
+	}
+	if r != nil {
+		ms.removeReservation(bookId, memberId)
+	}
+	inv.OnLoan++
+
+	ms.loanSeq++
+	now := ms.now()
+	l := &mystore.Loan{
+		Id:         fmt.Sprintf("loan-%d", ms.loanSeq),
+		BookId:     bookId,
+		MemberId:   memberId,
+		BorrowedAt: now,
+		DueAt:      now.Add(ms.loanPeriod),
+	}
+	ms.loans[l.Id] = l
+	return *l, nil
+}
+
+// Renew extends the due date of an active loan, unless other members are
+// waiting for the book or the renew limit has been reached.
+func (ms *MemStore) Renew(loanId string) (mystore.Loan, error) {
+	ms.Lock()
+	defer ms.Unlock()
+
+	l, ok := ms.loans[loanId]
+	if !ok {
+		return mystore.Loan{}, mystore.ErrNotFound
+	}
+	if !l.Active() {
+		return *l, mystore.ErrReturned
+	}
+	if l.Renewals >= ms.maxRenewals {
+		return *l, mystore.ErrRenewLimit
+	}
+	if len(ms.reservations[l.BookId]) > 0 {
+		return *l, mystore.ErrReserved
+	}
+
+	l.Renewals++
+	l.DueAt = ms.now().Add(ms.loanPeriod)
+	return *l, nil
+}
+
+// Return ends an active loan. The returned copy is held for the next
+// member in the reservation queue, if any.
+func (ms *MemStore) Return(loanId string) (mystore.Loan, error) {
+	ms.Lock()
+	defer ms.Unlock()
+
+	l, ok := ms.loans[loanId]
+	if !ok {
+		return mystore.Loan{}, mystore.ErrNotFound
+	}
+	if !l.Active() {
+		return *l, mystore.ErrReturned
+	}
+
+	now := ms.now()
+	l.ReturnedAt = &now
+
+	inv := ms.inventories[l.BookId]
+	inv.OnLoan--
+	inv.Available++
+	ms.promote(inv)
+	return *l, nil
+}
+
+// GetLoan retrieves a loan from the store, by id.
+func (ms *MemStore) GetLoan(id string) (mystore.Loan, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
+	l, ok := ms.loans[id]
+	if ok {
+		return *l, nil
+	}
+	return mystore.Loan{}, mystore.ErrNotFound
+}
+
+// GetAllLoans returns all the loans in the store, oldest first.
+func (ms *MemStore) GetAllLoans() ([]mystore.Loan, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
+	return ms.filterLoans(func(*mystore.Loan) bool { return true }), nil
+}
+
+// GetOverdueLoans returns the active loans whose due date has passed,
+// oldest first.
+func (ms *MemStore) GetOverdueLoans() ([]mystore.Loan, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
+	now := ms.now()
+	return ms.filterLoans(func(l *mystore.Loan) bool {
+		return l.Active() && now.After(l.DueAt)
+	}), nil
+}
+
+func (ms *MemStore) filterLoans(match func(*mystore.Loan) bool) []mystore.Loan {
+	loans := make([]mystore.Loan, 0)
+	for _, l := range ms.loans {
+		if match(l) {
+			loans = append(loans, *l)
+		}
+	}
+	sort.Slice(loans, func(i, j int) bool {
+		return loans[i].BorrowedAt.Before(loans[j].BorrowedAt)
+	})
+	return loans
+}
+
+// Reserve puts the member at the end of the reservation queue of the book.
+// Reservations are only accepted when no copy is available.
+func (ms *MemStore) Reserve(bookId, memberId string) (mystore.Reservation, error) {
+	ms.Lock()
+	defer ms.Unlock()
+
+	if _, ok := ms.books[bookId]; !ok {
+		return mystore.Reservation{}, mystore.ErrNotFound
+	}
+	if _, ok := ms.members[memberId]; !ok {
+		return mystore.Reservation{}, mystore.ErrNotFound
+	}
+
+	inv, ok := ms.inventories[bookId]
+	if !ok || inv.Total == 0 {
+		return mystore.Reservation{}, mystore.ErrUnavailable
+	}
+	if inv.Available > 0 {
+		return mystore.Reservation{}, mystore.ErrAvailable
+	}
+
+	if ms.findReservation(bookId, memberId) != nil {
+		return mystore.Reservation{}, mystore.ErrExist
+	}
+	for _, l := range ms.loans {
+		if l.BookId == bookId && l.MemberId == memberId && l.Active() {
+			return mystore.Reservation{}, mystore.ErrExist
+		}
+	}
+
+	r := &mystore.Reservation{
+		BookId:    bookId,
+		MemberId:  memberId,
+		CreatedAt: ms.now(),
+	}
+	ms.reservations[bookId] = append(ms.reservations[bookId], r)
+	return *r, nil
+}
+
+// CancelReservation removes the member from the reservation queue of the
+// book. A copy held for the member goes to the next one in the queue.
+func (ms *MemStore) CancelReservation(bookId, memberId string) error {
+	ms.Lock()
+	defer ms.Unlock()
+
+	if !ms.cancelReservation(bookId, memberId) {
+		return mystore.ErrNotFound
+	}
+	return nil
+}
+
+// GetReservations returns the reservation queue of the book.
+func (ms *MemStore) GetReservations(bookId string) ([]mystore.Reservation, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
+	if _, ok := ms.books[bookId]; !ok {
+		return nil, mystore.ErrNotFound
+	}
+
+	queue := make([]mystore.Reservation, 0, len(ms.reservations[bookId]))
+	for _, r := range ms.reservations[bookId] {
+		queue = append(queue, *r)
+	}
+	return queue, nil
+}
+
+func (ms *MemStore) cancelReservation(bookId, memberId string) bool {
+	r := ms.findReservation(bookId, memberId)
+	if r == nil {
+		return false
+	}
+
+	ms.removeReservation(bookId, memberId)
+	if r.Ready {
+		inv := ms.inventories[bookId]
+		inv.Held--
+		inv.Available++
+		ms.promote(inv)
+	}
+	return true
+}
+
+func (ms *MemStore) findReservation(bookId, memberId string) *mystore.Reservation {
+	for _, r := range ms.reservations[bookId] {
+		if r.MemberId == memberId {
+			return r
+		}
+	}
+	return nil
+}
+
+func (ms *MemStore) removeReservation(bookId, memberId string) {
+	queue := ms.reservations[bookId]
+	for i, r := range queue {
+		if r.MemberId == memberId {
+			queue = append(queue[:i:i], queue[i+1:]...)
+			break
+		}
+	}
+
+	if len(queue) == 0 {
+		delete(ms.reservations, bookId)
+		return
+	}
+	ms.reservations[bookId] = queue
+}
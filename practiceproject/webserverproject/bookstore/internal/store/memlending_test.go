@@ -0,0 +1,112 @@
+package store
+
+import (
+	"fmt"
+	mystore "github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newLendingStore(copies int, members ...string) *MemStore {
+	ms := NewMemStore()
+	ms.Create(&mystore.Book{Id: "1", Name: "The Go Programming Language"})
+	ms.SetInventory("1", copies)
+	for _, id := range members {
+		ms.CreateMember(&mystore.Member{Id: id})
+	}
+	return ms
+}
+
+func TestBorrowConcurrent(t *testing.T) {
+	var members []string
+	for i := 0; i < 100; i++ {
+		members = append(members, fmt.Sprintf("m%d", i))
+	}
+	ms := newLendingStore(3, members...)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var lent int
+	for _, id := range members {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			if _, err := ms.Borrow("1", id); err == nil {
+				mu.Lock()
+				lent++
+				mu.Unlock()
+			}
+		}(id)
+	}
+	wg.Wait()
+
+	if lent != 3 {
+		t.Errorf("want 3, actual %d", lent)
+	}
+	inv, _ := ms.GetInventory("1")
+	if inv.OnLoan != 3 || inv.Available != 0 {
+		t.Errorf("want 3 on loan and 0 available, actual %+v", inv)
+	}
+}
+
+func TestReservationQueue(t *testing.T) {
+	ms := newLendingStore(1, "alice", "bob", "carol")
+
+	loan, err := ms.Borrow("1", "alice")
+	if err != nil {
+		t.Fatalf("want nil, actual %s", err.Error())
+	}
+	if _, err = ms.Borrow("1", "bob"); err != mystore.ErrUnavailable {
+		t.Errorf("want %v, actual %v", mystore.ErrUnavailable, err)
+	}
+
+	ms.Reserve("1", "bob")
+	if _, err = ms.Renew(loan.Id); err != mystore.ErrReserved {
+		t.Errorf("want %v, actual %v", mystore.ErrReserved, err)
+	}
+
+	ms.Return(loan.Id)
+	// 归还的副本为bob保留，carol不能借走
+	if _, err = ms.Borrow("1", "carol"); err != mystore.ErrUnavailable {
+		t.Errorf("want %v, actual %v", mystore.ErrUnavailable, err)
+	}
+	if _, err = ms.Borrow("1", "bob"); err != nil {
+		t.Errorf("want nil, actual %s", err.Error())
+	}
+
+	inv, _ := ms.GetInventory("1")
+	if inv.OnLoan != 1 || inv.Held != 0 || inv.Available != 0 {
+		t.Errorf("want 1 on loan, actual %+v", inv)
+	}
+	if err = ms.Delete("1"); err != mystore.ErrInUse {
+		t.Errorf("want %v, actual %v", mystore.ErrInUse, err)
+	}
+}
+
+func TestOverdueAndRenew(t *testing.T) {
+	now := time.Now()
+	ms := newLendingStore(1, "alice")
+	ms.now = func() time.Time { return now }
+	ms.maxRenewals = 1
+
+	loan, _ := ms.Borrow("1", "alice")
+	now = now.Add(ms.loanPeriod + time.Hour)
+
+	overdue, _ := ms.GetOverdueLoans()
+	if len(overdue) != 1 || overdue[0].Id != loan.Id {
+		t.Errorf("want loan %s overdue, actual %+v", loan.Id, overdue)
+	}
+
+	if _, err := ms.Renew(loan.Id); err != nil {
+		t.Errorf("want nil, actual %s", err.Error())
+	}
+	if _, err := ms.Renew(loan.Id); err != mystore.ErrRenewLimit {
+		t.Errorf("want %v, actual %v", mystore.ErrRenewLimit, err)
+	}
+
+	overdue, _ = ms.GetOverdueLoans()
+	if len(overdue) != 0 {
+		t.Errorf("want no overdue loans, actual %+v", overdue)
+	}
+}
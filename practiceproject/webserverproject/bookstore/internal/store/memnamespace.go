@@ -0,0 +1,34 @@
+package store
+
+import (
+	mystore "github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+)
+
+// Namespace implements store.Namespacer. The store of a namespace is a
+// separate MemStore with the same lending settings as ms.
+func (ms *MemStore) Namespace(name string) (mystore.Store, error) {
+	ms.Lock()
+	defer ms.Unlock()
+
+	ns, ok := ms.namespaces[name]
+	if !ok {
+		ns = NewMemStore()
+		ns.loanPeriod = ms.loanPeriod
+		ns.maxRenewals = ms.maxRenewals
+		ns.now = ms.now
+		ms.namespaces[name] = ns
+	}
+	return ns, nil
+}
+
+// DropNamespace implements store.Namespacer.
+func (ms *MemStore) DropNamespace(name string) error {
+	ms.Lock()
+	defer ms.Unlock()
+
+	if _, ok := ms.namespaces[name]; !ok {
+		return mystore.ErrNotFound
+	}
+	delete(ms.namespaces, name)
+	return nil
+}
@@ -0,0 +1,178 @@
+package store
+
+import (
+	"fmt"
+	mystore "github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Snapshot copies the books, authors, presses and lending data of the
+// store under one read lock.
+func (ms *MemStore) Snapshot() (mystore.Snapshot, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+	return ms.snapshot(), nil
+}
+
+// snapshot copies the content of the store, the caller must hold the lock
+// of ms.
+func (ms *MemStore) snapshot() mystore.Snapshot {
+	snap := mystore.Snapshot{
+		Books:   make([]mystore.Book, 0, len(ms.books)),
+		Authors: make([]mystore.Author, 0, len(ms.authors)),
+		Presses: make([]mystore.Press, 0, len(ms.presses)),
+	}
+	for _, book := range ms.books {
+		snap.Books = append(snap.Books, *book)
+	}
+	for _, a := range ms.authors {
+		snap.Authors = append(snap.Authors, *a)
+	}
+	for _, p := range ms.presses {
+		snap.Presses = append(snap.Presses, *p)
+	}
+
+	// 没有借阅数据时保持为nil，与读回的备份一致
+	for _, inv := range ms.inventories {
+		snap.Inventories = append(snap.Inventories, *inv)
+	}
+	for _, m := range ms.members {
+		snap.Members = append(snap.Members, *m)
+	}
+	for _, l := range ms.loans {
+		snap.Loans = append(snap.Loans, *l)
+	}
+	bookIds := make([]string, 0, len(ms.reservations))
+	for bookId := range ms.reservations {
+		bookIds = append(bookIds, bookId)
+	}
+	sort.Strings(bookIds)
+	for _, bookId := range bookIds {
+		for _, r := range ms.reservations[bookId] {
+			snap.Reservations = append(snap.Reservations, *r)
+		}
+	}
+	return snap
+}
+
+// Restore replaces the content of the store with the snapshot returned by
+// fn, under the write lock. The namespaces of the store are kept.
+func (ms *MemStore) Restore(fn func(mystore.Snapshot) (mystore.Snapshot, error)) error {
+	ms.Lock()
+	defer ms.Unlock()
+
+	snap, err := fn(ms.snapshot())
+	if err != nil {
+		return err
+	}
+
+	// 先在新的存储中重建全部数据，校验通过后再替换
+	n := NewMemStore()
+	for i := range snap.Authors {
+		a := snap.Authors[i]
+		n.authors[a.Id] = &a
+	}
+	for i := range snap.Presses {
+		p := snap.Presses[i]
+		n.presses[p.Id] = &p
+	}
+	for i := range snap.Books {
+		book := snap.Books[i]
+		if err = n.checkRefs(&book); err != nil {
+			return err
+		}
+		n.books[book.Id] = &book
+	}
+	for i := range snap.Members {
+		m := snap.Members[i]
+		n.members[m.Id] = &m
+	}
+	for i := range snap.Inventories {
+		inv := snap.Inventories[i]
+		if _, ok := n.books[inv.BookId]; !ok {
+			return mystore.ErrReference
+		}
+		n.inventories[inv.BookId] = &inv
+	}
+	for i := range snap.Loans {
+		l := snap.Loans[i]
+		if err = n.checkLendingRefs(l.BookId, l.MemberId); err != nil {
+			return err
+		}
+		n.loans[l.Id] = &l
+		// 借阅ID继续递增，不与恢复的借阅重复
+		if seq, err := strconv.Atoi(strings.TrimPrefix(l.Id, "loan-")); err == nil && seq > n.loanSeq {
+			n.loanSeq = seq
+		}
+	}
+	for i := range snap.Reservations {
+		r := snap.Reservations[i]
+		if err = n.checkLendingRefs(r.BookId, r.MemberId); err != nil {
+			return err
+		}
+		n.reservations[r.BookId] = append(n.reservations[r.BookId], &r)
+	}
+	// 合并恢复时库存、借阅与预约各自按id覆盖，可能彼此不一致
+	if err = n.checkInventories(); err != nil {
+		return err
+	}
+
+	ms.books, ms.authors, ms.presses = n.books, n.authors, n.presses
+	ms.inventories, ms.members, ms.loans, ms.reservations = n.inventories, n.members, n.loans, n.reservations
+	if n.loanSeq > ms.loanSeq {
+		ms.loanSeq = n.loanSeq
+	}
+	return nil
+}
+
+// checkInventories checks that the copies on loan and held of each book
+// are those of its active loans and ready reservations, and returns
+// ErrLendingData otherwise. The caller must hold the lock of ms.
+func (ms *MemStore) checkInventories() error {
+	onLoan := make(map[string]int)
+	for _, l := range ms.loans {
+		if l.Active() {
+			onLoan[l.BookId]++
+		}
+	}
+	held := make(map[string]int)
+	for bookId, rs := range ms.reservations {
+		for _, r := range rs {
+			if r.Ready {
+				held[bookId]++
+			}
+		}
+	}
+
+	for bookId := range onLoan {
+		if _, ok := ms.inventories[bookId]; !ok {
+			return fmt.Errorf("%w: book %s has loans but no inventory", mystore.ErrLendingData, bookId)
+		}
+	}
+	for bookId := range held {
+		if _, ok := ms.inventories[bookId]; !ok {
+			return fmt.Errorf("%w: book %s has held copies but no inventory", mystore.ErrLendingData, bookId)
+		}
+	}
+	for bookId, inv := range ms.inventories {
+		if inv.OnLoan != onLoan[bookId] || inv.Held != held[bookId] ||
+			inv.Available < 0 || inv.OnLoan+inv.Held+inv.Available != inv.Total {
+			return fmt.Errorf("%w: book %s", mystore.ErrLendingData, bookId)
+		}
+	}
+	return nil
+}
+
+// checkLendingRefs checks that the book and the member of a loan or a
+// reservation exist. The caller must hold the lock of ms.
+func (ms *MemStore) checkLendingRefs(bookId, memberId string) error {
+	if _, ok := ms.books[bookId]; !ok {
+		return mystore.ErrReference
+	}
+	if _, ok := ms.members[memberId]; !ok {
+		return mystore.ErrReference
+	}
+	return nil
+}
@@ -4,17 +4,47 @@ import (
 	mystore "github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
 	factory "github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store/factory"
 	"sync"
+	"time"
 )
 
 func init() {
-	factory.Register("mem", &MemStore{
-		books: make(map[string]*mystore.Book),
-	})
+	factory.Register("mem", NewMemStore())
 }
 
 type MemStore struct {
 	sync.RWMutex
-	books map[string]*mystore.Book
+	books   map[string]*mystore.Book
+	authors map[string]*mystore.Author
+	presses map[string]*mystore.Press
+
+	inventories  map[string]*mystore.Inventory
+	members      map[string]*mystore.Member
+	loans        map[string]*mystore.Loan
+	reservations map[string][]*mystore.Reservation // 各图书的预约队列
+	loanSeq      int
+
+	loanPeriod  time.Duration    // 借期
+	maxRenewals int              // 最多续借次数
+	now         func() time.Time // 时钟，便于测试
+
+	namespaces map[string]*MemStore // 各命名空间(租户)的独立存储
+}
+
+// NewMemStore returns an empty MemStore.
+func NewMemStore() *MemStore {
+	return &MemStore{
+		books:        make(map[string]*mystore.Book),
+		authors:      make(map[string]*mystore.Author),
+		presses:      make(map[string]*mystore.Press),
+		inventories:  make(map[string]*mystore.Inventory),
+		members:      make(map[string]*mystore.Member),
+		loans:        make(map[string]*mystore.Loan),
+		reservations: make(map[string][]*mystore.Reservation),
+		loanPeriod:   mystore.DefaultLoanPeriod,
+		maxRenewals:  mystore.DefaultMaxRenewals,
+		now:          time.Now,
+		namespaces:   make(map[string]*MemStore),
+	}
 }
 
 // Create creates a new Book in the store.
@@ -26,6 +56,10 @@ func (ms *MemStore) Create(book *mystore.Book) error {
 		return mystore.ErrExist
 	}
 
+	if err := ms.checkRefs(book); err != nil {
+		return err
+	}
+
 	nBook := *book
 	ms.books[book.Id] = &nBook
 
@@ -42,6 +76,18 @@ func (ms *MemStore) Update(book *mystore.Book) error {
 		return mystore.ErrNotFound
 	}
 
+	nBook := mergeBook(oldBook, book)
+	if err := ms.checkRefs(&nBook); err != nil {
+		return err
+	}
+	ms.books[book.Id] = &nBook
+
+	return nil
+}
+
+// mergeBook returns a copy of oldBook with the non-empty fields of book
+// applied, and the fields named by book.Clear emptied.
+func mergeBook(oldBook, book *mystore.Book) mystore.Book {
 	nBook := *oldBook
 	if book.Name != "" {
 		nBook.Name = book.Name
@@ -55,9 +101,27 @@ func (ms *MemStore) Update(book *mystore.Book) error {
 		nBook.Press = book.Press
 	}
 
-	ms.books[book.Id] = &nBook
+	if book.AuthorIds != nil {
+		nBook.AuthorIds = book.AuthorIds
+	}
 
-	return nil
+	if book.PressId != "" {
+		nBook.PressId = book.PressId
+	}
+
+	if book.CoverURL != "" {
+		nBook.CoverURL = book.CoverURL
+	}
+
+	for _, f := range book.Clear {
+		switch f {
+		case mystore.FieldPress:
+			nBook.Press = ""
+		case mystore.FieldPressId:
+			nBook.PressId = ""
+		}
+	}
+	return nBook
 }
 
 // Get retrieves a book from the store, by id. If no such id exists. an
@@ -83,7 +147,12 @@ func (ms *MemStore) Delete(id string) error {
 		return mystore.ErrNotFound
 	}
 
+	if err := ms.checkLent(id); err != nil {
+		return err
+	}
+
 	delete(ms.books, id)
+	ms.dropLending(id)
 	return nil
 }
 
@@ -0,0 +1,41 @@
+package store
+
+import (
+	mystore "github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	"testing"
+)
+
+func TestMemStoreReferences(t *testing.T) {
+	ms := NewMemStore()
+	ms.CreateAuthor(&mystore.Author{Id: "a1", Name: "Rob Pike"})
+	ms.CreatePress(&mystore.Press{Id: "p1", Name: "Addison-Wesley"})
+
+	err := ms.Create(&mystore.Book{Id: "1", AuthorIds: []string{"a1", "a2"}})
+	if err != mystore.ErrReference {
+		t.Errorf("want %v, actual %v", mystore.ErrReference, err)
+	}
+
+	err = ms.Create(&mystore.Book{Id: "1", AuthorIds: []string{"a1"}, PressId: "p1"})
+	if err != nil {
+		t.Errorf("want nil, actual %s", err.Error())
+	}
+
+	if err = ms.Update(&mystore.Book{Id: "1", PressId: "p2"}); err != mystore.ErrReference {
+		t.Errorf("want %v, actual %v", mystore.ErrReference, err)
+	}
+
+	if err = ms.DeletePress("p1"); err != mystore.ErrInUse {
+		t.Errorf("want %v, actual %v", mystore.ErrInUse, err)
+	}
+	if err = ms.DeleteAuthor("a1"); err != mystore.ErrInUse {
+		t.Errorf("want %v, actual %v", mystore.ErrInUse, err)
+	}
+
+	ms.Delete("1")
+	if err = ms.DeletePress("p1"); err != nil {
+		t.Errorf("want nil, actual %s", err.Error())
+	}
+	if err = ms.DeleteAuthor("a1"); err != nil {
+		t.Errorf("want nil, actual %s", err.Error())
+	}
+}
@@ -0,0 +1,111 @@
+package store
+
+import (
+	mystore "github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+)
+
+// Transact runs fn while holding the write lock of the store. The changes
+// made through the Tx are buffered and only applied if fn returns nil.
+func (ms *MemStore) Transact(fn func(mystore.Tx) error) error {
+	ms.Lock()
+	defer ms.Unlock()
+
+	tx := &memTx{
+		ms:     ms,
+		books:  ms.books,
+		writes: make(map[string]*mystore.Book),
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	for id, book := range tx.writes {
+		if book == nil {
+			delete(ms.books, id)
+			ms.dropLending(id)
+			continue
+		}
+		ms.books[id] = book
+	}
+	return nil
+}
+
+// memTx reads through to the books of the MemStore and buffers its writes,
+// a nil Book in writes marks a deleted book.
+type memTx struct {
+	ms     *MemStore
+	books  map[string]*mystore.Book
+	writes map[string]*mystore.Book
+}
+
+func (tx *memTx) get(id string) (*mystore.Book, bool) {
+	if book, ok := tx.writes[id]; ok {
+		return book, book != nil
+	}
+	book, ok := tx.books[id]
+	return book, ok
+}
+
+func (tx *memTx) Create(book *mystore.Book) error {
+	if _, ok := tx.get(book.Id); ok {
+		return mystore.ErrExist
+	}
+
+	if err := tx.ms.checkRefs(book); err != nil {
+		return err
+	}
+
+	nBook := *book
+	tx.writes[book.Id] = &nBook
+	return nil
+}
+
+func (tx *memTx) Update(book *mystore.Book) error {
+	oldBook, ok := tx.get(book.Id)
+	if !ok {
+		return mystore.ErrNotFound
+	}
+
+	nBook := mergeBook(oldBook, book)
+	if err := tx.ms.checkRefs(&nBook); err != nil {
+		return err
+	}
+	tx.writes[book.Id] = &nBook
+	return nil
+}
+
+func (tx *memTx) Get(id string) (mystore.Book, error) {
+	book, ok := tx.get(id)
+	if !ok {
+		return mystore.Book{}, mystore.ErrNotFound
+	}
+	return *book, nil
+}
+
+func (tx *memTx) GetAll() ([]mystore.Book, error) {
+	allBooks := make([]mystore.Book, 0, len(tx.books))
+	for id, book := range tx.books {
+		if _, ok := tx.writes[id]; !ok {
+			allBooks = append(allBooks, *book)
+		}
+	}
+	for _, book := range tx.writes {
+		if book != nil {
+			allBooks = append(allBooks, *book)
+		}
+	}
+	return allBooks, nil
+}
+
+func (tx *memTx) Delete(id string) error {
+	if _, ok := tx.get(id); !ok {
+		return mystore.ErrNotFound
+	}
+
+	if err := tx.ms.checkLent(id); err != nil {
+		return err
+	}
+
+	tx.writes[id] = nil
+	return nil
+}
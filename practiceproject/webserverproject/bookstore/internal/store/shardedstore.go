@@ -0,0 +1,319 @@
+package store
+
+import (
+	mystore "github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	factory "github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store/factory"
+	"hash/fnv"
+	"sort"
+	"sync"
+)
+
+// defaultShards is the number of shards of the "sharded-mem" provider.
+const defaultShards = 32
+
+func init() {
+	factory.Register("sharded-mem", NewShardedMemStore(defaultShards))
+}
+
+// ShardedMemStore is an in-memory store of books that spreads them over
+// independently locked shards by the hash of their id, so that writes to
+// different books do not serialize. It does not support authors, presses
+// or lending.
+type ShardedMemStore struct {
+	shards []*shard
+
+	nsMu       sync.Mutex
+	namespaces map[string]*ShardedMemStore // 各命名空间(租户)的独立存储
+}
+
+type shard struct {
+	sync.RWMutex
+	books map[string]*mystore.Book
+}
+
+// NewShardedMemStore returns an empty ShardedMemStore with n shards.
+func NewShardedMemStore(n int) *ShardedMemStore {
+	if n < 1 {
+		n = 1
+	}
+
+	ss := &ShardedMemStore{
+		shards:     make([]*shard, n),
+		namespaces: make(map[string]*ShardedMemStore),
+	}
+	for i := range ss.shards {
+		ss.shards[i] = &shard{books: make(map[string]*mystore.Book)}
+	}
+	return ss
+}
+
+func (ss *ShardedMemStore) shard(id string) *shard {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return ss.shards[h.Sum32()%uint32(len(ss.shards))]
+}
+
+// lockAll locks every shard, always in the same order so that two callers
+// cannot deadlock.
+func (ss *ShardedMemStore) lockAll(write bool) func() {
+	for _, sh := range ss.shards {
+		if write {
+			sh.Lock()
+		} else {
+			sh.RLock()
+		}
+	}
+
+	return func() {
+		for i := len(ss.shards) - 1; i >= 0; i-- {
+			if write {
+				ss.shards[i].Unlock()
+			} else {
+				ss.shards[i].RUnlock()
+			}
+		}
+	}
+}
+
+// Create creates a new Book in the store.
+func (ss *ShardedMemStore) Create(book *mystore.Book) error {
+	sh := ss.shard(book.Id)
+	sh.Lock()
+	defer sh.Unlock()
+
+	if _, ok := sh.books[book.Id]; ok {
+		return mystore.ErrExist
+	}
+
+	nBook := *book
+	sh.books[book.Id] = &nBook
+	return nil
+}
+
+// Update updates the existed Book in the store.
+func (ss *ShardedMemStore) Update(book *mystore.Book) error {
+	sh := ss.shard(book.Id)
+	sh.Lock()
+	defer sh.Unlock()
+
+	oldBook, ok := sh.books[book.Id]
+	if !ok {
+		return mystore.ErrNotFound
+	}
+
+	nBook := mergeBook(oldBook, book)
+	sh.books[book.Id] = &nBook
+	return nil
+}
+
+// Get retrieves a book from the store, by id.
+func (ss *ShardedMemStore) Get(id string) (mystore.Book, error) {
+	sh := ss.shard(id)
+	sh.RLock()
+	defer sh.RUnlock()
+
+	if book, ok := sh.books[id]; ok {
+		return *book, nil
+	}
+	return mystore.Book{}, mystore.ErrNotFound
+}
+
+// Delete deletes the book with the given id.
+func (ss *ShardedMemStore) Delete(id string) error {
+	sh := ss.shard(id)
+	sh.Lock()
+	defer sh.Unlock()
+
+	if _, ok := sh.books[id]; !ok {
+		return mystore.ErrNotFound
+	}
+	delete(sh.books, id)
+	return nil
+}
+
+// GetAll returns all the books in the store sorted by id. All the shards
+// are read locked together, so the result is a consistent view of the
+// store.
+func (ss *ShardedMemStore) GetAll() ([]mystore.Book, error) {
+	unlock := ss.lockAll(false)
+	allBooks := ss.books()
+	unlock()
+
+	sortBooks(allBooks)
+	return allBooks, nil
+}
+
+// books returns a copy of the books of all shards, the caller holds the
+// locks.
+func (ss *ShardedMemStore) books() []mystore.Book {
+	n := 0
+	for _, sh := range ss.shards {
+		n += len(sh.books)
+	}
+
+	allBooks := make([]mystore.Book, 0, n)
+	for _, sh := range ss.shards {
+		for _, book := range sh.books {
+			allBooks = append(allBooks, *book)
+		}
+	}
+	return allBooks
+}
+
+func sortBooks(books []mystore.Book) {
+	sort.Slice(books, func(i, j int) bool { return books[i].Id < books[j].Id })
+}
+
+// Snapshot implements store.Snapshotter.
+func (ss *ShardedMemStore) Snapshot() (mystore.Snapshot, error) {
+	books, err := ss.GetAll()
+	return mystore.Snapshot{Books: books}, err
+}
+
+// Restore implements store.Restorer, while holding the write locks of all
+// shards. Snapshots with authors, presses or lending data are refused with
+// store.ErrNotSupported.
+func (ss *ShardedMemStore) Restore(fn func(mystore.Snapshot) (mystore.Snapshot, error)) error {
+	defer ss.lockAll(true)()
+
+	books := ss.books()
+	sortBooks(books)
+	snap, err := fn(mystore.Snapshot{Books: books})
+	if err != nil {
+		return err
+	}
+	if len(snap.Authors) > 0 || len(snap.Presses) > 0 || len(snap.Inventories) > 0 ||
+		len(snap.Members) > 0 || len(snap.Loans) > 0 || len(snap.Reservations) > 0 {
+		return mystore.ErrNotSupported
+	}
+
+	for _, sh := range ss.shards {
+		sh.books = make(map[string]*mystore.Book)
+	}
+	for i := range snap.Books {
+		book := snap.Books[i]
+		ss.shard(book.Id).books[book.Id] = &book
+	}
+	return nil
+}
+
+// Transact runs fn while holding the write locks of all shards. The
+// changes made through the Tx are buffered and only applied if fn returns
+// nil.
+func (ss *ShardedMemStore) Transact(fn func(mystore.Tx) error) error {
+	defer ss.lockAll(true)()
+
+	tx := &shardedTx{
+		ss:     ss,
+		writes: make(map[string]*mystore.Book),
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	for id, book := range tx.writes {
+		sh := ss.shard(id)
+		if book == nil {
+			delete(sh.books, id)
+			continue
+		}
+		sh.books[id] = book
+	}
+	return nil
+}
+
+// shardedTx reads through to the shards and buffers its writes, a nil Book
+// in writes marks a deleted book.
+type shardedTx struct {
+	ss     *ShardedMemStore
+	writes map[string]*mystore.Book
+}
+
+func (tx *shardedTx) get(id string) (*mystore.Book, bool) {
+	if book, ok := tx.writes[id]; ok {
+		return book, book != nil
+	}
+	book, ok := tx.ss.shard(id).books[id]
+	return book, ok
+}
+
+func (tx *shardedTx) Create(book *mystore.Book) error {
+	if _, ok := tx.get(book.Id); ok {
+		return mystore.ErrExist
+	}
+
+	nBook := *book
+	tx.writes[book.Id] = &nBook
+	return nil
+}
+
+func (tx *shardedTx) Update(book *mystore.Book) error {
+	oldBook, ok := tx.get(book.Id)
+	if !ok {
+		return mystore.ErrNotFound
+	}
+
+	nBook := mergeBook(oldBook, book)
+	tx.writes[book.Id] = &nBook
+	return nil
+}
+
+func (tx *shardedTx) Get(id string) (mystore.Book, error) {
+	book, ok := tx.get(id)
+	if !ok {
+		return mystore.Book{}, mystore.ErrNotFound
+	}
+	return *book, nil
+}
+
+func (tx *shardedTx) GetAll() ([]mystore.Book, error) {
+	allBooks := make([]mystore.Book, 0)
+	for _, book := range tx.ss.books() {
+		if _, ok := tx.writes[book.Id]; !ok {
+			allBooks = append(allBooks, book)
+		}
+	}
+	for _, book := range tx.writes {
+		if book != nil {
+			allBooks = append(allBooks, *book)
+		}
+	}
+
+	sortBooks(allBooks)
+	return allBooks, nil
+}
+
+func (tx *shardedTx) Delete(id string) error {
+	if _, ok := tx.get(id); !ok {
+		return mystore.ErrNotFound
+	}
+
+	tx.writes[id] = nil
+	return nil
+}
+
+// Namespace implements store.Namespacer, the store of a namespace has as
+// many shards as ss.
+func (ss *ShardedMemStore) Namespace(name string) (mystore.Store, error) {
+	ss.nsMu.Lock()
+	defer ss.nsMu.Unlock()
+
+	ns, ok := ss.namespaces[name]
+	if !ok {
+		ns = NewShardedMemStore(len(ss.shards))
+		ss.namespaces[name] = ns
+	}
+	return ns, nil
+}
+
+// DropNamespace implements store.Namespacer.
+func (ss *ShardedMemStore) DropNamespace(name string) error {
+	ss.nsMu.Lock()
+	defer ss.nsMu.Unlock()
+
+	if _, ok := ss.namespaces[name]; !ok {
+		return mystore.ErrNotFound
+	}
+	delete(ss.namespaces, name)
+	return nil
+}
@@ -0,0 +1,139 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	mystore "github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	"math/rand"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestShardedMemStoreConcurrent(t *testing.T) {
+	ss := NewShardedMemStore(8)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ss.Create(&mystore.Book{Id: fmt.Sprintf("%03d", i)})
+		}(i)
+	}
+	wg.Wait()
+
+	books, _ := ss.GetAll()
+	if len(books) != 100 {
+		t.Fatalf("want 100, actual %d", len(books))
+	}
+	for i, book := range books {
+		if want := fmt.Sprintf("%03d", i); book.Id != want {
+			t.Errorf("want %s, actual %s", want, book.Id)
+		}
+	}
+}
+
+func TestShardedMemStoreTransact(t *testing.T) {
+	ss := NewShardedMemStore(8)
+	ss.Create(&mystore.Book{Id: "1", Name: "The Go Programming Language"})
+
+	errAbort := errors.New("abort")
+	err := ss.Transact(func(tx mystore.Tx) error {
+		tx.Delete("1")
+		tx.Create(&mystore.Book{Id: "2"})
+		return errAbort
+	})
+	if err != errAbort {
+		t.Errorf("want %v, actual %v", errAbort, err)
+	}
+	if books, _ := ss.GetAll(); len(books) != 1 || books[0].Id != "1" {
+		t.Errorf("want book 1 only, actual %v", books)
+	}
+
+	err = ss.Transact(func(tx mystore.Tx) error {
+		if err := tx.Delete("1"); err != nil {
+			return err
+		}
+		return tx.Create(&mystore.Book{Id: "2"})
+	})
+	if err != nil {
+		t.Errorf("want nil, actual %s", err.Error())
+	}
+	if books, _ := ss.GetAll(); len(books) != 1 || books[0].Id != "2" {
+		t.Errorf("want book 2 only, actual %v", books)
+	}
+}
+
+// benchStores are the stores compared by the benchmarks.
+var benchStores = []struct {
+	name string
+	new  func() mystore.Store
+}{
+	{"mem", func() mystore.Store { return NewMemStore() }},
+	{"sharded-mem", func() mystore.Store { return NewShardedMemStore(defaultShards) }},
+}
+
+// BenchmarkStores compares MemStore and ShardedMemStore on a mix of Get and
+// Update calls, with the given percentage of writes, at several GOMAXPROCS.
+func BenchmarkStores(b *testing.B) {
+	const books = 1024
+	ids := make([]string, books)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("%d", i)
+	}
+
+	for _, procs := range []int{1, 4, 16} {
+		for _, writes := range []int{10, 50, 90} {
+			for _, st := range benchStores {
+				name := fmt.Sprintf("procs=%d/writes=%d%%/%s", procs, writes, st.name)
+				b.Run(name, func(b *testing.B) {
+					defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(procs))
+
+					s := st.new()
+					for _, id := range ids {
+						s.Create(&mystore.Book{Id: id})
+					}
+
+					b.RunParallel(func(pb *testing.PB) {
+						r := rand.New(rand.NewSource(rand.Int63()))
+						for pb.Next() {
+							id := ids[r.Intn(books)]
+							if r.Intn(100) < writes {
+								s.Update(&mystore.Book{Id: id, Name: "name"})
+							} else {
+								s.Get(id)
+							}
+						}
+					})
+				})
+			}
+		}
+	}
+}
+
+// BenchmarkStoresCreate compares MemStore and ShardedMemStore on parallel
+// Create calls of new books, at several GOMAXPROCS.
+func BenchmarkStoresCreate(b *testing.B) {
+	for _, procs := range []int{1, 4, 16} {
+		for _, st := range benchStores {
+			name := fmt.Sprintf("procs=%d/%s", procs, st.name)
+			b.Run(name, func(b *testing.B) {
+				defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(procs))
+
+				s := st.new()
+				var seq int64
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						id := strconv.FormatInt(atomic.AddInt64(&seq, 1), 10)
+						if err := s.Create(&mystore.Book{Id: id}); err != nil {
+							b.Error(err)
+						}
+					}
+				})
+			})
+		}
+	}
+}
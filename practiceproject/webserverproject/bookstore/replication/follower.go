@@ -0,0 +1,345 @@
+package replication
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// retryInterval is how long a follower waits before reconnecting to the
+// leader.
+var retryInterval = time.Second
+
+// Stats describes how far a follower is behind its leader.
+type Stats struct {
+	LeaderURL  string  `json:"leader_url"`
+	Connected  bool    `json:"connected"`
+	AppliedSeq uint64  `json:"applied_seq"` // 已应用的最后一条日志
+	LeaderSeq  uint64  `json:"leader_seq"`  // 领导者的最后一条日志
+	LagEntries uint64  `json:"lag_entries"` // 落后的日志条数
+	LagSeconds float64 `json:"lag_seconds"` // 距最近一次追平领导者的时间
+	Snapshots  int     `json:"snapshots"`   // 恢复快照的次数
+	LastError  string  `json:"last_error,omitempty"`
+}
+
+// Follower applies the mutation log of a leader to a local store.
+type Follower struct {
+	leader string
+	s      store.Store
+	client *http.Client
+
+	mu         sync.Mutex
+	stats      Stats
+	synced     bool      // 是否已恢复过快照
+	logID      string    // 快照所属的领导者日志
+	caughtUpAt time.Time // 最近一次追平领导者的时间
+}
+
+// NewFollower returns a Follower replicating the leader at leaderURL, such
+// as "http://10.0.0.1:8080", into s.
+func NewFollower(leaderURL string, s store.Store) *Follower {
+	leaderURL = strings.TrimSuffix(leaderURL, "/")
+	return &Follower{
+		leader:     leaderURL,
+		s:          s,
+		client:     &http.Client{},
+		stats:      Stats{LeaderURL: leaderURL},
+		caughtUpAt: time.Now(),
+	}
+}
+
+// LeaderURL returns the URL of the leader.
+func (f *Follower) LeaderURL() string {
+	return f.leader
+}
+
+// Stats returns the replication state of the follower.
+func (f *Follower) Stats() Stats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	st := f.stats
+	if st.LeaderSeq > st.AppliedSeq {
+		st.LagEntries = st.LeaderSeq - st.AppliedSeq
+		st.LagSeconds = time.Since(f.caughtUpAt).Seconds()
+	}
+	return st
+}
+
+// Run replicates the leader until ctx is done, reconnecting after errors.
+func (f *Follower) Run(ctx context.Context) error {
+	for {
+		err := f.sync(ctx)
+		f.mu.Lock()
+		f.stats.Connected = false
+		if err != nil && ctx.Err() == nil {
+			f.stats.LastError = err.Error()
+			log.Println("replication: sync with leader failed:", err)
+		}
+		f.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+// sync restores a snapshot if needed and then applies the log stream until
+// it ends.
+func (f *Follower) sync(ctx context.Context) error {
+	f.mu.Lock()
+	synced, seq, logID := f.synced, f.stats.AppliedSeq, f.logID
+	f.mu.Unlock()
+
+	if !synced {
+		if err := f.restore(ctx); err != nil {
+			return err
+		}
+		f.mu.Lock()
+		seq, logID = f.stats.AppliedSeq, f.logID
+		f.mu.Unlock()
+	}
+
+	query := url.Values{"from": {strconv.FormatUint(seq, 10)}, "log_id": {logID}}
+	req, err := http.NewRequestWithContext(ctx, "GET", f.leader+"/replication/log?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusGone {
+		f.mu.Lock()
+		f.synced = false
+		f.mu.Unlock()
+		return ErrTruncated
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("replication: leader replied %s", resp.Status)
+	}
+
+	f.mu.Lock()
+	f.stats.Connected = true
+	f.stats.LastError = ""
+	f.mu.Unlock()
+
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 64*1024), 64<<20)
+	for sc.Scan() {
+		var m message
+		if err := json.Unmarshal(sc.Bytes(), &m); err != nil {
+			return err
+		}
+
+		if m.Entry != nil {
+			if m.Entry.Seq != seq+1 {
+				return fmt.Errorf("replication: want entry %d, got %d", seq+1, m.Entry.Seq)
+			}
+			if err := f.apply(m.Entry.Ops); err != nil {
+				return err
+			}
+			seq = m.Entry.Seq
+		}
+		f.advance(seq, m.LeaderSeq)
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	return errors.New("replication: log stream closed by leader")
+}
+
+func (f *Follower) advance(applied, leaderSeq uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.stats.AppliedSeq = applied
+	f.stats.LeaderSeq = leaderSeq
+	if applied >= f.stats.LeaderSeq {
+		f.caughtUpAt = time.Now()
+	}
+}
+
+// restore replaces the content of the local store with a snapshot of the
+// leader.
+func (f *Follower) restore(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", f.leader+"/replication/snapshot", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("replication: leader replied %s", resp.Status)
+	}
+
+	var snap Snapshot
+	if err = json.NewDecoder(resp.Body).Decode(&snap); err != nil {
+		return err
+	}
+
+	if err = Restore(f.s, &snap); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	// 领导者重启后序号从头开始，以快照为准重置进度
+	f.synced = true
+	f.logID = snap.LogID
+	f.stats.Snapshots++
+	f.stats.AppliedSeq = snap.Seq
+	f.stats.LeaderSeq = snap.Seq
+	f.mu.Unlock()
+	return nil
+}
+
+// Restore makes the content of s equal to the snapshot. Authors and
+// presses are put before the books that refer to them, and removed after.
+func Restore(s store.Store, snap *Snapshot) error {
+	var ops []Op
+	keep := make(map[string]bool)
+
+	for i := range snap.Authors {
+		ops = append(ops, Op{Kind: KindAuthor, Action: ActionPut, Id: snap.Authors[i].Id, Author: &snap.Authors[i]})
+	}
+	for i := range snap.Presses {
+		ops = append(ops, Op{Kind: KindPress, Action: ActionPut, Id: snap.Presses[i].Id, Press: &snap.Presses[i]})
+	}
+	for i := range snap.Books {
+		keep[snap.Books[i].Id] = true
+	}
+
+	books, err := s.GetAll()
+	if err != nil {
+		return err
+	}
+	for _, book := range books {
+		if !keep[book.Id] {
+			ops = append(ops, Op{Kind: KindBook, Action: ActionDelete, Id: book.Id})
+		}
+	}
+	for i := range snap.Books {
+		ops = append(ops, Op{Kind: KindBook, Action: ActionPut, Id: snap.Books[i].Id, Book: &snap.Books[i]})
+	}
+
+	if cs, ok := s.(store.CatalogStore); ok {
+		keep = make(map[string]bool)
+		for _, a := range snap.Authors {
+			keep[a.Id] = true
+		}
+		authors, err := cs.GetAllAuthors()
+		if err != nil {
+			return err
+		}
+		for _, a := range authors {
+			if !keep[a.Id] {
+				ops = append(ops, Op{Kind: KindAuthor, Action: ActionDelete, Id: a.Id})
+			}
+		}
+
+		keep = make(map[string]bool)
+		for _, p := range snap.Presses {
+			keep[p.Id] = true
+		}
+		presses, err := cs.GetAllPresses()
+		if err != nil {
+			return err
+		}
+		for _, p := range presses {
+			if !keep[p.Id] {
+				ops = append(ops, Op{Kind: KindPress, Action: ActionDelete, Id: p.Id})
+			}
+		}
+	}
+
+	for i := range ops {
+		if err = applyOp(s, &ops[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *Follower) apply(ops []Op) error {
+	for i := range ops {
+		if err := applyOp(f.s, &ops[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyOp applies op to s. Applying an op twice has the same effect as
+// applying it once.
+func applyOp(s store.Store, op *Op) error {
+	switch op.Kind {
+	case KindBook:
+		if op.Action == ActionDelete {
+			return ignoreNotFound(s.Delete(op.Id))
+		}
+		if _, err := s.Get(op.Id); err == store.ErrNotFound {
+			return s.Create(op.Book)
+		}
+		// op.Book是更新后的整个图书，其中为空的字段须清空
+		book := *op.Book
+		if book.Press == "" {
+			book.Clear = append(book.Clear, store.FieldPress)
+		}
+		if book.PressId == "" {
+			book.Clear = append(book.Clear, store.FieldPressId)
+		}
+		return s.Update(&book)
+	case KindAuthor, KindPress:
+		cs, ok := s.(store.CatalogStore)
+		if !ok {
+			return store.ErrNotSupported
+		}
+		return applyCatalogOp(cs, op)
+	}
+	return fmt.Errorf("replication: unknown op kind %q", op.Kind)
+}
+
+func applyCatalogOp(cs store.CatalogStore, op *Op) error {
+	if op.Kind == KindAuthor {
+		if op.Action == ActionDelete {
+			return ignoreNotFound(cs.DeleteAuthor(op.Id))
+		}
+		if _, err := cs.GetAuthor(op.Id); err == store.ErrNotFound {
+			return cs.CreateAuthor(op.Author)
+		}
+		return cs.UpdateAuthor(op.Author)
+	}
+
+	if op.Action == ActionDelete {
+		return ignoreNotFound(cs.DeletePress(op.Id))
+	}
+	if _, err := cs.GetPress(op.Id); err == store.ErrNotFound {
+		return cs.CreatePress(op.Press)
+	}
+	return cs.UpdatePress(op.Press)
+}
+
+func ignoreNotFound(err error) error {
+	if err == store.ErrNotFound {
+		return nil
+	}
+	return err
+}
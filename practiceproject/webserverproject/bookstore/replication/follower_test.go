@@ -0,0 +1,200 @@
+package replication
+
+import (
+	"context"
+	memstore "github.com/Kate-liu/GoBeginner/webserverproject/bookstore/internal/store"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// serveLeader serves the replication endpoints of l.
+func serveLeader(t *testing.T, l *Leader) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/replication/snapshot", l.ServeSnapshot)
+	mux.HandleFunc("/replication/log", l.ServeLog)
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// waitApplied waits until f has applied the entries up to seq.
+func waitApplied(t *testing.T, f *Follower, seq uint64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for f.Stats().AppliedSeq < seq && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if st := f.Stats(); st.AppliedSeq < seq {
+		t.Fatalf("want entry %d applied, actual %+v", seq, st)
+	}
+}
+
+func TestFollower(t *testing.T) {
+	l := NewLeader(memstore.NewMemStore(), 2)
+	l.CreateAuthor(&store.Author{Id: "a1", Name: "Alan Donovan"})
+	for _, id := range []string{"1", "2", "3"} {
+		l.Create(&store.Book{Id: id, AuthorIds: []string{"a1"}})
+	}
+	ts := serveLeader(t, l)
+
+	// 跟随者原有的数据被快照覆盖
+	fs := memstore.NewMemStore()
+	fs.Create(&store.Book{Id: "stale"})
+	f := NewFollower(ts.URL+"/", fs)
+	if f.LeaderURL() != ts.URL {
+		t.Errorf("want %s, actual %s", ts.URL, f.LeaderURL())
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- f.Run(ctx) }()
+	waitApplied(t, f, l.Log().Last())
+
+	if _, err := fs.Get("stale"); err != store.ErrNotFound {
+		t.Errorf("want the stale book removed, actual %v", err)
+	}
+	if books, _ := fs.GetAll(); len(books) != 3 {
+		t.Errorf("want 3 books, actual %d", len(books))
+	}
+
+	l.Update(&store.Book{Id: "1", Name: "gopl"})
+	l.Delete("2")
+	l.Transact(func(tx store.Tx) error {
+		return tx.Create(&store.Book{Id: "4"})
+	})
+	waitApplied(t, f, l.Log().Last())
+
+	if book, _ := fs.Get("1"); book.Name != "gopl" {
+		t.Errorf("want gopl, actual %q", book.Name)
+	}
+	if _, err := fs.Get("2"); err != store.ErrNotFound {
+		t.Errorf("want book 2 deleted, actual %v", err)
+	}
+	if _, err := fs.Get("4"); err != nil {
+		t.Errorf("want book 4 created, actual %v", err)
+	}
+	if st := f.Stats(); !st.Connected || st.Snapshots != 1 || st.LagEntries != 0 {
+		t.Errorf("want connected, 1 snapshot and no lag, actual %+v", st)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("want %v, actual %v", context.Canceled, err)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	s := memstore.NewMemStore()
+	s.CreateAuthor(&store.Author{Id: "old"})
+	s.CreatePress(&store.Press{Id: "p1", Name: "old"})
+	s.Create(&store.Book{Id: "1", AuthorIds: []string{"old"}})
+
+	// 引用旧作者的图书先删除，旧作者才能删除
+	snap := &Snapshot{
+		Seq:     7,
+		Books:   []store.Book{{Id: "2", AuthorIds: []string{"a1"}, PressId: "p1"}},
+		Authors: []store.Author{{Id: "a1"}},
+		Presses: []store.Press{{Id: "p1", Name: "new"}},
+	}
+	if err := Restore(s, snap); err != nil {
+		t.Fatal(err)
+	}
+	if books, _ := s.GetAll(); len(books) != 1 || books[0].Id != "2" {
+		t.Errorf("want book 2 only, actual %+v", books)
+	}
+	if authors, _ := s.GetAllAuthors(); len(authors) != 1 || authors[0].Id != "a1" {
+		t.Errorf("want author a1 only, actual %+v", authors)
+	}
+	if press, _ := s.GetPress("p1"); press.Name != "new" {
+		t.Errorf("want new, actual %q", press.Name)
+	}
+}
+
+func TestApplyOpIdempotent(t *testing.T) {
+	s := memstore.NewMemStore()
+	ops := []Op{
+		{Kind: KindPress, Action: ActionPut, Id: "p1", Press: &store.Press{Id: "p1"}},
+		{Kind: KindBook, Action: ActionPut, Id: "1", Book: &store.Book{Id: "1", PressId: "p1"}},
+		{Kind: KindBook, Action: ActionDelete, Id: "2"},
+	}
+	for i := 0; i < 2; i++ {
+		for j := range ops {
+			if err := applyOp(s, &ops[j]); err != nil {
+				t.Fatalf("apply %d of op %d: %v", i+1, j, err)
+			}
+		}
+	}
+	if err := applyOp(s, &Op{Kind: "loan", Action: ActionPut}); err == nil {
+		t.Error("want an error for an unknown kind")
+	}
+
+	// 图书的op是整个图书，领导者清空的字段在跟随者上同样清空
+	if err := applyOp(s, &Op{Kind: KindBook, Action: ActionPut, Id: "1", Book: &store.Book{Id: "1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if book, _ := s.Get("1"); book.PressId != "" {
+		t.Errorf("want the press cleared, actual %+v", book)
+	}
+}
+
+func TestFollowerLeaderRestart(t *testing.T) {
+	defer func(d time.Duration) { retryInterval = d }(retryInterval)
+	retryInterval = 10 * time.Millisecond
+
+	var mu sync.Mutex
+	l := NewLeader(memstore.NewMemStore(), 10)
+	for _, id := range []string{"1", "2", "3"} {
+		l.Create(&store.Book{Id: id})
+	}
+	leader := func() *Leader {
+		mu.Lock()
+		defer mu.Unlock()
+		return l
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/replication/snapshot", func(w http.ResponseWriter, req *http.Request) { leader().ServeSnapshot(w, req) })
+	mux.HandleFunc("/replication/log", func(w http.ResponseWriter, req *http.Request) { leader().ServeLog(w, req) })
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	fs := memstore.NewMemStore()
+	f := NewFollower(ts.URL, fs)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- f.Run(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	waitApplied(t, f, 3)
+
+	// 重启后的领导者日志从1开始，不论序号比跟随者的大还是小，都须重新拉取快照
+	for _, ids := range [][]string{{"new"}, {"a", "b", "c", "d"}} {
+		restarted := NewLeader(memstore.NewMemStore(), 10)
+		for _, id := range ids {
+			restarted.Create(&store.Book{Id: id})
+		}
+		mu.Lock()
+		l = restarted
+		mu.Unlock()
+		ts.CloseClientConnections()
+
+		before := f.Stats().Snapshots
+		deadline := time.Now().Add(5 * time.Second)
+		for f.Stats().Snapshots == before && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		waitApplied(t, f, uint64(len(ids)))
+
+		if books, _ := fs.GetAll(); len(books) != len(ids) {
+			t.Errorf("want %d books, actual %+v", len(ids), books)
+		}
+		if st := f.Stats(); st.Snapshots != before+1 || st.LeaderSeq != uint64(len(ids)) || st.AppliedSeq != uint64(len(ids)) {
+			t.Errorf("want a new snapshot at %d, actual %+v", len(ids), st)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package replication
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// heartbeatInterval is how often the log stream tells an idle follower the
+// sequence number of the leader.
+var heartbeatInterval = time.Second
+
+// message is a line of the log stream. A message without Entry is a
+// heartbeat.
+type message struct {
+	Entry     *Entry `json:"entry,omitempty"`
+	LeaderSeq uint64 `json:"leader_seq"`
+}
+
+// ServeSnapshot writes the snapshot of the leader as JSON.
+func (l *Leader) ServeSnapshot(w http.ResponseWriter, req *http.Request) {
+	snap, err := l.Snapshot()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snap)
+}
+
+// ServeLog streams the entries after the "from" query parameter as JSON
+// lines, followed by new entries as they are appended, until the follower
+// goes away. It replies 410 if the entries have been dropped from the log,
+// or if the "log_id" query parameter is not the ID of the log, that is the
+// follower restored its snapshot from the leader before a restart.
+func (l *Leader) ServeLog(w http.ResponseWriter, req *http.Request) {
+	from, err := strconv.ParseUint(req.URL.Query().Get("from"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid from: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entries, notify, err := l.log.Since(from)
+	if id := req.URL.Query().Get("log_id"); id != "" && id != l.log.ID() {
+		err = ErrTruncated
+	}
+	if err == ErrTruncated {
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		for i := range entries {
+			if err = enc.Encode(message{Entry: &entries[i], LeaderSeq: l.log.Last()}); err != nil {
+				return
+			}
+			from = entries[i].Seq
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		select {
+		case <-req.Context().Done():
+			return
+		case <-ticker.C:
+			if err = enc.Encode(message{LeaderSeq: l.log.Last()}); err != nil {
+				return
+			}
+		case <-notify:
+		}
+
+		entries, notify, err = l.log.Since(from)
+		if err != nil {
+			// 跟随者落后太多，断开连接，由其重新拉取快照
+			return
+		}
+	}
+}
@@ -0,0 +1,341 @@
+package replication
+
+import (
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	"sync"
+)
+
+// Leader is a store.Store that records every successful mutation of the
+// books, authors and presses into a Log. Lending data is not replicated,
+// so the leader does not unwrap to s: the lending store of s cannot be
+// reached through it, and its writes cannot bypass the log.
+type Leader struct {
+	s   store.Store
+	mu  sync.Mutex // 保证修改存储与追加日志的顺序一致
+	log *Log
+}
+
+// Snapshot is the state of the leader's store at log sequence Seq of the
+// log LogID.
+type Snapshot struct {
+	LogID   string         `json:"log_id"`
+	Seq     uint64         `json:"seq"`
+	Books   []store.Book   `json:"books"`
+	Authors []store.Author `json:"authors"`
+	Presses []store.Press  `json:"presses"`
+}
+
+// NewLeader wraps s, keeping the last logSize mutations for followers.
+func NewLeader(s store.Store, logSize int) *Leader {
+	return &Leader{
+		s:   s,
+		log: NewLog(logSize),
+	}
+}
+
+// Log returns the mutation log of the leader.
+func (l *Leader) Log() *Log {
+	return l.log
+}
+
+// Snapshot returns a consistent copy of the store and the sequence number
+// of the last mutation it contains.
+func (l *Leader) Snapshot() (Snapshot, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var snap Snapshot
+	var err error
+	if snap.Books, err = l.s.GetAll(); err != nil {
+		return Snapshot{}, err
+	}
+
+	if cs, ok := l.s.(store.CatalogStore); ok {
+		if snap.Authors, err = cs.GetAllAuthors(); err != nil {
+			return Snapshot{}, err
+		}
+		if snap.Presses, err = cs.GetAllPresses(); err != nil {
+			return Snapshot{}, err
+		}
+	}
+	snap.LogID = l.log.ID()
+	snap.Seq = l.log.Last()
+	return snap, nil
+}
+
+func putBook(book store.Book) Op {
+	return Op{Kind: KindBook, Action: ActionPut, Id: book.Id, Book: &book}
+}
+
+// putBookOp reads back the book after a mutation, so that the op holds the
+// merged state.
+func putBookOp(get func(string) (store.Book, error), id string) ([]Op, error) {
+	book, err := get(id)
+	if err != nil {
+		return nil, err
+	}
+	return []Op{putBook(book)}, nil
+}
+
+// Create implements store.Store.
+func (l *Leader) Create(book *store.Book) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.s.Create(book); err != nil {
+		return err
+	}
+	ops, err := putBookOp(l.s.Get, book.Id)
+	if err != nil {
+		return err
+	}
+	l.log.append(ops)
+	return nil
+}
+
+// Update implements store.Store.
+func (l *Leader) Update(book *store.Book) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.s.Update(book); err != nil {
+		return err
+	}
+	ops, err := putBookOp(l.s.Get, book.Id)
+	if err != nil {
+		return err
+	}
+	l.log.append(ops)
+	return nil
+}
+
+// Get implements store.Store.
+func (l *Leader) Get(id string) (store.Book, error) {
+	return l.s.Get(id)
+}
+
+// GetAll implements store.Store.
+func (l *Leader) GetAll() ([]store.Book, error) {
+	return l.s.GetAll()
+}
+
+// Delete implements store.Store.
+func (l *Leader) Delete(id string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.s.Delete(id); err != nil {
+		return err
+	}
+	l.log.append([]Op{{Kind: KindBook, Action: ActionDelete, Id: id}})
+	return nil
+}
+
+// Transact implements store.TxStore. All the mutations of the transaction
+// are recorded in one Entry.
+func (l *Leader) Transact(fn func(store.Tx) error) error {
+	ts, ok := l.s.(store.TxStore)
+	if !ok {
+		return store.ErrNotSupported
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var rtx *recordingTx
+	err := ts.Transact(func(tx store.Tx) error {
+		rtx = &recordingTx{Tx: tx}
+		return fn(rtx)
+	})
+	if err != nil {
+		return err
+	}
+	if len(rtx.ops) > 0 {
+		l.log.append(rtx.ops)
+	}
+	return nil
+}
+
+// recordingTx keeps the ops made through a store.Tx.
+type recordingTx struct {
+	store.Tx
+	ops []Op
+}
+
+func (tx *recordingTx) Create(book *store.Book) error {
+	if err := tx.Tx.Create(book); err != nil {
+		return err
+	}
+	ops, err := putBookOp(tx.Tx.Get, book.Id)
+	if err != nil {
+		return err
+	}
+	tx.ops = append(tx.ops, ops...)
+	return nil
+}
+
+func (tx *recordingTx) Update(book *store.Book) error {
+	if err := tx.Tx.Update(book); err != nil {
+		return err
+	}
+	ops, err := putBookOp(tx.Tx.Get, book.Id)
+	if err != nil {
+		return err
+	}
+	tx.ops = append(tx.ops, ops...)
+	return nil
+}
+
+func (tx *recordingTx) Delete(id string) error {
+	if err := tx.Tx.Delete(id); err != nil {
+		return err
+	}
+	tx.ops = append(tx.ops, Op{Kind: KindBook, Action: ActionDelete, Id: id})
+	return nil
+}
+
+func (l *Leader) catalog() (store.CatalogStore, error) {
+	cs, ok := l.s.(store.CatalogStore)
+	if !ok {
+		return nil, store.ErrNotSupported
+	}
+	return cs, nil
+}
+
+// CreateAuthor implements store.AuthorStore.
+func (l *Leader) CreateAuthor(author *store.Author) error {
+	return l.mutateAuthor(author.Id, func(cs store.CatalogStore) error {
+		return cs.CreateAuthor(author)
+	})
+}
+
+// UpdateAuthor implements store.AuthorStore.
+func (l *Leader) UpdateAuthor(author *store.Author) error {
+	return l.mutateAuthor(author.Id, func(cs store.CatalogStore) error {
+		return cs.UpdateAuthor(author)
+	})
+}
+
+func (l *Leader) mutateAuthor(id string, fn func(store.CatalogStore) error) error {
+	cs, err := l.catalog()
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err = fn(cs); err != nil {
+		return err
+	}
+	author, err := cs.GetAuthor(id)
+	if err != nil {
+		return err
+	}
+	l.log.append([]Op{{Kind: KindAuthor, Action: ActionPut, Id: id, Author: &author}})
+	return nil
+}
+
+// GetAuthor implements store.AuthorStore.
+func (l *Leader) GetAuthor(id string) (store.Author, error) {
+	cs, err := l.catalog()
+	if err != nil {
+		return store.Author{}, err
+	}
+	return cs.GetAuthor(id)
+}
+
+// GetAllAuthors implements store.AuthorStore.
+func (l *Leader) GetAllAuthors() ([]store.Author, error) {
+	cs, err := l.catalog()
+	if err != nil {
+		return nil, err
+	}
+	return cs.GetAllAuthors()
+}
+
+// DeleteAuthor implements store.AuthorStore.
+func (l *Leader) DeleteAuthor(id string) error {
+	cs, err := l.catalog()
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err = cs.DeleteAuthor(id); err != nil {
+		return err
+	}
+	l.log.append([]Op{{Kind: KindAuthor, Action: ActionDelete, Id: id}})
+	return nil
+}
+
+// CreatePress implements store.PressStore.
+func (l *Leader) CreatePress(press *store.Press) error {
+	return l.mutatePress(press.Id, func(cs store.CatalogStore) error {
+		return cs.CreatePress(press)
+	})
+}
+
+// UpdatePress implements store.PressStore.
+func (l *Leader) UpdatePress(press *store.Press) error {
+	return l.mutatePress(press.Id, func(cs store.CatalogStore) error {
+		return cs.UpdatePress(press)
+	})
+}
+
+func (l *Leader) mutatePress(id string, fn func(store.CatalogStore) error) error {
+	cs, err := l.catalog()
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err = fn(cs); err != nil {
+		return err
+	}
+	press, err := cs.GetPress(id)
+	if err != nil {
+		return err
+	}
+	l.log.append([]Op{{Kind: KindPress, Action: ActionPut, Id: id, Press: &press}})
+	return nil
+}
+
+// GetPress implements store.PressStore.
+func (l *Leader) GetPress(id string) (store.Press, error) {
+	cs, err := l.catalog()
+	if err != nil {
+		return store.Press{}, err
+	}
+	return cs.GetPress(id)
+}
+
+// GetAllPresses implements store.PressStore.
+func (l *Leader) GetAllPresses() ([]store.Press, error) {
+	cs, err := l.catalog()
+	if err != nil {
+		return nil, err
+	}
+	return cs.GetAllPresses()
+}
+
+// DeletePress implements store.PressStore.
+func (l *Leader) DeletePress(id string) error {
+	cs, err := l.catalog()
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err = cs.DeletePress(id); err != nil {
+		return err
+	}
+	l.log.append([]Op{{Kind: KindPress, Action: ActionDelete, Id: id}})
+	return nil
+}
@@ -0,0 +1,119 @@
+package replication
+
+import (
+	"errors"
+	memstore "github.com/Kate-liu/GoBeginner/webserverproject/bookstore/internal/store"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	"reflect"
+	"testing"
+)
+
+// lastOps returns the ops of the last entry of l.
+func lastOps(t *testing.T, l *Leader) []Op {
+	t.Helper()
+	entries, _, err := l.Log().Since(l.Log().Last() - 1)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("want the last entry, actual %v, %v", entries, err)
+	}
+	return entries[0].Ops
+}
+
+func TestLeaderLogsMutations(t *testing.T) {
+	l := NewLeader(memstore.NewMemStore(), 10)
+
+	if err := l.CreateAuthor(&store.Author{Id: "a1", Name: "Alan Donovan"}); err != nil {
+		t.Fatal(err)
+	}
+	if ops := lastOps(t, l); len(ops) != 1 || ops[0].Kind != KindAuthor || ops[0].Author.Name != "Alan Donovan" {
+		t.Errorf("want the author put, actual %+v", ops)
+	}
+
+	if err := l.Create(&store.Book{Id: "1", Name: "gopl", AuthorIds: []string{"a1"}}); err != nil {
+		t.Fatal(err)
+	}
+	// put记录的是合并后的完整图书
+	if err := l.Update(&store.Book{Id: "1", Press: "Addison-Wesley"}); err != nil {
+		t.Fatal(err)
+	}
+	want := store.Book{Id: "1", Name: "gopl", AuthorIds: []string{"a1"}, Press: "Addison-Wesley"}
+	if ops := lastOps(t, l); len(ops) != 1 || ops[0].Action != ActionPut || !reflect.DeepEqual(*ops[0].Book, want) {
+		t.Errorf("want the merged book put, actual %+v", ops)
+	}
+
+	if err := l.Delete("1"); err != nil {
+		t.Fatal(err)
+	}
+	if ops := lastOps(t, l); len(ops) != 1 || ops[0].Action != ActionDelete || ops[0].Id != "1" {
+		t.Errorf("want the book deleted, actual %+v", ops)
+	}
+
+	// 失败的修改不记录日志
+	seq := l.Log().Last()
+	if err := l.Delete("1"); err != store.ErrNotFound {
+		t.Errorf("want %v, actual %v", store.ErrNotFound, err)
+	}
+	if err := l.CreatePress(&store.Press{Id: "p1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.CreatePress(&store.Press{Id: "p1"}); err != store.ErrExist {
+		t.Errorf("want %v, actual %v", store.ErrExist, err)
+	}
+	if l.Log().Last() != seq+1 {
+		t.Errorf("want %d, actual %d", seq+1, l.Log().Last())
+	}
+}
+
+func TestLeaderTransact(t *testing.T) {
+	l := NewLeader(memstore.NewMemStore(), 10)
+
+	err := l.Transact(func(tx store.Tx) error {
+		if err := tx.Create(&store.Book{Id: "1"}); err != nil {
+			return err
+		}
+		return tx.Create(&store.Book{Id: "2"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ops := lastOps(t, l); len(ops) != 2 {
+		t.Errorf("want 2 ops in one entry, actual %+v", ops)
+	}
+
+	// 回滚的事务不记录日志
+	errAbort := errors.New("abort")
+	err = l.Transact(func(tx store.Tx) error {
+		tx.Delete("1")
+		return errAbort
+	})
+	if err != errAbort {
+		t.Errorf("want %v, actual %v", errAbort, err)
+	}
+	if l.Log().Last() != 1 {
+		t.Errorf("want 1, actual %d", l.Log().Last())
+	}
+}
+
+func TestLeaderSnapshot(t *testing.T) {
+	l := NewLeader(memstore.NewMemStore(), 10)
+	l.CreateAuthor(&store.Author{Id: "a1"})
+	l.CreatePress(&store.Press{Id: "p1"})
+	l.Create(&store.Book{Id: "1", AuthorIds: []string{"a1"}, PressId: "p1"})
+
+	snap, err := l.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.Seq != 3 || len(snap.Books) != 1 || len(snap.Authors) != 1 || len(snap.Presses) != 1 {
+		t.Errorf("want 1 book, author and press at 3, actual %+v", snap)
+	}
+}
+
+func TestLeaderHidesLending(t *testing.T) {
+	var s store.Store = NewLeader(memstore.NewMemStore(), 10)
+	if _, ok := s.(store.LendingStore); ok {
+		t.Error("want no lending store")
+	}
+	if store.Unwrap(s) != nil {
+		t.Error("want the lending store of the wrapped store unreachable")
+	}
+}
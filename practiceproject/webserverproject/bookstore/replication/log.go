@@ -0,0 +1,123 @@
+package replication
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	"sync"
+	"time"
+)
+
+// ErrTruncated is returned when the entries a follower asks for have been
+// dropped from the log, or were never in it because the leader restarted
+// with a new log. The follower has to restore a snapshot first.
+var ErrTruncated = errors.New("replication: log truncated")
+
+const (
+	KindBook   = "book"
+	KindAuthor = "author"
+	KindPress  = "press"
+
+	ActionPut    = "put"    // 创建或覆盖条目
+	ActionDelete = "delete" // 删除条目
+)
+
+// Op is a single mutation. A put carries the full state of the entry
+// after the mutation, so applying it does not depend on the follower's
+// current state.
+type Op struct {
+	Kind   string        `json:"kind"`
+	Action string        `json:"action"`
+	Id     string        `json:"id"`
+	Book   *store.Book   `json:"book,omitempty"`
+	Author *store.Author `json:"author,omitempty"`
+	Press  *store.Press  `json:"press,omitempty"`
+}
+
+// Entry is a numbered record of the log. The ops of an entry were applied
+// atomically on the leader, for example by a batch request.
+type Entry struct {
+	Seq  uint64    `json:"seq"`
+	Time time.Time `json:"time"`
+	Ops  []Op      `json:"ops"`
+}
+
+// Log is the ordered, bounded mutation log of a leader. Each Log has a
+// random ID, so that followers notice when a restarted leader numbers its
+// entries from 1 again.
+type Log struct {
+	id       string
+	mu       sync.Mutex
+	capacity int
+	entries  []Entry // 按Seq递增排列
+	last     uint64
+	notify   chan struct{}
+}
+
+// NewLog returns a Log keeping at least the last capacity entries.
+func NewLog(capacity int) *Log {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	var b [8]byte
+	rand.Read(b[:])
+	return &Log{
+		id:       hex.EncodeToString(b[:]),
+		capacity: capacity,
+		notify:   make(chan struct{}),
+	}
+}
+
+func (l *Log) append(ops []Op) Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.last++
+	e := Entry{Seq: l.last, Time: time.Now(), Ops: ops}
+	l.entries = append(l.entries, e)
+	// 超出容量两倍时才整体拷贝，均摊裁剪的开销
+	if len(l.entries) >= 2*l.capacity {
+		l.entries = append([]Entry(nil), l.entries[len(l.entries)-l.capacity:]...)
+	}
+
+	close(l.notify)
+	l.notify = make(chan struct{})
+	return e
+}
+
+// ID returns the random ID of the log.
+func (l *Log) ID() string {
+	return l.id
+}
+
+// Last returns the sequence number of the last entry.
+func (l *Log) Last() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.last
+}
+
+// Since returns the entries after seq and a channel that is closed when a
+// new entry is appended. It returns ErrTruncated if the entries have been
+// dropped, or if seq is beyond the last entry.
+func (l *Log) Since(seq uint64) ([]Entry, <-chan struct{}, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if seq == l.last {
+		return nil, l.notify, nil
+	}
+	if seq > l.last {
+		return nil, l.notify, ErrTruncated // 跟随者的日志来自重启前的领导者
+	}
+
+	first := l.last - uint64(len(l.entries)) + 1
+	if seq+1 < first {
+		return nil, l.notify, ErrTruncated
+	}
+
+	entries := make([]Entry, l.last-seq)
+	copy(entries, l.entries[seq+1-first:])
+	return entries, l.notify, nil
+}
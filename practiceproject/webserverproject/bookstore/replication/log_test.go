@@ -0,0 +1,52 @@
+package replication
+
+import "testing"
+
+func TestLog(t *testing.T) {
+	l := NewLog(2)
+	if l.Last() != 0 {
+		t.Errorf("want 0, actual %d", l.Last())
+	}
+
+	entries, notify, err := l.Since(0)
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("want no entry, actual %v, %v", entries, err)
+	}
+	l.append([]Op{{Kind: KindBook, Action: ActionDelete, Id: "1"}})
+	select {
+	case <-notify:
+	default:
+		t.Error("want the channel closed by append")
+	}
+
+	for i := 0; i < 3; i++ {
+		l.append([]Op{{Kind: KindBook, Action: ActionDelete, Id: "2"}})
+	}
+	if l.Last() != 4 {
+		t.Errorf("want 4, actual %d", l.Last())
+	}
+
+	// 至少保留最后2条
+	entries, _, err = l.Since(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Seq != 3 || entries[1].Seq != 4 {
+		t.Errorf("want entries 3 and 4, actual %+v", entries)
+	}
+	if entries, _, err = l.Since(4); err != nil || len(entries) != 0 {
+		t.Errorf("want no entry, actual %v, %v", entries, err)
+	}
+
+	// 超出两倍容量后，较早的条目被裁剪
+	if _, _, err = l.Since(0); err != ErrTruncated {
+		t.Errorf("want %v, actual %v", ErrTruncated, err)
+	}
+	// 超出最后一条的序号来自重启前的日志
+	if _, _, err = l.Since(5); err != ErrTruncated {
+		t.Errorf("want %v, actual %v", ErrTruncated, err)
+	}
+	if NewLog(2).ID() == l.ID() {
+		t.Error("want a new ID for each log")
+	}
+}
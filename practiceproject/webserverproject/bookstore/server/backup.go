@@ -0,0 +1,88 @@
+package server
+
+import (
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/backup"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	"net/http"
+	"strconv"
+)
+
+// restoreMaxBytes is the maximum size of a backup sent to /admin/restore.
+const restoreMaxBytes = 64 << 20
+
+type restoreResponse struct {
+	Changes []backup.Change `json:"changes"`
+	Applied bool            `json:"applied"` // dry run时为false
+}
+
+// backupStore returns the store, or the first store it wraps, that can
+// replace its whole content, so that backups include its lending data and
+// restores are atomic. It returns the store itself if none can, restores
+// are then refused. It writes a 501 under tenancy, whose namespaces are
+// not covered by backups.
+func (bs *BookStoreServer) backupStore(w http.ResponseWriter, req *http.Request) (store.Store, bool) {
+	if bs.tenants != nil {
+		http.Error(w, "backups are not supported with tenancy", http.StatusNotImplemented)
+		return nil, false
+	}
+	if !bs.authorizeAdmin(w, req) {
+		return nil, false
+	}
+	for s := bs.s; s != nil; s = store.Unwrap(s) {
+		if _, ok := s.(store.Restorer); ok {
+			return s, true
+		}
+	}
+	return bs.s, true
+}
+
+func (bs *BookStoreServer) backupHandler(w http.ResponseWriter, req *http.Request) {
+	s, ok := bs.backupStore(w, req)
+	if !ok {
+		return
+	}
+
+	b, err := backup.Take(s, "http")
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	response(w, b)
+}
+
+// restoreHandler restores the backup in the request body with the mode of
+// the "mode" query parameter, merge by default. With "dry_run=true" it
+// only returns the changes it would make.
+func (bs *BookStoreServer) restoreHandler(w http.ResponseWriter, req *http.Request) {
+	s, ok := bs.backupStore(w, req)
+	if !ok {
+		return
+	}
+
+	mode := backup.Mode(req.URL.Query().Get("mode"))
+	if mode == "" {
+		mode = backup.Merge
+	}
+	dryRun, _ := strconv.ParseBool(req.URL.Query().Get("dry_run"))
+
+	b, err := backup.Read(http.MaxBytesReader(w, req.Body, restoreMaxBytes))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var changes []backup.Change
+	if dryRun {
+		changes, err = backup.Diff(s, b, mode)
+	} else {
+		changes, err = backup.Restore(s, b, mode)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	if changes == nil {
+		changes = []backup.Change{}
+	}
+	response(w, restoreResponse{Changes: changes, Applied: !dryRun})
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"encoding/json"
+	memstore "github.com/Kate-liu/GoBeginner/webserverproject/bookstore/internal/store"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	"net/http"
+	"testing"
+)
+
+func TestBackupRestore(t *testing.T) {
+	src := memstore.NewMemStore()
+	src.Create(&store.Book{Id: "1", Name: "gopl"})
+	src.SetInventory("1", 1)
+	src.CreateMember(&store.Member{Id: "m1", Name: "Tom"})
+	src.Borrow("1", "m1")
+
+	rr := do(newTestServer(src), "GET", "/admin/backup", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("want %d, actual %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	data := rr.Body.String()
+
+	dst := memstore.NewMemStore()
+	dst.Create(&store.Book{Id: "9"})
+	bs := newTestServer(dst)
+
+	var resp restoreResponse
+	rr = do(bs, "POST", "/admin/restore?mode=replace&dry_run=true", data)
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	if rr.Code != http.StatusOK || resp.Applied || len(resp.Changes) != 5 {
+		t.Errorf("want 5 changes not applied, actual %d %+v", rr.Code, resp)
+	}
+	if _, err := dst.Get("9"); err != nil {
+		t.Errorf("dry run: want nil, actual %v", err)
+	}
+
+	rr = do(bs, "POST", "/admin/restore?mode=replace", data)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("want %d, actual %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if _, err := dst.Get("9"); err != store.ErrNotFound {
+		t.Errorf("want book 9 deleted, actual %v", err)
+	}
+	if loans, _ := dst.GetAllLoans(); len(loans) != 1 {
+		t.Errorf("want 1 loan, actual %d", len(loans))
+	}
+
+	for _, tt := range []struct {
+		path, body string
+		want       int
+	}{
+		{"/admin/restore?mode=other", data, http.StatusBadRequest},
+		{"/admin/restore", `{"version":1}`, http.StatusBadRequest},
+	} {
+		if rr = do(bs, "POST", tt.path, tt.body); rr.Code != tt.want {
+			t.Errorf("%s: want %d, actual %d", tt.path, tt.want, rr.Code)
+		}
+	}
+}
+
+func TestRestoreNotSupported(t *testing.T) {
+	data := do(newTestServer(memstore.NewMemStore()), "GET", "/admin/backup", "").Body.String()
+
+	// 领导者的修改必须经过日志，不能整体替换存储
+	leader := newTestServer(memstore.NewMemStore(), WithLeader(10), WithoutLending())
+	if rr := do(leader, "POST", "/admin/restore", data); rr.Code != http.StatusNotImplemented {
+		t.Errorf("leader: want %d, actual %d", http.StatusNotImplemented, rr.Code)
+	}
+
+	bs := newTenancyServer(memstore.NewMemStore())
+	if rr := doAs(bs, testAdminToken, "GET", "/admin/backup", ""); rr.Code != http.StatusNotImplemented {
+		t.Errorf("tenancy: want %d, actual %d", http.StatusNotImplemented, rr.Code)
+	}
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	"net/http"
+)
+
+const maxBatchOperations = 1000
+
+const (
+	opCreate = "create"
+	opUpdate = "update"
+	opDelete = "delete"
+)
+
+type batchOperation struct {
+	Op   string      `json:"op"`             // create, update 或 delete
+	Id   string      `json:"id,omitempty"`   // update/delete的图书id
+	Book *store.Book `json:"book,omitempty"` // create/update的图书内容
+}
+
+type batchRequest struct {
+	Operations []batchOperation `json:"operations"`
+}
+
+type batchResult struct {
+	Op     string `json:"op"`
+	Id     string `json:"id"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type batchResponse struct {
+	Committed bool          `json:"committed"`
+	Results   []batchResult `json:"results"`
+}
+
+// errBatchAborted marks the operations that were rolled back or never
+// executed because another operation of the batch failed.
+var errBatchAborted = errors.New("aborted: another operation in the batch failed")
+
+func (bs *BookStoreServer) batchBooksHandler(w http.ResponseWriter, req *http.Request) {
+	ts, ok := bs.s.(store.TxStore)
+	if !ok {
+		http.Error(w, "store does not support transactions", http.StatusNotImplemented)
+		return
+	}
+
+	dec := json.NewDecoder(req.Body)
+	var breq batchRequest
+	if err := dec.Decode(&breq); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := validateBatch(breq.Operations); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	results := make([]batchResult, len(breq.Operations))
+	for i, op := range breq.Operations {
+		results[i] = batchResult{Op: op.Op, Id: op.id()}
+	}
+
+	failed := -1
+	started := false
+	err := ts.Transact(func(tx store.Tx) error {
+		started = true
+		for i, op := range breq.Operations {
+			if err := op.apply(tx); err != nil {
+				failed = i
+				return err
+			}
+			results[i].Status = http.StatusOK
+		}
+		return nil
+	})
+
+	if err == nil {
+		for _, op := range breq.Operations {
+			if op.Op == opDelete {
+				deleteCovers(bs.blobs, op.id())
+			}
+		}
+		response(w, batchResponse{Committed: true, Results: results})
+		return
+	}
+	if !started && errors.Is(err, store.ErrNotSupported) {
+		// 包装的存储不支持事务，没有执行任何操作
+		http.Error(w, "store does not support transactions", http.StatusNotImplemented)
+		return
+	}
+
+	status := errorStatus(err)
+	for i := range results {
+		if i == failed {
+			results[i].Status = status
+			results[i].Error = err.Error()
+			continue
+		}
+		results[i].Status = http.StatusFailedDependency
+		results[i].Error = errBatchAborted.Error()
+	}
+	responseWithStatus(w, status, batchResponse{Committed: false, Results: results})
+}
+
+func validateBatch(ops []batchOperation) error {
+	if len(ops) == 0 {
+		return errors.New("no operations in batch")
+	}
+	if len(ops) > maxBatchOperations {
+		return fmt.Errorf("too many operations in batch, max %d", maxBatchOperations)
+	}
+
+	for i, op := range ops {
+		switch op.Op {
+		case opCreate, opUpdate:
+			if op.Book == nil {
+				return fmt.Errorf("operation %d: no book found", i)
+			}
+		case opDelete:
+		default:
+			return fmt.Errorf("operation %d: unknown op %q", i, op.Op)
+		}
+
+		if op.id() == "" {
+			return fmt.Errorf("operation %d: no id found", i)
+		}
+	}
+	return nil
+}
+
+func (op *batchOperation) id() string {
+	if op.Id != "" {
+		return op.Id
+	}
+	if op.Book != nil {
+		return op.Book.Id
+	}
+	return ""
+}
+
+func (op *batchOperation) apply(tx store.Tx) error {
+	switch op.Op {
+	case opCreate:
+		book := *op.Book
+		book.Id = op.id()
+		return tx.Create(&book)
+	case opUpdate:
+		book := *op.Book
+		book.Id = op.id()
+		return tx.Update(&book)
+	case opDelete:
+		return tx.Delete(op.id())
+	}
+	return fmt.Errorf("unknown op %q", op.Op)
+}
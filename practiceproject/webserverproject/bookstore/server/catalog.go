@@ -0,0 +1,266 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+// catalog returns the store, or the first store it wraps, as a
+// store.CatalogStore, or writes a 501 if the provider does not keep authors
+// and presses.
+func (bs *BookStoreServer) catalog(w http.ResponseWriter) (store.CatalogStore, bool) {
+	cs, ok := findCatalog(bs.s)
+	if !ok {
+		http.Error(w, "store does not support authors and presses", http.StatusNotImplemented)
+	}
+	return cs, ok
+}
+
+func findCatalog(s store.Store) (store.CatalogStore, bool) {
+	for ; s != nil; s = store.Unwrap(s) {
+		if cs, ok := s.(store.CatalogStore); ok {
+			return cs, true
+		}
+	}
+	return nil, false
+}
+
+func newId() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+func (bs *BookStoreServer) createAuthorHandler(w http.ResponseWriter, req *http.Request) {
+	cs, ok := bs.catalog(w)
+	if !ok {
+		return
+	}
+
+	dec := json.NewDecoder(req.Body)
+	var author store.Author
+	if err := dec.Decode(&author); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if author.Id == "" {
+		author.Id = newId()
+	}
+	if err := cs.CreateAuthor(&author); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	response(w, author)
+}
+
+func (bs *BookStoreServer) updateAuthorHandler(w http.ResponseWriter, req *http.Request) {
+	cs, ok := bs.catalog(w)
+	if !ok {
+		return
+	}
+
+	dec := json.NewDecoder(req.Body)
+	var author store.Author
+	if err := dec.Decode(&author); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	author.Id = mux.Vars(req)["id"]
+	if err := cs.UpdateAuthor(&author); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+}
+
+func (bs *BookStoreServer) getAuthorHandler(w http.ResponseWriter, req *http.Request) {
+	cs, ok := bs.catalog(w)
+	if !ok {
+		return
+	}
+
+	author, err := cs.GetAuthor(mux.Vars(req)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	response(w, author)
+}
+
+func (bs *BookStoreServer) getAllAuthorsHandler(w http.ResponseWriter, req *http.Request) {
+	cs, ok := bs.catalog(w)
+	if !ok {
+		return
+	}
+
+	authors, err := cs.GetAllAuthors()
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	response(w, authors)
+}
+
+func (bs *BookStoreServer) delAuthorHandler(w http.ResponseWriter, req *http.Request) {
+	cs, ok := bs.catalog(w)
+	if !ok {
+		return
+	}
+
+	if err := cs.DeleteAuthor(mux.Vars(req)["id"]); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+}
+
+func (bs *BookStoreServer) getAuthorBooksHandler(w http.ResponseWriter, req *http.Request) {
+	cs, ok := bs.catalog(w)
+	if !ok {
+		return
+	}
+
+	id := mux.Vars(req)["id"]
+	if _, err := cs.GetAuthor(id); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	books, err := filterBooks(cs, func(book *store.Book) bool {
+		for _, authorId := range book.AuthorIds {
+			if authorId == id {
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	response(w, books)
+}
+
+func (bs *BookStoreServer) createPressHandler(w http.ResponseWriter, req *http.Request) {
+	cs, ok := bs.catalog(w)
+	if !ok {
+		return
+	}
+
+	dec := json.NewDecoder(req.Body)
+	var press store.Press
+	if err := dec.Decode(&press); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if press.Id == "" {
+		press.Id = newId()
+	}
+	if err := cs.CreatePress(&press); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	response(w, press)
+}
+
+func (bs *BookStoreServer) updatePressHandler(w http.ResponseWriter, req *http.Request) {
+	cs, ok := bs.catalog(w)
+	if !ok {
+		return
+	}
+
+	dec := json.NewDecoder(req.Body)
+	var press store.Press
+	if err := dec.Decode(&press); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	press.Id = mux.Vars(req)["id"]
+	if err := cs.UpdatePress(&press); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+}
+
+func (bs *BookStoreServer) getPressHandler(w http.ResponseWriter, req *http.Request) {
+	cs, ok := bs.catalog(w)
+	if !ok {
+		return
+	}
+
+	press, err := cs.GetPress(mux.Vars(req)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	response(w, press)
+}
+
+func (bs *BookStoreServer) getAllPressesHandler(w http.ResponseWriter, req *http.Request) {
+	cs, ok := bs.catalog(w)
+	if !ok {
+		return
+	}
+
+	presses, err := cs.GetAllPresses()
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	response(w, presses)
+}
+
+func (bs *BookStoreServer) delPressHandler(w http.ResponseWriter, req *http.Request) {
+	cs, ok := bs.catalog(w)
+	if !ok {
+		return
+	}
+
+	if err := cs.DeletePress(mux.Vars(req)["id"]); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+}
+
+func (bs *BookStoreServer) getPressBooksHandler(w http.ResponseWriter, req *http.Request) {
+	cs, ok := bs.catalog(w)
+	if !ok {
+		return
+	}
+
+	id := mux.Vars(req)["id"]
+	if _, err := cs.GetPress(id); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	books, err := filterBooks(cs, func(book *store.Book) bool {
+		return book.PressId == id
+	})
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	response(w, books)
+}
+
+func filterBooks(s store.Store, match func(*store.Book) bool) ([]store.Book, error) {
+	books, err := s.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	matched := make([]store.Book, 0)
+	for i := range books {
+		if match(&books[i]) {
+			matched = append(matched, books[i])
+		}
+	}
+	return matched, nil
+}
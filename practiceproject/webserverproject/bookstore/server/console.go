@@ -0,0 +1,613 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/server/tenant"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	"github.com/gorilla/mux"
+	"html/template"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	consoleCookie      = "bookstore_console"
+	consoleSessionTTL  = 12 * time.Hour
+	consoleLoginCookie = "bookstore_console_login"
+	consoleLoginTTL    = time.Hour
+	consolePageSize    = 20
+
+	// consoleCSP lets the pages load nothing but their stylesheet, and post
+	// their forms only to the server.
+	consoleCSP = "default-src 'none'; style-src 'self'; form-action 'self'; frame-ancestors 'none'; base-uri 'none'"
+)
+
+// consoleFiles holds the templates and the stylesheet of the console, so
+// that the binary needs no file at run time.
+//
+//go:embed console
+var consoleFiles embed.FS
+
+var consoleTemplates = loadConsoleTemplates()
+
+// loadConsoleTemplates parses each page of the console together with the
+// layout shared by all of them.
+func loadConsoleTemplates() map[string]*template.Template {
+	funcs := template.FuncMap{
+		"join": strings.Join,
+		"inc":  func(i int) int { return i + 1 },
+		"dec":  func(i int) int { return i - 1 },
+		"pageURL": func(query string, page int) string {
+			v := url.Values{"page": {strconv.Itoa(page)}}
+			if query != "" {
+				v.Set("q", query)
+			}
+			return "/admin/books?" + v.Encode()
+		},
+	}
+	layout := template.Must(template.New("layout.html").Funcs(funcs).ParseFS(consoleFiles, "console/layout.html"))
+
+	pages := make(map[string]*template.Template)
+	for _, name := range []string{"login.html", "books.html", "book.html"} {
+		t := template.Must(layout.Clone())
+		pages[name] = template.Must(t.ParseFS(consoleFiles, "console/"+name))
+	}
+	return pages
+}
+
+type console struct {
+	router *mux.Router
+	now    func() time.Time
+	key    []byte // 签名登录前的CSRF令牌
+
+	mu       sync.Mutex
+	sessions map[string]*consoleSession // 会话ID -> 会话，仅限已登录的浏览器
+}
+
+// consoleSession is the state of one signed in browser, kept on the server.
+// The browser only holds its random id in a cookie.
+type consoleSession struct {
+	id       string
+	csrf     string // 表单中须携带的CSRF令牌
+	tenantID string // 登录的租户，未启用多租户时为空，以管理令牌登录
+	flashes  []consoleFlash
+	expires  time.Time
+}
+
+// consoleFlash is a message shown once, on the next page rendered for the
+// session.
+type consoleFlash struct {
+	Kind    string // success或error
+	Message string
+}
+
+// consolePage is the data of the layout, Data is that of the page.
+type consolePage struct {
+	Title    string
+	CSRF     string
+	Tenant   string
+	SignedIn bool // 登录页之外的页面均已登录
+	Flashes  []consoleFlash
+	Error    string
+	Data     interface{}
+}
+
+type consoleBooks struct {
+	Books []store.Book
+	Query string
+	Total int
+	Page  int
+	Pages int
+}
+
+type consoleBook struct {
+	Book    store.Book
+	Authors string
+	New     bool
+}
+
+func newConsole() *console {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic("server: no randomness: " + err.Error())
+	}
+	return &console{
+		now:      time.Now,
+		key:      key,
+		sessions: make(map[string]*consoleSession),
+	}
+}
+
+// consoleRoutes returns the router of the console pages. They are served
+// outside of the JSON API, without its validation and idempotency.
+func (bs *BookStoreServer) consoleRoutes() *mux.Router {
+	r := mux.NewRouter()
+	r.Handle("/admin", http.RedirectHandler("/admin/books", http.StatusSeeOther)).Methods("GET")
+	r.HandleFunc("/admin/static/console.css", consoleStylesheet).Methods("GET")
+	r.HandleFunc("/admin/login", bs.consoleLoginPage).Methods("GET")
+	r.HandleFunc("/admin/login", bs.consoleLogin).Methods("POST")
+	r.HandleFunc("/admin/logout", bs.consoleLogout).Methods("POST")
+	r.HandleFunc("/admin/books", bs.consoleAuth(bs.consoleBooksPage)).Methods("GET")
+	r.HandleFunc("/admin/books", bs.consoleAuth(bs.consoleCreateBook)).Methods("POST")
+	r.HandleFunc("/admin/books/new", bs.consoleAuth(bs.consoleNewBookPage)).Methods("GET")
+	r.HandleFunc("/admin/books/{id}/edit", bs.consoleAuth(bs.consoleEditBookPage)).Methods("GET")
+	r.HandleFunc("/admin/books/{id}", bs.consoleAuth(bs.consoleUpdateBook)).Methods("POST")
+	r.HandleFunc("/admin/books/{id}/delete", bs.consoleAuth(bs.consoleDeleteBook)).Methods("POST")
+	return r
+}
+
+// withConsole serves the console pages, and the other requests with next.
+func (bs *BookStoreServer) withConsole(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var match mux.RouteMatch
+		if bs.console.router.Match(req, &match) {
+			bs.console.router.ServeHTTP(w, req)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+func consoleStylesheet(w http.ResponseWriter, req *http.Request) {
+	css, err := consoleFiles.ReadFile("console/console.css")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/css; charset=utf-8")
+	w.Write(css)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic("server: no randomness: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
+
+// session returns the session of the request, or nil if it is not signed
+// in or its session expired.
+func (c *console) session(req *http.Request) *consoleSession {
+	cookie, err := req.Cookie(consoleCookie)
+	if err != nil {
+		return nil
+	}
+	now := c.now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if sess, ok := c.sessions[cookie.Value]; ok && now.Before(sess.expires) {
+		return sess
+	}
+	return nil
+}
+
+func (c *console) newSessionLocked(w http.ResponseWriter, req *http.Request, now time.Time) *consoleSession {
+	for id, sess := range c.sessions {
+		if !now.Before(sess.expires) {
+			delete(c.sessions, id)
+		}
+	}
+
+	sess := &consoleSession{
+		id:      randomHex(16),
+		csrf:    randomHex(16),
+		expires: now.Add(consoleSessionTTL),
+	}
+	c.sessions[sess.id] = sess
+	http.SetCookie(w, &http.Cookie{
+		Name:     consoleCookie,
+		Value:    sess.id,
+		Path:     "/admin",
+		Expires:  sess.expires,
+		HttpOnly: true,
+		Secure:   req.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return sess
+}
+
+// login creates the session of a browser signed in to the tenant id, and
+// drops the session it had, so that an id planted before is of no use.
+func (c *console) login(w http.ResponseWriter, req *http.Request, id string) *consoleSession {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cookie, err := req.Cookie(consoleCookie); err == nil {
+		delete(c.sessions, cookie.Value)
+	}
+	sess := c.newSessionLocked(w, req, c.now())
+	sess.tenantID = id
+	http.SetCookie(w, &http.Cookie{Name: consoleLoginCookie, Value: "", Path: "/admin/login", MaxAge: -1})
+	return sess
+}
+
+func (c *console) sign(payload string) string {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// loginToken returns the CSRF token of the sign in form. Before sign in the
+// server keeps no state for a browser: the token and its expiry are kept in
+// a cookie signed by the console.
+func (c *console) loginToken(w http.ResponseWriter, req *http.Request) string {
+	if token, ok := c.verifyLoginCookie(req); ok {
+		return token
+	}
+	token := randomHex(16)
+	expires := c.now().Add(consoleLoginTTL)
+	payload := token + "." + strconv.FormatInt(expires.Unix(), 10)
+	http.SetCookie(w, &http.Cookie{
+		Name:     consoleLoginCookie,
+		Value:    payload + "." + c.sign(payload),
+		Path:     "/admin/login",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   req.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return token
+}
+
+// verifyLoginCookie returns the token of the sign in cookie of req, if it is
+// signed by the console and has not expired.
+func (c *console) verifyLoginCookie(req *http.Request) (string, bool) {
+	cookie, err := req.Cookie(consoleLoginCookie)
+	if err != nil {
+		return "", false
+	}
+	i := strings.LastIndexByte(cookie.Value, '.')
+	if i < 0 {
+		return "", false
+	}
+	payload, sig := cookie.Value[:i], cookie.Value[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(c.sign(payload))) {
+		return "", false
+	}
+	parts := strings.SplitN(payload, ".", 2)
+	if len(parts) != 2 {
+		return "", false
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || !c.now().Before(time.Unix(expires, 0)) {
+		return "", false
+	}
+	return parts[0], true
+}
+
+func (c *console) logout(w http.ResponseWriter, sess *consoleSession) {
+	c.mu.Lock()
+	delete(c.sessions, sess.id)
+	c.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{Name: consoleCookie, Value: "", Path: "/admin", MaxAge: -1})
+}
+
+func (c *console) flash(sess *consoleSession, kind, message string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sess.flashes = append(sess.flashes, consoleFlash{Kind: kind, Message: message})
+}
+
+func (c *console) takeFlashes(sess *consoleSession) []consoleFlash {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	flashes := sess.flashes
+	sess.flashes = nil
+	return flashes
+}
+
+// checkCSRF checks the token posted with a form, and writes a 403 if it is
+// not that of the session.
+func checkCSRF(w http.ResponseWriter, req *http.Request, sess *consoleSession) bool {
+	return checkCSRFToken(w, req, sess.csrf)
+}
+
+func checkCSRFToken(w http.ResponseWriter, req *http.Request, want string) bool {
+	token := req.PostFormValue("csrf")
+	if token == "" || want == "" || subtle.ConstantTimeCompare([]byte(token), []byte(want)) != 1 {
+		http.Error(w, "invalid CSRF token", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+type consoleHandler func(w http.ResponseWriter, req *http.Request, sess *consoleSession, tbs *BookStoreServer)
+
+// consoleAuth finds the session and the server of a console request, and
+// sends the browsers that are not signed in to the sign in page. With
+// tenancy the session is that of a tenant, whose rate limit applies and
+// whose copy of the server holds its books and covers; without it the
+// session was signed in with the admin token and uses the server itself. Forms must carry the CSRF token of the session.
+func (bs *BookStoreServer) consoleAuth(fn consoleHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		sess := bs.console.session(req)
+		if sess == nil {
+			http.Redirect(w, req, "/admin/login", http.StatusSeeOther)
+			return
+		}
+		if req.Method == "POST" && !checkCSRF(w, req, sess) {
+			return
+		}
+
+		tbs := bs
+		if bs.tenants != nil {
+			t, err := bs.tenants.reg.Get(sess.tenantID)
+			if sess.tenantID == "" || err != nil {
+				http.Redirect(w, req, "/admin/login", http.StatusSeeOther)
+				return
+			}
+			th, err := bs.tenantHandler(t)
+			if err != nil {
+				http.Redirect(w, req, "/admin/login", http.StatusSeeOther)
+				return
+			}
+			if th.limiter != nil {
+				if ok, wait := th.limiter.Allow(); !ok {
+					w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+					http.Error(w, "tenant request rate exceeded", http.StatusTooManyRequests)
+					return
+				}
+			}
+			tbs = th.srv
+		}
+		fn(w, req, sess, tbs)
+	}
+}
+
+// render writes the page name with the flashes of the session.
+func (bs *BookStoreServer) render(w http.ResponseWriter, status int, name string, sess *consoleSession, page consolePage) {
+	page.CSRF = sess.csrf
+	page.Tenant = sess.tenantID
+	page.SignedIn = sess.id != ""
+	page.Flashes = bs.console.takeFlashes(sess)
+
+	var buf strings.Builder
+	if err := consoleTemplates[name].ExecuteTemplate(&buf, "layout.html", page); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", consoleCSP)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write([]byte(buf.String()))
+}
+
+// tokenKind names the token asked by the sign in page.
+func (bs *BookStoreServer) tokenKind() string {
+	if bs.tenants != nil {
+		return "tenant"
+	}
+	return "admin"
+}
+
+// loginPage renders the sign in page. It has no session, the flashes and
+// the CSRF token are those of the sign in form only.
+func (bs *BookStoreServer) loginPage(w http.ResponseWriter, req *http.Request, status int, errMsg string) {
+	sess := &consoleSession{csrf: bs.console.loginToken(w, req)}
+	bs.render(w, status, "login.html", sess, consolePage{Title: "Sign in", Error: errMsg, Data: bs.tokenKind()})
+}
+
+func (bs *BookStoreServer) consoleLoginPage(w http.ResponseWriter, req *http.Request) {
+	bs.loginPage(w, req, http.StatusOK, "")
+}
+
+// consoleLogin signs a librarian in with the token of their tenant, or with
+// the admin token of the server without tenancy.
+func (bs *BookStoreServer) consoleLogin(w http.ResponseWriter, req *http.Request) {
+	token, _ := bs.console.verifyLoginCookie(req)
+	if !checkCSRFToken(w, req, token) {
+		return
+	}
+
+	posted := strings.TrimSpace(req.PostFormValue("token"))
+	if bs.tenants == nil {
+		if posted == "" || subtle.ConstantTimeCompare([]byte(posted), []byte(bs.adminToken)) != 1 {
+			bs.loginPage(w, req, http.StatusUnauthorized, "invalid admin token")
+			return
+		}
+		sess := bs.console.login(w, req, "")
+		bs.console.flash(sess, "success", "Signed in")
+		http.Redirect(w, req, "/admin/books", http.StatusSeeOther)
+		return
+	}
+
+	t, err := bs.tenants.reg.ByToken(posted)
+	if err != nil {
+		bs.loginPage(w, req, http.StatusUnauthorized, "invalid tenant token")
+		return
+	}
+	sess := bs.console.login(w, req, t.Id)
+	bs.console.flash(sess, "success", "Signed in to "+tenantName(t))
+	http.Redirect(w, req, "/admin/books", http.StatusSeeOther)
+}
+
+func tenantName(t tenant.Tenant) string {
+	if t.Name != "" {
+		return t.Name
+	}
+	return t.Id
+}
+
+func (bs *BookStoreServer) consoleLogout(w http.ResponseWriter, req *http.Request) {
+	sess := bs.console.session(req)
+	if sess == nil {
+		http.Redirect(w, req, "/admin/login", http.StatusSeeOther)
+		return
+	}
+	if !checkCSRF(w, req, sess) {
+		return
+	}
+	bs.console.logout(w, sess)
+	http.Redirect(w, req, "/admin/login", http.StatusSeeOther)
+}
+
+// matchBook reports whether the id, name, authors or press of book contain
+// query, ignoring case.
+func matchBook(book store.Book, query string) bool {
+	query = strings.ToLower(query)
+	fields := append([]string{book.Id, book.Name, book.Press}, book.Authors...)
+	for _, f := range fields {
+		if strings.Contains(strings.ToLower(f), query) {
+			return true
+		}
+	}
+	return false
+}
+
+func (bs *BookStoreServer) consoleBooksPage(w http.ResponseWriter, req *http.Request, sess *consoleSession, tbs *BookStoreServer) {
+	books, err := tbs.s.GetAll()
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	query := strings.TrimSpace(req.URL.Query().Get("q"))
+	if query != "" {
+		var found []store.Book
+		for _, book := range books {
+			if matchBook(book, query) {
+				found = append(found, book)
+			}
+		}
+		books = found
+	}
+	sort.Slice(books, func(i, j int) bool { return books[i].Id < books[j].Id })
+
+	data := consoleBooks{Query: query, Total: len(books), Page: 1}
+	data.Pages = (len(books) + consolePageSize - 1) / consolePageSize
+	if data.Pages == 0 {
+		data.Pages = 1
+	}
+	if page, err := strconv.Atoi(req.URL.Query().Get("page")); err == nil && page > 1 {
+		data.Page = page
+	}
+	if data.Page > data.Pages {
+		data.Page = data.Pages
+	}
+	start := (data.Page - 1) * consolePageSize
+	end := start + consolePageSize
+	if end > len(books) {
+		end = len(books)
+	}
+	data.Books = books[start:end]
+
+	bs.render(w, http.StatusOK, "books.html", sess, consolePage{Title: "Books", Data: data})
+}
+
+func (bs *BookStoreServer) consoleNewBookPage(w http.ResponseWriter, req *http.Request, sess *consoleSession, tbs *BookStoreServer) {
+	bs.render(w, http.StatusOK, "book.html", sess, consolePage{
+		Title: "New book",
+		Data:  consoleBook{New: true},
+	})
+}
+
+func (bs *BookStoreServer) consoleEditBookPage(w http.ResponseWriter, req *http.Request, sess *consoleSession, tbs *BookStoreServer) {
+	book, err := tbs.s.Get(mux.Vars(req)["id"])
+	if err != nil {
+		bs.console.flash(sess, "error", err.Error())
+		http.Redirect(w, req, "/admin/books", http.StatusSeeOther)
+		return
+	}
+	bs.render(w, http.StatusOK, "book.html", sess, consolePage{
+		Title: "Edit " + book.Name,
+		Data:  consoleBook{Book: book, Authors: strings.Join(book.Authors, ", ")},
+	})
+}
+
+// bookForm reads the fields of the book form of the book id. The authors
+// are separated by commas.
+func bookForm(req *http.Request, id string) (consoleBook, error) {
+	data := consoleBook{
+		Book: store.Book{
+			Id:    strings.TrimSpace(id),
+			Name:  strings.TrimSpace(req.PostFormValue("name")),
+			Press: strings.TrimSpace(req.PostFormValue("press")),
+		},
+		Authors: req.PostFormValue("authors"),
+	}
+	data.Book.Authors = []string{}
+	for _, a := range strings.Split(data.Authors, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			data.Book.Authors = append(data.Book.Authors, a)
+		}
+	}
+
+	switch {
+	case data.Book.Id == "":
+		return data, errors.New("id is required")
+	case data.Book.Name == "":
+		return data, errors.New("name is required")
+	}
+	return data, nil
+}
+
+func (bs *BookStoreServer) consoleCreateBook(w http.ResponseWriter, req *http.Request, sess *consoleSession, tbs *BookStoreServer) {
+	data, err := bookForm(req, req.PostFormValue("id"))
+	data.New = true
+	if err == nil {
+		err = tbs.s.Create(&data.Book)
+	}
+	if err != nil {
+		status := errorStatus(err)
+		if status == http.StatusBadRequest {
+			status = http.StatusUnprocessableEntity
+		}
+		bs.render(w, status, "book.html", sess, consolePage{Title: "New book", Error: err.Error(), Data: data})
+		return
+	}
+
+	bs.console.flash(sess, "success", "Created book "+data.Book.Id)
+	http.Redirect(w, req, "/admin/books", http.StatusSeeOther)
+}
+
+func (bs *BookStoreServer) consoleUpdateBook(w http.ResponseWriter, req *http.Request, sess *consoleSession, tbs *BookStoreServer) {
+	data, err := bookForm(req, mux.Vars(req)["id"]) // 编号不可修改
+	if _, ok := req.PostForm["press"]; ok && data.Book.Press == "" {
+		data.Book.Clear = []string{store.FieldPress} // 表单中清空的出版社
+	}
+	if err == nil {
+		err = tbs.s.Update(&data.Book)
+	}
+	if err != nil {
+		status := errorStatus(err)
+		if status == http.StatusBadRequest {
+			status = http.StatusUnprocessableEntity
+		}
+		bs.render(w, status, "book.html", sess, consolePage{Title: "Edit " + data.Book.Id, Error: err.Error(), Data: data})
+		return
+	}
+
+	bs.console.flash(sess, "success", "Updated book "+data.Book.Id)
+	http.Redirect(w, req, "/admin/books", http.StatusSeeOther)
+}
+
+func (bs *BookStoreServer) consoleDeleteBook(w http.ResponseWriter, req *http.Request, sess *consoleSession, tbs *BookStoreServer) {
+	id := mux.Vars(req)["id"]
+	if err := tbs.s.Delete(id); err != nil {
+		bs.console.flash(sess, "error", "Cannot delete book "+id+": "+err.Error())
+	} else {
+		deleteCovers(tbs.blobs, id)
+		bs.console.flash(sess, "success", "Deleted book "+id)
+	}
+
+	back := "/admin/books"
+	if q := req.PostFormValue("return"); strings.HasPrefix(q, "/admin/books?") {
+		back = q
+	}
+	http.Redirect(w, req, back, http.StatusSeeOther)
+}
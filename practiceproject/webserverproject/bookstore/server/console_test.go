@@ -0,0 +1,336 @@
+package server
+
+import (
+	"fmt"
+	memstore "github.com/Kate-liu/GoBeginner/webserverproject/bookstore/internal/store"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store/blob/local"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// browser is an http client that keeps the cookies of the console and the
+// CSRF token of the last page.
+type browser struct {
+	t    *testing.T
+	base string
+	c    *http.Client
+	csrf string
+}
+
+var csrfField = regexp.MustCompile(`name="csrf" value="([0-9a-f]+)"`)
+
+func newBrowser(t *testing.T, bs *BookStoreServer) *browser {
+	ts := httptest.NewServer(bs.srv.Handler)
+	t.Cleanup(ts.Close)
+	jar, _ := cookiejar.New(nil)
+	return &browser{t: t, base: ts.URL, c: &http.Client{Jar: jar}}
+}
+
+func (b *browser) read(resp *http.Response, err error) (int, string) {
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if m := csrfField.FindSubmatch(body); m != nil {
+		b.csrf = string(m[1])
+	}
+	return resp.StatusCode, string(body)
+}
+
+func (b *browser) get(path string) (int, string) {
+	return b.read(b.c.Get(b.base + path))
+}
+
+// post submits a form with the CSRF token of the last page.
+func (b *browser) post(path string, form url.Values) (int, string) {
+	if form.Get("csrf") == "" {
+		form.Set("csrf", b.csrf)
+	}
+	return b.read(b.c.PostForm(b.base+path, form))
+}
+
+// signIn signs the browser in to the console with token.
+func (b *browser) signIn(token string) {
+	b.get("/admin/login")
+	if code, body := b.post("/admin/login", url.Values{"token": {token}}); code != http.StatusOK || !strings.Contains(body, "Signed in") {
+		b.t.Fatalf("want signed in, actual %d: %s", code, body)
+	}
+}
+
+func newConsoleServer(s store.Store) *BookStoreServer {
+	return newTestServer(s, WithConsole(), WithAdminToken(testAdminToken))
+}
+
+func TestConsoleBooks(t *testing.T) {
+	blobs, err := local.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := memstore.NewMemStore()
+	bs := newTestServer(s, WithConsole(), WithAdminToken(testAdminToken), WithBlobStore(blobs))
+	b := newBrowser(t, bs)
+
+	code, body := b.get("/admin")
+	if code != http.StatusOK || !strings.Contains(body, "<h1>Sign in</h1>") || !strings.Contains(body, "Admin token") {
+		t.Fatalf("want the sign in page, actual %d: %s", code, body)
+	}
+	b.signIn(testAdminToken)
+	code, body = b.get("/admin")
+	if code != http.StatusOK || !strings.Contains(body, "<h1>Books</h1>") {
+		t.Fatalf("want the books page, actual %d: %s", code, body)
+	}
+
+	b.get("/admin/books/new")
+	code, body = b.post("/admin/books", url.Values{
+		"id": {"978-7-111"}, "name": {"Go <Programming>"}, "authors": {"Alan, Brian"}, "press": {"Pearson"},
+	})
+	if code != http.StatusOK || !strings.Contains(body, "Created book 978-7-111") {
+		t.Errorf("want a created flash, actual %d: %s", code, body)
+	}
+	if !strings.Contains(body, "Go &lt;Programming&gt;") {
+		t.Errorf("want the escaped name, actual %s", body)
+	}
+	book, err := s.Get("978-7-111")
+	if err != nil || len(book.Authors) != 2 || book.Authors[1] != "Brian" {
+		t.Errorf("want the created book, actual %v, %v", book, err)
+	}
+
+	_, body = b.get("/admin/books")
+	if strings.Contains(body, "Created book") {
+		t.Errorf("want the flash shown once, actual %s", body)
+	}
+
+	code, body = b.post("/admin/books", url.Values{"id": {"978-7-111"}, "name": {"Again"}})
+	if code != http.StatusConflict || !strings.Contains(body, `value="Again"`) {
+		t.Errorf("want %d with the form, actual %d: %s", http.StatusConflict, code, body)
+	}
+	code, _ = b.post("/admin/books", url.Values{"id": {"978-7-222"}})
+	if code != http.StatusUnprocessableEntity {
+		t.Errorf("want %d, actual %d", http.StatusUnprocessableEntity, code)
+	}
+
+	code, body = b.get("/admin/books/978-7-111/edit")
+	if code != http.StatusOK || !strings.Contains(body, `value="Alan, Brian"`) {
+		t.Errorf("want the edit form, actual %d: %s", code, body)
+	}
+	code, body = b.post("/admin/books/978-7-111", url.Values{"name": {"The Go Programming Language"}, "authors": {"Alan"}})
+	if code != http.StatusOK || !strings.Contains(body, "Updated book 978-7-111") {
+		t.Errorf("want an updated flash, actual %d: %s", code, body)
+	}
+	if book, _ = s.Get("978-7-111"); book.Name != "The Go Programming Language" || book.Press != "Pearson" {
+		t.Errorf("want the updated book, actual %v", book)
+	}
+
+	// 清空出版社
+	b.get("/admin/books/978-7-111/edit")
+	code, body = b.post("/admin/books/978-7-111", url.Values{"name": {"The Go Programming Language"}, "authors": {"Alan"}, "press": {""}})
+	if code != http.StatusOK || !strings.Contains(body, "Updated book 978-7-111") {
+		t.Errorf("want an updated flash, actual %d: %s", code, body)
+	}
+	if book, _ = s.Get("978-7-111"); book.Press != "" {
+		t.Errorf("want the press cleared, actual %v", book)
+	}
+
+	if rr := putCover(bs, "978-7-111", pngImage(10, 10)); rr.Code != http.StatusOK {
+		t.Fatalf("want %d, actual %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	code, body = b.post("/admin/books/978-7-111/delete", url.Values{})
+	if code != http.StatusOK || !strings.Contains(body, "Deleted book 978-7-111") {
+		t.Errorf("want a deleted flash, actual %d: %s", code, body)
+	}
+	if _, err = s.Get("978-7-111"); err != store.ErrNotFound {
+		t.Errorf("want %v, actual %v", store.ErrNotFound, err)
+	}
+	if _, _, err = blobs.Get(coverKey("978-7-111", "original")); err == nil {
+		t.Error("want the cover deleted with the book")
+	}
+}
+
+func TestConsoleCSRF(t *testing.T) {
+	s := memstore.NewMemStore()
+	b := newBrowser(t, newConsoleServer(s))
+	b.signIn(testAdminToken)
+	b.get("/admin/books/new")
+
+	code, _ := b.post("/admin/books", url.Values{"csrf": {"0badc0de"}, "id": {"978-7-111"}, "name": {"Go"}})
+	if code != http.StatusForbidden {
+		t.Errorf("want %d, actual %d", http.StatusForbidden, code)
+	}
+
+	// 另一浏览器的令牌对本会话无效
+	other := newBrowser(t, newConsoleServer(s))
+	other.signIn(testAdminToken)
+	other.get("/admin/books/new")
+	code, _ = b.post("/admin/books", url.Values{"csrf": {other.csrf}, "id": {"978-7-111"}, "name": {"Go"}})
+	if code != http.StatusForbidden {
+		t.Errorf("want %d, actual %d", http.StatusForbidden, code)
+	}
+	if _, err := s.Get("978-7-111"); err != store.ErrNotFound {
+		t.Errorf("want %v, actual %v", store.ErrNotFound, err)
+	}
+}
+
+func TestConsolePagination(t *testing.T) {
+	s := memstore.NewMemStore()
+	for i := 0; i < 25; i++ {
+		press := "Pearson"
+		if i%5 == 0 {
+			press = "O'Reilly"
+		}
+		s.Create(&store.Book{Id: fmt.Sprintf("978-%02d", i), Name: fmt.Sprintf("Book %d", i), Press: press})
+	}
+	b := newBrowser(t, newConsoleServer(s))
+	b.signIn(testAdminToken)
+
+	rows := func(body string) int {
+		return strings.Count(body, "/edit\">Edit</a>")
+	}
+	_, body := b.get("/admin/books")
+	if rows(body) != consolePageSize || !strings.Contains(body, "Page 1 of 2, 25 books") {
+		t.Errorf("want %d rows of page 1, actual %d: %s", consolePageSize, rows(body), body)
+	}
+	_, body = b.get("/admin/books?page=2")
+	if rows(body) != 5 || !strings.Contains(body, "978-24") || strings.Contains(body, ">978-00<") {
+		t.Errorf("want the last 5 rows, actual %d: %s", rows(body), body)
+	}
+	_, body = b.get("/admin/books?page=9")
+	if !strings.Contains(body, "Page 2 of 2") {
+		t.Errorf("want the last page, actual %s", body)
+	}
+
+	_, body = b.get("/admin/books?q=o%27reilly")
+	if rows(body) != 5 || !strings.Contains(body, "Page 1 of 1, 5 books") {
+		t.Errorf("want 5 matching rows, actual %d: %s", rows(body), body)
+	}
+	_, body = b.get("/admin/books?q=nothing")
+	if rows(body) != 0 || !strings.Contains(body, "No books match") {
+		t.Errorf("want no rows, actual %s", body)
+	}
+}
+
+func TestConsoleTenancy(t *testing.T) {
+	bs := newTenancyServer(memstore.NewMemStore(), WithConsole())
+	tokenA := createTenant(t, bs, `{"id":"lib-a","name":"Library A"}`)
+	tokenB := createTenant(t, bs, `{"id":"lib-b"}`)
+	b := newBrowser(t, bs)
+
+	code, body := b.get("/admin/books")
+	if code != http.StatusOK || !strings.Contains(body, "<h1>Sign in</h1>") {
+		t.Fatalf("want the sign in page, actual %d: %s", code, body)
+	}
+	code, body = b.post("/admin/login", url.Values{"token": {"wrong"}})
+	if code != http.StatusUnauthorized || !strings.Contains(body, "invalid tenant token") {
+		t.Errorf("want %d, actual %d: %s", http.StatusUnauthorized, code, body)
+	}
+
+	if before := b.c.Jar.Cookies(mustParse(t, b.base+"/admin")); len(before) != 0 {
+		t.Errorf("want no session before sign in, actual %v", before)
+	}
+	code, body = b.post("/admin/login", url.Values{"token": {tokenA}})
+	if code != http.StatusOK || !strings.Contains(body, "Signed in to Library A") {
+		t.Fatalf("want the books page, actual %d: %s", code, body)
+	}
+	first := b.c.Jar.Cookies(mustParse(t, b.base+"/admin"))
+	b.signIn(tokenA)
+	after := b.c.Jar.Cookies(mustParse(t, b.base+"/admin"))
+	if len(first) != 1 || len(after) != 1 || first[0].Value == after[0].Value {
+		t.Errorf("want a new session after sign in, actual %v, %v", first, after)
+	}
+	if len(bs.console.sessions) != 1 {
+		t.Errorf("want the previous session dropped, actual %d sessions", len(bs.console.sessions))
+	}
+
+	b.post("/admin/books", url.Values{"id": {"978-7-111"}, "name": {"Go"}})
+	if rr := doAs(bs, tokenA, "GET", "/book/978-7-111", ""); rr.Code != http.StatusOK {
+		t.Errorf("want %d, actual %d", http.StatusOK, rr.Code)
+	}
+	if rr := doAs(bs, tokenB, "GET", "/book/978-7-111", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("want %d, actual %d", http.StatusBadRequest, rr.Code)
+	}
+
+	b.post("/admin/logout", url.Values{})
+	code, body = b.get("/admin/books")
+	if code != http.StatusOK || !strings.Contains(body, "<h1>Sign in</h1>") {
+		t.Errorf("want the sign in page, actual %d: %s", code, body)
+	}
+
+	// 删除租户后其会话失效
+	b.post("/admin/login", url.Values{"token": {tokenB}})
+	doAs(bs, testAdminToken, "DELETE", "/admin/tenant/lib-b", "")
+	_, body = b.get("/admin/books")
+	if !strings.Contains(body, "<h1>Sign in</h1>") {
+		t.Errorf("want the sign in page, actual %s", body)
+	}
+}
+
+func mustParse(t *testing.T, rawurl string) *url.URL {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestConsoleSignIn(t *testing.T) {
+	bs := newConsoleServer(memstore.NewMemStore())
+
+	// 登录前的请求不在服务端保存会话
+	for i := 0; i < 10; i++ {
+		do(bs, "GET", "/admin/login", "")
+		do(bs, "GET", "/admin/books", "")
+	}
+	if len(bs.console.sessions) != 0 {
+		t.Errorf("want no session, actual %d", len(bs.console.sessions))
+	}
+
+	b := newBrowser(t, bs)
+	code, body := b.post("/admin/books", url.Values{"id": {"978-7-111"}, "name": {"Go"}})
+	if code != http.StatusOK || !strings.Contains(body, "<h1>Sign in</h1>") {
+		t.Errorf("want the sign in page, actual %d: %s", code, body)
+	}
+	code, body = b.post("/admin/login", url.Values{"token": {"wrong"}})
+	if code != http.StatusUnauthorized || !strings.Contains(body, "invalid admin token") {
+		t.Errorf("want %d, actual %d: %s", http.StatusUnauthorized, code, body)
+	}
+
+	// 登录表单的CSRF令牌须与签名的cookie一致
+	forged := newBrowser(t, bs)
+	forged.get("/admin/login")
+	if code, _ = forged.post("/admin/login", url.Values{"csrf": {"0badc0de"}, "token": {testAdminToken}}); code != http.StatusForbidden {
+		t.Errorf("want %d, actual %d", http.StatusForbidden, code)
+	}
+	forged.c.Jar.SetCookies(mustParse(t, forged.base+"/admin/login"), []*http.Cookie{
+		{Name: consoleLoginCookie, Value: forged.csrf + ".9999999999.0badc0de", Path: "/admin/login"},
+	})
+	if code, _ = forged.post("/admin/login", url.Values{"token": {testAdminToken}}); code != http.StatusForbidden {
+		t.Errorf("want %d, actual %d", http.StatusForbidden, code)
+	}
+
+	b.signIn(testAdminToken)
+	if code, body = b.get("/admin/books"); code != http.StatusOK || !strings.Contains(body, "Sign out") {
+		t.Errorf("want the books page, actual %d: %s", code, body)
+	}
+	b.post("/admin/logout", url.Values{})
+	if len(bs.console.sessions) != 0 {
+		t.Errorf("want no session after sign out, actual %d", len(bs.console.sessions))
+	}
+
+	if _, err := NewBookStoreServer(":0", memstore.NewMemStore(), WithConsole()); err == nil {
+		t.Error("want an error without an admin token, actual nil")
+	}
+}
+
+func TestConsoleDisabled(t *testing.T) {
+	bs := newTestServer(memstore.NewMemStore())
+	if rr := do(bs, "GET", "/admin/books", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("want %d, actual %d", http.StatusNotFound, rr.Code)
+	}
+}
@@ -0,0 +1,253 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store/blob"
+	"github.com/gorilla/mux"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	_ "image/gif" // 以空导入方式注入gif图片格式驱动
+)
+
+const (
+	defaultCoverMaxBytes  = 5 << 20 // 封面图片最大字节数
+	defaultCoverMaxPixels = 4096    // 封面图片最大宽/高
+	coverCacheMaxAge      = 86400
+)
+
+// thumbnailSizes are the longest edges of the generated thumbnails.
+var thumbnailSizes = []int{64, 256}
+
+var errCoverTooLarge = errors.New("cover image too large")
+
+type coverResponse struct {
+	CoverURL   string         `json:"cover_url"`
+	Format     string         `json:"format"`
+	Width      int            `json:"width"`
+	Height     int            `json:"height"`
+	Thumbnails map[int]string `json:"thumbnails"`
+}
+
+func coverKey(id, variant string) string {
+	return "covers/" + url.PathEscape(id) + "/" + variant
+}
+
+func coverURL(id string) string {
+	return "/book/" + url.PathEscape(id) + "/cover"
+}
+
+func (bs *BookStoreServer) putCoverHandler(w http.ResponseWriter, req *http.Request) {
+	if bs.blobs == nil {
+		http.Error(w, "no blob store configured", http.StatusNotImplemented)
+		return
+	}
+
+	id := mux.Vars(req)["id"]
+	if _, err := bs.s.Get(id); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(req.Body, bs.coverMaxBytes+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if int64(len(data)) > bs.coverMaxBytes {
+		http.Error(w, errCoverTooLarge.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// 先只解码图片头部，拒绝超大尺寸的图片，避免解码时占用过多内存
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	if cfg.Width > bs.coverMaxPixels || cfg.Height > bs.coverMaxPixels {
+		http.Error(w, errCoverTooLarge.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	info, err := bs.blobs.Put(coverKey(id, "original"), bytes.NewReader(data), "image/"+format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := coverResponse{
+		Format:     format,
+		Width:      cfg.Width,
+		Height:     cfg.Height,
+		Thumbnails: make(map[int]string),
+	}
+	for _, size := range thumbnailSizes {
+		var buf bytes.Buffer
+		contentType, err := encodeThumbnail(&buf, thumbnail(img, size), format)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		variant := "thumb-" + strconv.Itoa(size)
+		if _, err = bs.blobs.Put(coverKey(id, variant), &buf, contentType); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp.Thumbnails[size] = coverURL(id) + "?size=" + strconv.Itoa(size)
+	}
+
+	// 用内容摘要作为版本号，封面更新后URL随之变化
+	resp.CoverURL = coverURL(id) + "?v=" + url.QueryEscape(trimQuotes(info.ETag))
+	if err = bs.s.Update(&store.Book{Id: id, CoverURL: resp.CoverURL}); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	response(w, resp)
+}
+
+func (bs *BookStoreServer) getCoverHandler(w http.ResponseWriter, req *http.Request) {
+	if bs.blobs == nil {
+		http.Error(w, "no blob store configured", http.StatusNotImplemented)
+		return
+	}
+
+	variant := "original"
+	if size := req.URL.Query().Get("size"); size != "" {
+		if !validThumbnailSize(size) {
+			http.Error(w, fmt.Sprintf("invalid thumbnail size %s", size), http.StatusBadRequest)
+			return
+		}
+		variant = "thumb-" + size
+	}
+
+	// 图书已删除或没有上传封面时，不返回残留的封面
+	id := mux.Vars(req)["id"]
+	book, err := bs.s.Get(id)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	if book.CoverURL == "" {
+		http.Error(w, "cover "+blob.ErrNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	rs, info, err := bs.blobs.Get(coverKey(id, variant))
+	if err == blob.ErrNotFound {
+		http.Error(w, "cover "+err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rs.Close()
+
+	w.Header().Set("Content-Type", info.ContentType)
+	w.Header().Set("ETag", info.ETag)
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(coverCacheMaxAge))
+	http.ServeContent(w, req, "", info.ModTime, rs)
+}
+
+// deleteCovers deletes the original and the thumbnails of the cover of
+// the book id from blobs, which may be nil.
+func deleteCovers(blobs blob.Store, id string) {
+	if blobs == nil {
+		return
+	}
+	variants := []string{"original"}
+	for _, size := range thumbnailSizes {
+		variants = append(variants, "thumb-"+strconv.Itoa(size))
+	}
+	for _, variant := range variants {
+		// 封面不存在或删除失败时忽略，图书已经删除
+		_ = blobs.Delete(coverKey(id, variant))
+	}
+}
+
+func validThumbnailSize(size string) bool {
+	for _, s := range thumbnailSizes {
+		if strconv.Itoa(s) == size {
+			return true
+		}
+	}
+	return false
+}
+
+func trimQuotes(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// encodeThumbnail encodes jpeg covers as jpeg and the others as png.
+func encodeThumbnail(w io.Writer, img image.Image, format string) (string, error) {
+	if format == "jpeg" {
+		return "image/jpeg", jpeg.Encode(w, img, &jpeg.Options{Quality: 85})
+	}
+	return "image/png", png.Encode(w, img)
+}
+
+// thumbnail scales img down so that its longest edge is size, averaging
+// the source pixels covered by each target pixel. Smaller images are
+// returned as is.
+func thumbnail(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= size && h <= size {
+		return img
+	}
+
+	tw, th := size, size
+	if w > h {
+		th = h * size / w
+	} else {
+		tw = w * size / h
+	}
+	if tw == 0 {
+		tw = 1
+	}
+	if th == 0 {
+		th = 1
+	}
+
+	dst := image.NewRGBA64(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		sy0, sy1 := b.Min.Y+y*h/th, b.Min.Y+(y+1)*h/th
+		for x := 0; x < tw; x++ {
+			sx0, sx1 := b.Min.X+x*w/tw, b.Min.X+(x+1)*w/tw
+
+			var r, g, bl, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.SetRGBA64(x, y, color.RGBA64{
+				R: uint16(r / n), G: uint16(g / n), B: uint16(bl / n), A: uint16(a / n),
+			})
+		}
+	}
+	return dst
+}
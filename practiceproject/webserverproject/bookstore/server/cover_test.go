@@ -0,0 +1,119 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	memstore "github.com/Kate-liu/GoBeginner/webserverproject/bookstore/internal/store"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store/blob/local"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func pngImage(w, h int) []byte {
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, h)))
+	return buf.Bytes()
+}
+
+func putCover(bs *BookStoreServer, id string, data []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("PUT", "/book/"+id+"/cover", bytes.NewReader(data))
+	req.Header.Set("Content-Type", "image/png")
+	rr := httptest.NewRecorder()
+	bs.srv.Handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestCoverUpload(t *testing.T) {
+	blobs, err := local.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := memstore.NewMemStore()
+	s.Create(&store.Book{Id: "1", Name: "The Go Programming Language"})
+	bs := newTestServer(s, WithBlobStore(blobs), WithCoverLimits(1<<20, 1000))
+
+	rr := putCover(bs, "1", pngImage(600, 300))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("want %d, actual %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var resp coverResponse
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	if resp.Format != "png" || resp.Width != 600 || resp.Height != 300 {
+		t.Errorf("want png 600x300, actual %+v", resp)
+	}
+
+	book, _ := s.Get("1")
+	if book.CoverURL != resp.CoverURL {
+		t.Errorf("want %s, actual %s", resp.CoverURL, book.CoverURL)
+	}
+
+	req := httptest.NewRequest("GET", "/book/1/cover?size=64", nil)
+	rr = httptest.NewRecorder()
+	bs.srv.Handler.ServeHTTP(rr, req)
+	if rr.Header().Get("Content-Type") != "image/png" || rr.Header().Get("Cache-Control") == "" {
+		t.Errorf("want png with cache headers, actual %v", rr.Header())
+	}
+	cfg, _, err := image.DecodeConfig(rr.Body)
+	if err != nil || cfg.Width != 64 || cfg.Height != 32 {
+		t.Errorf("want 64x32 thumbnail, actual %+v, %v", cfg, err)
+	}
+
+	if rr = putCover(bs, "1", pngImage(1200, 10)); rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("want %d, actual %d", http.StatusRequestEntityTooLarge, rr.Code)
+	}
+	if rr = putCover(bs, "1", []byte("not an image")); rr.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("want %d, actual %d", http.StatusUnsupportedMediaType, rr.Code)
+	}
+	if rr = putCover(bs, "404", pngImage(10, 10)); rr.Code != http.StatusNotFound {
+		t.Errorf("want %d, actual %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestCoverDeletedBook(t *testing.T) {
+	deletes := map[string]func(bs *BookStoreServer) int{
+		"http": func(bs *BookStoreServer) int {
+			return do(bs, "DELETE", "/book/1", "").Code
+		},
+		"graphql": func(bs *BookStoreServer) int {
+			return do(bs, "POST", "/graphql", `{"query": "mutation { deleteBook(id: \"1\") }"}`).Code
+		},
+		"batch": func(bs *BookStoreServer) int {
+			return do(bs, "POST", "/book:batch", `{"operations": [{"op": "delete", "id": "1"}]}`).Code
+		},
+	}
+
+	for name, del := range deletes {
+		t.Run(name, func(t *testing.T) {
+			blobs, err := local.New(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := memstore.NewMemStore()
+			s.Create(&store.Book{Id: "1", Name: "The Go Programming Language"})
+			bs := newTestServer(s, WithBlobStore(blobs))
+
+			if rr := putCover(bs, "1", pngImage(10, 10)); rr.Code != http.StatusOK {
+				t.Fatalf("want %d, actual %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+			}
+			if code := del(bs); code != http.StatusOK {
+				t.Fatalf("want %d, actual %d", http.StatusOK, code)
+			}
+			if rr := do(bs, "GET", "/book/1/cover", ""); rr.Code != http.StatusNotFound {
+				t.Errorf("want %d, actual %d", http.StatusNotFound, rr.Code)
+			}
+			if _, _, err := blobs.Get(coverKey("1", "original")); err == nil {
+				t.Error("want the cover deleted with the book")
+			}
+
+			// 同id新建的图书不显示旧封面
+			s.Create(&store.Book{Id: "1", Name: "The Go Programming Language"})
+			if rr := do(bs, "GET", "/book/1/cover?size=64", ""); rr.Code != http.StatusNotFound {
+				t.Errorf("want %d, actual %d", http.StatusNotFound, rr.Code)
+			}
+		})
+	}
+}
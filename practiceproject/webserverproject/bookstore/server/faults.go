@@ -0,0 +1,71 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store/fault"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+type faultsResponse struct {
+	Rules    map[fault.Op]fault.Rule `json:"rules"`
+	Injected map[fault.Op]int        `json:"injected"` // 各操作已注入的错误与panic数
+}
+
+// injector returns the fault injector of the server, or writes a 501 if
+// fault injection is not enabled. The admin token is always required, the
+// faults affect every client of the server.
+func (bs *BookStoreServer) injector(w http.ResponseWriter, req *http.Request) (*fault.Injector, bool) {
+	if bs.faults == nil {
+		http.Error(w, "fault injection is not enabled", http.StatusNotImplemented)
+		return nil, false
+	}
+	if !bs.requireAdmin(w, req) {
+		return nil, false
+	}
+	return bs.faults, true
+}
+
+func (bs *BookStoreServer) getFaultsHandler(w http.ResponseWriter, req *http.Request) {
+	inj, ok := bs.injector(w, req)
+	if !ok {
+		return
+	}
+	response(w, faultsResponse{Rules: inj.Rules(), Injected: inj.Injected()})
+}
+
+func (bs *BookStoreServer) resetFaultsHandler(w http.ResponseWriter, req *http.Request) {
+	inj, ok := bs.injector(w, req)
+	if !ok {
+		return
+	}
+	inj.Reset()
+}
+
+func (bs *BookStoreServer) setFaultHandler(w http.ResponseWriter, req *http.Request) {
+	inj, ok := bs.injector(w, req)
+	if !ok {
+		return
+	}
+
+	dec := json.NewDecoder(req.Body)
+	var rule fault.Rule
+	if err := dec.Decode(&rule); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := inj.Set(fault.Op(mux.Vars(req)["op"]), rule); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	response(w, rule)
+}
+
+func (bs *BookStoreServer) clearFaultHandler(w http.ResponseWriter, req *http.Request) {
+	inj, ok := bs.injector(w, req)
+	if !ok {
+		return
+	}
+	inj.Clear(fault.Op(mux.Vars(req)["op"]))
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	memstore "github.com/Kate-liu/GoBeginner/webserverproject/bookstore/internal/store"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store/fault"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFaultStatus(t *testing.T) {
+	s := memstore.NewMemStore()
+	s.Create(&store.Book{Id: "1", Name: "b1"})
+	bs := newTestServer(s, WithFaultInjection(fault.NewInjector()), WithAdminToken(testAdminToken))
+
+	cases := []struct {
+		rule string
+		want int
+	}{
+		{`{"error_rate":1}`, http.StatusInternalServerError},
+		{`{"error_rate":1,"error":"not_found"}`, http.StatusBadRequest}, // 与/book的其他存储错误一致
+		{`{"error_rate":1,"error":"quota"}`, http.StatusForbidden},
+		{`{"error_rate":1,"error":"not_supported"}`, http.StatusNotImplemented},
+	}
+	for _, c := range cases {
+		if rr := doAs(bs, testAdminToken, "PUT", "/admin/faults/get", c.rule); rr.Code != http.StatusOK {
+			t.Fatalf("want %d, actual %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		if rr := do(bs, "GET", "/book/1", ""); rr.Code != c.want {
+			t.Errorf("rule %s: want %d, actual %d", c.rule, c.want, rr.Code)
+		}
+	}
+
+	rr := doAs(bs, testAdminToken, "GET", "/admin/faults", "")
+	if want := `"injected":{"get":4}`; !strings.Contains(rr.Body.String(), want) {
+		t.Errorf("want %s, actual %s", want, rr.Body.String())
+	}
+
+	if rr = doAs(bs, testAdminToken, "DELETE", "/admin/faults", ""); rr.Code != http.StatusOK {
+		t.Fatalf("want %d, actual %d", http.StatusOK, rr.Code)
+	}
+	if rr = do(bs, "GET", "/book/1", ""); rr.Code != http.StatusOK {
+		t.Errorf("want %d, actual %d", http.StatusOK, rr.Code)
+	}
+
+	if rr = doAs(bs, testAdminToken, "PUT", "/admin/faults/get", `{"error_rate":3}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("want %d, actual %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+func TestFaultTimeout(t *testing.T) {
+	inj := fault.NewInjector()
+	bs := newTestServer(memstore.NewMemStore(), WithFaultInjection(inj), WithHandlerTimeout(20*time.Millisecond))
+
+	inj.Set(fault.OpGetAll, fault.Rule{Latency: 200 * time.Millisecond})
+	if rr := do(bs, "GET", "/book", ""); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("want %d, actual %d", http.StatusServiceUnavailable, rr.Code)
+	}
+	inj.Clear(fault.OpGetAll)
+	if rr := do(bs, "GET", "/book", ""); rr.Code != http.StatusOK {
+		t.Errorf("want %d, actual %d", http.StatusOK, rr.Code)
+	}
+}
+
+func TestFaultAdmin(t *testing.T) {
+	if rr := do(newTestServer(memstore.NewMemStore()), "GET", "/admin/faults", ""); rr.Code != http.StatusNotImplemented {
+		t.Errorf("want %d, actual %d", http.StatusNotImplemented, rr.Code)
+	}
+
+	// 未设置管理令牌时，不提供故障注入接口
+	bs := newTestServer(memstore.NewMemStore(), WithFaultInjection(fault.NewInjector()))
+	if rr := do(bs, "PUT", "/admin/faults/get", `{"error_rate":1}`); rr.Code != http.StatusUnauthorized {
+		t.Errorf("want %d, actual %d", http.StatusUnauthorized, rr.Code)
+	}
+	bs = newTestServer(memstore.NewMemStore(), WithFaultInjection(fault.NewInjector()), WithAdminToken(testAdminToken))
+	if rr := doAs(bs, "other", "GET", "/admin/faults", ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("want %d, actual %d", http.StatusUnauthorized, rr.Code)
+	}
+	if rr := doAs(bs, testAdminToken, "GET", "/admin/faults", ""); rr.Code != http.StatusOK {
+		t.Errorf("want %d, actual %d", http.StatusOK, rr.Code)
+	}
+
+	// 启用多租户时，使用多租户的管理令牌
+	bs = newTenancyServer(memstore.NewMemStore(), WithFaultInjection(fault.NewInjector()))
+	a := createTenant(t, bs, `{"id":"a"}`)
+	if rr := doAs(bs, a, "PUT", "/admin/faults/get", `{"error_rate":1}`); rr.Code != http.StatusUnauthorized {
+		t.Errorf("want %d, actual %d", http.StatusUnauthorized, rr.Code)
+	}
+	if rr := doAs(bs, testAdminToken, "PUT", "/admin/faults/create", `{"error_rate":1}`); rr.Code != http.StatusOK {
+		t.Fatalf("want %d, actual %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if rr := doAs(bs, a, "POST", "/book", `{"id":"1","name":"b1"}`); rr.Code != http.StatusInternalServerError {
+		t.Errorf("want %d, actual %d", http.StatusInternalServerError, rr.Code)
+	}
+}
+
+func TestFaultPanic(t *testing.T) {
+	inj := fault.NewInjector()
+	bs := newTestServer(memstore.NewMemStore(), WithFaultInjection(inj))
+
+	inj.Set(fault.OpGetAll, fault.Rule{PanicRate: 1})
+	if rr := do(bs, "GET", "/book", ""); rr.Code != http.StatusInternalServerError {
+		t.Errorf("want %d, actual %d", http.StatusInternalServerError, rr.Code)
+	}
+	inj.Reset()
+	if rr := do(bs, "GET", "/book", ""); rr.Code != http.StatusOK {
+		t.Errorf("want %d, actual %d", http.StatusOK, rr.Code)
+	}
+}
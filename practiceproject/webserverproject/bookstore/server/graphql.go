@@ -0,0 +1,412 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/server/graphql"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store/blob"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const (
+	defaultGraphQLMaxDepth      = 8
+	defaultGraphQLMaxComplexity = 1000
+	graphQLMaxBytes             = 1 << 20 // POST请求体的最大字节数
+
+	defaultBooksPageSize = 20
+	maxBooksPageSize     = 100
+)
+
+// bookPage is a page of the books query.
+type bookPage struct {
+	items       []store.Book
+	totalCount  int
+	endCursor   string
+	hasNextPage bool
+}
+
+func encodeCursor(id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(id))
+}
+
+func decodeCursor(cursor string) (string, error) {
+	id, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", errors.New("invalid cursor")
+	}
+	return string(id), nil
+}
+
+func nonNull(t graphql.Type) graphql.Type {
+	return &graphql.NonNull{Of: t}
+}
+
+func listOf(t graphql.Type) graphql.Type {
+	return &graphql.NonNull{Of: &graphql.List{Of: &graphql.NonNull{Of: t}}}
+}
+
+// optionalString resolves empty strings to null.
+func optionalString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// newGraphQLSchema returns the GraphQL schema of the books of s. Authors
+// and presses are reachable from books if s keeps a store.CatalogStore.
+// Deleting a book deletes its covers from blobs, which may be nil.
+func newGraphQLSchema(s store.Store, blobs blob.Store) *graphql.Schema {
+	book := &graphql.Object{Name: "Book"}
+	author := &graphql.Object{Name: "Author"}
+	press := &graphql.Object{Name: "Press"}
+
+	catalog := func() (store.CatalogStore, error) {
+		cs, ok := findCatalog(s)
+		if !ok {
+			return nil, store.ErrNotSupported
+		}
+		return cs, nil
+	}
+
+	book.Fields = map[string]*graphql.FieldDef{
+		"id": {Type: nonNull(graphql.ID), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(store.Book).Id, nil
+		}},
+		"name": {Type: nonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(store.Book).Name, nil
+		}},
+		"authors": {Type: listOf(graphql.String), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return append([]string{}, p.Source.(store.Book).Authors...), nil
+		}},
+		"press": {Type: nonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(store.Book).Press, nil
+		}},
+		"authorIds": {Type: listOf(graphql.ID), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return append([]string{}, p.Source.(store.Book).AuthorIds...), nil
+		}},
+		"pressId": {Type: graphql.ID, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return optionalString(p.Source.(store.Book).PressId), nil
+		}},
+		"coverUrl": {Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return optionalString(p.Source.(store.Book).CoverURL), nil
+		}},
+		"authorDetails": {Type: listOf(author), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			cs, err := catalog()
+			if err != nil {
+				return nil, err
+			}
+			authors := make([]store.Author, 0)
+			for _, id := range p.Source.(store.Book).AuthorIds {
+				a, err := cs.GetAuthor(id)
+				if err != nil {
+					return nil, err
+				}
+				authors = append(authors, a)
+			}
+			return authors, nil
+		}},
+		"pressDetails": {Type: press, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			id := p.Source.(store.Book).PressId
+			if id == "" {
+				return nil, nil
+			}
+			cs, err := catalog()
+			if err != nil {
+				return nil, err
+			}
+			pr, err := cs.GetPress(id)
+			if err != nil {
+				return nil, err
+			}
+			return pr, nil
+		}},
+	}
+
+	author.Fields = map[string]*graphql.FieldDef{
+		"id": {Type: nonNull(graphql.ID), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(store.Author).Id, nil
+		}},
+		"name": {Type: nonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(store.Author).Name, nil
+		}},
+		"books": {Type: listOf(book), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			id := p.Source.(store.Author).Id
+			return filterBooks(s, func(book *store.Book) bool {
+				return containsString(book.AuthorIds, id)
+			})
+		}},
+	}
+
+	press.Fields = map[string]*graphql.FieldDef{
+		"id": {Type: nonNull(graphql.ID), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(store.Press).Id, nil
+		}},
+		"name": {Type: nonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(store.Press).Name, nil
+		}},
+		"books": {Type: listOf(book), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			id := p.Source.(store.Press).Id
+			return filterBooks(s, func(book *store.Book) bool {
+				return book.PressId == id
+			})
+		}},
+	}
+
+	page := &graphql.Object{Name: "BookPage", Fields: map[string]*graphql.FieldDef{
+		"items": {
+			Type: listOf(book),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*bookPage).items, nil
+			},
+			// books已按first计算了条目数
+			Complexity: func(args map[string]interface{}, childComplexity int) int {
+				return 1 + childComplexity
+			},
+		},
+		"totalCount": {Type: nonNull(graphql.Int), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(*bookPage).totalCount, nil
+		}},
+		"endCursor": {Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return optionalString(p.Source.(*bookPage).endCursor), nil
+		}},
+		"hasNextPage": {Type: nonNull(graphql.Boolean), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(*bookPage).hasNextPage, nil
+		}},
+	}}
+
+	query := &graphql.Object{Name: "Query", Fields: map[string]*graphql.FieldDef{
+		"book": {
+			Type: book,
+			Args: map[string]*graphql.ArgumentDef{"id": {Type: nonNull(graphql.ID)}},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				b, err := s.Get(p.Args["id"].(string))
+				if err == store.ErrNotFound {
+					return nil, nil
+				}
+				if err != nil {
+					return nil, err
+				}
+				return b, nil
+			},
+		},
+		"books": {
+			Type: nonNull(page),
+			Args: map[string]*graphql.ArgumentDef{
+				"author": {Type: graphql.String},
+				"press":  {Type: graphql.String},
+				"name":   {Type: graphql.String},
+				"first":  {Type: graphql.Int, Default: int64(defaultBooksPageSize)},
+				"after":  {Type: graphql.String},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return queryBooks(s, p.Args)
+			},
+			Complexity: func(args map[string]interface{}, childComplexity int) int {
+				first, _ := args["first"].(int)
+				if first < 1 {
+					first = 1
+				}
+				return 1 + first*childComplexity
+			},
+		},
+	}}
+
+	input := &graphql.InputObject{Name: "BookInput", Fields: map[string]*graphql.ArgumentDef{
+		"id":        {Type: graphql.ID},
+		"name":      {Type: graphql.String},
+		"authors":   {Type: &graphql.List{Of: nonNull(graphql.String)}},
+		"press":     {Type: graphql.String},
+		"authorIds": {Type: &graphql.List{Of: nonNull(graphql.ID)}},
+		"pressId":   {Type: graphql.ID},
+	}}
+
+	mutation := &graphql.Object{Name: "Mutation", Fields: map[string]*graphql.FieldDef{
+		"createBook": {
+			Type: nonNull(book),
+			Args: map[string]*graphql.ArgumentDef{"input": {Type: nonNull(input)}},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				b := bookFromInput(p.Args["input"].(map[string]interface{}))
+				if b.Id == "" {
+					return nil, errors.New("input.id is required")
+				}
+				if err := s.Create(&b); err != nil {
+					return nil, err
+				}
+				return s.Get(b.Id)
+			},
+		},
+		"updateBook": {
+			Type: nonNull(book),
+			Args: map[string]*graphql.ArgumentDef{
+				"id":    {Type: nonNull(graphql.ID)},
+				"input": {Type: nonNull(input)},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				b := bookFromInput(p.Args["input"].(map[string]interface{}))
+				b.Id = p.Args["id"].(string)
+				if err := s.Update(&b); err != nil {
+					return nil, err
+				}
+				return s.Get(b.Id)
+			},
+		},
+		"deleteBook": {
+			Type: nonNull(graphql.Boolean),
+			Args: map[string]*graphql.ArgumentDef{"id": {Type: nonNull(graphql.ID)}},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				id := p.Args["id"].(string)
+				if err := s.Delete(id); err != nil {
+					return nil, err
+				}
+				deleteCovers(blobs, id)
+				return true, nil
+			},
+		},
+	}}
+
+	return &graphql.Schema{Query: query, Mutation: mutation}
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// queryBooks returns the page of books matching the filters of the books
+// query. Books are sorted by id, and the cursor of a page is the encoded id
+// of its last book.
+func queryBooks(s store.Store, args map[string]interface{}) (*bookPage, error) {
+	first, ok := args["first"].(int)
+	if !ok {
+		first = defaultBooksPageSize
+	}
+	if first < 0 || first > maxBooksPageSize {
+		return nil, fmt.Errorf("first must be between 0 and %d", maxBooksPageSize)
+	}
+
+	author, _ := args["author"].(string)
+	press, _ := args["press"].(string)
+	name, _ := args["name"].(string)
+	books, err := filterBooks(s, func(book *store.Book) bool {
+		if author != "" && !containsString(book.AuthorIds, author) && !containsFold(book.Authors, author) {
+			return false
+		}
+		if press != "" && book.PressId != press && !strings.EqualFold(book.Press, press) {
+			return false
+		}
+		return name == "" || strings.Contains(strings.ToLower(book.Name), strings.ToLower(name))
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(books, func(i, j int) bool { return books[i].Id < books[j].Id })
+
+	start := 0
+	if after, ok := args["after"].(string); ok {
+		id, err := decodeCursor(after)
+		if err != nil {
+			return nil, err
+		}
+		start = sort.Search(len(books), func(i int) bool { return books[i].Id > id })
+	}
+
+	end := start + first
+	if end > len(books) {
+		end = len(books)
+	}
+	page := &bookPage{
+		items:       books[start:end],
+		totalCount:  len(books),
+		hasNextPage: end < len(books),
+	}
+	if end > start {
+		page.endCursor = encodeCursor(books[end-1].Id)
+	}
+	return page, nil
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func bookFromInput(in map[string]interface{}) store.Book {
+	var b store.Book
+	b.Id, _ = in["id"].(string)
+	b.Name, _ = in["name"].(string)
+	b.Press, _ = in["press"].(string)
+	b.PressId, _ = in["pressId"].(string)
+	b.Authors = stringList(in["authors"])
+	b.AuthorIds = stringList(in["authorIds"])
+	return b
+}
+
+func stringList(v interface{}) []string {
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil
+	}
+	out := make([]string, len(list))
+	for i, item := range list {
+		out[i] = item.(string)
+	}
+	return out
+}
+
+// graphqlHandler serves GraphQL requests sent as a JSON body with POST, or
+// as query parameters with GET. Mutations are only accepted with POST.
+func (bs *BookStoreServer) graphqlHandler(w http.ResponseWriter, req *http.Request) {
+	var greq graphql.Request
+	if req.Method == http.MethodGet {
+		q := req.URL.Query()
+		greq.Query = q.Get("query")
+		greq.OperationName = q.Get("operationName")
+		if vars := q.Get("variables"); vars != "" {
+			if err := json.Unmarshal([]byte(vars), &greq.Variables); err != nil {
+				http.Error(w, "invalid variables: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+	} else if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, graphQLMaxBytes)).Decode(&greq); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if greq.Query == "" {
+		http.Error(w, "no query found in request", http.StatusBadRequest)
+		return
+	}
+
+	op, err := greq.Operation()
+	if err != nil {
+		response(w, &graphql.Result{Errors: []*graphql.Error{toGraphQLError(err)}})
+		return
+	}
+	if op.Type == "mutation" && req.Method != http.MethodPost {
+		http.Error(w, "mutations must be sent with POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	response(w, bs.gqlSchema.ExecuteOperation(req.Context(), op, greq.Variables, bs.gqlLimits))
+}
+
+func toGraphQLError(err error) *graphql.Error {
+	if gerr, ok := err.(*graphql.Error); ok {
+		return gerr
+	}
+	return &graphql.Error{Message: err.Error()}
+}
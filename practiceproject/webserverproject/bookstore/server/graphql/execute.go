@@ -0,0 +1,430 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Error is an error of a GraphQL response.
+type Error struct {
+	Message   string        `json:"message"`
+	Locations []Location    `json:"locations,omitempty"`
+	Path      []interface{} `json:"path,omitempty"` // 出错字段在响应中的路径
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Request is a GraphQL request as sent over http.
+type Request struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+// Result is the response to a Request. Data is left out of the JSON
+// encoding if the request failed before execution, and is null if a
+// non-null root field is null.
+type Result struct {
+	Data   interface{}
+	Errors []*Error
+
+	executed bool // 是否开始执行
+}
+
+func (r *Result) MarshalJSON() ([]byte, error) {
+	var out struct {
+		Data   *interface{} `json:"data,omitempty"`
+		Errors []*Error     `json:"errors,omitempty"`
+	}
+	if r.executed || r.Data != nil {
+		out.Data = &r.Data
+	}
+	out.Errors = r.Errors
+	return json.Marshal(out)
+}
+
+// Limits bounds the cost of a request, zero means no limit.
+type Limits struct {
+	MaxDepth      int // 选择集最大嵌套层数
+	MaxComplexity int // 按FieldDef.Complexity计算的最大代价
+}
+
+type executor struct {
+	ctx     context.Context
+	schema  *Schema
+	vars    map[string]interface{} // 已传入或有默认值的变量
+	defined map[string]bool        // 操作声明的变量
+	errors  []*Error
+}
+
+func failed(err error) *Result {
+	if gerr, ok := err.(*Error); ok {
+		return &Result{Errors: []*Error{gerr}}
+	}
+	return &Result{Errors: []*Error{{Message: err.Error()}}}
+}
+
+// Execute runs a request against the schema. Requests exceeding the limits
+// are rejected before any field is resolved. Mutation fields are resolved
+// one after the other, in the order of the request.
+func (s *Schema) Execute(ctx context.Context, req Request, limits Limits) *Result {
+	doc, err := Parse(req.Query)
+	if err != nil {
+		return failed(err)
+	}
+	op, err := doc.operation(req.OperationName)
+	if err != nil {
+		return failed(err)
+	}
+	return s.ExecuteOperation(ctx, op, req.Variables, limits)
+}
+
+// operation selects the operation to execute.
+func (doc *Document) operation(name string) (*Operation, error) {
+	if name == "" {
+		if len(doc.Operations) > 1 {
+			return nil, &Error{Message: "operationName is required for a document with several operations"}
+		}
+		return doc.Operations[0], nil
+	}
+	for _, op := range doc.Operations {
+		if op.Name == name {
+			return op, nil
+		}
+	}
+	return nil, &Error{Message: fmt.Sprintf("unknown operation %s", name)}
+}
+
+// Operation returns the operation of the request that Execute would run,
+// so that a caller can check its type.
+func (req Request) Operation() (*Operation, error) {
+	doc, err := Parse(req.Query)
+	if err != nil {
+		return nil, err
+	}
+	return doc.operation(req.OperationName)
+}
+
+// ExecuteOperation runs one operation of a parsed document.
+func (s *Schema) ExecuteOperation(ctx context.Context, op *Operation, variables map[string]interface{}, limits Limits) *Result {
+	root := s.Query
+	if op.Type == "mutation" {
+		root = s.Mutation
+	}
+	if root == nil {
+		return failed(fmt.Errorf("%s operations are not supported", op.Type))
+	}
+
+	e := &executor{
+		ctx:     ctx,
+		schema:  s,
+		vars:    make(map[string]interface{}),
+		defined: make(map[string]bool),
+	}
+	if err := e.coerceVariables(op, variables); err != nil {
+		return failed(err)
+	}
+
+	depth, complexity, err := e.analyze(root, op.Selections, 1)
+	if err != nil {
+		return failed(err)
+	}
+	if limits.MaxDepth > 0 && depth > limits.MaxDepth {
+		return failed(fmt.Errorf("query depth %d exceeds the limit of %d", depth, limits.MaxDepth))
+	}
+	if limits.MaxComplexity > 0 && complexity > limits.MaxComplexity {
+		return failed(fmt.Errorf("query complexity %d exceeds the limit of %d", complexity, limits.MaxComplexity))
+	}
+
+	data, ok := e.executeFields(root, nil, op.Selections, nil)
+	if !ok {
+		return &Result{Errors: e.errors, executed: true}
+	}
+	return &Result{Data: data, Errors: e.errors, executed: true}
+}
+
+// coerceVariables checks the variables against their definitions. The
+// values are kept as sent, they are coerced again with the arguments.
+func (e *executor) coerceVariables(op *Operation, variables map[string]interface{}) error {
+	for _, def := range op.Variables {
+		t, err := e.schema.parseTypeRef(def.Type)
+		if err != nil {
+			return fmt.Errorf("variable $%s: %v", def.Name, err)
+		}
+
+		e.defined[def.Name] = true
+		v, ok := variables[def.Name]
+		if !ok {
+			v, ok = def.Default, def.Default != nil
+		}
+		if _, err = coerce(v, t, nil); err != nil {
+			return fmt.Errorf("variable $%s: %v", def.Name, err)
+		}
+		if ok {
+			e.vars[def.Name] = v
+		}
+	}
+	return nil
+}
+
+func namedType(t Type) Type {
+	for {
+		switch tt := t.(type) {
+		case *NonNull:
+			t = tt.Of
+		case *List:
+			t = tt.Of
+		default:
+			return t
+		}
+	}
+}
+
+func isList(t Type) bool {
+	if nn, ok := t.(*NonNull); ok {
+		t = nn.Of
+	}
+	_, ok := t.(*List)
+	return ok
+}
+
+func fieldError(f *Field, format string, args ...interface{}) error {
+	return &Error{Message: fmt.Sprintf(format, args...), Locations: []Location{f.Location}}
+}
+
+// analyze validates a selection set and returns its depth and complexity.
+func (e *executor) analyze(obj *Object, sels []*Field, depth int) (int, int, error) {
+	maxDepth, complexity := depth, 0
+	for _, sel := range sels {
+		if sel.Name == "__typename" {
+			continue
+		}
+
+		def, ok := obj.Fields[sel.Name]
+		if !ok {
+			return 0, 0, fieldError(sel, "cannot query field %s on type %s", sel.Name, obj.Name)
+		}
+		if err := e.checkVariables(sel, sel.Arguments); err != nil {
+			return 0, 0, err
+		}
+		args, err := coerceArgs(def.Args, sel, e.vars)
+		if err != nil {
+			return 0, 0, fieldError(sel, "%v", err)
+		}
+
+		childCost := 0
+		child, isObject := namedType(def.Type).(*Object)
+		switch {
+		case isObject && len(sel.Selections) == 0:
+			return 0, 0, fieldError(sel, "field %s of type %s must have a selection of subfields", sel.Name, def.Type)
+		case !isObject && len(sel.Selections) > 0:
+			return 0, 0, fieldError(sel, "field %s of type %s must not have a selection", sel.Name, def.Type)
+		case isObject:
+			var childDepth int
+			childDepth, childCost, err = e.analyze(child, sel.Selections, depth+1)
+			if err != nil {
+				return 0, 0, err
+			}
+			if childDepth > maxDepth {
+				maxDepth = childDepth
+			}
+		}
+
+		switch {
+		case def.Complexity != nil:
+			complexity += def.Complexity(args, childCost)
+		case isList(def.Type):
+			complexity += 1 + DefaultListSize*childCost
+		default:
+			complexity += 1 + childCost
+		}
+	}
+	return maxDepth, complexity, nil
+}
+
+func (e *executor) checkVariables(sel *Field, v interface{}) error {
+	switch v := v.(type) {
+	case Variable:
+		if !e.defined[string(v)] {
+			return fieldError(sel, "variable $%s is not defined", v)
+		}
+	case []interface{}:
+		for _, item := range v {
+			if err := e.checkVariables(sel, item); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		for _, item := range v {
+			if err := e.checkVariables(sel, item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (e *executor) addError(sel *Field, path []interface{}, message string) {
+	e.errors = append(e.errors, &Error{
+		Message:   message,
+		Locations: []Location{sel.Location},
+		Path:      append([]interface{}(nil), path...),
+	})
+}
+
+// executeFields resolves a selection set on source. It returns false if a
+// non-null field is null, the null then propagates to the parent.
+func (e *executor) executeFields(obj *Object, source interface{}, sels []*Field, path []interface{}) (*orderedMap, bool) {
+	out := newOrderedMap()
+	for _, sel := range sels {
+		key := sel.ResponseKey()
+		if sel.Name == "__typename" {
+			out.set(key, obj.Name)
+			continue
+		}
+
+		def := obj.Fields[sel.Name]
+		fieldPath := append(path[:len(path):len(path)], key)
+		v, err := e.resolve(def, sel, source)
+		if err != nil {
+			e.addError(sel, fieldPath, err.Error())
+			v = nil
+		}
+
+		cv, ok := e.completeValue(def.Type, sel, v, fieldPath, err != nil)
+		if !ok {
+			return nil, false
+		}
+		out.set(key, cv)
+	}
+	return out, true
+}
+
+func (e *executor) resolve(def *FieldDef, sel *Field, source interface{}) (v interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			v, err = nil, fmt.Errorf("internal error resolving %s", sel.Name)
+		}
+	}()
+
+	args, err := coerceArgs(def.Args, sel, e.vars)
+	if err != nil {
+		return nil, err
+	}
+	return def.Resolve(ResolveParams{Context: e.ctx, Source: source, Args: args})
+}
+
+// completeValue shapes a resolved value by the type of its field. It
+// returns false if the value is null because of a non-null field, the null
+// then propagates up to the nearest nullable field or list item. reported
+// tells whether an error has already been recorded for a null value.
+func (e *executor) completeValue(t Type, sel *Field, v interface{}, path []interface{}, reported bool) (interface{}, bool) {
+	cv, ok := e.complete(t, sel, v, path, reported)
+	if _, nonNull := t.(*NonNull); !ok && !nonNull {
+		return nil, true
+	}
+	return cv, ok
+}
+
+func (e *executor) complete(t Type, sel *Field, v interface{}, path []interface{}, reported bool) (interface{}, bool) {
+	if nn, ok := t.(*NonNull); ok {
+		cv, ok := e.completeValue(nn.Of, sel, v, path, reported)
+		if ok && cv == nil {
+			if !reported {
+				e.addError(sel, path, fmt.Sprintf("non-null field %s returned null", sel.Name))
+			}
+			return nil, false
+		}
+		return cv, ok
+	}
+
+	if isNil(v) {
+		return nil, true
+	}
+
+	switch t := t.(type) {
+	case *Object:
+		out, ok := e.executeFields(t, v, sel.Selections, path)
+		if !ok {
+			return nil, false
+		}
+		return out, true
+
+	case *List:
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			e.addError(sel, path, fmt.Sprintf("field %s did not return a list", sel.Name))
+			return nil, true
+		}
+		list := make([]interface{}, rv.Len())
+		for i := range list {
+			cv, ok := e.completeValue(t.Of, sel, rv.Index(i).Interface(), append(path[:len(path):len(path)], i), false)
+			if !ok {
+				return nil, false
+			}
+			list[i] = cv
+		}
+		return list, true
+	}
+	return v, true
+}
+
+func isNil(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// orderedMap is a JSON object that keeps the order of the fields of the
+// query.
+type orderedMap struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func newOrderedMap() *orderedMap {
+	return &orderedMap{values: make(map[string]interface{})}
+}
+
+func (m *orderedMap) set(key string, v interface{}) {
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = v
+}
+
+func (m *orderedMap) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range m.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		buf.Write(k)
+		buf.WriteByte(':')
+		v, err := json.Marshal(m.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,199 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokPunct
+	tokName
+	tokInt
+	tokFloat
+	tokString
+)
+
+type token struct {
+	kind      tokenKind
+	value     string
+	line, col int
+}
+
+// lexer splits a GraphQL document into tokens, skipping white space,
+// commas and comments.
+type lexer struct {
+	src       string
+	pos       int
+	line, col int
+}
+
+func newLexer(src string) *lexer {
+	return &lexer{src: src, line: 1, col: 1}
+}
+
+func (l *lexer) errorf(line, col int, format string, args ...interface{}) error {
+	return &Error{Message: fmt.Sprintf(format, args...), Locations: []Location{{line, col}}}
+}
+
+func (l *lexer) advance(n int) {
+	for i := 0; i < n; i++ {
+		if l.src[l.pos] == '\n' {
+			l.line++
+			l.col = 1
+		} else {
+			l.col++
+		}
+		l.pos++
+	}
+}
+
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',' {
+			l.advance(1)
+			continue
+		}
+		if c == '#' {
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.advance(1)
+			}
+			continue
+		}
+		break
+	}
+
+	tok := token{line: l.line, col: l.col}
+	if l.pos >= len(l.src) {
+		tok.kind = tokEOF
+		return tok, nil
+	}
+
+	c := l.src[l.pos]
+	switch {
+	case strings.HasPrefix(l.src[l.pos:], "..."):
+		tok.kind, tok.value = tokPunct, "..."
+		l.advance(3)
+	case strings.IndexByte("!$():=@[]{}|", c) >= 0:
+		tok.kind, tok.value = tokPunct, string(c)
+		l.advance(1)
+	case c == '_' || isLetter(c):
+		start := l.pos
+		for l.pos < len(l.src) && (l.src[l.pos] == '_' || isLetter(l.src[l.pos]) || isDigit(l.src[l.pos])) {
+			l.advance(1)
+		}
+		tok.kind, tok.value = tokName, l.src[start:l.pos]
+	case c == '-' || isDigit(c):
+		return l.number(tok)
+	case c == '"':
+		return l.string(tok)
+	default:
+		r, _ := utf8.DecodeRuneInString(l.src[l.pos:])
+		return tok, l.errorf(tok.line, tok.col, "unexpected character %q", r)
+	}
+	return tok, nil
+}
+
+func (l *lexer) number(tok token) (token, error) {
+	start := l.pos
+	tok.kind = tokInt
+	if l.src[l.pos] == '-' {
+		l.advance(1)
+	}
+	digits := func() {
+		for l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+			l.advance(1)
+		}
+	}
+	digits()
+	if l.pos < len(l.src) && l.src[l.pos] == '.' {
+		tok.kind = tokFloat
+		l.advance(1)
+		digits()
+	}
+	if l.pos < len(l.src) && (l.src[l.pos] == 'e' || l.src[l.pos] == 'E') {
+		tok.kind = tokFloat
+		l.advance(1)
+		if l.pos < len(l.src) && (l.src[l.pos] == '+' || l.src[l.pos] == '-') {
+			l.advance(1)
+		}
+		digits()
+	}
+
+	tok.value = l.src[start:l.pos]
+	if _, err := strconv.ParseFloat(tok.value, 64); err != nil {
+		return tok, l.errorf(tok.line, tok.col, "invalid number %s", tok.value)
+	}
+	return tok, nil
+}
+
+func (l *lexer) string(tok token) (token, error) {
+	if strings.HasPrefix(l.src[l.pos:], `"""`) {
+		return tok, l.errorf(tok.line, tok.col, "block strings are not supported")
+	}
+
+	tok.kind = tokString
+	l.advance(1)
+	var sb strings.Builder
+	for {
+		if l.pos >= len(l.src) || l.src[l.pos] == '\n' {
+			return tok, l.errorf(tok.line, tok.col, "unterminated string")
+		}
+		c := l.src[l.pos]
+		if c == '"' {
+			l.advance(1)
+			tok.value = sb.String()
+			return tok, nil
+		}
+		if c != '\\' {
+			sb.WriteByte(c)
+			l.advance(1)
+			continue
+		}
+
+		if l.pos+1 >= len(l.src) {
+			return tok, l.errorf(tok.line, tok.col, "unterminated string")
+		}
+		esc := l.src[l.pos+1]
+		switch esc {
+		case '"', '\\', '/':
+			sb.WriteByte(esc)
+		case 'b':
+			sb.WriteByte('\b')
+		case 'f':
+			sb.WriteByte('\f')
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 't':
+			sb.WriteByte('\t')
+		case 'u':
+			if l.pos+6 > len(l.src) {
+				return tok, l.errorf(l.line, l.col, "invalid unicode escape")
+			}
+			r, err := strconv.ParseUint(l.src[l.pos+2:l.pos+6], 16, 32)
+			if err != nil {
+				return tok, l.errorf(l.line, l.col, "invalid unicode escape")
+			}
+			sb.WriteRune(rune(r))
+			l.advance(4)
+		default:
+			return tok, l.errorf(l.line, l.col, "invalid escape \\%c", esc)
+		}
+		l.advance(2)
+	}
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,412 @@
+package graphql
+
+import (
+	"strconv"
+)
+
+// Document is a parsed GraphQL request document. Fragments and directives
+// are not supported.
+type Document struct {
+	Operations []*Operation
+}
+
+type Operation struct {
+	Type       string // query 或 mutation
+	Name       string
+	Variables  []*VariableDefinition
+	Selections []*Field
+}
+
+type VariableDefinition struct {
+	Name    string
+	Type    string      // 如 "Int" 或 "[String!]!"
+	Default interface{} // 默认值，未设置时为nil
+}
+
+// Field is a field of a selection set. Argument values are int64, float64,
+// string, bool, nil, Enum, Variable, []interface{} or
+// map[string]interface{}.
+type Field struct {
+	Alias      string
+	Name       string
+	Arguments  map[string]interface{}
+	Selections []*Field
+	Location   Location
+}
+
+// Variable is a reference to a variable in an argument value.
+type Variable string
+
+// Enum is an enum value in an argument value.
+type Enum string
+
+// ResponseKey returns the key of the field in the response.
+func (f *Field) ResponseKey() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+	return f.Name
+}
+
+// maxNesting is the maximum nesting of the selection sets, list and
+// object values and list types of a document. Deeper documents are refused
+// while parsing, before the recursion exhausts the stack.
+const maxNesting = 64
+
+type parser struct {
+	lex   *lexer
+	tok   token
+	depth int // 当前的嵌套层数
+}
+
+// Parse parses a GraphQL request document.
+func Parse(src string) (*Document, error) {
+	p := &parser{lex: newLexer(src)}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	doc := &Document{}
+	for p.tok.kind != tokEOF {
+		op, err := p.operation()
+		if err != nil {
+			return nil, err
+		}
+		doc.Operations = append(doc.Operations, op)
+	}
+	if len(doc.Operations) == 0 {
+		return nil, &Error{Message: "document has no operation"}
+	}
+	return doc, nil
+}
+
+func (p *parser) advance() error {
+	tok, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return p.lex.errorf(p.tok.line, p.tok.col, format, args...)
+}
+
+func (p *parser) describe() string {
+	switch p.tok.kind {
+	case tokEOF:
+		return "end of document"
+	case tokString:
+		return strconv.Quote(p.tok.value)
+	}
+	return p.tok.value
+}
+
+func (p *parser) peek(punct string) bool {
+	return p.tok.kind == tokPunct && p.tok.value == punct
+}
+
+func (p *parser) expect(punct string) error {
+	if !p.peek(punct) {
+		return p.errorf("expected %s, found %s", punct, p.describe())
+	}
+	return p.advance()
+}
+
+// nest enters a nested selection set, value or type, the caller must call
+// unnest when leaving it.
+func (p *parser) nest() error {
+	p.depth++
+	if p.depth > maxNesting {
+		return p.errorf("document is nested deeper than %d levels", maxNesting)
+	}
+	return nil
+}
+
+func (p *parser) unnest() {
+	p.depth--
+}
+
+func (p *parser) name() (string, error) {
+	if p.tok.kind != tokName {
+		return "", p.errorf("expected name, found %s", p.describe())
+	}
+	name := p.tok.value
+	return name, p.advance()
+}
+
+func (p *parser) operation() (*Operation, error) {
+	op := &Operation{Type: "query"}
+	if p.peek("{") {
+		sels, err := p.selectionSet()
+		op.Selections = sels
+		return op, err
+	}
+
+	if p.tok.kind == tokName && p.tok.value == "fragment" {
+		return nil, p.errorf("fragments are not supported")
+	}
+	if p.tok.kind != tokName || (p.tok.value != "query" && p.tok.value != "mutation") {
+		return nil, p.errorf("expected query or mutation, found %s", p.describe())
+	}
+	op.Type = p.tok.value
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	if p.tok.kind == tokName {
+		op.Name = p.tok.value
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.peek("(") {
+		vars, err := p.variableDefinitions()
+		if err != nil {
+			return nil, err
+		}
+		op.Variables = vars
+	}
+	if p.peek("@") {
+		return nil, p.errorf("directives are not supported")
+	}
+
+	sels, err := p.selectionSet()
+	op.Selections = sels
+	return op, err
+}
+
+func (p *parser) variableDefinitions() ([]*VariableDefinition, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	var vars []*VariableDefinition
+	for !p.peek(")") {
+		if err := p.expect("$"); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expect(":"); err != nil {
+			return nil, err
+		}
+		typ, err := p.typeRef()
+		if err != nil {
+			return nil, err
+		}
+
+		v := &VariableDefinition{Name: name, Type: typ}
+		if p.peek("=") {
+			if err = p.advance(); err != nil {
+				return nil, err
+			}
+			if v.Default, err = p.value(true); err != nil {
+				return nil, err
+			}
+		}
+		vars = append(vars, v)
+	}
+	return vars, p.advance()
+}
+
+func (p *parser) typeRef() (string, error) {
+	var typ string
+	if p.peek("[") {
+		if err := p.nest(); err != nil {
+			return "", err
+		}
+		defer p.unnest()
+		if err := p.advance(); err != nil {
+			return "", err
+		}
+		of, err := p.typeRef()
+		if err != nil {
+			return "", err
+		}
+		if err = p.expect("]"); err != nil {
+			return "", err
+		}
+		typ = "[" + of + "]"
+	} else {
+		name, err := p.name()
+		if err != nil {
+			return "", err
+		}
+		typ = name
+	}
+
+	if p.peek("!") {
+		return typ + "!", p.advance()
+	}
+	return typ, nil
+}
+
+func (p *parser) selectionSet() ([]*Field, error) {
+	if err := p.nest(); err != nil {
+		return nil, err
+	}
+	defer p.unnest()
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+
+	var fields []*Field
+	for !p.peek("}") {
+		if p.peek("...") {
+			return nil, p.errorf("fragments are not supported")
+		}
+		f, err := p.field()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+	}
+	if len(fields) == 0 {
+		return nil, p.errorf("selection set must not be empty")
+	}
+	return fields, p.advance()
+}
+
+func (p *parser) field() (*Field, error) {
+	f := &Field{Location: Location{p.tok.line, p.tok.col}}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek(":") {
+		if err = p.advance(); err != nil {
+			return nil, err
+		}
+		f.Alias = name
+		if name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	f.Name = name
+
+	if p.peek("(") {
+		if err = p.advance(); err != nil {
+			return nil, err
+		}
+		f.Arguments = make(map[string]interface{})
+		for !p.peek(")") {
+			arg, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if _, dup := f.Arguments[arg]; dup {
+				return nil, p.errorf("duplicate argument %s", arg)
+			}
+			if err = p.expect(":"); err != nil {
+				return nil, err
+			}
+			if f.Arguments[arg], err = p.value(false); err != nil {
+				return nil, err
+			}
+		}
+		if err = p.advance(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.peek("@") {
+		return nil, p.errorf("directives are not supported")
+	}
+	if p.peek("{") {
+		if f.Selections, err = p.selectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// value parses an argument value, const values cannot hold variables.
+func (p *parser) value(isConst bool) (interface{}, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokInt:
+		n, err := strconv.ParseInt(tok.value, 10, 64)
+		if err != nil {
+			return nil, p.errorf("invalid integer %s", tok.value)
+		}
+		return n, p.advance()
+	case tokFloat:
+		f, _ := strconv.ParseFloat(tok.value, 64)
+		return f, p.advance()
+	case tokString:
+		return tok.value, p.advance()
+	case tokName:
+		var v interface{}
+		switch tok.value {
+		case "true":
+			v = true
+		case "false":
+			v = false
+		case "null":
+			v = nil
+		default:
+			v = Enum(tok.value)
+		}
+		return v, p.advance()
+	}
+
+	switch {
+	case p.peek("$"):
+		if isConst {
+			return nil, p.errorf("variables are not allowed here")
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		return Variable(name), err
+
+	case p.peek("["):
+		if err := p.nest(); err != nil {
+			return nil, err
+		}
+		defer p.unnest()
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		list := make([]interface{}, 0)
+		for !p.peek("]") {
+			v, err := p.value(isConst)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, p.advance()
+
+	case p.peek("{"):
+		if err := p.nest(); err != nil {
+			return nil, err
+		}
+		defer p.unnest()
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		obj := make(map[string]interface{})
+		for !p.peek("}") {
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err = p.expect(":"); err != nil {
+				return nil, err
+			}
+			if obj[name], err = p.value(isConst); err != nil {
+				return nil, err
+			}
+		}
+		return obj, p.advance()
+	}
+	return nil, p.errorf("unexpected %s", p.describe())
+}
@@ -0,0 +1,91 @@
+package graphql
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	doc, err := Parse(`
+		# 按作者查询
+		query Books($author: String = "Rob \"Commander\" Pike", $first: Int!) {
+			books(author: $author, first: $first, tags: ["go", 1, 2.5, null, {a: true}]) {
+				total: totalCount
+			}
+		}`)
+	if err != nil {
+		t.Fatalf("want nil, actual %s", err.Error())
+	}
+
+	op := doc.Operations[0]
+	if op.Type != "query" || op.Name != "Books" || len(op.Variables) != 2 {
+		t.Fatalf("want query Books with 2 variables, actual %+v", op)
+	}
+	if v := op.Variables[0]; v.Type != "String" || v.Default != `Rob "Commander" Pike` {
+		t.Errorf("want String with default, actual %+v", v)
+	}
+	if v := op.Variables[1]; v.Type != "Int!" || v.Default != nil {
+		t.Errorf("want Int! without default, actual %+v", v)
+	}
+
+	f := op.Selections[0]
+	want := map[string]interface{}{
+		"author": Variable("author"),
+		"first":  Variable("first"),
+		"tags":   []interface{}{"go", int64(1), 2.5, nil, map[string]interface{}{"a": true}},
+	}
+	if !reflect.DeepEqual(f.Arguments, want) {
+		t.Errorf("want %v, actual %v", want, f.Arguments)
+	}
+	if sel := f.Selections[0]; sel.ResponseKey() != "total" || sel.Name != "totalCount" {
+		t.Errorf("want total: totalCount, actual %+v", sel)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src, message string
+		loc          Location
+	}{
+		{`{ book(id: "1") { ...BookFields } }`, "fragments are not supported", Location{1, 19}},
+		{`{ book(id: "1) }`, "unterminated string", Location{1, 12}},
+		{"query {\n  book(id:\n}", "unexpected }", Location{3, 1}},
+		{"{ book", "expected name, found end of document", Location{1, 7}},
+		{`subscription { books }`, "expected query or mutation, found subscription", Location{1, 1}},
+		{`{ }`, "selection set must not be empty", Location{1, 3}},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse(tt.src)
+		gerr, ok := err.(*Error)
+		if !ok {
+			t.Errorf("%s: want *Error, actual %v", tt.src, err)
+			continue
+		}
+		if gerr.Message != tt.message || !reflect.DeepEqual(gerr.Locations, []Location{tt.loc}) {
+			t.Errorf("%s: want %s at %v, actual %s at %v", tt.src, tt.message, tt.loc, gerr.Message, gerr.Locations)
+		}
+	}
+}
+
+func TestParseNesting(t *testing.T) {
+	deep := map[string]string{
+		"list value":    "{ books(filter: " + strings.Repeat("[", 100000) + ") { id } }",
+		"object value":  "{ books(filter: " + strings.Repeat("{a: ", 100000) + ") { id } }",
+		"selection set": strings.Repeat("{ a ", 100000),
+		"list type":     "query ($v: " + strings.Repeat("[", 100000) + ") { id }",
+	}
+	for name, src := range deep {
+		_, err := Parse(src)
+		if gerr, ok := err.(*Error); !ok || !strings.Contains(gerr.Message, "nested deeper") {
+			t.Errorf("%s: want a nesting error, actual %v", name, err)
+		}
+	}
+
+	// 未超过上限的嵌套可以解析
+	src := "{ books(filter: " + strings.Repeat("[", maxNesting-1) + strings.Repeat("]", maxNesting-1) + ") { id } }"
+	if _, err := Parse(src); err != nil {
+		t.Errorf("want nil, actual %v", err)
+	}
+}
@@ -0,0 +1,299 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Type is a GraphQL type: a *Scalar, *Object, *InputObject, *List or
+// *NonNull.
+type Type interface {
+	String() string
+}
+
+// Scalar is a leaf type. Coerce converts an input value, as parsed from a
+// query or decoded from JSON variables, to the Go value given to resolvers.
+type Scalar struct {
+	Name   string
+	Coerce func(v interface{}) (interface{}, bool)
+}
+
+func (s *Scalar) String() string { return s.Name }
+
+// Object is an output type with fields.
+type Object struct {
+	Name   string
+	Fields map[string]*FieldDef
+}
+
+func (o *Object) String() string { return o.Name }
+
+// InputObject is an argument type with fields, coerced to a
+// map[string]interface{}.
+type InputObject struct {
+	Name   string
+	Fields map[string]*ArgumentDef
+}
+
+func (o *InputObject) String() string { return o.Name }
+
+type List struct {
+	Of Type
+}
+
+func (l *List) String() string { return "[" + l.Of.String() + "]" }
+
+type NonNull struct {
+	Of Type
+}
+
+func (n *NonNull) String() string { return n.Of.String() + "!" }
+
+type ArgumentDef struct {
+	Type    Type
+	Default interface{} // 未传入时的值
+}
+
+// ResolveParams are the inputs of a field resolver.
+type ResolveParams struct {
+	Context context.Context
+	Source  interface{}            // 父对象的值
+	Args    map[string]interface{} // 已转换类型的参数
+}
+
+type FieldDef struct {
+	Type    Type
+	Args    map[string]*ArgumentDef
+	Resolve func(p ResolveParams) (interface{}, error)
+	// Complexity returns the cost of the field given its arguments and the
+	// cost of its selection set. Without it the cost is 1 plus the cost of
+	// the selection set, times DefaultListSize for lists.
+	Complexity func(args map[string]interface{}, childComplexity int) int
+}
+
+// DefaultListSize is the number of items assumed for a list field without
+// a Complexity function.
+const DefaultListSize = 10
+
+// Schema is the entry point of queries and mutations.
+type Schema struct {
+	Query    *Object
+	Mutation *Object
+}
+
+var (
+	Int = &Scalar{Name: "Int", Coerce: func(v interface{}) (interface{}, bool) {
+		switch n := v.(type) {
+		case int64:
+			return int(n), n >= math.MinInt32 && n <= math.MaxInt32
+		case float64: // JSON变量中的数字
+			return int(n), n == math.Trunc(n) && n >= math.MinInt32 && n <= math.MaxInt32
+		}
+		return nil, false
+	}}
+	Float = &Scalar{Name: "Float", Coerce: func(v interface{}) (interface{}, bool) {
+		switch n := v.(type) {
+		case int64:
+			return float64(n), true
+		case float64:
+			return n, true
+		}
+		return nil, false
+	}}
+	String = &Scalar{Name: "String", Coerce: func(v interface{}) (interface{}, bool) {
+		s, ok := v.(string)
+		return s, ok
+	}}
+	Boolean = &Scalar{Name: "Boolean", Coerce: func(v interface{}) (interface{}, bool) {
+		b, ok := v.(bool)
+		return b, ok
+	}}
+	ID = &Scalar{Name: "ID", Coerce: func(v interface{}) (interface{}, bool) {
+		switch id := v.(type) {
+		case string:
+			return id, true
+		case int64:
+			return fmt.Sprint(id), true
+		}
+		return nil, false
+	}}
+)
+
+// coerceArgs converts the argument values of f to the types of their
+// definitions, replacing variables by their values.
+func coerceArgs(defs map[string]*ArgumentDef, f *Field, vars map[string]interface{}) (map[string]interface{}, error) {
+	for name := range f.Arguments {
+		if _, ok := defs[name]; !ok {
+			return nil, fmt.Errorf("unknown argument %s on field %s", name, f.Name)
+		}
+	}
+
+	args := make(map[string]interface{}, len(defs))
+	for name, def := range defs {
+		v, ok := f.Arguments[name]
+		if vr, isVar := v.(Variable); ok && isVar {
+			v, ok = vars[string(vr)]
+		}
+		if !ok {
+			if _, nonNull := def.Type.(*NonNull); nonNull && def.Default == nil {
+				return nil, fmt.Errorf("argument %s of field %s is required", name, f.Name)
+			}
+			v = def.Default
+		}
+
+		cv, err := coerce(v, def.Type, vars)
+		if err != nil {
+			return nil, fmt.Errorf("argument %s of field %s: %v", name, f.Name, err)
+		}
+		args[name] = cv
+	}
+	return args, nil
+}
+
+func coerce(v interface{}, t Type, vars map[string]interface{}) (interface{}, error) {
+	if vr, ok := v.(Variable); ok {
+		v = vars[string(vr)]
+	}
+
+	if nn, ok := t.(*NonNull); ok {
+		if v == nil {
+			return nil, fmt.Errorf("must not be null")
+		}
+		return coerce(v, nn.Of, vars)
+	}
+	if v == nil {
+		return nil, nil
+	}
+
+	switch t := t.(type) {
+	case *Scalar:
+		cv, ok := t.Coerce(v)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a valid %s", describeValue(v), t.Name)
+		}
+		return cv, nil
+
+	case *List:
+		list, ok := v.([]interface{})
+		if !ok {
+			list = []interface{}{v} // 单个值视为只有一项的列表
+		}
+		out := make([]interface{}, len(list))
+		for i, item := range list {
+			cv, err := coerce(item, t.Of, vars)
+			if err != nil {
+				return nil, fmt.Errorf("item %d: %v", i, err)
+			}
+			out[i] = cv
+		}
+		return out, nil
+
+	case *InputObject:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s is not a valid %s", describeValue(v), t.Name)
+		}
+		for name := range obj {
+			if _, ok := t.Fields[name]; !ok {
+				return nil, fmt.Errorf("unknown field %s of %s", name, t.Name)
+			}
+		}
+		out := make(map[string]interface{}, len(obj))
+		for name, def := range t.Fields {
+			fv, ok := obj[name]
+			if !ok {
+				if _, nonNull := def.Type.(*NonNull); nonNull && def.Default == nil {
+					return nil, fmt.Errorf("field %s of %s is required", name, t.Name)
+				}
+				if def.Default == nil {
+					continue
+				}
+				fv = def.Default
+			}
+			cv, err := coerce(fv, def.Type, vars)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %v", name, err)
+			}
+			out[name] = cv
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("%s is not an input type", t)
+}
+
+func describeValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return fmt.Sprintf("%q", v)
+	case Enum:
+		return string(v)
+	case []interface{}:
+		return "list"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprint(v)
+}
+
+// parseTypeRef resolves a variable type such as "[String!]!" with the
+// input types of the schema.
+func (s *Schema) parseTypeRef(ref string) (Type, error) {
+	if strings.HasSuffix(ref, "!") {
+		of, err := s.parseTypeRef(strings.TrimSuffix(ref, "!"))
+		if err != nil {
+			return nil, err
+		}
+		return &NonNull{Of: of}, nil
+	}
+	if strings.HasPrefix(ref, "[") && strings.HasSuffix(ref, "]") {
+		of, err := s.parseTypeRef(ref[1 : len(ref)-1])
+		if err != nil {
+			return nil, err
+		}
+		return &List{Of: of}, nil
+	}
+
+	for _, t := range []*Scalar{Int, Float, String, Boolean, ID} {
+		if t.Name == ref {
+			return t, nil
+		}
+	}
+	if t := s.inputObject(ref); t != nil {
+		return t, nil
+	}
+	return nil, fmt.Errorf("unknown type %s", ref)
+}
+
+// inputObject finds the input object type with the given name among the
+// arguments of the root fields.
+func (s *Schema) inputObject(name string) *InputObject {
+	for _, root := range []*Object{s.Query, s.Mutation} {
+		if root == nil {
+			continue
+		}
+		for _, f := range root.Fields {
+			for _, arg := range f.Args {
+				if io := findInputObject(arg.Type, name); io != nil {
+					return io
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func findInputObject(t Type, name string) *InputObject {
+	switch t := t.(type) {
+	case *NonNull:
+		return findInputObject(t.Of, name)
+	case *List:
+		return findInputObject(t.Of, name)
+	case *InputObject:
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
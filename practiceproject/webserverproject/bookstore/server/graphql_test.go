@@ -0,0 +1,164 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	memstore "github.com/Kate-liu/GoBeginner/webserverproject/bookstore/internal/store"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func newGraphQLStore() *memstore.MemStore {
+	s := memstore.NewMemStore()
+	s.CreateAuthor(&store.Author{Id: "a1", Name: "Rob Pike"})
+	s.CreateAuthor(&store.Author{Id: "a2", Name: "Brian Kernighan"})
+	s.CreatePress(&store.Press{Id: "p1", Name: "Addison-Wesley"})
+	s.Create(&store.Book{Id: "1", Name: "The Go Programming Language", Authors: []string{"Alan Donovan", "Brian Kernighan"}, AuthorIds: []string{"a2"}, PressId: "p1"})
+	s.Create(&store.Book{Id: "2", Name: "The Practice of Programming", Authors: []string{"Brian Kernighan", "Rob Pike"}, AuthorIds: []string{"a1", "a2"}})
+	s.Create(&store.Book{Id: "3", Name: "The Unix Programming Environment", Authors: []string{"Brian Kernighan", "Rob Pike"}, AuthorIds: []string{"a1", "a2"}})
+	return s
+}
+
+func doGraphQL(t *testing.T, bs *BookStoreServer, query string, vars map[string]interface{}) (string, []string) {
+	body, _ := json.Marshal(map[string]interface{}{"query": query, "variables": vars})
+	rr := do(bs, "POST", "/graphql", string(body))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("want %d, actual %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	var resp struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	var errs []string
+	for _, e := range resp.Errors {
+		errs = append(errs, e.Message)
+	}
+	return string(resp.Data), errs
+}
+
+func TestGraphQLQuery(t *testing.T) {
+	bs := newTestServer(newGraphQLStore())
+
+	data, errs := doGraphQL(t, bs, `{ book(id: "1") { name pressDetails { name } } missing: book(id: "9") { id } }`, nil)
+	want := `{"book":{"name":"The Go Programming Language","pressDetails":{"name":"Addison-Wesley"}},"missing":null}`
+	if data != want || errs != nil {
+		t.Errorf("want %s, actual %s %v", want, data, errs)
+	}
+
+	query := `query Page($author: String, $after: String) {
+		books(author: $author, first: 2, after: $after) {
+			totalCount hasNextPage endCursor
+			items { id authorDetails { name } }
+		}
+	}`
+	data, errs = doGraphQL(t, bs, query, map[string]interface{}{"author": "rob pike"})
+	var page struct {
+		Books struct {
+			TotalCount  int
+			HasNextPage bool
+			EndCursor   string
+			Items       []struct{ Id string }
+		}
+	}
+	json.Unmarshal([]byte(data), &page)
+	if errs != nil || page.Books.TotalCount != 2 || page.Books.HasNextPage || len(page.Books.Items) != 2 || page.Books.Items[0].Id != "2" {
+		t.Errorf("want books 2 and 3 on one page, actual %s %v", data, errs)
+	}
+
+	data, errs = doGraphQL(t, bs, query, map[string]interface{}{"author": "a2"})
+	json.Unmarshal([]byte(data), &page)
+	if !page.Books.HasNextPage || len(page.Books.Items) != 2 {
+		t.Fatalf("want a first page of 2 books, actual %s %v", data, errs)
+	}
+	data, _ = doGraphQL(t, bs, query, map[string]interface{}{"author": "a2", "after": page.Books.EndCursor})
+	json.Unmarshal([]byte(data), &page)
+	if page.Books.HasNextPage || len(page.Books.Items) != 1 || page.Books.Items[0].Id != "3" {
+		t.Errorf("want book 3 on the last page, actual %s", data)
+	}
+
+	_, errs = doGraphQL(t, bs, `{ book(id: "1") { title } }`, nil)
+	if len(errs) != 1 || errs[0] != "cannot query field title on type Book" {
+		t.Errorf("want unknown field error, actual %v", errs)
+	}
+}
+
+func TestGraphQLMutation(t *testing.T) {
+	s := newGraphQLStore()
+	bs := newTestServer(s)
+
+	data, errs := doGraphQL(t, bs, `mutation { createBook(input: {id: "4", name: "Go in Action", pressId: "p1"}) { id name } }`, nil)
+	if want := `{"createBook":{"id":"4","name":"Go in Action"}}`; data != want || errs != nil {
+		t.Errorf("want %s, actual %s %v", want, data, errs)
+	}
+
+	data, errs = doGraphQL(t, bs, `mutation($in: BookInput!) { updateBook(id: "4", input: $in) { name press } }`,
+		map[string]interface{}{"in": map[string]interface{}{"press": "Manning"}})
+	if want := `{"updateBook":{"name":"Go in Action","press":"Manning"}}`; data != want || errs != nil {
+		t.Errorf("want %s, actual %s %v", want, data, errs)
+	}
+
+	data, errs = doGraphQL(t, bs, `mutation { a: deleteBook(id: "4") b: deleteBook(id: "4") }`, nil)
+	if data != `null` || len(errs) != 1 || errs[0] != store.ErrNotFound.Error() {
+		t.Errorf("want null data and one error, actual %s %v", data, errs)
+	}
+	if _, err := s.Get("4"); err != store.ErrNotFound {
+		t.Errorf("want %v, actual %v", store.ErrNotFound, err)
+	}
+
+	rr := do(bs, "GET", "/graphql?query="+url.QueryEscape(`mutation { deleteBook(id: "1") }`), "")
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("want %d, actual %d", http.StatusMethodNotAllowed, rr.Code)
+	}
+	rr = do(bs, "GET", "/graphql?query="+url.QueryEscape(`{ book(id: "1") { id } }`), "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"id":"1"`) {
+		t.Errorf("want book 1, actual %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestGraphQLLimits(t *testing.T) {
+	bs := newTestServer(newGraphQLStore(), WithGraphQLLimits(4, 200))
+
+	// book -> authorDetails -> books -> authorDetails -> books -> id，共6层字段
+	deep := `{ book(id: "1") { authorDetails { books { authorDetails { books { id } } } } } }`
+	_, errs := doGraphQL(t, bs, deep, nil)
+	if len(errs) != 1 || errs[0] != "query depth 6 exceeds the limit of 4" {
+		t.Errorf("want depth error, actual %v", errs)
+	}
+
+	// 1 + 100 * (1 + (1 + 1)) = 301
+	wide := `{ books(first: 100) { items { id name } } }`
+	_, errs = doGraphQL(t, bs, wide, nil)
+	if len(errs) != 1 || errs[0] != fmt.Sprintf("query complexity %d exceeds the limit of %d", 301, 200) {
+		t.Errorf("want complexity error, actual %v", errs)
+	}
+
+	data, errs := doGraphQL(t, bs, `{ books(first: 10) { items { id name } } }`, nil)
+	if errs != nil || !strings.Contains(data, `"id":"3"`) {
+		t.Errorf("want books, actual %s %v", data, errs)
+	}
+}
+
+func TestGraphQLLargeRequests(t *testing.T) {
+	bs := newTestServer(newGraphQLStore())
+
+	// 请求体超过上限时不再解析
+	body, _ := json.Marshal(map[string]string{"query": `{ books { totalCount } }` + strings.Repeat(" ", graphQLMaxBytes)})
+	if rr := do(bs, "POST", "/graphql", string(body)); rr.Code != http.StatusBadRequest {
+		t.Errorf("want %d, actual %d", http.StatusBadRequest, rr.Code)
+	}
+
+	// 嵌套过深的查询返回错误，而不是耗尽栈空间
+	_, errs := doGraphQL(t, bs, "{ books(filter: "+strings.Repeat("[", 100000)+") { id } }", nil)
+	if len(errs) != 1 || !strings.Contains(errs[0], "nested deeper") {
+		t.Errorf("want nesting error, actual %v", errs)
+	}
+}
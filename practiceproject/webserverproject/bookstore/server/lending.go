@@ -0,0 +1,291 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+// lending returns the lending store of the server, or writes a 501 if the
+// provider does not support lending or WithoutLending turned it off.
+func (bs *BookStoreServer) lending(w http.ResponseWriter) (store.LendingStore, bool) {
+	if bs.noLending {
+		http.Error(w, "lending is turned off", http.StatusNotImplemented)
+		return nil, false
+	}
+	if ls, ok := findLending(bs.s); ok {
+		return ls, true
+	}
+	http.Error(w, "store does not support lending", http.StatusNotImplemented)
+	return nil, false
+}
+
+// findLending returns s, or the first store it wraps, as a
+// store.LendingStore.
+func findLending(s store.Store) (store.LendingStore, bool) {
+	for ; s != nil; s = store.Unwrap(s) {
+		if ls, ok := s.(store.LendingStore); ok {
+			return ls, true
+		}
+	}
+	return nil, false
+}
+
+type inventoryRequest struct {
+	Total int `json:"total"`
+}
+
+type loanRequest struct {
+	BookId   string `json:"book_id"`
+	MemberId string `json:"member_id"`
+}
+
+type reservationRequest struct {
+	MemberId string `json:"member_id"`
+}
+
+func (bs *BookStoreServer) setInventoryHandler(w http.ResponseWriter, req *http.Request) {
+	ls, ok := bs.lending(w)
+	if !ok {
+		return
+	}
+
+	dec := json.NewDecoder(req.Body)
+	var ireq inventoryRequest
+	if err := dec.Decode(&ireq); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	inv, err := ls.SetInventory(mux.Vars(req)["id"], ireq.Total)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	response(w, inv)
+}
+
+func (bs *BookStoreServer) getInventoryHandler(w http.ResponseWriter, req *http.Request) {
+	ls, ok := bs.lending(w)
+	if !ok {
+		return
+	}
+
+	inv, err := ls.GetInventory(mux.Vars(req)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	response(w, inv)
+}
+
+func (bs *BookStoreServer) createMemberHandler(w http.ResponseWriter, req *http.Request) {
+	ls, ok := bs.lending(w)
+	if !ok {
+		return
+	}
+
+	dec := json.NewDecoder(req.Body)
+	var member store.Member
+	if err := dec.Decode(&member); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if member.Id == "" {
+		member.Id = newId()
+	}
+	if err := ls.CreateMember(&member); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	response(w, member)
+}
+
+func (bs *BookStoreServer) getMemberHandler(w http.ResponseWriter, req *http.Request) {
+	ls, ok := bs.lending(w)
+	if !ok {
+		return
+	}
+
+	member, err := ls.GetMember(mux.Vars(req)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	response(w, member)
+}
+
+func (bs *BookStoreServer) getAllMembersHandler(w http.ResponseWriter, req *http.Request) {
+	ls, ok := bs.lending(w)
+	if !ok {
+		return
+	}
+
+	members, err := ls.GetAllMembers()
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	response(w, members)
+}
+
+func (bs *BookStoreServer) delMemberHandler(w http.ResponseWriter, req *http.Request) {
+	ls, ok := bs.lending(w)
+	if !ok {
+		return
+	}
+
+	if err := ls.DeleteMember(mux.Vars(req)["id"]); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+}
+
+func (bs *BookStoreServer) getMemberLoansHandler(w http.ResponseWriter, req *http.Request) {
+	ls, ok := bs.lending(w)
+	if !ok {
+		return
+	}
+
+	loans, err := ls.GetMemberLoans(mux.Vars(req)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	response(w, loans)
+}
+
+func (bs *BookStoreServer) borrowHandler(w http.ResponseWriter, req *http.Request) {
+	ls, ok := bs.lending(w)
+	if !ok {
+		return
+	}
+
+	dec := json.NewDecoder(req.Body)
+	var lreq loanRequest
+	if err := dec.Decode(&lreq); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	loan, err := ls.Borrow(lreq.BookId, lreq.MemberId)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	response(w, loan)
+}
+
+func (bs *BookStoreServer) renewHandler(w http.ResponseWriter, req *http.Request) {
+	ls, ok := bs.lending(w)
+	if !ok {
+		return
+	}
+
+	loan, err := ls.Renew(mux.Vars(req)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	response(w, loan)
+}
+
+func (bs *BookStoreServer) returnHandler(w http.ResponseWriter, req *http.Request) {
+	ls, ok := bs.lending(w)
+	if !ok {
+		return
+	}
+
+	loan, err := ls.Return(mux.Vars(req)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	response(w, loan)
+}
+
+func (bs *BookStoreServer) getLoanHandler(w http.ResponseWriter, req *http.Request) {
+	ls, ok := bs.lending(w)
+	if !ok {
+		return
+	}
+
+	loan, err := ls.GetLoan(mux.Vars(req)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	response(w, loan)
+}
+
+// getAllLoansHandler lists all loans, or only the overdue ones when the
+// request has the query "overdue=true".
+func (bs *BookStoreServer) getAllLoansHandler(w http.ResponseWriter, req *http.Request) {
+	ls, ok := bs.lending(w)
+	if !ok {
+		return
+	}
+
+	var loans []store.Loan
+	var err error
+	if req.URL.Query().Get("overdue") == "true" {
+		loans, err = ls.GetOverdueLoans()
+	} else {
+		loans, err = ls.GetAllLoans()
+	}
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	response(w, loans)
+}
+
+func (bs *BookStoreServer) reserveHandler(w http.ResponseWriter, req *http.Request) {
+	ls, ok := bs.lending(w)
+	if !ok {
+		return
+	}
+
+	dec := json.NewDecoder(req.Body)
+	var rreq reservationRequest
+	if err := dec.Decode(&rreq); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	r, err := ls.Reserve(mux.Vars(req)["id"], rreq.MemberId)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	response(w, r)
+}
+
+func (bs *BookStoreServer) getReservationsHandler(w http.ResponseWriter, req *http.Request) {
+	ls, ok := bs.lending(w)
+	if !ok {
+		return
+	}
+
+	queue, err := ls.GetReservations(mux.Vars(req)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	response(w, queue)
+}
+
+func (bs *BookStoreServer) cancelReservationHandler(w http.ResponseWriter, req *http.Request) {
+	ls, ok := bs.lending(w)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(req)
+	if err := ls.CancelReservation(vars["id"], vars["member"]); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+}
@@ -0,0 +1,35 @@
+package middleware
+
+import "net/http"
+
+// Middleware wraps a handler with extra behavior.
+type Middleware func(http.Handler) http.Handler
+
+// Chain is an ordered list of middlewares, the first one is the outermost:
+// it sees the request first and the response last.
+type Chain []Middleware
+
+func NewChain(mws ...Middleware) Chain {
+	return Chain(nil).Append(mws...)
+}
+
+// Append returns a new chain with mws added after the middlewares of c,
+// nil middlewares are skipped.
+func (c Chain) Append(mws ...Middleware) Chain {
+	nc := make(Chain, 0, len(c)+len(mws))
+	nc = append(nc, c...)
+	for _, mw := range mws {
+		if mw != nil {
+			nc = append(nc, mw)
+		}
+	}
+	return nc
+}
+
+// Then returns h wrapped by the middlewares of c.
+func (c Chain) Then(h http.Handler) http.Handler {
+	for i := len(c) - 1; i >= 0; i-- {
+		h = c[i](h)
+	}
+	return h
+}
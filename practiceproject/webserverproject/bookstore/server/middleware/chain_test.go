@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChainOrder(t *testing.T) {
+	var order []string
+	mw := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, req)
+			})
+		}
+	}
+
+	h := NewChain(mw("a"), nil, mw("b")).Append(mw("c")).Then(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			order = append(order, "handler")
+		}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if got := strings.Join(order, ","); got != "a,b,c,handler" {
+		t.Errorf("want a,b,c,handler, actual %s", got)
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	h := Recovery(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("X-Partial", "1")
+		panic("boom")
+	}))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/book/1", nil))
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("want %d, actual %d", http.StatusInternalServerError, rr.Code)
+	}
+
+	started := Recovery(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("partial"))
+		panic("boom")
+	}))
+	defer func() {
+		if r := recover(); r != http.ErrAbortHandler {
+			t.Errorf("want %v, actual %v", http.ErrAbortHandler, r)
+		}
+	}()
+	started.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/book/1", nil))
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	opts := DefaultSecurityOptions
+	opts.FrameOptions = ""
+	opts.HSTSMaxAge = 24 * time.Hour
+	h := SecurityHeaders(opts)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	want := map[string]string{
+		"X-Content-Type-Options":    "nosniff",
+		"X-Frame-Options":           "",
+		"Strict-Transport-Security": "max-age=86400",
+	}
+	for k, v := range want {
+		if got := rr.Header().Get(k); got != v {
+			t.Errorf("%s: want %q, actual %q", k, v, got)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/gzip"
+	"github.com/andybalholm/brotli"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	EncodingGzip   = "gzip"
+	EncodingBrotli = "br"
+
+	defaultCompressMinSize = 1024
+)
+
+// CompressOptions configures Compress.
+type CompressOptions struct {
+	MinSize   int      // 小于该字节数的响应不压缩，0时使用1024
+	Encodings []string // 支持的编码，按优先级排列，为空时为br与gzip
+	Level     int      // 压缩级别，0时使用各编码的默认级别
+}
+
+// compressibleTypes are the media types worth compressing, images such as
+// book covers are already compressed.
+var compressibleTypes = []string{
+	"application/json", "application/javascript", "application/xml",
+	"application/graphql-response+json", "image/svg+xml",
+}
+
+// Compress compresses the responses of next with the preferred encoding
+// accepted by the client, once they reach MinSize bytes. Responses which
+// are already encoded, partial, or not of a compressible type are sent as
+// they are.
+func Compress(opts CompressOptions) Middleware {
+	if opts.MinSize <= 0 {
+		opts.MinSize = defaultCompressMinSize
+	}
+	if len(opts.Encodings) == 0 {
+		opts.Encodings = []string{EncodingBrotli, EncodingGzip}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			encoding := negotiateEncoding(req.Header.Get("Accept-Encoding"), opts.Encodings)
+			if encoding == "" || req.Method == http.MethodHead {
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, opts: &opts, encoding: encoding}
+			defer cw.Close()
+			next.ServeHTTP(cw, req)
+		})
+	}
+}
+
+// negotiateEncoding returns the first of supported accepted with a non-zero
+// quality by the Accept-Encoding header, or "" for the identity encoding.
+func negotiateEncoding(header string, supported []string) string {
+	accepted := make(map[string]bool)
+	wildcard := false
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if name == "*" {
+			wildcard = q > 0
+			continue
+		}
+		accepted[name] = q > 0
+	}
+
+	for _, enc := range supported {
+		ok, listed := accepted[enc]
+		if ok || (!listed && wildcard) {
+			return enc
+		}
+	}
+	return ""
+}
+
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+	for _, t := range compressibleTypes {
+		if mediaType == t {
+			return true
+		}
+	}
+	return false
+}
+
+// compressWriter buffers the start of a response until it knows whether
+// to compress it.
+type compressWriter struct {
+	http.ResponseWriter
+	opts     *CompressOptions
+	encoding string
+
+	statusCode int
+	buf        []byte
+	decided    bool
+	enc        io.WriteCloser // nil表示不压缩
+}
+
+func (cw *compressWriter) WriteHeader(statusCode int) {
+	if cw.decided || cw.statusCode != 0 {
+		return
+	}
+	if statusCode >= 100 && statusCode < 200 {
+		cw.ResponseWriter.WriteHeader(statusCode) // 信息响应直接发送
+		return
+	}
+	cw.statusCode = statusCode
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.statusCode == 0 {
+		cw.statusCode = http.StatusOK
+	}
+	if cw.decided {
+		return cw.write(b)
+	}
+
+	cw.buf = append(cw.buf, b...)
+	if len(cw.buf) >= cw.opts.MinSize {
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+func (cw *compressWriter) write(b []byte) (int, error) {
+	if cw.enc != nil {
+		return cw.enc.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// decide starts the response, compressed if it is large enough and worth
+// compressing, and writes the buffered bytes.
+func (cw *compressWriter) decide(large bool) error {
+	cw.decided = true
+	h := cw.Header()
+	if h.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+
+	if large && cw.statusCode == http.StatusOK && h.Get("Content-Encoding") == "" &&
+		h.Get("Content-Range") == "" && compressible(h.Get("Content-Type")) {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", cw.encoding)
+		cw.enc = newEncoder(cw.encoding, cw.ResponseWriter, cw.opts.Level)
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.statusCode)
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := cw.write(buf)
+	return err
+}
+
+func newEncoder(encoding string, w io.Writer, level int) io.WriteCloser {
+	if encoding == EncodingBrotli {
+		if level == 0 {
+			level = brotli.DefaultCompression
+		}
+		return brotli.NewWriterLevel(w, level)
+	}
+
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	zw, err := gzip.NewWriterLevel(w, level)
+	if err != nil {
+		zw = gzip.NewWriter(w)
+	}
+	return zw
+}
+
+// Close ends the response, sending what is still buffered.
+func (cw *compressWriter) Close() error {
+	if !cw.decided {
+		if cw.statusCode == 0 {
+			return nil // 处理器未写响应，由net/http发送200
+		}
+		if err := cw.decide(false); err != nil {
+			return err
+		}
+	}
+	if cw.enc != nil {
+		return cw.enc.Close()
+	}
+	return nil
+}
+
+// Flush implements http.Flusher, it sends the buffered bytes even if the
+// response is smaller than MinSize.
+func (cw *compressWriter) Flush() {
+	if !cw.decided && cw.statusCode != 0 {
+		cw.decide(len(cw.buf) >= cw.opts.MinSize)
+	}
+	if f, ok := cw.enc.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker for the protocols upgrading a
+// connection.
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	return hj.Hijack()
+}
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"github.com/andybalholm/brotli"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	supported := []string{EncodingBrotli, EncodingGzip}
+	cases := map[string]string{
+		"":                    "",
+		"gzip":                "gzip",
+		"gzip, br":            "br",
+		"br;q=0, gzip;q=0.5":  "gzip",
+		"*":                   "br",
+		"*, br;q=0":           "gzip",
+		"identity, deflate":   "",
+		"GZIP;q=1.0, br;q=0 ": "gzip",
+	}
+	for header, want := range cases {
+		if got := negotiateEncoding(header, supported); got != want {
+			t.Errorf("%q: want %q, actual %q", header, want, got)
+		}
+	}
+}
+
+func TestCompress(t *testing.T) {
+	large := `{"name":"` + strings.Repeat("a", 2000) + `"}`
+	h := Compress(CompressOptions{MinSize: 1024})(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body := large
+		switch req.URL.Path {
+		case "/small":
+			body = `{"name":"a"}`
+		case "/cover":
+			w.Header().Set("Content-Type", "image/png")
+		case "/error":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+		}
+		// 分多次写入，跨过阈值
+		io.WriteString(w, body[:len(body)/2])
+		io.WriteString(w, body[len(body)/2:])
+	}))
+
+	do := func(path, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	readers := map[string]func(io.Reader) (io.Reader, error){
+		"gzip": func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"br":   func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+	}
+	for enc, newReader := range readers {
+		rr := do("/book", enc)
+		if got := rr.Header().Get("Content-Encoding"); got != enc {
+			t.Fatalf("want %s, actual %q", enc, got)
+		}
+		if rr.Body.Len() >= len(large) {
+			t.Errorf("%s: want a compressed body, actual %d bytes", enc, rr.Body.Len())
+		}
+		r, err := newReader(rr.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(r)
+		if err != nil || string(body) != large {
+			t.Errorf("%s: want the original body, actual %d bytes, %v", enc, len(body), err)
+		}
+		if rr.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("want Vary: Accept-Encoding, actual %q", rr.Header().Get("Vary"))
+		}
+	}
+
+	for _, path := range []string{"/small", "/cover", "/error"} {
+		rr := do(path, "gzip, br")
+		if got := rr.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("%s: want no encoding, actual %q", path, got)
+		}
+	}
+	if rr := do("/error", "gzip"); rr.Code != http.StatusNotFound || rr.Body.Len() != len(large) {
+		t.Errorf("want the uncompressed 404, actual %d, %d bytes", rr.Code, rr.Body.Len())
+	}
+	if rr := do("/book", ""); rr.Header().Get("Content-Encoding") != "" || rr.Body.String() != large {
+		t.Error("want the identity encoding without Accept-Encoding")
+	}
+}
@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSOptions configures the cross-origin requests allowed by CORS.
+type CORSOptions struct {
+	AllowedOrigins   []string      // 允许的来源，如https://example.com，"*"表示任意来源
+	AllowedMethods   []string      // 预检请求允许的方法，为空时使用DefaultCORSMethods
+	AllowedHeaders   []string      // 预检请求允许的请求头，为空时使用DefaultCORSHeaders
+	ExposedHeaders   []string      // 浏览器可读取的响应头
+	AllowCredentials bool          // 是否允许携带凭据
+	MaxAge           time.Duration // 预检结果的缓存时间，0表示不缓存
+}
+
+var (
+	DefaultCORSMethods = []string{"GET", "POST", "PUT", "DELETE"}
+	DefaultCORSHeaders = []string{"Content-Type", "Authorization", IdempotencyKeyHeader, "X-Tenant"}
+)
+
+// CORS adds the CORS headers to the responses to allowed origins and
+// answers their preflight requests with a 204. Requests from other origins
+// get no CORS headers, so browsers block them.
+func CORS(opts CORSOptions) Middleware {
+	if len(opts.AllowedMethods) == 0 {
+		opts.AllowedMethods = DefaultCORSMethods
+	}
+	if len(opts.AllowedHeaders) == 0 {
+		opts.AllowedHeaders = DefaultCORSHeaders
+	}
+	methods := strings.Join(opts.AllowedMethods, ", ")
+	headers := strings.Join(opts.AllowedHeaders, ", ")
+	exposed := strings.Join(opts.ExposedHeaders, ", ")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			origin := req.Header.Get("Origin")
+			h := w.Header()
+			h.Add("Vary", "Origin")
+			preflight := req.Method == http.MethodOptions && req.Header.Get("Access-Control-Request-Method") != ""
+			if origin == "" || !opts.allowOrigin(origin) {
+				if preflight {
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			if opts.AllowCredentials || !opts.anyOrigin() {
+				h.Set("Access-Control-Allow-Origin", origin)
+			} else {
+				h.Set("Access-Control-Allow-Origin", "*")
+			}
+			if opts.AllowCredentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if !preflight {
+				if exposed != "" {
+					h.Set("Access-Control-Expose-Headers", exposed)
+				}
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+			if !containsFold(opts.AllowedMethods, req.Header.Get("Access-Control-Request-Method")) {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			h.Set("Access-Control-Allow-Methods", methods)
+			h.Set("Access-Control-Allow-Headers", headers)
+			if opts.MaxAge > 0 {
+				h.Set("Access-Control-Max-Age", strconv.Itoa(int(opts.MaxAge.Seconds())))
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+func (opts *CORSOptions) anyOrigin() bool {
+	for _, o := range opts.AllowedOrigins {
+		if o == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func (opts *CORSOptions) allowOrigin(origin string) bool {
+	return opts.anyOrigin() || containsFold(opts.AllowedOrigins, origin)
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
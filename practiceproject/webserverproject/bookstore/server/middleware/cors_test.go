@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	var called bool
+	h := CORS(CORSOptions{
+		AllowedOrigins: []string{"https://shop.example.com"},
+		ExposedHeaders: []string{IdempotentReplayedHeader},
+		MaxAge:         10 * time.Minute,
+	})(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		called = true
+	}))
+
+	do := func(method, origin, reqMethod string) *httptest.ResponseRecorder {
+		called = false
+		req := httptest.NewRequest(method, "/book", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if reqMethod != "" {
+			req.Header.Set("Access-Control-Request-Method", reqMethod)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := do("OPTIONS", "https://shop.example.com", "DELETE")
+	if rr.Code != http.StatusNoContent || called {
+		t.Errorf("want %d without calling the handler, actual %d, %v", http.StatusNoContent, rr.Code, called)
+	}
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "https://shop.example.com" {
+		t.Errorf("want the origin, actual %q", got)
+	}
+	if got := rr.Header().Get("Access-Control-Allow-Methods"); got != "GET, POST, PUT, DELETE" {
+		t.Errorf("want the default methods, actual %q", got)
+	}
+	if got := rr.Header().Get("Access-Control-Max-Age"); got != "600" {
+		t.Errorf("want 600, actual %q", got)
+	}
+
+	rr = do("OPTIONS", "https://shop.example.com", "PATCH")
+	if got := rr.Header().Get("Access-Control-Allow-Methods"); got != "" {
+		t.Errorf("want no allowed methods, actual %q", got)
+	}
+
+	rr = do("OPTIONS", "https://evil.example.com", "GET")
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "" || called {
+		t.Errorf("want no CORS headers, actual %q", got)
+	}
+
+	rr = do("GET", "https://shop.example.com", "")
+	if !called || rr.Header().Get("Access-Control-Expose-Headers") != IdempotentReplayedHeader {
+		t.Errorf("want the handler called with exposed headers, actual %v, %v", called, rr.Header())
+	}
+	if rr = do("GET", "", ""); !called || rr.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("want a plain response without origin, actual %v", rr.Header())
+	}
+}
+
+func TestCORSAnyOrigin(t *testing.T) {
+	h := CORS(CORSOptions{AllowedOrigins: []string{"*"}})(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	req := httptest.NewRequest("GET", "/book", nil)
+	req.Header.Set("Origin", "https://any.example.com")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("want *, actual %q", got)
+	}
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// SecurityOptions are the security headers added by SecurityHeaders, empty
+// values are left out.
+type SecurityOptions struct {
+	ContentTypeOptions    string        // X-Content-Type-Options
+	FrameOptions          string        // X-Frame-Options
+	ReferrerPolicy        string        // Referrer-Policy
+	ContentSecurityPolicy string        // Content-Security-Policy
+	HSTSMaxAge            time.Duration // Strict-Transport-Security的max-age，0表示不发送
+	HSTSIncludeSubdomains bool
+}
+
+// DefaultSecurityOptions suit a JSON API that is never rendered in a
+// frame and does not load any resource.
+var DefaultSecurityOptions = SecurityOptions{
+	ContentTypeOptions:    "nosniff",
+	FrameOptions:          "DENY",
+	ReferrerPolicy:        "no-referrer",
+	ContentSecurityPolicy: "default-src 'none'; frame-ancestors 'none'",
+}
+
+// SecurityHeaders adds the headers of opts to every response. Handlers may
+// still override them.
+func SecurityHeaders(opts SecurityOptions) Middleware {
+	headers := make(http.Header)
+	set := func(key, value string) {
+		if value != "" {
+			headers.Set(key, value)
+		}
+	}
+	set("X-Content-Type-Options", opts.ContentTypeOptions)
+	set("X-Frame-Options", opts.FrameOptions)
+	set("Referrer-Policy", opts.ReferrerPolicy)
+	set("Content-Security-Policy", opts.ContentSecurityPolicy)
+	if opts.HSTSMaxAge > 0 {
+		hsts := "max-age=" + strconv.Itoa(int(opts.HSTSMaxAge.Seconds()))
+		if opts.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		set("Strict-Transport-Security", hsts)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			for k, v := range headers {
+				w.Header()[k] = append([]string(nil), v...)
+			}
+			next.ServeHTTP(w, req)
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store/idempotency"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotentReplayedHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLen      = 255
+	maxIdempotentRequestBytes = 1 << 20
+)
+
+// Idempotency replays the stored response for POST requests that carry an
+// Idempotency-Key header which has been seen within ttl. A retry that reuses
+// the key with a different request gets a 422.
+func Idempotency(ks idempotency.KeyStore, ttl time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			key := req.Header.Get(IdempotencyKeyHeader)
+			if req.Method != http.MethodPost || key == "" {
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			if len(key) > maxIdempotencyKeyLen {
+				http.Error(w, "Idempotency-Key too long", http.StatusBadRequest)
+				return
+			}
+
+			body, err := ioutil.ReadAll(io.LimitReader(req.Body, maxIdempotentRequestBytes+1))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if len(body) > maxIdempotentRequestBytes {
+				http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			fp := fingerprint(req, body)
+			rec, err := ks.Reserve(key, fp, ttl)
+			switch err {
+			case nil:
+			case idempotency.ErrMismatch:
+				http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+				return
+			case idempotency.ErrInProgress:
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			case idempotency.ErrFull:
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			if rec != nil { // 重放首次请求的响应
+				for k, v := range rec.Header {
+					w.Header()[k] = v
+				}
+				w.Header().Set(IdempotentReplayedHeader, "true")
+				w.WriteHeader(rec.StatusCode)
+				w.Write(rec.Body)
+				return
+			}
+
+			rw := &recordingWriter{ResponseWriter: w, statusCode: http.StatusOK}
+			defer func() {
+				// next panic时释放key，否则重试在ttl内都会得到409
+				if r := recover(); r != nil {
+					ks.Release(key)
+					panic(r)
+				}
+			}()
+			next.ServeHTTP(rw, req)
+
+			// 服务端错误不做缓存，允许客户端重试
+			if rw.statusCode >= http.StatusInternalServerError {
+				ks.Release(key)
+				return
+			}
+			ks.Save(key, &idempotency.Record{
+				Fingerprint: fp,
+				StatusCode:  rw.statusCode,
+				Header:      w.Header().Clone(),
+				Body:        rw.body.Bytes(),
+				ExpiresAt:   time.Now().Add(ttl),
+			})
+		})
+	}
+}
+
+func fingerprint(req *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, req.Method)
+	io.WriteString(h, " ")
+	io.WriteString(h, req.URL.RequestURI())
+	io.WriteString(h, "\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// recordingWriter passes the response through to the client and keeps a
+// copy of it.
+type recordingWriter struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rw *recordingWriter) WriteHeader(statusCode int) {
+	if rw.wroteHeader {
+		return
+	}
+	rw.wroteHeader = true
+	rw.statusCode = statusCode
+	rw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rw *recordingWriter) Write(p []byte) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	rw.body.Write(p)
+	return rw.ResponseWriter.Write(p)
+}
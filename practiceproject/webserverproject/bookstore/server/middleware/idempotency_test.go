@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store/idempotency"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyReplay(t *testing.T) {
+	var calls int
+	h := Idempotency(idempotency.NewMemKeyStore(10), time.Minute)(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			calls++
+			body, _ := ioutil.ReadAll(req.Body)
+			w.WriteHeader(http.StatusCreated)
+			w.Write(body)
+		}))
+
+	do := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/book", strings.NewReader(body))
+		req.Header.Set(IdempotencyKeyHeader, "key-1")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := do(`{"id":"978-7-111"}`)
+	if rr.Code != http.StatusCreated {
+		t.Errorf("want %d, actual %d", http.StatusCreated, rr.Code)
+	}
+
+	rr = do(`{"id":"978-7-111"}`)
+	if rr.Code != http.StatusCreated {
+		t.Errorf("want %d, actual %d", http.StatusCreated, rr.Code)
+	}
+	if rr.Body.String() != `{"id":"978-7-111"}` {
+		t.Errorf("want the first response body, actual %s", rr.Body.String())
+	}
+	if rr.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Errorf("want replayed header, actual none")
+	}
+	if calls != 1 {
+		t.Errorf("want 1 call, actual %d", calls)
+	}
+
+	rr = do(`{"id":"978-7-222"}`)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("want %d, actual %d", http.StatusUnprocessableEntity, rr.Code)
+	}
+}
+
+func TestIdempotencyServerErrorNotStored(t *testing.T) {
+	var calls int
+	h := Idempotency(idempotency.NewMemKeyStore(10), time.Minute)(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			calls++
+			http.Error(w, "boom", http.StatusInternalServerError)
+		}))
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("POST", "/book", strings.NewReader("{}"))
+		req.Header.Set(IdempotencyKeyHeader, "key-1")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if calls != 2 {
+		t.Errorf("want 2 calls, actual %d", calls)
+	}
+}
+
+func TestIdempotencyPanicReleasesKey(t *testing.T) {
+	var calls int
+	h := Recovery(Idempotency(idempotency.NewMemKeyStore(10), time.Minute)(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			calls++
+			if calls == 1 {
+				panic("boom")
+			}
+			w.WriteHeader(http.StatusCreated)
+		})))
+
+	codes := make([]int, 0, 2)
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("POST", "/book", strings.NewReader("{}"))
+		req.Header.Set(IdempotencyKeyHeader, "key-1")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		codes = append(codes, rr.Code)
+	}
+	if codes[0] != http.StatusInternalServerError || codes[1] != http.StatusCreated {
+		t.Errorf("want [500 201], actual %v", codes)
+	}
+}
+
+func TestIdempotencyFullInProgress(t *testing.T) {
+	var h http.Handler
+	var inner int
+	h = Idempotency(idempotency.NewMemKeyStore(1), time.Minute)(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			if req.Header.Get(IdempotencyKeyHeader) == "key-1" {
+				// key-1处理中时，另一个key无处预留
+				req := httptest.NewRequest("POST", "/book", strings.NewReader("{}"))
+				req.Header.Set(IdempotencyKeyHeader, "key-2")
+				rr := httptest.NewRecorder()
+				h.ServeHTTP(rr, req)
+				inner = rr.Code
+			}
+			w.WriteHeader(http.StatusCreated)
+		}))
+
+	req := httptest.NewRequest("POST", "/book", strings.NewReader("{}"))
+	req.Header.Set(IdempotencyKeyHeader, "key-1")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated || inner != http.StatusServiceUnavailable {
+		t.Errorf("want [201 503], actual [%d %d]", rr.Code, inner)
+	}
+}
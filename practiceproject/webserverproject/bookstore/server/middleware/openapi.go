@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/server/openapi"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+)
+
+const maxValidatedRequestBytes = 1 << 20
+
+type validationError struct {
+	Error  string               `json:"error"`
+	Fields []openapi.FieldError `json:"fields"`
+}
+
+// OpenAPIValidating rejects the requests whose parameters or JSON body do
+// not match the operation of doc they are sent to, with a 400 listing the
+// invalid fields. Requests to paths unknown to doc are passed through.
+func OpenAPIValidating(doc *openapi.Document) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			op, params := doc.Find(req.Method, req.URL.Path)
+			if op == nil {
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			var body []byte
+			if mediatype, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type")); mediatype == "application/json" && op.RequestBody != nil {
+				var err error
+				body, err = ioutil.ReadAll(io.LimitReader(req.Body, maxValidatedRequestBytes+1))
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				if len(body) > maxValidatedRequestBytes {
+					http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+					return
+				}
+				req.Body = ioutil.NopCloser(bytes.NewReader(body))
+			}
+
+			if errs := doc.ValidateRequest(op, req, params, body); len(errs) > 0 {
+				data, _ := json.Marshal(validationError{Error: "invalid request", Fields: errs})
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write(data)
+				return
+			}
+			next.ServeHTTP(w, req)
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+)
+
+const LeaderHeader = "X-Bookstore-Leader"
+
+// ReadOnly is used on replication followers. Requests that may modify data
+// are forwarded to the leader when forward is true, otherwise they are
+// rejected with a 503 naming the leader.
+func ReadOnly(leader *url.URL, forward bool) func(http.Handler) http.Handler {
+	proxy := httputil.NewSingleHostReverseProxy(leader)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			switch req.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			if forward {
+				proxy.ServeHTTP(w, req)
+				return
+			}
+			w.Header().Set(LeaderHeader, leader.String())
+			http.Error(w, "read-only follower, send writes to the leader", http.StatusServiceUnavailable)
+		})
+	}
+}
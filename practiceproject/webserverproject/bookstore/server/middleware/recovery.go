@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"runtime/debug"
+)
+
+// Recovery turns a panic of next into a 500 and logs it with its stack. If
+// the response has already started, the connection is aborted instead, as
+// its status can no longer be changed.
+func Recovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		sw := &statusWriter{ResponseWriter: w}
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+			if r == http.ErrAbortHandler { // 有意中止，不记录
+				panic(r)
+			}
+
+			log.Printf("panic serving %s %s: %v\n%s", req.Method, req.URL.Path, r, debug.Stack())
+			if sw.wroteHeader {
+				panic(http.ErrAbortHandler)
+			}
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}()
+		next.ServeHTTP(sw, req)
+	})
+}
+
+// statusWriter records whether the response has started.
+type statusWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (sw *statusWriter) WriteHeader(statusCode int) {
+	sw.wroteHeader = true
+	sw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	sw.wroteHeader = true
+	return sw.ResponseWriter.Write(b)
+}
+
+func (sw *statusWriter) Flush() {
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		sw.wroteHeader = true
+		f.Flush()
+	}
+}
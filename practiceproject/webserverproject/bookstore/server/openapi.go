@@ -0,0 +1,27 @@
+package server
+
+import (
+	_ "embed" // 以空导入方式启用go:embed
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/server/openapi"
+	"net/http"
+)
+
+// openAPISpec describes every route registered by NewBookStoreServer. It
+// must be updated together with the routes, TestOpenAPIRoutes checks that
+// they match.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+func loadOpenAPI() *openapi.Document {
+	doc, err := openapi.Parse(openAPISpec)
+	if err != nil {
+		panic("server: invalid openapi.json: " + err.Error())
+	}
+	return doc
+}
+
+func (bs *BookStoreServer) openAPIHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
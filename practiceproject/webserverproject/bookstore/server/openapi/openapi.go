@@ -0,0 +1,214 @@
+// Package openapi loads the subset of an OpenAPI 3 document needed to
+// validate requests: paths, operations, parameters, JSON request bodies and
+// the schemas they refer to.
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components struct {
+		Schemas map[string]*Schema `json:"schemas"`
+	} `json:"components"`
+}
+
+// PathItem maps lower case http methods to the operations of a path.
+type PathItem map[string]*Operation
+
+type Operation struct {
+	OperationId string       `json:"operationId"`
+	Parameters  []Parameter  `json:"parameters"`
+	RequestBody *RequestBody `json:"requestBody"`
+}
+
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"` // path 或 query
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Format               string             `json:"format"`
+	Nullable             bool               `json:"nullable"`
+	Enum                 []interface{}      `json:"enum"`
+	Required             []string           `json:"required"`
+	Properties           map[string]*Schema `json:"properties"`
+	AdditionalProperties json.RawMessage    `json:"additionalProperties"` // false 或 schema
+	Items                *Schema            `json:"items"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+	MinItems             *int               `json:"minItems"`
+	MaxItems             *int               `json:"maxItems"`
+}
+
+const schemaRefPrefix = "#/components/schemas/"
+
+// Parse parses an OpenAPI 3 document and checks that all its schema
+// references resolve.
+func Parse(data []byte) (*Document, error) {
+	var doc Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("openapi: %w", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return nil, fmt.Errorf("openapi: unsupported version %q", doc.OpenAPI)
+	}
+
+	for _, s := range doc.Components.Schemas {
+		if err := doc.checkRefs(s); err != nil {
+			return nil, err
+		}
+	}
+	for path, item := range doc.Paths {
+		for method, op := range item {
+			if op == nil {
+				return nil, fmt.Errorf("openapi: empty operation %s %s", method, path)
+			}
+			for _, p := range op.Parameters {
+				if err := doc.checkRefs(p.Schema); err != nil {
+					return nil, err
+				}
+			}
+			if op.RequestBody == nil {
+				continue
+			}
+			for _, mt := range op.RequestBody.Content {
+				if err := doc.checkRefs(mt.Schema); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return &doc, nil
+}
+
+func (doc *Document) checkRefs(s *Schema) error {
+	if s == nil {
+		return nil
+	}
+	if s.Ref != "" {
+		_, err := doc.resolve(s)
+		return err
+	}
+	for _, p := range s.Properties {
+		if err := doc.checkRefs(p); err != nil {
+			return err
+		}
+	}
+	if extra, _ := s.additional(); extra != nil {
+		if err := doc.checkRefs(extra); err != nil {
+			return err
+		}
+	}
+	return doc.checkRefs(s.Items)
+}
+
+// resolve follows the $ref of s, if any.
+func (doc *Document) resolve(s *Schema) (*Schema, error) {
+	if s.Ref == "" {
+		return s, nil
+	}
+	if !strings.HasPrefix(s.Ref, schemaRefPrefix) {
+		return nil, fmt.Errorf("openapi: unsupported reference %q", s.Ref)
+	}
+	target, ok := doc.Components.Schemas[strings.TrimPrefix(s.Ref, schemaRefPrefix)]
+	if !ok {
+		return nil, fmt.Errorf("openapi: unknown schema %q", s.Ref)
+	}
+	return target, nil
+}
+
+// additional returns whether an object may have properties not listed in
+// Properties, and the schema they must match.
+func (s *Schema) additional() (*Schema, bool) {
+	raw := strings.TrimSpace(string(s.AdditionalProperties))
+	switch raw {
+	case "", "true":
+		return nil, true
+	case "false":
+		return nil, false
+	}
+
+	var extra Schema
+	if err := json.Unmarshal(s.AdditionalProperties, &extra); err != nil {
+		return nil, true
+	}
+	return &extra, true
+}
+
+// Routes returns the "METHOD /path" of every operation of the document,
+// with upper case methods.
+func (doc *Document) Routes() []string {
+	var routes []string
+	for path, item := range doc.Paths {
+		for method := range item {
+			routes = append(routes, strings.ToUpper(method)+" "+path)
+		}
+	}
+	return routes
+}
+
+// Find returns the operation matching the method and the path of a request,
+// and the values of its path parameters. Paths with fewer parameters win
+// when several match.
+func (doc *Document) Find(method, path string) (*Operation, map[string]string) {
+	method = strings.ToLower(method)
+	segs := strings.Split(path, "/")
+
+	var best *Operation
+	var bestParams map[string]string
+	for tmpl, item := range doc.Paths {
+		op, ok := item[method]
+		if !ok {
+			continue
+		}
+		params, ok := match(strings.Split(tmpl, "/"), segs)
+		if !ok {
+			continue
+		}
+		if best == nil || len(params) < len(bestParams) {
+			best, bestParams = op, params
+		}
+	}
+	return best, bestParams
+}
+
+func match(tmpl, segs []string) (map[string]string, bool) {
+	if len(tmpl) != len(segs) {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+	for i, t := range tmpl {
+		if strings.HasPrefix(t, "{") && strings.HasSuffix(t, "}") {
+			if segs[i] == "" {
+				return nil, false
+			}
+			params[t[1:len(t)-1]] = segs[i]
+			continue
+		}
+		if t != segs[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
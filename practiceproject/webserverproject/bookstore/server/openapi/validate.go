@@ -0,0 +1,265 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FieldError describes why one field of a request does not match the
+// document. Field is "body" for the request body as a whole, a path such as
+// "operations[0].op" for a field of a JSON body, or "query.<name>" and
+// "path.<name>" for the parameters.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ValidateRequest checks the parameters and the JSON body of req against op.
+// The body is passed separately, as it has already been read from req.
+func (doc *Document) ValidateRequest(op *Operation, req *http.Request, pathParams map[string]string, body []byte) []FieldError {
+	var errs []FieldError
+
+	query := req.URL.Query()
+	for _, p := range op.Parameters {
+		var value string
+		var present bool
+		switch p.In {
+		case "query":
+			_, present = query[p.Name]
+			value = query.Get(p.Name)
+		case "path":
+			value, present = pathParams[p.Name]
+		default:
+			continue
+		}
+
+		field := p.In + "." + p.Name
+		if !present {
+			if p.Required {
+				errs = append(errs, FieldError{field, "is required"})
+			}
+			continue
+		}
+		errs = append(errs, doc.validateParam(field, value, p.Schema)...)
+	}
+
+	if op.RequestBody == nil {
+		return errs
+	}
+	mt, ok := op.RequestBody.Content["application/json"]
+	if !ok || mt.Schema == nil {
+		return errs
+	}
+	if mediatype, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type")); mediatype != "application/json" {
+		return errs
+	}
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		if op.RequestBody.Required {
+			errs = append(errs, FieldError{"body", "is required"})
+		}
+		return errs
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return append(errs, FieldError{"body", "invalid JSON: " + err.Error()})
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return append(errs, FieldError{"body", "invalid JSON: data after the top-level value"})
+	}
+	return append(errs, doc.validate("", v, mt.Schema)...)
+}
+
+// validateParam converts a parameter to the type of its schema before
+// validating it.
+func (doc *Document) validateParam(field, value string, s *Schema) []FieldError {
+	if s == nil {
+		return nil
+	}
+	s, err := doc.resolve(s)
+	if err != nil {
+		return []FieldError{{field, err.Error()}}
+	}
+
+	var v interface{} = value
+	switch s.Type {
+	case "integer", "number":
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			v = json.Number(value)
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(value); err == nil {
+			v = b
+		}
+	}
+	return doc.validate(field, v, s)
+}
+
+// validate checks a value decoded with json.Decoder.UseNumber against s.
+func (doc *Document) validate(field string, v interface{}, s *Schema) []FieldError {
+	s, err := doc.resolve(s)
+	if err != nil {
+		return []FieldError{{fieldName(field), err.Error()}}
+	}
+
+	if v == nil {
+		if s.Nullable {
+			return nil
+		}
+		return []FieldError{{fieldName(field), "must not be null"}}
+	}
+
+	var errs []FieldError
+	fail := func(format string, args ...interface{}) []FieldError {
+		return append(errs, FieldError{fieldName(field), fmt.Sprintf(format, args...)})
+	}
+
+	if len(s.Enum) > 0 && !inEnum(v, s.Enum) {
+		return fail("must be one of %s", enumString(s.Enum))
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return fail("must be an object")
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				errs = append(errs, FieldError{join(field, name), "is required"})
+			}
+		}
+
+		extra, allowed := s.additional()
+		names := make([]string, 0, len(obj))
+		for name := range obj {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if ps, ok := s.Properties[name]; ok {
+				errs = append(errs, doc.validate(join(field, name), obj[name], ps)...)
+				continue
+			}
+			if !allowed {
+				errs = append(errs, FieldError{join(field, name), "is not a known field"})
+			} else if extra != nil {
+				errs = append(errs, doc.validate(join(field, name), obj[name], extra)...)
+			}
+		}
+
+	case "array":
+		arr, ok := v.([]interface{})
+		if !ok {
+			return fail("must be an array")
+		}
+		if s.MinItems != nil && len(arr) < *s.MinItems {
+			return fail("must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(arr) > *s.MaxItems {
+			return fail("must have at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range arr {
+				errs = append(errs, doc.validate(fmt.Sprintf("%s[%d]", field, i), item, s.Items)...)
+			}
+		}
+
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return fail("must be a string")
+		}
+		n := len([]rune(str))
+		if s.MinLength != nil && n < *s.MinLength {
+			if *s.MinLength == 1 {
+				return fail("must not be empty")
+			}
+			return fail("must be at least %d characters long", *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			return fail("must be at most %d characters long", *s.MaxLength)
+		}
+
+	case "integer", "number":
+		kind := "a number"
+		if s.Type == "integer" {
+			kind = "an integer"
+		}
+		num, ok := v.(json.Number)
+		if !ok {
+			return fail("must be %s", kind)
+		}
+		f, err := num.Float64()
+		if err != nil {
+			return fail("must be %s", kind)
+		}
+		if _, err := num.Int64(); s.Type == "integer" && err != nil {
+			return fail("must be %s", kind)
+		}
+		if s.Minimum != nil && f < *s.Minimum {
+			return fail("must be at least %v", *s.Minimum)
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			return fail("must be at most %v", *s.Maximum)
+		}
+
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fail("must be a boolean")
+		}
+	}
+	return errs
+}
+
+func join(field, name string) string {
+	if field == "" {
+		return name
+	}
+	return field + "." + name
+}
+
+func fieldName(field string) string {
+	if field == "" {
+		return "body"
+	}
+	return field
+}
+
+func inEnum(v interface{}, enum []interface{}) bool {
+	for _, e := range enum {
+		if n, ok := v.(json.Number); ok {
+			if f, err := n.Float64(); err == nil && reflect.DeepEqual(f, e) {
+				return true
+			}
+			continue
+		}
+		if reflect.DeepEqual(v, e) {
+			return true
+		}
+	}
+	return false
+}
+
+func enumString(enum []interface{}) string {
+	values := make([]string, len(enum))
+	for i, e := range enum {
+		values[i] = fmt.Sprint(e)
+	}
+	return strings.Join(values, ", ")
+}
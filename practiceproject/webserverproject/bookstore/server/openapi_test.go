@@ -0,0 +1,112 @@
+package server
+
+import (
+	"encoding/json"
+	memstore "github.com/Kate-liu/GoBeginner/webserverproject/bookstore/internal/store"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/server/openapi"
+	"github.com/gorilla/mux"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// TestOpenAPIRoutes fails when a route is registered without being described
+// in openapi.json, or the other way around.
+func TestOpenAPIRoutes(t *testing.T) {
+	bs := newTestServer(memstore.NewMemStore(), WithLeader(10), WithoutLending(), WithConsole(), WithAdminToken(testAdminToken))
+
+	var routes []string
+	walk := func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		tmpl, err := route.GetPathTemplate()
+		if err != nil {
+			return nil // 子路由本身没有路径
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			t.Errorf("route %s has no methods", tmpl)
+			return nil
+		}
+		for _, m := range methods {
+			routes = append(routes, m+" "+tmpl)
+		}
+		return nil
+	}
+	// 管理页面在JSON API之外的路由中
+	for _, r := range []*mux.Router{bs.router, bs.console.router} {
+		if err := r.Walk(walk); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	spec := loadOpenAPI().Routes()
+	sort.Strings(routes)
+	sort.Strings(spec)
+	if !reflect.DeepEqual(routes, spec) {
+		t.Errorf("routes and openapi.json differ:\nroutes: %s\nspec:   %s",
+			strings.Join(routes, ", "), strings.Join(spec, ", "))
+	}
+}
+
+func TestOpenAPIServe(t *testing.T) {
+	bs := newTestServer(memstore.NewMemStore())
+
+	rr := do(bs, "GET", "/openapi.json", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("want %d, actual %d", http.StatusOK, rr.Code)
+	}
+	if _, err := openapi.Parse(rr.Body.Bytes()); err != nil {
+		t.Errorf("want nil, actual %s", err.Error())
+	}
+}
+
+func TestRequestValidation(t *testing.T) {
+	bs := newTestServer(memstore.NewMemStore(), WithRequestValidation())
+
+	tests := []struct {
+		method, path, body string
+		fields             []openapi.FieldError
+	}{
+		{"POST", "/book", `{"id":"1","name":""}`,
+			[]openapi.FieldError{{Field: "name", Message: "must not be empty"}}},
+		{"POST", "/book", `{"name":"Go","authors":"Rob Pike","isbn":"1"}`,
+			[]openapi.FieldError{
+				{Field: "id", Message: "is required"},
+				{Field: "authors", Message: "must be an array"},
+				{Field: "isbn", Message: "is not a known field"},
+			}},
+		{"POST", "/book:batch", `{"operations":[{"op":"create","book":{"id":1}},{"op":"move"}]}`,
+			[]openapi.FieldError{
+				{Field: "operations[0].book.id", Message: "must be a string"},
+				{Field: "operations[1].op", Message: "must be one of create, update, delete"},
+			}},
+		{"POST", "/book/1/inventory", `{"total":-1}`,
+			[]openapi.FieldError{{Field: "total", Message: "must be at least 0"}}},
+		{"GET", "/loan?overdue=maybe", ``,
+			[]openapi.FieldError{{Field: "query.overdue", Message: "must be a boolean"}}},
+		{"POST", "/member", `{"name":`,
+			[]openapi.FieldError{{Field: "body", Message: "invalid JSON: unexpected EOF"}}},
+	}
+
+	for _, tt := range tests {
+		rr := do(bs, tt.method, tt.path, tt.body)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s %s: want %d, actual %d", tt.method, tt.path, http.StatusBadRequest, rr.Code)
+			continue
+		}
+
+		var resp struct {
+			Fields []openapi.FieldError `json:"fields"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		if !reflect.DeepEqual(resp.Fields, tt.fields) {
+			t.Errorf("%s %s: want %v, actual %v", tt.method, tt.path, tt.fields, resp.Fields)
+		}
+	}
+
+	rr := do(bs, "POST", "/book", `{"id":"1","name":"The Go Programming Language","authors":["Alan Donovan"]}`)
+	if rr.Code != http.StatusOK {
+		t.Errorf("want %d, actual %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+}
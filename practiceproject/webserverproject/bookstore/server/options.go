@@ -0,0 +1,197 @@
+package server
+
+import (
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/replication"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/server/graphql"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/server/middleware"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/server/tenant"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store/blob"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store/fault"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store/idempotency"
+	"time"
+)
+
+type Option func(*BookStoreServer)
+
+// WithIdempotency sets the key store used for Idempotency-Key handling and
+// how long a stored response is replayed.
+func WithIdempotency(ks idempotency.KeyStore, ttl time.Duration) Option {
+	return func(bs *BookStoreServer) {
+		bs.idemKeys = ks
+		bs.idemTTL = ttl
+	}
+}
+
+// WithBlobStore sets the store for book cover images. Without it the cover
+// endpoints reply 501.
+func WithBlobStore(b blob.Store) Option {
+	return func(bs *BookStoreServer) {
+		bs.blobs = b
+	}
+}
+
+// WithCoverLimits sets the maximum size in bytes and the maximum width and
+// height in pixels of an uploaded cover image.
+func WithCoverLimits(maxBytes int64, maxPixels int) Option {
+	return func(bs *BookStoreServer) {
+		bs.coverMaxBytes = maxBytes
+		bs.coverMaxPixels = maxPixels
+	}
+}
+
+// WithLeader makes the server record the mutations of its store into a
+// replication log of logSize entries, and serve the log to followers.
+// Members, loans and reservations are not replicated, so if the store
+// supports lending WithoutLending is required too.
+func WithLeader(logSize int) Option {
+	return func(bs *BookStoreServer) {
+		bs.leader = replication.NewLeader(bs.s, logSize)
+	}
+}
+
+// WithFollower makes the server a read-only replica of the leader at
+// leaderURL. Writes are forwarded to the leader if forwardWrites is true,
+// and rejected otherwise. Like WithLeader, it requires WithoutLending if
+// the store supports lending.
+func WithFollower(leaderURL string, forwardWrites bool) Option {
+	return func(bs *BookStoreServer) {
+		bs.follower = replication.NewFollower(leaderURL, bs.s)
+		bs.forwardWrites = forwardWrites
+	}
+}
+
+// WithoutLending turns the lending routes off, they reply 501 as if the
+// store did not support lending.
+func WithoutLending() Option {
+	return func(bs *BookStoreServer) {
+		bs.noLending = true
+	}
+}
+
+// WithRequestValidation makes the server check every request against its
+// OpenAPI document, served at /openapi.json, and reply 400 with the list of
+// invalid fields to the requests that do not match.
+func WithRequestValidation() Option {
+	return func(bs *BookStoreServer) {
+		bs.validateRequests = true
+	}
+}
+
+// WithGraphQLLimits sets the maximum depth and complexity of the requests
+// to /graphql, zero means no limit.
+func WithGraphQLLimits(maxDepth, maxComplexity int) Option {
+	return func(bs *BookStoreServer) {
+		bs.gqlLimits = graphql.Limits{MaxDepth: maxDepth, MaxComplexity: maxComplexity}
+	}
+}
+
+// WithTenancy serves a separate catalog to each tenant of reg, found from
+// the bearer token of a request. Tenants are managed under /admin/tenant
+// with adminToken, which becomes the admin token of the server. Tenancy
+// cannot be combined with replication.
+func WithTenancy(reg *tenant.Registry, adminToken string) Option {
+	return func(bs *BookStoreServer) {
+		bs.tenants = &tenancy{
+			reg:      reg,
+			handlers: make(map[string]*tenantHandler),
+		}
+		bs.adminToken = adminToken
+	}
+}
+
+// WithAdminToken sets the bearer token required by the admin endpoints
+// under /admin. Without it, and without tenancy, they are open, except
+// /admin/faults which is never served without a token.
+func WithAdminToken(token string) Option {
+	return func(bs *BookStoreServer) {
+		bs.adminToken = token
+	}
+}
+
+// WithTenantHeader makes the server trust the X-Tenant header of requests
+// without a token, such as when a gateway authenticates the clients. It
+// requires WithTenancy.
+func WithTenantHeader() Option {
+	return func(bs *BookStoreServer) {
+		bs.tenantHeader = true
+	}
+}
+
+// WithFaultInjection wraps the store of the server with the faults of inj,
+// which can be changed from test code, or under /admin/faults with the
+// admin token of the server. It is meant for testing clients and the error
+// paths of the server.
+func WithFaultInjection(inj *fault.Injector) Option {
+	return func(bs *BookStoreServer) {
+		bs.faults = inj
+	}
+}
+
+// WithHandlerTimeout makes the server reply 503 to the requests not handled
+// within d.
+func WithHandlerTimeout(d time.Duration) Option {
+	return func(bs *BookStoreServer) {
+		bs.handlerTimeout = d
+	}
+}
+
+// WithoutRecovery lets the panics of handlers reach net/http, which drops
+// the connection without a response. By default they get a 500 and are
+// logged with their stack.
+func WithoutRecovery() Option {
+	return func(bs *BookStoreServer) {
+		bs.noRecovery = true
+	}
+}
+
+// WithSecurityHeaders adds the headers of opts to every response, such as
+// middleware.DefaultSecurityOptions.
+func WithSecurityHeaders(opts middleware.SecurityOptions) Option {
+	return func(bs *BookStoreServer) {
+		bs.securityHeaders = &opts
+	}
+}
+
+// WithCORS allows cross-origin requests from browsers as configured by
+// opts.
+func WithCORS(opts middleware.CORSOptions) Option {
+	return func(bs *BookStoreServer) {
+		bs.cors = &opts
+	}
+}
+
+// WithCompression compresses the responses with gzip or brotli, as
+// configured by opts.
+func WithCompression(opts middleware.CompressOptions) Option {
+	return func(bs *BookStoreServer) {
+		bs.compress = &opts
+	}
+}
+
+// WithMiddleware adds mws to the chain of the server, inside the built-in
+// middlewares. The first one sees the requests first.
+func WithMiddleware(mws ...middleware.Middleware) Option {
+	return func(bs *BookStoreServer) {
+		bs.middlewares = append(bs.middlewares, mws...)
+	}
+}
+
+// WithTCP makes the server also serve the books of its store at addr over
+// the binary protocol of the tcp package. Followers reject its writes,
+// they are not forwarded to the leader. It cannot be combined with
+// tenancy, the protocol has no authentication.
+func WithTCP(addr string) Option {
+	return func(bs *BookStoreServer) {
+		bs.tcpAddr = addr
+	}
+}
+
+// WithConsole serves html pages under /admin to list, search, create, edit
+// and delete books from a browser. With tenancy librarians sign in with the
+// token of their tenant, without it with the admin token, so it requires
+// WithTenancy or WithAdminToken.
+func WithConsole() Option {
+	return func(bs *BookStoreServer) {
+		bs.console = newConsole()
+	}
+}
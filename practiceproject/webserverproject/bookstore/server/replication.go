@@ -0,0 +1,30 @@
+package server
+
+import (
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/replication"
+	"net/http"
+)
+
+type replicationStatus struct {
+	Role      string             `json:"role"` // standalone, leader 或 follower
+	LeaderSeq uint64             `json:"leader_seq,omitempty"`
+	Follower  *replication.Stats `json:"follower,omitempty"`
+}
+
+// ReplicationStatus returns the replication role of the server and, for a
+// follower, its lag behind the leader. It can be published with expvar.
+func (bs *BookStoreServer) ReplicationStatus() interface{} {
+	switch {
+	case bs.leader != nil:
+		return replicationStatus{Role: "leader", LeaderSeq: bs.leader.Log().Last()}
+	case bs.follower != nil:
+		st := bs.follower.Stats()
+		return replicationStatus{Role: "follower", LeaderSeq: st.LeaderSeq, Follower: &st}
+	default:
+		return replicationStatus{Role: "standalone"}
+	}
+}
+
+func (bs *BookStoreServer) replicationStatusHandler(w http.ResponseWriter, req *http.Request) {
+	response(w, bs.ReplicationStatus())
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	memstore "github.com/Kate-liu/GoBeginner/webserverproject/bookstore/internal/store"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitCaughtUp waits until the follower has applied the whole log of the
+// leader.
+func waitCaughtUp(t *testing.T, leader, follower *BookStoreServer) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if follower.follower.Stats().AppliedSeq == leader.leader.Log().Last() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("follower did not catch up: %+v", follower.follower.Stats())
+}
+
+func TestReplication(t *testing.T) {
+	leader := newTestServer(memstore.NewMemStore(), WithLeader(2), WithoutLending())
+	ts := httptest.NewServer(leader.srv.Handler)
+	defer ts.Close()
+
+	// 日志只保留2条，新的跟随者需要先恢复快照
+	do(leader, "POST", "/author", `{"id":"a1","name":"Alan Donovan"}`)
+	for i := 0; i < 5; i++ {
+		do(leader, "POST", "/book", fmt.Sprintf(`{"id":"%d","name":"book%d","author_ids":["a1"]}`, i, i))
+	}
+
+	fs := memstore.NewMemStore()
+	follower := newTestServer(fs, WithFollower(ts.URL, false), WithoutLending())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go follower.follower.Run(ctx)
+	waitCaughtUp(t, leader, follower)
+
+	if books, _ := fs.GetAll(); len(books) != 5 {
+		t.Errorf("want 5 books, actual %d", len(books))
+	}
+
+	do(leader, "POST", "/book/1", `{"name":"renamed"}`)
+	do(leader, "DELETE", "/book/2", "")
+	do(leader, "POST", "/book:batch", `{"operations":[{"op":"create","book":{"id":"9","name":"book9"}},{"op":"delete","id":"3"}]}`)
+	waitCaughtUp(t, leader, follower)
+
+	if book, _ := fs.Get("1"); book.Name != "renamed" {
+		t.Errorf("want renamed, actual %s", book.Name)
+	}
+	for _, id := range []string{"2", "3"} {
+		if _, err := fs.Get(id); err != store.ErrNotFound {
+			t.Errorf("want book %s deleted, actual %v", id, err)
+		}
+	}
+	if rr := do(follower, "GET", "/book/9", ""); rr.Code != http.StatusOK {
+		t.Errorf("want %d, actual %d", http.StatusOK, rr.Code)
+	}
+
+	if rr := do(follower, "POST", "/book", `{"id":"10"}`); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("want %d, actual %d", http.StatusServiceUnavailable, rr.Code)
+	}
+	if st := follower.follower.Stats(); st.Snapshots != 1 || st.LagEntries != 0 {
+		t.Errorf("want 1 snapshot and no lag, actual %+v", st)
+	}
+}
+
+func TestFollowerForwardWrites(t *testing.T) {
+	ls := memstore.NewMemStore()
+	leader := newTestServer(ls, WithLeader(100), WithoutLending())
+	ts := httptest.NewServer(leader.srv.Handler)
+	defer ts.Close()
+
+	follower := newTestServer(memstore.NewMemStore(), WithFollower(ts.URL, true), WithoutLending())
+	if rr := do(follower, "POST", "/book", `{"id":"1","name":"forwarded"}`); rr.Code != http.StatusOK {
+		t.Fatalf("want %d, actual %d", http.StatusOK, rr.Code)
+	}
+	if book, err := ls.Get("1"); err != nil || book.Name != "forwarded" {
+		t.Errorf("want the book created on the leader, actual %+v, %v", book, err)
+	}
+}
+
+func TestReplicationWithoutLending(t *testing.T) {
+	// 借阅数据不在日志中，支持借阅的存储须关闭借阅才能复制
+	for i, opt := range []Option{WithLeader(10), WithFollower("http://127.0.0.1:1", false)} {
+		if _, err := NewBookStoreServer(":0", memstore.NewMemStore(), opt); err == nil {
+			t.Errorf("case %d: want an error, actual nil", i)
+		}
+	}
+
+	leader := newTestServer(memstore.NewMemStore(), WithLeader(10), WithoutLending())
+	follower := newTestServer(memstore.NewMemStore(), WithFollower("http://127.0.0.1:1", false), WithoutLending())
+
+	for _, rr := range []*httptest.ResponseRecorder{
+		do(leader, "POST", "/member", `{"id":"m1","name":"Tom"}`),
+		do(leader, "GET", "/loan", ""),
+		do(follower, "GET", "/loan", ""),
+	} {
+		if rr.Code != http.StatusNotImplemented {
+			t.Errorf("want %d, actual %d", http.StatusNotImplemented, rr.Code)
+		}
+	}
+	if seq := leader.leader.Log().Last(); seq != 0 {
+		t.Errorf("want no entry logged, actual %d", seq)
+	}
+}
+
+// TestReplicationLogNoTimeout checks that the log stream outlives the
+// handler timeout of the leader.
+func TestReplicationLogNoTimeout(t *testing.T) {
+	leader := newTestServer(memstore.NewMemStore(), WithLeader(10), WithoutLending(), WithHandlerTimeout(20*time.Millisecond))
+	ts := httptest.NewServer(leader.srv.Handler)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/replication/log?from=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("want %d, actual %d", http.StatusOK, resp.StatusCode)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	do(leader, "POST", "/book", `{"id":"1","name":"b1"}`)
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil || !strings.Contains(line, `"seq":1`) {
+		t.Errorf("want entry 1, actual %q, %v", line, err)
+	}
+}
@@ -3,35 +3,272 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/replication"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/server/graphql"
 	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/server/middleware"
 	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store/blob"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store/fault"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store/idempotency"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/tcp"
 	"github.com/gorilla/mux"
+	"io"
+	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"time"
 )
 
+const (
+	defaultIdempotencyTTL      = 24 * time.Hour
+	defaultIdempotencyCapacity = 10000
+)
+
 type BookStoreServer struct {
 	s   store.Store
 	srv *http.Server
+
+	idemKeys idempotency.KeyStore // 保存Idempotency-Key对应的首次响应
+	idemTTL  time.Duration
+
+	blobs          blob.Store // 保存图书封面
+	coverMaxBytes  int64
+	coverMaxPixels int
+
+	leader        *replication.Leader   // 作为领导者时，记录并分发修改日志
+	follower      *replication.Follower // 作为跟随者时，从领导者同步数据
+	forwardWrites bool
+	stopReplica   context.CancelFunc
+	noLending     bool // 是否关闭借阅接口，借阅数据不参与复制
+
+	validateRequests bool        // 是否按openapi.json校验请求
+	router           *mux.Router // 所有路由，便于测试核对openapi.json
+
+	gqlSchema *graphql.Schema // /graphql的schema
+	gqlLimits graphql.Limits
+
+	tenants      *tenancy // 多租户时，各租户的令牌、配额与处理器
+	tenantHeader bool     // 是否信任X-Tenant头，需要多租户
+	adminToken   string   // /admin下管理接口的令牌，为空时不校验
+
+	faults         *fault.Injector // 注入存储故障，仅用于测试
+	handlerTimeout time.Duration   // 处理请求的超时时间，0表示不限
+
+	noRecovery      bool                        // 是否关闭panic恢复
+	securityHeaders *middleware.SecurityOptions // 为nil时不添加安全响应头
+	cors            *middleware.CORSOptions     // 为nil时不处理跨域请求
+	compress        *middleware.CompressOptions // 为nil时不压缩响应
+	middlewares     []middleware.Middleware     // 自定义中间件
+
+	tcpAddr string      // 二进制TCP协议的监听地址，为空时不监听
+	tcp     *tcp.Server // 与http共用同一个存储
+
+	console *console // /admin下的图书管理页面，为nil时不提供
+}
+
+// streamingPaths are the paths whose responses are streamed, they are not
+// limited by WithHandlerTimeout.
+var streamingPaths = map[string]bool{
+	"/replication/log": true,
 }
 
-func NewBookStoreServer(addr string, s store.Store) *BookStoreServer {
+// NewBookStoreServer returns a server of s listening on addr, or an error if
+// opts cannot be combined.
+func NewBookStoreServer(addr string, s store.Store, opts ...Option) (*BookStoreServer, error) {
 	srv := &BookStoreServer{
 		s: s,
 		srv: &http.Server{
 			Addr: addr,
 		},
+		idemTTL:        defaultIdempotencyTTL,
+		coverMaxBytes:  defaultCoverMaxBytes,
+		coverMaxPixels: defaultCoverMaxPixels,
+		gqlLimits: graphql.Limits{
+			MaxDepth:      defaultGraphQLMaxDepth,
+			MaxComplexity: defaultGraphQLMaxComplexity,
+		},
+	}
+
+	for _, opt := range opts {
+		opt(srv)
+	}
+
+	if srv.tenants != nil && (srv.leader != nil || srv.follower != nil) {
+		return nil, errors.New("server: tenancy cannot be combined with replication")
+	}
+	if (srv.leader != nil || srv.follower != nil) && !srv.noLending {
+		// 领导者不解包到原存储，须在包装之前检查
+		if _, ok := findLending(srv.s); ok {
+			return nil, errors.New("server: lending is not replicated, replication requires WithoutLending")
+		}
+	}
+	if srv.tenants != nil && srv.tcpAddr != "" {
+		return nil, errors.New("server: tenancy cannot be combined with the tcp front end")
+	}
+	if srv.console != nil && srv.tenants == nil && srv.adminToken == "" {
+		return nil, errors.New("server: WithConsole requires WithTenancy or WithAdminToken")
 	}
+	if srv.tenantHeader {
+		if srv.tenants == nil {
+			return nil, errors.New("server: WithTenantHeader requires WithTenancy")
+		}
+		srv.tenants.trustHeader = true
+	}
+	var leaderURL *url.URL
+	if srv.follower != nil {
+		var err error
+		if leaderURL, err = url.Parse(srv.follower.LeaderURL()); err != nil {
+			return nil, fmt.Errorf("server: invalid leader url: %w", err)
+		}
+	}
+
+	if srv.leader != nil {
+		srv.s = srv.leader
+	}
+	if srv.faults != nil {
+		srv.s = fault.Wrap(srv.s, srv.faults)
+	}
+
+	srv.gqlSchema = newGraphQLSchema(srv.s, srv.blobs)
+
+	if srv.idemKeys == nil {
+		srv.idemKeys = idempotency.NewMemKeyStore(defaultIdempotencyCapacity)
+	}
+
+	if srv.tcpAddr != "" {
+		var tcpOpts []tcp.Option
+		if srv.follower != nil {
+			tcpOpts = append(tcpOpts, tcp.ReadOnly())
+		}
+		srv.tcp = tcp.NewServer(srv.s, tcpOpts...)
+	}
+
+	srv.router = srv.routes()
+	handler := srv.api(srv.router)
+	if srv.tenants != nil {
+		handler = srv.tenancy(handler)
+	}
+	if srv.console != nil {
+		srv.console.router = srv.consoleRoutes()
+		handler = srv.withConsole(handler)
+	}
+
+	chain := middleware.NewChain(middleware.Logging)
+	if !srv.noRecovery {
+		chain = chain.Append(middleware.Recovery)
+	}
+	if srv.securityHeaders != nil {
+		chain = chain.Append(middleware.SecurityHeaders(*srv.securityHeaders))
+	}
+	if srv.cors != nil {
+		chain = chain.Append(middleware.CORS(*srv.cors))
+	}
+	if srv.compress != nil {
+		chain = chain.Append(middleware.Compress(*srv.compress))
+	}
+	chain = chain.Append(srv.middlewares...)
+	if srv.handlerTimeout > 0 {
+		chain = chain.Append(func(next http.Handler) http.Handler {
+			timeout := http.TimeoutHandler(next, srv.handlerTimeout, "request timed out")
+			return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				// 流式响应持续到客户端断开，且需要Flush，不受超时限制
+				if streamingPaths[req.URL.Path] {
+					next.ServeHTTP(w, req)
+					return
+				}
+				timeout.ServeHTTP(w, req)
+			})
+		})
+	}
+	if srv.follower != nil {
+		chain = chain.Append(middleware.ReadOnly(leaderURL, srv.forwardWrites))
+	}
+	srv.srv.Handler = chain.Then(handler)
+	return srv, nil
+}
+
+// routes returns the router of all the endpoints of bs.
+func (bs *BookStoreServer) routes() *mux.Router {
+	root := mux.NewRouter()
+	router := root.NewRoute().Subrouter() // JSON API，校验请求的Content-Type
+	router.Use(middleware.Validating)
+	router.HandleFunc("/book", bs.createBookHandler).Methods("POST")
+	router.HandleFunc("/book/{id}", bs.updateBookHandler).Methods("POST")
+	router.HandleFunc("/book/{id}", bs.getBookHandler).Methods("GET")
+	router.HandleFunc("/book", bs.getAllBooksHandler).Methods("GET")
+	router.HandleFunc("/book/{id}", bs.delBookHandler).Methods("DELETE")
+	router.HandleFunc("/book:batch", bs.batchBooksHandler).Methods("POST")
 
-	router := mux.NewRouter()
-	router.HandleFunc("/book", srv.createBookHandler).Methods("POST")
-	router.HandleFunc("/book/{id}", srv.updateBookHandler).Methods("POST")
-	router.HandleFunc("/book/{id}", srv.getBookHandler).Methods("GET")
-	router.HandleFunc("/book", srv.getAllBooksHandler).Methods("GET")
-	router.HandleFunc("/book/{id}", srv.delBookHandler).Methods("DELETE")
+	router.HandleFunc("/author", bs.createAuthorHandler).Methods("POST")
+	router.HandleFunc("/author/{id}", bs.updateAuthorHandler).Methods("POST")
+	router.HandleFunc("/author/{id}", bs.getAuthorHandler).Methods("GET")
+	router.HandleFunc("/author", bs.getAllAuthorsHandler).Methods("GET")
+	router.HandleFunc("/author/{id}", bs.delAuthorHandler).Methods("DELETE")
+	router.HandleFunc("/author/{id}/books", bs.getAuthorBooksHandler).Methods("GET")
 
-	srv.srv.Handler = middleware.Logging(middleware.Validating(router))
-	return srv
+	router.HandleFunc("/press", bs.createPressHandler).Methods("POST")
+	router.HandleFunc("/press/{id}", bs.updatePressHandler).Methods("POST")
+	router.HandleFunc("/press/{id}", bs.getPressHandler).Methods("GET")
+	router.HandleFunc("/press", bs.getAllPressesHandler).Methods("GET")
+	router.HandleFunc("/press/{id}", bs.delPressHandler).Methods("DELETE")
+	router.HandleFunc("/press/{id}/books", bs.getPressBooksHandler).Methods("GET")
+
+	router.HandleFunc("/book/{id}/inventory", bs.setInventoryHandler).Methods("POST")
+	router.HandleFunc("/book/{id}/inventory", bs.getInventoryHandler).Methods("GET")
+	router.HandleFunc("/book/{id}/reservation", bs.reserveHandler).Methods("POST")
+	router.HandleFunc("/book/{id}/reservation", bs.getReservationsHandler).Methods("GET")
+	router.HandleFunc("/book/{id}/reservation/{member}", bs.cancelReservationHandler).Methods("DELETE")
+
+	router.HandleFunc("/member", bs.createMemberHandler).Methods("POST")
+	router.HandleFunc("/member/{id}", bs.getMemberHandler).Methods("GET")
+	router.HandleFunc("/member", bs.getAllMembersHandler).Methods("GET")
+	router.HandleFunc("/member/{id}", bs.delMemberHandler).Methods("DELETE")
+	router.HandleFunc("/member/{id}/loans", bs.getMemberLoansHandler).Methods("GET")
+
+	router.HandleFunc("/loan", bs.borrowHandler).Methods("POST")
+	router.HandleFunc("/loan/{id}", bs.getLoanHandler).Methods("GET")
+	router.HandleFunc("/loan", bs.getAllLoansHandler).Methods("GET")
+	router.HandleFunc("/loan/{id}/renew", bs.renewHandler).Methods("POST")
+	router.HandleFunc("/loan/{id}/return", bs.returnHandler).Methods("POST")
+
+	router.HandleFunc("/admin/tenant", bs.createTenantHandler).Methods("POST")
+	router.HandleFunc("/admin/tenant", bs.getAllTenantsHandler).Methods("GET")
+	router.HandleFunc("/admin/tenant/{id}", bs.getTenantHandler).Methods("GET")
+	router.HandleFunc("/admin/tenant/{id}", bs.delTenantHandler).Methods("DELETE")
+	router.HandleFunc("/admin/backup", bs.backupHandler).Methods("GET")
+	router.HandleFunc("/admin/restore", bs.restoreHandler).Methods("POST")
+	router.HandleFunc("/admin/faults", bs.getFaultsHandler).Methods("GET")
+	router.HandleFunc("/admin/faults", bs.resetFaultsHandler).Methods("DELETE")
+	router.HandleFunc("/admin/faults/{op}", bs.setFaultHandler).Methods("PUT")
+	router.HandleFunc("/admin/faults/{op}", bs.clearFaultHandler).Methods("DELETE")
+
+	router.HandleFunc("/graphql", bs.graphqlHandler).Methods("POST")
+	root.HandleFunc("/graphql", bs.graphqlHandler).Methods("GET")
+
+	root.HandleFunc("/book/{id}/cover", bs.putCoverHandler).Methods("PUT")
+	root.HandleFunc("/book/{id}/cover", bs.getCoverHandler).Methods("GET")
+
+	root.HandleFunc("/replication/status", bs.replicationStatusHandler).Methods("GET")
+	if bs.leader != nil {
+		root.HandleFunc("/replication/snapshot", bs.leader.ServeSnapshot).Methods("GET")
+		root.HandleFunc("/replication/log", bs.leader.ServeLog).Methods("GET")
+	}
+	root.Handle("/debug/vars", expvar.Handler()).Methods("GET")
+	root.HandleFunc("/openapi.json", bs.openAPIHandler).Methods("GET")
+	return root
+}
+
+// api wraps the router of bs with idempotency and request validation.
+func (bs *BookStoreServer) api(router *mux.Router) http.Handler {
+	chain := middleware.NewChain(middleware.Idempotency(bs.idemKeys, bs.idemTTL))
+	if bs.validateRequests {
+		chain = chain.Append(middleware.OpenAPIValidating(loadOpenAPI()))
+	}
+	return chain.Then(router)
 }
 
 func (bs *BookStoreServer) createBookHandler(w http.ResponseWriter, req *http.Request) {
@@ -44,7 +281,7 @@ func (bs *BookStoreServer) createBookHandler(w http.ResponseWriter, req *http.Re
 	}
 
 	if err := bs.s.Create(&book); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		http.Error(w, err.Error(), bookErrorStatus(err))
 		return
 	}
 }
@@ -56,20 +293,45 @@ func (bs *BookStoreServer) updateBookHandler(w http.ResponseWriter, req *http.Re
 		return
 	}
 
-	dec := json.NewDecoder(req.Body)
+	data, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	var book store.Book
-	if err := dec.Decode(&book); err != nil {
+	if err = json.Unmarshal(data, &book); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if book.Clear, err = nullFields(data, store.FieldPress, store.FieldPressId); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	book.Id = id
-	if err := bs.s.Update(&book); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err = bs.s.Update(&book); err != nil {
+		http.Error(w, err.Error(), bookErrorStatus(err))
 		return
 	}
 }
 
+// nullFields returns the fields among names that are null in the JSON
+// object data: an update clears them, while it leaves the missing and
+// empty fields unchanged.
+func nullFields(data []byte, names ...string) ([]string, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	var null []string
+	for _, name := range names {
+		if v, ok := fields[name]; ok && string(v) == "null" {
+			null = append(null, name)
+		}
+	}
+	return null, nil
+}
+
 func (bs *BookStoreServer) getBookHandler(w http.ResponseWriter, req *http.Request) {
 	id, ok := mux.Vars(req)["id"]
 	if !ok {
@@ -79,7 +341,7 @@ func (bs *BookStoreServer) getBookHandler(w http.ResponseWriter, req *http.Reque
 
 	book, err := bs.s.Get(id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		http.Error(w, err.Error(), bookErrorStatus(err))
 		return
 	}
 	response(w, book)
@@ -88,7 +350,7 @@ func (bs *BookStoreServer) getBookHandler(w http.ResponseWriter, req *http.Reque
 func (bs *BookStoreServer) getAllBooksHandler(w http.ResponseWriter, req *http.Request) {
 	books, err := bs.s.GetAll()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		http.Error(w, err.Error(), bookErrorStatus(err))
 		return
 	}
 
@@ -104,12 +366,17 @@ func (bs *BookStoreServer) delBookHandler(w http.ResponseWriter, req *http.Reque
 
 	err := bs.s.Delete(id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		http.Error(w, err.Error(), bookErrorStatus(err))
 		return
 	}
+	deleteCovers(bs.blobs, id)
 }
 
 func response(w http.ResponseWriter, v interface{}) {
+	responseWithStatus(w, http.StatusOK, v)
+}
+
+func responseWithStatus(w http.ResponseWriter, status int, v interface{}) {
 	data, err := json.Marshal(v)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -117,20 +384,84 @@ func response(w http.ResponseWriter, v interface{}) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
 	w.Write(data)
 }
 
+// bookErrorStatus is the status of the errors of the /book routes. They
+// have always answered the errors of the store with 400, which their
+// clients rely on; only the quotas, the operations a provider does not
+// support and the injected faults, which came later, have their own.
+func bookErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, store.ErrQuota), errors.Is(err, store.ErrNotSupported),
+		errors.Is(err, fault.ErrInjected):
+		return errorStatus(err)
+	}
+	return http.StatusBadRequest
+}
+
+// errorStatus maps the errors returned by store.Store to http status codes.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, store.ErrExist), errors.Is(err, store.ErrInUse),
+		errors.Is(err, store.ErrUnavailable), errors.Is(err, store.ErrAvailable),
+		errors.Is(err, store.ErrRenewLimit), errors.Is(err, store.ErrReserved),
+		errors.Is(err, store.ErrReturned), errors.Is(err, store.ErrLendingData):
+		return http.StatusConflict
+	case errors.Is(err, store.ErrQuota):
+		return http.StatusForbidden
+	case errors.Is(err, store.ErrReference):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, store.ErrNotSupported):
+		return http.StatusNotImplemented
+	case errors.Is(err, fault.ErrInjected):
+		return http.StatusInternalServerError
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// ListenAndServe starts the listeners of bs. If one of them fails to start,
+// the ones already started are stopped and the error is returned.
 func (bs *BookStoreServer) ListenAndServe() (<-chan error, error) {
-	var err error
-	errChan := make(chan error)
+	errChan := make(chan error, 2)
+
+	var l net.Listener
+	if bs.tcp != nil {
+		var err error
+		if l, err = net.Listen("tcp", bs.tcpAddr); err != nil {
+			return nil, err
+		}
+		go func() {
+			errChan <- bs.tcp.Serve(l)
+		}()
+		log.Println("serving the tcp protocol on", l.Addr())
+	}
+
+	if bs.follower != nil {
+		var ctx context.Context
+		ctx, bs.stopReplica = context.WithCancel(context.Background())
+		go bs.follower.Run(ctx)
+		log.Println("replicating from leader", bs.follower.LeaderURL())
+	}
 
 	go func() {
-		err = bs.srv.ListenAndServe()
-		errChan <- err
+		errChan <- bs.srv.ListenAndServe()
 	}()
 
 	select {
-	case err = <-errChan:
+	case err := <-errChan:
+		// 不留下已启动的tcp监听与复制，Serve可能尚未登记l，直接关闭
+		if bs.stopReplica != nil {
+			bs.stopReplica()
+		}
+		if l != nil {
+			l.Close()
+			bs.tcp.Close()
+		}
 		return nil, err
 	case <-time.After(time.Second):
 		return errChan, nil
@@ -138,5 +469,11 @@ func (bs *BookStoreServer) ListenAndServe() (<-chan error, error) {
 }
 
 func (bs *BookStoreServer) Shutdown(ctx context.Context) error {
+	if bs.stopReplica != nil {
+		bs.stopReplica()
+	}
+	if bs.tcp != nil {
+		bs.tcp.Close()
+	}
 	return bs.srv.Shutdown(ctx)
 }
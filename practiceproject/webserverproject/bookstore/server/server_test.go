@@ -0,0 +1,193 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	memstore "github.com/Kate-liu/GoBeginner/webserverproject/bookstore/internal/store"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/server/middleware"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store/fault"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestServer(s store.Store, opts ...Option) *BookStoreServer {
+	bs, err := NewBookStoreServer(":0", s, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return bs
+}
+
+func do(bs *BookStoreServer, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	bs.srv.Handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestBatchCommit(t *testing.T) {
+	s := memstore.NewMemStore()
+	s.Create(&store.Book{Id: "1", Name: "old", Press: "p1"})
+	bs := newTestServer(s)
+
+	rr := do(bs, "POST", "/book:batch", `{"operations":[
+		{"op":"create","book":{"id":"2","name":"b2","press":"p1"}},
+		{"op":"update","id":"1","book":{"press":"p2"}},
+		{"op":"delete","id":"2"}]}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("want %d, actual %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	var resp batchResponse
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	if !resp.Committed || len(resp.Results) != 3 {
+		t.Errorf("want committed with 3 results, actual %+v", resp)
+	}
+
+	book, _ := s.Get("1")
+	if book.Press != "p2" || book.Name != "old" {
+		t.Errorf("want updated book, actual %+v", book)
+	}
+	if _, err := s.Get("2"); err != store.ErrNotFound {
+		t.Errorf("want %v, actual %v", store.ErrNotFound, err)
+	}
+}
+
+func TestBatchRollback(t *testing.T) {
+	s := memstore.NewMemStore()
+	s.Create(&store.Book{Id: "1", Name: "old", Press: "p1"})
+	bs := newTestServer(s)
+
+	rr := do(bs, "POST", "/book:batch", `{"operations":[
+		{"op":"update","id":"1","book":{"press":"p2"}},
+		{"op":"create","book":{"id":"3","name":"b3"}},
+		{"op":"delete","id":"404"}]}`)
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("want %d, actual %d: %s", http.StatusNotFound, rr.Code, rr.Body.String())
+	}
+
+	var resp batchResponse
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	if resp.Committed {
+		t.Errorf("want not committed")
+	}
+	if resp.Results[0].Status != http.StatusFailedDependency || resp.Results[2].Status != http.StatusNotFound {
+		t.Errorf("want per-operation results, actual %+v", resp.Results)
+	}
+
+	book, _ := s.Get("1")
+	if book.Press != "p1" {
+		t.Errorf("want p1, actual %s", book.Press)
+	}
+	if _, err := s.Get("3"); err != store.ErrNotFound {
+		t.Errorf("want %v, actual %v", store.ErrNotFound, err)
+	}
+}
+
+// plainStore hides the optional interfaces of the store it embeds, such
+// as store.TxStore.
+type plainStore struct {
+	store.Store
+}
+
+func TestBatchNotSupported(t *testing.T) {
+	s := plainStore{memstore.NewMemStore()}
+	// 故障注入包装了不支持事务的存储
+	bs := newTestServer(s, WithFaultInjection(fault.NewInjector()))
+
+	rr := do(bs, "POST", "/book:batch", `{"operations":[{"op":"create","book":{"id":"1","name":"b1"}}]}`)
+	if rr.Code != http.StatusNotImplemented {
+		t.Fatalf("want %d, actual %d: %s", http.StatusNotImplemented, rr.Code, rr.Body.String())
+	}
+	if strings.Contains(rr.Body.String(), "results") {
+		t.Errorf("want a plain error, actual %s", rr.Body.String())
+	}
+	if _, err := s.Get("1"); err != store.ErrNotFound {
+		t.Errorf("want %v, actual %v", store.ErrNotFound, err)
+	}
+}
+
+func TestAuthorBooks(t *testing.T) {
+	bs := newTestServer(memstore.NewMemStore())
+
+	do(bs, "POST", "/author", `{"id":"a1","name":"Alan Donovan"}`)
+	do(bs, "POST", "/press", `{"id":"p1","name":"Addison-Wesley"}`)
+	do(bs, "POST", "/book", `{"id":"1","name":"The Go Programming Language","author_ids":["a1"],"press_id":"p1"}`)
+	do(bs, "POST", "/book", `{"id":"2","name":"Go in Action"}`)
+
+	rr := do(bs, "GET", "/author/a1/books", "")
+	var books []store.Book
+	json.Unmarshal(rr.Body.Bytes(), &books)
+	if len(books) != 1 || books[0].Id != "1" {
+		t.Errorf("want book 1, actual %s", rr.Body.String())
+	}
+
+	rr = do(bs, "DELETE", "/press/p1", "")
+	if rr.Code != http.StatusConflict {
+		t.Errorf("want %d, actual %d", http.StatusConflict, rr.Code)
+	}
+
+	rr = do(bs, "POST", "/book", `{"id":"3","author_ids":["a404"]}`)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("want %d, actual %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+func TestClearPress(t *testing.T) {
+	bs := newTestServer(memstore.NewMemStore(), WithRequestValidation())
+	do(bs, "POST", "/press", `{"id":"p1","name":"Addison-Wesley"}`)
+	do(bs, "POST", "/book", `{"id":"1","name":"The Go Programming Language","press":"Addison-Wesley","press_id":"p1"}`)
+
+	// 空字段不修改图书
+	do(bs, "POST", "/book/1", `{"press":"","name":"gopl"}`)
+	if book, _ := bs.s.Get("1"); book.Press != "Addison-Wesley" || book.PressId != "p1" {
+		t.Errorf("want the press unchanged, actual %+v", book)
+	}
+
+	// null清空字段，出版社不再被引用
+	if rr := do(bs, "POST", "/book/1", `{"press":null,"press_id":null}`); rr.Code != http.StatusOK {
+		t.Fatalf("want %d, actual %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if book, _ := bs.s.Get("1"); book.Press != "" || book.PressId != "" || book.Name != "gopl" {
+		t.Errorf("want the press cleared, actual %+v", book)
+	}
+	if rr := do(bs, "DELETE", "/press/p1", ""); rr.Code != http.StatusOK {
+		t.Errorf("want %d, actual %d", http.StatusOK, rr.Code)
+	}
+}
+
+func TestMiddlewareOptions(t *testing.T) {
+	s := memstore.NewMemStore()
+	for i := 0; i < 50; i++ {
+		s.Create(&store.Book{Id: fmt.Sprint(i), Name: "a book with a rather long name"})
+	}
+	bs := newTestServer(s,
+		WithSecurityHeaders(middleware.DefaultSecurityOptions),
+		WithCORS(middleware.CORSOptions{AllowedOrigins: []string{"https://shop.example.com"}}),
+		WithCompression(middleware.CompressOptions{}))
+
+	req := httptest.NewRequest("OPTIONS", "/book", nil)
+	req.Header.Set("Origin", "https://shop.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	rr := httptest.NewRecorder()
+	bs.srv.Handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNoContent || rr.Header().Get("Access-Control-Allow-Origin") == "" {
+		t.Errorf("want an allowed preflight, actual %d, %v", rr.Code, rr.Header())
+	}
+
+	req = httptest.NewRequest("GET", "/book", nil)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr = httptest.NewRecorder()
+	bs.srv.Handler.ServeHTTP(rr, req)
+	if rr.Header().Get("Content-Encoding") != "gzip" {
+		t.Errorf("want gzip, actual %q", rr.Header().Get("Content-Encoding"))
+	}
+	if rr.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("want nosniff, actual %q", rr.Header().Get("X-Content-Type-Options"))
+	}
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"errors"
+	memstore "github.com/Kate-liu/GoBeginner/webserverproject/bookstore/internal/store"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store/fault"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/tcp"
+	"net"
+	"net/http"
+	"testing"
+)
+
+// TestTCPFrontEnd checks that the http and tcp front ends see the same
+// books and report the same errors.
+func TestTCPFrontEnd(t *testing.T) {
+	inj := fault.NewInjector()
+	bs := newTestServer(memstore.NewMemStore(), WithTCP("127.0.0.1:0"), WithFaultInjection(inj))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go bs.tcp.Serve(l)
+	defer bs.tcp.Close()
+
+	c, err := tcp.Dial(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err = c.Create(&store.Book{Id: "1", Name: "from tcp"}); err != nil {
+		t.Fatal(err)
+	}
+	if rr := do(bs, "GET", "/book/1", ""); rr.Code != http.StatusOK {
+		t.Errorf("want %d, actual %d", http.StatusOK, rr.Code)
+	}
+	if rr := do(bs, "POST", "/book", `{"id":"2","name":"from http"}`); rr.Code != http.StatusOK {
+		t.Fatalf("want %d, actual %d", http.StatusOK, rr.Code)
+	}
+	if b, err := c.Get("2"); err != nil || b.Name != "from http" {
+		t.Errorf("want the book created over http, actual %v, %v", b, err)
+	}
+
+	cases := []struct {
+		rule   fault.Rule
+		status int
+		err    error
+	}{
+		{fault.Rule{ErrorRate: 1, Error: "not_found"}, http.StatusBadRequest, store.ErrNotFound},
+		{fault.Rule{ErrorRate: 1, Error: "exist"}, http.StatusBadRequest, store.ErrExist},
+		{fault.Rule{ErrorRate: 1, Error: "quota"}, http.StatusForbidden, store.ErrQuota},
+		{fault.Rule{ErrorRate: 1, Error: "not_supported"}, http.StatusNotImplemented, store.ErrNotSupported},
+	}
+	for _, cs := range cases {
+		inj.Set(fault.OpGet, cs.rule)
+		if rr := do(bs, "GET", "/book/1", ""); rr.Code != cs.status {
+			t.Errorf("%s: want %d, actual %d", cs.rule.Error, cs.status, rr.Code)
+		}
+		if _, err = c.Get("1"); !errors.Is(err, cs.err) {
+			t.Errorf("%s: want %v, actual %v", cs.rule.Error, cs.err, err)
+		}
+	}
+}
+
+// TestListenAndServeFailure checks that the tcp listener is closed when the
+// http one cannot be started.
+func TestListenAndServeFailure(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	free, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcpAddr := free.Addr().String()
+	free.Close()
+
+	bs, err := NewBookStoreServer(busy.Addr().String(), memstore.NewMemStore(), WithTCP(tcpAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = bs.ListenAndServe(); err == nil {
+		t.Fatal("want an error, actual nil")
+	}
+
+	l, err := net.Listen("tcp", tcpAddr)
+	if err != nil {
+		t.Fatalf("want the tcp address released, actual %v", err)
+	}
+	l.Close()
+}
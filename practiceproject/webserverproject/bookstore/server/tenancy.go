@@ -0,0 +1,249 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/server/tenant"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store/blob"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store/idempotency"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store/namespace"
+	"github.com/gorilla/mux"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const TenantHeader = "X-Tenant"
+
+type tenancy struct {
+	reg         *tenant.Registry
+	trustHeader bool // 是否信任X-Tenant头，如由网关完成认证时
+
+	mu       sync.Mutex
+	handlers map[string]*tenantHandler // 租户ID -> 处理器
+}
+
+// tenantHandler serves the requests of one tenant, with a copy of the
+// server restricted to the namespace of the tenant.
+type tenantHandler struct {
+	http.Handler
+	srv     *BookStoreServer // 租户的服务器副本，供管理控制台使用
+	limiter *tenant.Limiter  // nil表示不限速
+}
+
+// forTenant returns a copy of bs whose books, covers and idempotency keys
+// are those of the tenant t.
+func (bs *BookStoreServer) forTenant(t tenant.Tenant) (*BookStoreServer, error) {
+	s, err := namespace.Of(bs.s, t.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := "tenants/" + t.Id + "/"
+	tbs := *bs
+	tbs.s = tenant.NewQuotaStore(s, t.MaxBooks)
+	if bs.blobs != nil {
+		tbs.blobs = blob.WithPrefix(bs.blobs, prefix)
+	}
+	tbs.idemKeys = idempotency.WithPrefix(bs.idemKeys, prefix)
+	tbs.gqlSchema = newGraphQLSchema(tbs.s, tbs.blobs)
+	tbs.router = tbs.routes()
+	return &tbs, nil
+}
+
+// tenantHandler returns the handler of the tenant t, creating it on first
+// use.
+func (bs *BookStoreServer) tenantHandler(t tenant.Tenant) (*tenantHandler, error) {
+	bs.tenants.mu.Lock()
+	defer bs.tenants.mu.Unlock()
+
+	if th, ok := bs.tenants.handlers[t.Id]; ok {
+		return th, nil
+	}
+	if _, err := bs.tenants.reg.Get(t.Id); err != nil {
+		return nil, err // 已被删除
+	}
+
+	tbs, err := bs.forTenant(t)
+	if err != nil {
+		return nil, err
+	}
+	th := &tenantHandler{Handler: tbs.api(tbs.router), srv: tbs}
+	if t.RateLimit > 0 {
+		th.limiter = tenant.NewLimiter(t.RateLimit, t.Burst)
+	}
+	bs.tenants.handlers[t.Id] = th
+	return th, nil
+}
+
+// tenancy dispatches each request to the handler of its tenant. Admin
+// requests, the OpenAPI document and the debug variables are served by
+// next, outside of any tenant. The console under /admin finds the tenant
+// from its own session.
+func (bs *BookStoreServer) tenancy(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case strings.HasPrefix(req.URL.Path, "/admin/"),
+			req.URL.Path == "/openapi.json", req.URL.Path == "/debug/vars":
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		t, status, err := bs.resolveTenant(req)
+		if err != nil {
+			if status == http.StatusUnauthorized {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="bookstore"`)
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		th, err := bs.tenantHandler(t)
+		if err != nil {
+			http.Error(w, "unknown tenant", http.StatusUnauthorized)
+			return
+		}
+		if th.limiter != nil {
+			if ok, wait := th.limiter.Allow(); !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				http.Error(w, "tenant request rate exceeded", http.StatusTooManyRequests)
+				return
+			}
+		}
+		th.ServeHTTP(w, req)
+	})
+}
+
+// resolveTenant finds the tenant of a request from its bearer token, or
+// from its X-Tenant header if the header is trusted. A header naming
+// another tenant than the token is rejected.
+func (bs *BookStoreServer) resolveTenant(req *http.Request) (tenant.Tenant, int, error) {
+	token := bearerToken(req)
+	header := req.Header.Get(TenantHeader)
+
+	if token != "" {
+		t, err := bs.tenants.reg.ByToken(token)
+		if err != nil {
+			return t, http.StatusUnauthorized, errors.New("invalid tenant token")
+		}
+		if header != "" && header != t.Id {
+			return t, http.StatusForbidden, errors.New("token does not belong to tenant " + header)
+		}
+		return t, http.StatusOK, nil
+	}
+
+	if header != "" && bs.tenants.trustHeader {
+		t, err := bs.tenants.reg.Get(header)
+		if err != nil {
+			return t, http.StatusUnauthorized, errors.New("unknown tenant " + header)
+		}
+		return t, http.StatusOK, nil
+	}
+	return tenant.Tenant{}, http.StatusUnauthorized, errors.New("tenant token required")
+}
+
+func bearerToken(req *http.Request) string {
+	auth := req.Header.Get("Authorization")
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(auth[7:])
+}
+
+// admin checks the admin token of a tenant management request, or writes
+// a 501 if tenancy is not enabled.
+func (bs *BookStoreServer) admin(w http.ResponseWriter, req *http.Request) bool {
+	if bs.tenants == nil {
+		http.Error(w, "tenancy is not enabled", http.StatusNotImplemented)
+		return false
+	}
+	return bs.authorizeAdmin(w, req)
+}
+
+// authorizeAdmin checks the admin token of a request, and writes a 401 if
+// it is wrong. Without tenancy and without admin token, every request is
+// allowed.
+func (bs *BookStoreServer) authorizeAdmin(w http.ResponseWriter, req *http.Request) bool {
+	if bs.tenants == nil && bs.adminToken == "" {
+		return true
+	}
+	return bs.requireAdmin(w, req)
+}
+
+// requireAdmin is like authorizeAdmin, but also refuses every request if
+// the server has no admin token.
+func (bs *BookStoreServer) requireAdmin(w http.ResponseWriter, req *http.Request) bool {
+	token := bearerToken(req)
+	if bs.adminToken == "" || token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(bs.adminToken)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="bookstore-admin"`)
+		http.Error(w, "admin token required", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func (bs *BookStoreServer) createTenantHandler(w http.ResponseWriter, req *http.Request) {
+	if !bs.admin(w, req) {
+		return
+	}
+
+	dec := json.NewDecoder(req.Body)
+	var t tenant.Tenant
+	if err := dec.Decode(&t); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := bs.tenants.reg.Create(&t); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	response(w, t)
+}
+
+func (bs *BookStoreServer) getAllTenantsHandler(w http.ResponseWriter, req *http.Request) {
+	if !bs.admin(w, req) {
+		return
+	}
+	response(w, bs.tenants.reg.List())
+}
+
+func (bs *BookStoreServer) getTenantHandler(w http.ResponseWriter, req *http.Request) {
+	if !bs.admin(w, req) {
+		return
+	}
+
+	t, err := bs.tenants.reg.Get(mux.Vars(req)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	t.Token = ""
+	response(w, t)
+}
+
+// delTenantHandler deletes a tenant and the books of its namespace. Its
+// covers are left in the blob store, which cannot list them.
+func (bs *BookStoreServer) delTenantHandler(w http.ResponseWriter, req *http.Request) {
+	if !bs.admin(w, req) {
+		return
+	}
+
+	id := mux.Vars(req)["id"]
+	bs.tenants.mu.Lock()
+	defer bs.tenants.mu.Unlock()
+
+	if err := bs.tenants.reg.Delete(id); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	delete(bs.tenants.handlers, id)
+	if err := namespace.Drop(bs.s, id); err != nil && !errors.Is(err, store.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
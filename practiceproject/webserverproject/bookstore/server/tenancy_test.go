@@ -0,0 +1,263 @@
+package server
+
+import (
+	"encoding/json"
+	memstore "github.com/Kate-liu/GoBeginner/webserverproject/bookstore/internal/store"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/server/tenant"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testAdminToken = "admin-secret"
+
+func doAs(bs *BookStoreServer, token, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	bs.srv.Handler.ServeHTTP(rr, req)
+	return rr
+}
+
+// createTenant creates a tenant through the admin endpoint and returns its
+// token.
+func createTenant(t *testing.T, bs *BookStoreServer, body string) string {
+	rr := doAs(bs, testAdminToken, "POST", "/admin/tenant", body)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("want %d, actual %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var tn tenant.Tenant
+	json.Unmarshal(rr.Body.Bytes(), &tn)
+	if tn.Token == "" {
+		t.Fatal("want a token, actual none")
+	}
+	return tn.Token
+}
+
+func newTenancyServer(s store.Store, opts ...Option) *BookStoreServer {
+	opts = append([]Option{WithTenancy(tenant.NewRegistry(), testAdminToken)}, opts...)
+	return newTestServer(s, opts...)
+}
+
+func TestTenantIsolation(t *testing.T) {
+	providers := map[string]store.Store{
+		"mem":         memstore.NewMemStore(),
+		"sharded-mem": memstore.NewShardedMemStore(4),
+	}
+	for name, s := range providers {
+		t.Run(name, func(t *testing.T) {
+			bs := newTenancyServer(s)
+			a := createTenant(t, bs, `{"id":"a"}`)
+			b := createTenant(t, bs, `{"id":"b"}`)
+
+			if rr := doAs(bs, a, "POST", "/book", `{"id":"1","name":"in a"}`); rr.Code != http.StatusOK {
+				t.Fatalf("want %d, actual %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+			}
+
+			if rr := doAs(bs, b, "GET", "/book/1", ""); rr.Code != http.StatusBadRequest {
+				t.Errorf("want %d, actual %d", http.StatusBadRequest, rr.Code)
+			}
+			if rr := doAs(bs, b, "GET", "/book", ""); strings.TrimSpace(rr.Body.String()) != "[]" {
+				t.Errorf("want [], actual %s", rr.Body.String())
+			}
+			if rr := doAs(bs, b, "DELETE", "/book/1", ""); rr.Code != http.StatusBadRequest {
+				t.Errorf("want %d, actual %d", http.StatusBadRequest, rr.Code)
+			}
+			rr := doAs(bs, b, "POST", "/graphql", `{"query":"{ book(id: \"1\") { name } books { totalCount } }"}`)
+			if want := `{"data":{"book":null,"books":{"totalCount":0}}}`; strings.TrimSpace(rr.Body.String()) != want {
+				t.Errorf("want %s, actual %s", want, rr.Body.String())
+			}
+
+			if rr = doAs(bs, b, "POST", "/book", `{"id":"1","name":"in b"}`); rr.Code != http.StatusOK {
+				t.Errorf("want %d, actual %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+			}
+			rr = doAs(bs, a, "GET", "/book/1", "")
+			var book store.Book
+			json.Unmarshal(rr.Body.Bytes(), &book)
+			if book.Name != "in a" {
+				t.Errorf("want in a, actual %s", book.Name)
+			}
+
+			if books, _ := s.GetAll(); len(books) != 0 {
+				t.Errorf("want no books outside of tenants, actual %d", len(books))
+			}
+		})
+	}
+}
+
+func TestTenantCatalogIsolation(t *testing.T) {
+	bs := newTenancyServer(memstore.NewMemStore())
+	a := createTenant(t, bs, `{"id":"a"}`)
+	b := createTenant(t, bs, `{"id":"b"}`)
+
+	if rr := doAs(bs, a, "POST", "/author", `{"id":"au1","name":"x"}`); rr.Code != http.StatusOK {
+		t.Fatalf("want %d, actual %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if rr := doAs(bs, b, "GET", "/author/au1", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("want %d, actual %d", http.StatusNotFound, rr.Code)
+	}
+	if rr := doAs(bs, b, "POST", "/member", `{"id":"m1","name":"y"}`); rr.Code != http.StatusOK {
+		t.Fatalf("want %d, actual %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if rr := doAs(bs, a, "GET", "/member/m1", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("want %d, actual %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestTenantAuth(t *testing.T) {
+	bs := newTenancyServer(memstore.NewMemStore())
+	a := createTenant(t, bs, `{"id":"a"}`)
+	createTenant(t, bs, `{"id":"b"}`)
+
+	if rr := doAs(bs, "", "GET", "/book", ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("want %d, actual %d", http.StatusUnauthorized, rr.Code)
+	}
+	if rr := doAs(bs, "wrong", "GET", "/book", ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("want %d, actual %d", http.StatusUnauthorized, rr.Code)
+	}
+	if rr := doAs(bs, a, "GET", "/admin/tenant", ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("want %d, actual %d", http.StatusUnauthorized, rr.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/book", nil)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+a)
+	req.Header.Set(TenantHeader, "b")
+	rr := httptest.NewRecorder()
+	bs.srv.Handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("want %d, actual %d", http.StatusForbidden, rr.Code)
+	}
+
+	// 未信任X-Tenant时，仅凭该头不能访问
+	req.Header.Del("Authorization")
+	rr = httptest.NewRecorder()
+	bs.srv.Handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("want %d, actual %d", http.StatusUnauthorized, rr.Code)
+	}
+
+	rr = doAs(bs, testAdminToken, "GET", "/admin/tenant", "")
+	if strings.Contains(rr.Body.String(), "token") {
+		t.Errorf("want tenants without tokens, actual %s", rr.Body.String())
+	}
+}
+
+func TestTenantHeader(t *testing.T) {
+	bs := newTenancyServer(memstore.NewMemStore(), WithTenantHeader())
+	createTenant(t, bs, `{"id":"a"}`)
+
+	for tenantId, want := range map[string]int{"a": http.StatusOK, "c": http.StatusUnauthorized} {
+		req := httptest.NewRequest("GET", "/book", nil)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(TenantHeader, tenantId)
+		rr := httptest.NewRecorder()
+		bs.srv.Handler.ServeHTTP(rr, req)
+		if rr.Code != want {
+			t.Errorf("tenant %s: want %d, actual %d", tenantId, want, rr.Code)
+		}
+	}
+}
+
+func TestTenantQuota(t *testing.T) {
+	bs := newTenancyServer(memstore.NewMemStore(), WithRequestValidation())
+	a := createTenant(t, bs, `{"id":"a","max_books":2}`)
+	b := createTenant(t, bs, `{"id":"b","max_books":1}`)
+
+	for _, id := range []string{"1", "2"} {
+		if rr := doAs(bs, a, "POST", "/book", `{"id":"`+id+`","name":"b`+id+`"}`); rr.Code != http.StatusOK {
+			t.Fatalf("want %d, actual %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+	}
+	if rr := doAs(bs, a, "POST", "/book", `{"id":"3","name":"b3"}`); rr.Code != http.StatusForbidden {
+		t.Errorf("want %d, actual %d", http.StatusForbidden, rr.Code)
+	}
+	if rr := doAs(bs, b, "POST", "/book", `{"id":"3","name":"b3"}`); rr.Code != http.StatusOK {
+		t.Errorf("want %d, actual %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	rr := doAs(bs, a, "POST", "/book:batch", `{"operations":[
+		{"op":"delete","id":"1"},
+		{"op":"create","book":{"id":"4","name":"b4"}},
+		{"op":"create","book":{"id":"5","name":"b5"}}]}`)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("want %d, actual %d: %s", http.StatusForbidden, rr.Code, rr.Body.String())
+	}
+	if rr = doAs(bs, a, "GET", "/book/1", ""); rr.Code != http.StatusOK {
+		t.Errorf("want %d, actual %d", http.StatusOK, rr.Code)
+	}
+}
+
+func TestTenantRateLimit(t *testing.T) {
+	bs := newTenancyServer(memstore.NewMemStore())
+	a := createTenant(t, bs, `{"id":"a","rate_limit":0.5,"burst":2}`)
+	b := createTenant(t, bs, `{"id":"b"}`)
+
+	for i := 0; i < 2; i++ {
+		if rr := doAs(bs, a, "GET", "/book", ""); rr.Code != http.StatusOK {
+			t.Fatalf("want %d, actual %d", http.StatusOK, rr.Code)
+		}
+	}
+	rr := doAs(bs, a, "GET", "/book", "")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("want %d, actual %d", http.StatusTooManyRequests, rr.Code)
+	}
+	if rr.Header().Get("Retry-After") == "" {
+		t.Error("want Retry-After, actual none")
+	}
+	if rr = doAs(bs, b, "GET", "/book", ""); rr.Code != http.StatusOK {
+		t.Errorf("want %d, actual %d", http.StatusOK, rr.Code)
+	}
+}
+
+func TestTenantDelete(t *testing.T) {
+	bs := newTenancyServer(memstore.NewMemStore())
+	a := createTenant(t, bs, `{"id":"a"}`)
+	doAs(bs, a, "POST", "/book", `{"id":"1"}`)
+
+	if rr := doAs(bs, testAdminToken, "DELETE", "/admin/tenant/a", ""); rr.Code != http.StatusOK {
+		t.Fatalf("want %d, actual %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if rr := doAs(bs, a, "GET", "/book", ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("want %d, actual %d", http.StatusUnauthorized, rr.Code)
+	}
+	if rr := doAs(bs, testAdminToken, "GET", "/admin/tenant/a", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("want %d, actual %d", http.StatusNotFound, rr.Code)
+	}
+
+	a = createTenant(t, bs, `{"id":"a"}`)
+	if rr := doAs(bs, a, "GET", "/book/1", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("want %d, actual %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+func TestTenancyDisabled(t *testing.T) {
+	bs := newTestServer(memstore.NewMemStore())
+	if rr := doAs(bs, testAdminToken, "GET", "/admin/tenant", ""); rr.Code != http.StatusNotImplemented {
+		t.Errorf("want %d, actual %d", http.StatusNotImplemented, rr.Code)
+	}
+}
+
+func TestTenancyOptionErrors(t *testing.T) {
+	cases := [][]Option{
+		{WithTenancy(tenant.NewRegistry(), testAdminToken), WithTCP("127.0.0.1:0")},
+		{WithTenancy(tenant.NewRegistry(), testAdminToken), WithLeader(10)},
+		{WithTenancy(tenant.NewRegistry(), testAdminToken), WithFollower("http://127.0.0.1:1", false)},
+		{WithTenantHeader()},
+	}
+	for i, opts := range cases {
+		if _, err := NewBookStoreServer(":0", memstore.NewMemStore(), opts...); err == nil {
+			t.Errorf("case %d: want an error, actual nil", i)
+		}
+	}
+
+	// WithTenantHeader可以在WithTenancy之前
+	if _, err := NewBookStoreServer(":0", memstore.NewMemStore(), WithTenantHeader(), WithTenancy(tenant.NewRegistry(), testAdminToken)); err != nil {
+		t.Errorf("want nil, actual %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package tenant
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket allowing rate requests per second on average
+// and bursts of burst requests.
+type Limiter struct {
+	sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+func NewLimiter(rate float64, burst int) *Limiter {
+	return &Limiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		now:    time.Now,
+	}
+}
+
+// Allow takes a token from the bucket. If there is none it returns false
+// and how long to wait for the next one.
+func (l *Limiter) Allow() (bool, time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+
+	now := l.now()
+	if !l.last.IsZero() {
+		l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	l.last = now
+
+	if l.tokens >= 1 {
+		l.tokens--
+		return true, 0
+	}
+	wait := (1 - l.tokens) / l.rate
+	return false, time.Duration(wait * float64(time.Second))
+}
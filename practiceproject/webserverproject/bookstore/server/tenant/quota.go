@@ -0,0 +1,92 @@
+package tenant
+
+import (
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	"sync"
+)
+
+// QuotaStore limits the number of books of a tenant. Its writes are
+// serialized, so that concurrent creates cannot exceed the quota.
+type QuotaStore struct {
+	store.Store
+	mu       sync.Mutex
+	maxBooks int
+}
+
+// NewQuotaStore returns a store keeping at most maxBooks books in s, zero
+// means no limit.
+func NewQuotaStore(s store.Store, maxBooks int) *QuotaStore {
+	return &QuotaStore{Store: s, maxBooks: maxBooks}
+}
+
+// Unwrap implements store.Wrapper, the optional interfaces of the store of
+// the tenant can be found through it.
+func (q *QuotaStore) Unwrap() store.Store {
+	return q.Store
+}
+
+func (q *QuotaStore) Create(b *store.Book) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err := q.check(q.Store); err != nil {
+		return err
+	}
+	return q.Store.Create(b)
+}
+
+func (q *QuotaStore) Update(b *store.Book) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.Store.Update(b)
+}
+
+func (q *QuotaStore) Delete(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.Store.Delete(id)
+}
+
+// check returns store.ErrQuota if one more book would exceed the quota.
+func (q *QuotaStore) check(s interface {
+	GetAll() ([]store.Book, error)
+}) error {
+	if q.maxBooks <= 0 {
+		return nil
+	}
+	books, err := s.GetAll()
+	if err != nil {
+		return err
+	}
+	if len(books) >= q.maxBooks {
+		return store.ErrQuota
+	}
+	return nil
+}
+
+// Transact implements store.TxStore if the store of the tenant does, and
+// returns store.ErrNotSupported otherwise.
+func (q *QuotaStore) Transact(fn func(store.Tx) error) error {
+	ts, ok := q.Store.(store.TxStore)
+	if !ok {
+		return store.ErrNotSupported
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return ts.Transact(func(tx store.Tx) error {
+		return fn(&quotaTx{Tx: tx, q: q})
+	})
+}
+
+type quotaTx struct {
+	store.Tx
+	q *QuotaStore
+}
+
+func (t *quotaTx) Create(b *store.Book) error {
+	if err := t.q.check(t.Tx); err != nil {
+		return err
+	}
+	return t.Tx.Create(b)
+}
@@ -0,0 +1,122 @@
+// Package tenant keeps the tenants sharing a bookstore deployment, such as
+// the branches of a library, and enforces their quotas.
+package tenant
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+var validId = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+type Tenant struct {
+	Id        string  `json:"id"`                   // 租户ID，也是其命名空间名
+	Name      string  `json:"name,omitempty"`       // 租户名称
+	Token     string  `json:"token,omitempty"`      // 访问令牌，仅创建时返回
+	MaxBooks  int     `json:"max_books,omitempty"`  // 最多图书数，0表示不限
+	RateLimit float64 `json:"rate_limit,omitempty"` // 每秒请求数，0表示不限
+	Burst     int     `json:"burst,omitempty"`      // 突发请求数
+}
+
+// Registry is an in-memory set of tenants, indexed by id and by token.
+type Registry struct {
+	sync.RWMutex
+	tenants map[string]*Tenant
+	tokens  map[string]string // 令牌 -> 租户ID
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		tenants: make(map[string]*Tenant),
+		tokens:  make(map[string]string),
+	}
+}
+
+// Create adds t to the registry, generating its token if it has none. It
+// returns store.ErrExist if the id or the token is already used.
+func (r *Registry) Create(t *Tenant) error {
+	if !validId.MatchString(t.Id) {
+		return errors.New("tenant: id must be 1 to 64 letters, digits, '-' or '_'")
+	}
+	if t.MaxBooks < 0 || t.RateLimit < 0 || t.Burst < 0 {
+		return errors.New("tenant: quotas must not be negative")
+	}
+	if t.Token == "" {
+		var b [16]byte
+		rand.Read(b[:])
+		t.Token = hex.EncodeToString(b[:])
+	}
+	if t.RateLimit > 0 && t.Burst == 0 {
+		t.Burst = int(t.RateLimit) + 1
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	if _, ok := r.tenants[t.Id]; ok {
+		return store.ErrExist
+	}
+	if _, ok := r.tokens[t.Token]; ok {
+		return store.ErrExist
+	}
+
+	nt := *t
+	r.tenants[t.Id] = &nt
+	r.tokens[t.Token] = t.Id
+	return nil
+}
+
+func (r *Registry) Get(id string) (Tenant, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	t, ok := r.tenants[id]
+	if !ok {
+		return Tenant{}, store.ErrNotFound
+	}
+	return *t, nil
+}
+
+// ByToken returns the tenant whose token is token.
+func (r *Registry) ByToken(token string) (Tenant, error) {
+	r.RLock()
+	id, ok := r.tokens[token]
+	r.RUnlock()
+
+	if !ok {
+		return Tenant{}, store.ErrNotFound
+	}
+	return r.Get(id)
+}
+
+// List returns the tenants sorted by id, without their tokens.
+func (r *Registry) List() []Tenant {
+	r.RLock()
+	defer r.RUnlock()
+
+	tenants := make([]Tenant, 0, len(r.tenants))
+	for _, t := range r.tenants {
+		nt := *t
+		nt.Token = ""
+		tenants = append(tenants, nt)
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].Id < tenants[j].Id })
+	return tenants
+}
+
+func (r *Registry) Delete(id string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	t, ok := r.tenants[id]
+	if !ok {
+		return store.ErrNotFound
+	}
+	delete(r.tokens, t.Token)
+	delete(r.tenants, id)
+	return nil
+}
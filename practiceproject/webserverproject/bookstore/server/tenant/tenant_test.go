@@ -0,0 +1,77 @@
+package tenant
+
+import (
+	memstore "github.com/Kate-liu/GoBeginner/webserverproject/bookstore/internal/store"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	a := &Tenant{Id: "a"}
+	if err := r.Create(a); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Create(&Tenant{Id: "a"}); err != store.ErrExist {
+		t.Errorf("want %v, actual %v", store.ErrExist, err)
+	}
+	if err := r.Create(&Tenant{Id: "a/b"}); err == nil {
+		t.Error("want error for invalid id, actual nil")
+	}
+
+	got, err := r.ByToken(a.Token)
+	if err != nil || got.Id != "a" {
+		t.Errorf("want a, actual %v, %v", got, err)
+	}
+	if err = r.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = r.ByToken(a.Token); err != store.ErrNotFound {
+		t.Errorf("want %v, actual %v", store.ErrNotFound, err)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := NewLimiter(2, 2)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.Allow(); !ok {
+			t.Fatalf("request %d: want allowed, actual denied", i)
+		}
+	}
+	ok, wait := l.Allow()
+	if ok || wait != 500*time.Millisecond {
+		t.Errorf("want denied for 500ms, actual %v, %v", ok, wait)
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if ok, _ = l.Allow(); !ok {
+		t.Error("want allowed, actual denied")
+	}
+}
+
+func TestQuotaStore(t *testing.T) {
+	q := NewQuotaStore(memstore.NewMemStore(), 1)
+	if err := q.Create(&store.Book{Id: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Create(&store.Book{Id: "2"}); err != store.ErrQuota {
+		t.Errorf("want %v, actual %v", store.ErrQuota, err)
+	}
+
+	err := q.Transact(func(tx store.Tx) error {
+		if err := tx.Delete("1"); err != nil {
+			return err
+		}
+		return tx.Create(&store.Book{Id: "2"})
+	})
+	if err != nil {
+		t.Errorf("want nil, actual %v", err)
+	}
+	if _, ok := store.Unwrap(q).(store.LendingStore); !ok {
+		t.Error("want the wrapped store to be found, actual not")
+	}
+}
@@ -0,0 +1,24 @@
+package blob
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+var ErrNotFound = errors.New("blob: not found")
+
+type Info struct {
+	ContentType string    // 内容类型，如image/png
+	Size        int64     // 字节数
+	ETag        string    // 内容摘要
+	ModTime     time.Time // 最后修改时间
+}
+
+// Store keeps binary objects, such as book covers, by key. Keys are
+// slash separated paths like "covers/978-7-111/original".
+type Store interface {
+	Put(key string, r io.Reader, contentType string) (Info, error) // 保存对象，已存在时覆盖
+	Get(key string) (io.ReadSeekCloser, Info, error)               // 读取对象，不存在时返回ErrNotFound
+	Delete(key string) error                                       // 删除对象，不存在时返回ErrNotFound
+}
@@ -0,0 +1,120 @@
+package local
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store/blob"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// Store is a blob.Store that keeps each object in a file under its root
+// directory, next to a ".meta" file holding the content type and etag.
+type Store struct {
+	root string
+}
+
+type meta struct {
+	ContentType string `json:"content_type"`
+	ETag        string `json:"etag"`
+}
+
+// New returns a Store rooted at dir, creating dir if needed.
+func New(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Store{root: dir}, nil
+}
+
+// file maps key to a path under the root. Cleaning the key as an absolute
+// path drops any ".." that would escape the root.
+func (s *Store) file(key string) string {
+	return filepath.Join(s.root, filepath.FromSlash(path.Clean("/"+key)))
+}
+
+// Put implements blob.Store. The object is written to a temporary file
+// first and renamed, so readers never see a partial object.
+func (s *Store) Put(key string, r io.Reader, contentType string) (blob.Info, error) {
+	name := s.file(key)
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return blob.Info{}, err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(name), ".blob-*")
+	if err != nil {
+		return blob.Info{}, err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err != nil {
+		return blob.Info{}, err
+	}
+
+	m := meta{ContentType: contentType, ETag: `"` + hex.EncodeToString(h.Sum(nil))[:32] + `"`}
+	data, _ := json.Marshal(m)
+	if err = ioutil.WriteFile(name+".meta", data, 0644); err != nil {
+		return blob.Info{}, err
+	}
+	if err = os.Rename(tmp.Name(), name); err != nil {
+		return blob.Info{}, err
+	}
+
+	fi, err := os.Stat(name)
+	if err != nil {
+		return blob.Info{}, err
+	}
+	return blob.Info{ContentType: m.ContentType, Size: n, ETag: m.ETag, ModTime: fi.ModTime()}, nil
+}
+
+// Get implements blob.Store.
+func (s *Store) Get(key string) (io.ReadSeekCloser, blob.Info, error) {
+	name := s.file(key)
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil, blob.Info{}, blob.ErrNotFound
+	}
+	if err != nil {
+		return nil, blob.Info{}, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, blob.Info{}, err
+	}
+
+	var m meta
+	if data, err := ioutil.ReadFile(name + ".meta"); err == nil {
+		json.Unmarshal(data, &m)
+	}
+	if m.ContentType == "" {
+		m.ContentType = "application/octet-stream"
+	}
+	return f, blob.Info{ContentType: m.ContentType, Size: fi.Size(), ETag: m.ETag, ModTime: fi.ModTime()}, nil
+}
+
+// Delete implements blob.Store.
+func (s *Store) Delete(key string) error {
+	name := s.file(key)
+	err := os.Remove(name)
+	if os.IsNotExist(err) {
+		return blob.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	os.Remove(name + ".meta")
+	return nil
+}
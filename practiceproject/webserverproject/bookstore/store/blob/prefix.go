@@ -0,0 +1,26 @@
+package blob
+
+import "io"
+
+type prefixed struct {
+	s      Store
+	prefix string
+}
+
+// WithPrefix returns a Store keeping its objects in s under keys starting
+// with prefix, such as "tenants/a/".
+func WithPrefix(s Store, prefix string) Store {
+	return &prefixed{s: s, prefix: prefix}
+}
+
+func (p *prefixed) Put(key string, r io.Reader, contentType string) (Info, error) {
+	return p.s.Put(p.prefix+key, r, contentType)
+}
+
+func (p *prefixed) Get(key string) (io.ReadSeekCloser, Info, error) {
+	return p.s.Get(p.prefix + key)
+}
+
+func (p *prefixed) Delete(key string) error {
+	return p.s.Delete(p.prefix + key)
+}
@@ -0,0 +1,36 @@
+package store
+
+type Author struct {
+	Id   string `json:"id"`   // 作者ID
+	Name string `json:"name"` // 作者姓名
+}
+
+type Press struct {
+	Id   string `json:"id"`   // 出版社ID
+	Name string `json:"name"` // 出版社名称
+}
+
+type AuthorStore interface {
+	CreateAuthor(*Author) error       // 创建一个新作者条目
+	UpdateAuthor(*Author) error       // 更新某作者条目
+	GetAuthor(string) (Author, error) // 获取某作者信息
+	GetAllAuthors() ([]Author, error) // 获取所有作者信息
+	DeleteAuthor(string) error        // 删除某作者条目，仍被图书引用时返回ErrInUse
+}
+
+type PressStore interface {
+	CreatePress(*Press) error        // 创建一个新出版社条目
+	UpdatePress(*Press) error        // 更新某出版社条目
+	GetPress(string) (Press, error)  // 获取某出版社信息
+	GetAllPresses() ([]Press, error) // 获取所有出版社信息
+	DeletePress(string) error        // 删除某出版社条目，仍被图书引用时返回ErrInUse
+}
+
+// CatalogStore is a Store that also keeps authors and presses, and checks
+// that Book.AuthorIds and Book.PressId refer to existing entries, returning
+// ErrReference otherwise.
+type CatalogStore interface {
+	Store
+	AuthorStore
+	PressStore
+}
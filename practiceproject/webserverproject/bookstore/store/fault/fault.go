@@ -0,0 +1,249 @@
+// Package fault wraps a store.Store to inject latency, errors and panics
+// into its book operations, for testing clients and the error paths of the
+// server. The faults are set at runtime on an Injector, shared by all the
+// stores it wraps.
+package fault
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInjected = errors.New("fault: injected error")
+	ErrPanic    = errors.New("fault: injected panic")
+)
+
+// Op is a store operation faults can be injected into.
+type Op string
+
+const (
+	OpCreate   Op = "create"
+	OpUpdate   Op = "update"
+	OpGet      Op = "get"
+	OpGetAll   Op = "getall"
+	OpDelete   Op = "delete"
+	OpTransact Op = "transact"
+)
+
+// Ops lists the operations that accept faults.
+var Ops = []Op{OpCreate, OpUpdate, OpGet, OpGetAll, OpDelete, OpTransact}
+
+// errorsByName are the errors a Rule can return, so that the mapping of
+// store errors to http status codes can be tested.
+var errorsByName = map[string]error{
+	"injected":      ErrInjected,
+	"not_found":     store.ErrNotFound,
+	"exist":         store.ErrExist,
+	"in_use":        store.ErrInUse,
+	"reference":     store.ErrReference,
+	"not_supported": store.ErrNotSupported,
+	"quota":         store.ErrQuota,
+}
+
+// Rule is the fault injected into an operation. The latency is added
+// before the operation, then the operation panics with a probability of
+// PanicRate, or fails with a probability of ErrorRate.
+type Rule struct {
+	Latency   time.Duration // 固定延迟
+	Jitter    time.Duration // 额外的随机延迟，取值[0, Jitter)
+	ErrorRate float64       // 返回错误的概率，取值[0, 1]
+	Error     string        // 返回的错误名，如not_found，默认为injected
+	PanicRate float64       // panic的概率，取值[0, 1]
+}
+
+type ruleJSON struct {
+	Latency   string  `json:"latency,omitempty"` // 如"250ms"
+	Jitter    string  `json:"jitter,omitempty"`
+	ErrorRate float64 `json:"error_rate,omitempty"`
+	Error     string  `json:"error,omitempty"`
+	PanicRate float64 `json:"panic_rate,omitempty"`
+}
+
+func (r Rule) MarshalJSON() ([]byte, error) {
+	rj := ruleJSON{ErrorRate: r.ErrorRate, Error: r.Error, PanicRate: r.PanicRate}
+	if r.Latency > 0 {
+		rj.Latency = r.Latency.String()
+	}
+	if r.Jitter > 0 {
+		rj.Jitter = r.Jitter.String()
+	}
+	return json.Marshal(rj)
+}
+
+func (r *Rule) UnmarshalJSON(data []byte) error {
+	var rj ruleJSON
+	if err := json.Unmarshal(data, &rj); err != nil {
+		return err
+	}
+
+	*r = Rule{ErrorRate: rj.ErrorRate, Error: rj.Error, PanicRate: rj.PanicRate}
+	var err error
+	if rj.Latency != "" {
+		if r.Latency, err = time.ParseDuration(rj.Latency); err != nil {
+			return fmt.Errorf("fault: latency: %v", err)
+		}
+	}
+	if rj.Jitter != "" {
+		if r.Jitter, err = time.ParseDuration(rj.Jitter); err != nil {
+			return fmt.Errorf("fault: jitter: %v", err)
+		}
+	}
+	return nil
+}
+
+// Validate checks the ranges of the fields of r.
+func (r Rule) Validate() error {
+	switch {
+	case r.Latency < 0 || r.Jitter < 0:
+		return errors.New("fault: latency and jitter must not be negative")
+	case r.ErrorRate < 0 || r.ErrorRate > 1:
+		return errors.New("fault: error_rate must be between 0 and 1")
+	case r.PanicRate < 0 || r.PanicRate > 1:
+		return errors.New("fault: panic_rate must be between 0 and 1")
+	}
+	if _, ok := errorsByName[r.Error]; r.Error != "" && !ok {
+		names := make([]string, 0, len(errorsByName))
+		for name := range errorsByName {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("fault: unknown error %q, want one of %v", r.Error, names)
+	}
+	return nil
+}
+
+func validOp(op Op) bool {
+	for _, o := range Ops {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+// Injector holds the rules of each operation, and counts the faults it
+// has injected.
+type Injector struct {
+	mu       sync.RWMutex
+	rules    map[Op]Rule
+	injected map[Op]int
+
+	randMu sync.Mutex
+	rand   *rand.Rand
+	sleep  func(time.Duration) // 便于测试
+}
+
+func NewInjector() *Injector {
+	return &Injector{
+		rules:    make(map[Op]Rule),
+		injected: make(map[Op]int),
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		sleep:    time.Sleep,
+	}
+}
+
+// Set replaces the rule of op.
+func (inj *Injector) Set(op Op, r Rule) error {
+	if !validOp(op) {
+		return fmt.Errorf("fault: unknown operation %q", op)
+	}
+	if err := r.Validate(); err != nil {
+		return err
+	}
+
+	inj.mu.Lock()
+	defer inj.mu.Unlock()
+	inj.rules[op] = r
+	return nil
+}
+
+// Clear removes the rule of op.
+func (inj *Injector) Clear(op Op) {
+	inj.mu.Lock()
+	defer inj.mu.Unlock()
+	delete(inj.rules, op)
+}
+
+// Reset removes all the rules and the counts.
+func (inj *Injector) Reset() {
+	inj.mu.Lock()
+	defer inj.mu.Unlock()
+	inj.rules = make(map[Op]Rule)
+	inj.injected = make(map[Op]int)
+}
+
+// Rules returns a copy of the rules.
+func (inj *Injector) Rules() map[Op]Rule {
+	inj.mu.RLock()
+	defer inj.mu.RUnlock()
+
+	rules := make(map[Op]Rule, len(inj.rules))
+	for op, r := range inj.rules {
+		rules[op] = r
+	}
+	return rules
+}
+
+// Injected returns how many errors and panics were injected into each
+// operation since the last Reset.
+func (inj *Injector) Injected() map[Op]int {
+	inj.mu.RLock()
+	defer inj.mu.RUnlock()
+
+	injected := make(map[Op]int, len(inj.injected))
+	for op, n := range inj.injected {
+		injected[op] = n
+	}
+	return injected
+}
+
+func (inj *Injector) float64() float64 {
+	inj.randMu.Lock()
+	defer inj.randMu.Unlock()
+	return inj.rand.Float64()
+}
+
+// inject applies the rule of op. It may sleep, panic, or return the error
+// the operation must fail with.
+func (inj *Injector) inject(op Op) error {
+	inj.mu.RLock()
+	r, ok := inj.rules[op]
+	inj.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	delay := r.Latency
+	if r.Jitter > 0 {
+		delay += time.Duration(inj.float64() * float64(r.Jitter))
+	}
+	if delay > 0 {
+		inj.sleep(delay)
+	}
+
+	if r.PanicRate > 0 && inj.float64() < r.PanicRate {
+		inj.count(op)
+		panic(fmt.Errorf("%w in %s", ErrPanic, op))
+	}
+	if r.ErrorRate > 0 && inj.float64() < r.ErrorRate {
+		inj.count(op)
+		if err, ok := errorsByName[r.Error]; ok {
+			return err
+		}
+		return ErrInjected
+	}
+	return nil
+}
+
+func (inj *Injector) count(op Op) {
+	inj.mu.Lock()
+	defer inj.mu.Unlock()
+	inj.injected[op]++
+}
@@ -0,0 +1,117 @@
+package fault
+
+import (
+	"encoding/json"
+	"errors"
+	memstore "github.com/Kate-liu/GoBeginner/webserverproject/bookstore/internal/store"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	"testing"
+	"time"
+)
+
+func TestInjectErrors(t *testing.T) {
+	inj := NewInjector()
+	s := Wrap(memstore.NewMemStore(), inj)
+	if err := s.Create(&store.Book{Id: "1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	inj.Set(OpGet, Rule{ErrorRate: 1})
+	if _, err := s.Get("1"); err != ErrInjected {
+		t.Errorf("want %v, actual %v", ErrInjected, err)
+	}
+	inj.Set(OpGet, Rule{ErrorRate: 1, Error: "not_found"})
+	if _, err := s.Get("1"); err != store.ErrNotFound {
+		t.Errorf("want %v, actual %v", store.ErrNotFound, err)
+	}
+	if books, err := s.GetAll(); err != nil || len(books) != 1 {
+		t.Errorf("want 1 book, actual %v, %v", books, err)
+	}
+	if n := inj.Injected()[OpGet]; n != 2 {
+		t.Errorf("want 2 injected, actual %d", n)
+	}
+
+	inj.Clear(OpGet)
+	if _, err := s.Get("1"); err != nil {
+		t.Errorf("want nil, actual %v", err)
+	}
+
+	inj.Set(OpTransact, Rule{ErrorRate: 1})
+	called := false
+	err := s.Transact(func(store.Tx) error {
+		called = true
+		return nil
+	})
+	if err != ErrInjected || called {
+		t.Errorf("want %v before the transaction, actual %v, called %v", ErrInjected, err, called)
+	}
+}
+
+func TestInjectLatency(t *testing.T) {
+	inj := NewInjector()
+	var slept time.Duration
+	inj.sleep = func(d time.Duration) { slept += d }
+	s := Wrap(memstore.NewMemStore(), inj)
+
+	inj.Set(OpCreate, Rule{Latency: 100 * time.Millisecond, Jitter: 50 * time.Millisecond})
+	if err := s.Create(&store.Book{Id: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if slept < 100*time.Millisecond || slept >= 150*time.Millisecond {
+		t.Errorf("want a latency in [100ms, 150ms), actual %s", slept)
+	}
+}
+
+func TestInjectPanic(t *testing.T) {
+	inj := NewInjector()
+	s := Wrap(memstore.NewMemStore(), inj)
+	inj.Set(OpDelete, Rule{PanicRate: 1})
+
+	defer func() {
+		r := recover()
+		err, ok := r.(error)
+		if !ok || !errors.Is(err, ErrPanic) {
+			t.Errorf("want panic with %v, actual %v", ErrPanic, r)
+		}
+	}()
+	s.Delete("1")
+}
+
+func TestRule(t *testing.T) {
+	var r Rule
+	if err := json.Unmarshal([]byte(`{"latency":"250ms","error_rate":0.5,"error":"exist"}`), &r); err != nil {
+		t.Fatal(err)
+	}
+	want := Rule{Latency: 250 * time.Millisecond, ErrorRate: 0.5, Error: "exist"}
+	if r != want {
+		t.Errorf("want %v, actual %v", want, r)
+	}
+	data, _ := json.Marshal(r)
+	if string(data) != `{"latency":"250ms","error_rate":0.5,"error":"exist"}` {
+		t.Errorf("want the same json, actual %s", data)
+	}
+
+	inj := NewInjector()
+	for _, bad := range []Rule{{ErrorRate: 2}, {PanicRate: -1}, {Latency: -1}, {Error: "boom"}} {
+		if err := inj.Set(OpGet, bad); err == nil {
+			t.Errorf("rule %v: want error, actual nil", bad)
+		}
+	}
+	if err := inj.Set("fly", Rule{}); err == nil {
+		t.Error("want error for unknown operation, actual nil")
+	}
+}
+
+func TestNamespace(t *testing.T) {
+	inj := NewInjector()
+	s := Wrap(memstore.NewMemStore(), inj)
+	ns, err := s.Namespace("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inj.Set(OpCreate, Rule{ErrorRate: 1})
+	if err = ns.Create(&store.Book{Id: "1"}); err != ErrInjected {
+		t.Errorf("want %v, actual %v", ErrInjected, err)
+	}
+}
@@ -0,0 +1,95 @@
+package fault
+
+import (
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+)
+
+// Store injects the faults of an Injector into the book operations of the
+// store it wraps. The optional interfaces of the wrapped store, such as
+// store.LendingStore, are reachable through Unwrap without faults.
+type Store struct {
+	s   store.Store
+	inj *Injector
+}
+
+// Wrap returns s with the faults of inj.
+func Wrap(s store.Store, inj *Injector) *Store {
+	return &Store{s: s, inj: inj}
+}
+
+// Unwrap implements store.Wrapper.
+func (fs *Store) Unwrap() store.Store {
+	return fs.s
+}
+
+func (fs *Store) Create(book *store.Book) error {
+	if err := fs.inj.inject(OpCreate); err != nil {
+		return err
+	}
+	return fs.s.Create(book)
+}
+
+func (fs *Store) Update(book *store.Book) error {
+	if err := fs.inj.inject(OpUpdate); err != nil {
+		return err
+	}
+	return fs.s.Update(book)
+}
+
+func (fs *Store) Get(id string) (store.Book, error) {
+	if err := fs.inj.inject(OpGet); err != nil {
+		return store.Book{}, err
+	}
+	return fs.s.Get(id)
+}
+
+func (fs *Store) GetAll() ([]store.Book, error) {
+	if err := fs.inj.inject(OpGetAll); err != nil {
+		return nil, err
+	}
+	return fs.s.GetAll()
+}
+
+func (fs *Store) Delete(id string) error {
+	if err := fs.inj.inject(OpDelete); err != nil {
+		return err
+	}
+	return fs.s.Delete(id)
+}
+
+// Transact implements store.TxStore if the wrapped store does, and returns
+// store.ErrNotSupported otherwise. The faults of OpTransact are injected
+// before the transaction starts.
+func (fs *Store) Transact(fn func(store.Tx) error) error {
+	ts, ok := fs.s.(store.TxStore)
+	if !ok {
+		return store.ErrNotSupported
+	}
+	if err := fs.inj.inject(OpTransact); err != nil {
+		return err
+	}
+	return ts.Transact(fn)
+}
+
+// Namespace implements store.Namespacer if the wrapped store does, the
+// store of the namespace gets the same faults.
+func (fs *Store) Namespace(name string) (store.Store, error) {
+	ns, ok := fs.s.(store.Namespacer)
+	if !ok {
+		return nil, store.ErrNotSupported
+	}
+	s, err := ns.Namespace(name)
+	if err != nil {
+		return nil, err
+	}
+	return Wrap(s, fs.inj), nil
+}
+
+// DropNamespace implements store.Namespacer if the wrapped store does.
+func (fs *Store) DropNamespace(name string) error {
+	ns, ok := fs.s.(store.Namespacer)
+	if !ok {
+		return store.ErrNotSupported
+	}
+	return ns.DropNamespace(name)
+}
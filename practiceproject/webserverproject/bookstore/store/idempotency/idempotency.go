@@ -0,0 +1,42 @@
+package idempotency
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+var (
+	ErrInProgress = errors.New("idempotency: request with the same key is in progress")
+	ErrMismatch   = errors.New("idempotency: key reused with a different request")
+	ErrFull       = errors.New("idempotency: too many requests in progress")
+)
+
+// Record is the stored response of the first request made with an
+// Idempotency-Key.
+type Record struct {
+	Fingerprint string      // 请求指纹(method + uri + body 的摘要)
+	StatusCode  int         // 响应状态码
+	Header      http.Header // 响应头
+	Body        []byte      // 响应体
+	ExpiresAt   time.Time   // 过期时间
+}
+
+// KeyStore keeps the responses of idempotent requests. It is independent of
+// store.Store, so any key store can be combined with any book store provider.
+type KeyStore interface {
+	// Reserve claims key for the request identified by fingerprint.
+	// It returns (nil, nil) if the key is newly reserved and the request
+	// should be executed, the saved Record if the request has already been
+	// completed, ErrMismatch if the key was used by a different request,
+	// ErrInProgress if the first request has not completed yet, and
+	// ErrFull if no more keys can be reserved until requests complete.
+	Reserve(key, fingerprint string, ttl time.Duration) (*Record, error)
+
+	// Save stores the response of a reserved key.
+	Save(key string, rec *Record) error
+
+	// Release drops the reservation of key, so that the request can be
+	// retried.
+	Release(key string) error
+}
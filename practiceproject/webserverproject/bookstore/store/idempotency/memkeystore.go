@@ -0,0 +1,131 @@
+package idempotency
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+const defaultCapacity = 10000
+
+type entry struct {
+	key         string
+	fingerprint string
+	expiresAt   time.Time
+	rec         *Record // nil表示请求仍在处理中
+}
+
+// MemKeyStore is a bounded in-memory KeyStore. When it is full, the least
+// recently used key whose request has completed or expired is evicted; if
+// every key is held by a request in progress, new keys get ErrFull.
+type MemKeyStore struct {
+	sync.Mutex
+	capacity int
+	ll       *list.List
+	keys     map[string]*list.Element
+	now      func() time.Time
+}
+
+// NewMemKeyStore returns a MemKeyStore holding at most capacity keys.
+func NewMemKeyStore(capacity int) *MemKeyStore {
+	if capacity <= 0 {
+		capacity = defaultCapacity
+	}
+	return &MemKeyStore{
+		capacity: capacity,
+		ll:       list.New(),
+		keys:     make(map[string]*list.Element),
+		now:      time.Now,
+	}
+}
+
+// Reserve implements KeyStore.
+func (ks *MemKeyStore) Reserve(key, fingerprint string, ttl time.Duration) (*Record, error) {
+	ks.Lock()
+	defer ks.Unlock()
+
+	now := ks.now()
+	if el, ok := ks.keys[key]; ok {
+		e := el.Value.(*entry)
+		if now.Before(e.expiresAt) {
+			ks.ll.MoveToFront(el)
+			if e.fingerprint != fingerprint {
+				return nil, ErrMismatch
+			}
+			if e.rec == nil {
+				return nil, ErrInProgress
+			}
+			return e.rec, nil
+		}
+		ks.remove(el)
+	}
+
+	if !ks.evict(now) {
+		return nil, ErrFull
+	}
+	ks.keys[key] = ks.ll.PushFront(&entry{
+		key:         key,
+		fingerprint: fingerprint,
+		expiresAt:   now.Add(ttl),
+	})
+	return nil, nil
+}
+
+// Save implements KeyStore.
+func (ks *MemKeyStore) Save(key string, rec *Record) error {
+	ks.Lock()
+	defer ks.Unlock()
+
+	el, ok := ks.keys[key]
+	if !ok {
+		// the reservation has expired and been evicted, keep the record anyway.
+		if !ks.evict(ks.now()) {
+			return ErrFull
+		}
+		el = ks.ll.PushFront(&entry{key: key, fingerprint: rec.Fingerprint})
+		ks.keys[key] = el
+	}
+
+	e := el.Value.(*entry)
+	e.rec = rec
+	e.expiresAt = rec.ExpiresAt
+	return nil
+}
+
+// Release implements KeyStore.
+func (ks *MemKeyStore) Release(key string) error {
+	ks.Lock()
+	defer ks.Unlock()
+
+	if el, ok := ks.keys[key]; ok {
+		ks.remove(el)
+	}
+	return nil
+}
+
+// Len returns the number of keys in the store, including expired keys that
+// have not been evicted yet.
+func (ks *MemKeyStore) Len() int {
+	ks.Lock()
+	defer ks.Unlock()
+	return ks.ll.Len()
+}
+
+// evict makes room for a new key, removing the least recently used keys
+// that are completed or expired. It reports false if the store is full of
+// requests in progress, which must not lose their reservation.
+func (ks *MemKeyStore) evict(now time.Time) bool {
+	for el := ks.ll.Back(); el != nil && ks.ll.Len() >= ks.capacity; {
+		prev := el.Prev()
+		if e := el.Value.(*entry); e.rec != nil || !now.Before(e.expiresAt) {
+			ks.remove(el)
+		}
+		el = prev
+	}
+	return ks.ll.Len() < ks.capacity
+}
+
+func (ks *MemKeyStore) remove(el *list.Element) {
+	ks.ll.Remove(el)
+	delete(ks.keys, el.Value.(*entry).key)
+}
@@ -0,0 +1,86 @@
+package idempotency
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemKeyStoreBounded(t *testing.T) {
+	ks := NewMemKeyStore(2)
+	for _, key := range []string{"a", "b", "c"} {
+		if _, err := ks.Reserve(key, "fp", time.Minute); err != nil {
+			t.Errorf("want nil, actual %s", err.Error())
+		}
+		ks.Save(key, &Record{Fingerprint: "fp", StatusCode: 200, ExpiresAt: time.Now().Add(time.Minute)})
+	}
+
+	if ks.Len() != 2 {
+		t.Errorf("want 2, actual %d", ks.Len())
+	}
+
+	// "a"是最久未使用的key，已被淘汰，可以重新预留
+	rec, err := ks.Reserve("a", "other", time.Minute)
+	if rec != nil || err != nil {
+		t.Errorf("want nil, nil, actual %v, %v", rec, err)
+	}
+}
+
+func TestMemKeyStoreFullInProgress(t *testing.T) {
+	now := time.Now()
+	ks := NewMemKeyStore(2)
+	ks.now = func() time.Time { return now }
+
+	ks.Reserve("a", "fp", time.Minute)
+	ks.Reserve("b", "fp", 2*time.Minute)
+	ks.Save("b", &Record{Fingerprint: "fp", StatusCode: 200, ExpiresAt: now.Add(time.Minute)})
+
+	// 淘汰已完成的"b"，而不是处理中的"a"
+	if _, err := ks.Reserve("c", "fp", time.Minute); err != nil {
+		t.Errorf("want nil, actual %v", err)
+	}
+	if _, err := ks.Reserve("a", "other", time.Minute); err != ErrMismatch {
+		t.Errorf("want %v, actual %v", ErrMismatch, err)
+	}
+
+	// 所有key都在处理中时拒绝新key
+	if _, err := ks.Reserve("d", "fp", time.Minute); err != ErrFull {
+		t.Errorf("want %v, actual %v", ErrFull, err)
+	}
+	if _, err := ks.Reserve("a", "fp", time.Minute); err != ErrInProgress {
+		t.Errorf("want %v, actual %v", ErrInProgress, err)
+	}
+
+	// 过期的预留可以被淘汰
+	now = now.Add(2 * time.Minute)
+	if _, err := ks.Reserve("d", "fp", time.Minute); err != nil {
+		t.Errorf("want nil, actual %v", err)
+	}
+}
+
+func TestMemKeyStoreExpire(t *testing.T) {
+	now := time.Now()
+	ks := NewMemKeyStore(10)
+	ks.now = func() time.Time { return now }
+
+	ks.Reserve("a", "fp", time.Minute)
+	ks.Save("a", &Record{Fingerprint: "fp", StatusCode: 200, ExpiresAt: now.Add(time.Minute)})
+
+	if _, err := ks.Reserve("a", "other", time.Minute); err != ErrMismatch {
+		t.Errorf("want %v, actual %v", ErrMismatch, err)
+	}
+
+	rec, err := ks.Reserve("a", "fp", time.Minute)
+	if err != nil || rec == nil || rec.StatusCode != 200 {
+		t.Errorf("want saved record, actual %v, %v", rec, err)
+	}
+
+	now = now.Add(2 * time.Minute)
+	rec, err = ks.Reserve("a", "other", time.Minute)
+	if rec != nil || err != nil {
+		t.Errorf("want nil, nil, actual %v, %v", rec, err)
+	}
+
+	if _, err := ks.Reserve("a", "other", time.Minute); err != ErrInProgress {
+		t.Errorf("want %v, actual %v", ErrInProgress, err)
+	}
+}
@@ -0,0 +1,26 @@
+package idempotency
+
+import "time"
+
+type prefixed struct {
+	ks     KeyStore
+	prefix string
+}
+
+// WithPrefix returns a KeyStore keeping its keys in ks with prefix added,
+// so that clients sharing ks cannot replay each other's responses.
+func WithPrefix(ks KeyStore, prefix string) KeyStore {
+	return &prefixed{ks: ks, prefix: prefix}
+}
+
+func (p *prefixed) Reserve(key, fingerprint string, ttl time.Duration) (*Record, error) {
+	return p.ks.Reserve(p.prefix+key, fingerprint, ttl)
+}
+
+func (p *prefixed) Save(key string, rec *Record) error {
+	return p.ks.Save(p.prefix+key, rec)
+}
+
+func (p *prefixed) Release(key string) error {
+	return p.ks.Release(p.prefix + key)
+}
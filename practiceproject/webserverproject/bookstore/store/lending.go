@@ -0,0 +1,80 @@
+package store
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrUnavailable = errors.New("no copy available")
+	ErrAvailable   = errors.New("copy available, borrow it instead of reserving")
+	ErrRenewLimit  = errors.New("renew limit reached")
+	ErrReserved    = errors.New("reserved by other members")
+	ErrReturned    = errors.New("loan already returned")
+	ErrLendingData = errors.New("inventories do not match the loans and reservations")
+)
+
+const (
+	DefaultLoanPeriod  = 14 * 24 * time.Hour // 默认借期
+	DefaultMaxRenewals = 2                   // 默认最多续借次数
+)
+
+type Inventory struct {
+	BookId    string `json:"book_id"`   // 图书ISBN ID
+	Total     int    `json:"total"`     // 馆藏副本总数
+	OnLoan    int    `json:"on_loan"`   // 已借出的副本数
+	Held      int    `json:"held"`      // 为预约读者保留的副本数
+	Available int    `json:"available"` // 可借的副本数
+}
+
+type Member struct {
+	Id   string `json:"id"`   // 读者ID
+	Name string `json:"name"` // 读者姓名
+}
+
+type Loan struct {
+	Id         string     `json:"id"`                    // 借阅ID
+	BookId     string     `json:"book_id"`               // 图书ISBN ID
+	MemberId   string     `json:"member_id"`             // 读者ID
+	BorrowedAt time.Time  `json:"borrowed_at"`           // 借出时间
+	DueAt      time.Time  `json:"due_at"`                // 应还时间
+	ReturnedAt *time.Time `json:"returned_at,omitempty"` // 归还时间，未归还时为空
+	Renewals   int        `json:"renewals"`              // 已续借次数
+}
+
+// Active reports whether the loan has not been returned yet.
+func (l *Loan) Active() bool {
+	return l.ReturnedAt == nil
+}
+
+type Reservation struct {
+	BookId    string    `json:"book_id"`    // 图书ISBN ID
+	MemberId  string    `json:"member_id"`  // 读者ID
+	CreatedAt time.Time `json:"created_at"` // 预约时间
+	Ready     bool      `json:"ready"`      // 是否已有副本为该读者保留
+}
+
+// LendingStore keeps the copies of the books, the members and their loans.
+// A returned copy is held for the first member in the reservation queue of
+// the book, and only that member can borrow it.
+type LendingStore interface {
+	SetInventory(bookId string, total int) (Inventory, error) // 设置馆藏副本数，少于已借出和保留的副本数时返回ErrInUse
+	GetInventory(bookId string) (Inventory, error)            // 获取馆藏信息
+
+	CreateMember(*Member) error            // 创建一个新读者条目
+	GetMember(string) (Member, error)      // 获取某读者信息
+	GetAllMembers() ([]Member, error)      // 获取所有读者信息
+	DeleteMember(string) error             // 删除某读者条目，有未还借阅时返回ErrInUse
+	GetMemberLoans(string) ([]Loan, error) // 获取某读者的所有借阅
+
+	Borrow(bookId, memberId string) (Loan, error) // 借书
+	Renew(loanId string) (Loan, error)            // 续借
+	Return(loanId string) (Loan, error)           // 还书
+	GetLoan(string) (Loan, error)                 // 获取某借阅信息
+	GetAllLoans() ([]Loan, error)                 // 获取所有借阅信息
+	GetOverdueLoans() ([]Loan, error)             // 获取所有逾期未还的借阅
+
+	Reserve(bookId, memberId string) (Reservation, error) // 预约，仅在无可借副本时允许
+	CancelReservation(bookId, memberId string) error      // 取消预约
+	GetReservations(bookId string) ([]Reservation, error) // 获取某图书的预约队列
+}
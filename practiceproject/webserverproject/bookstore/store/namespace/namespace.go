@@ -0,0 +1,159 @@
+// Package namespace gives every provider independent keyspaces. Providers
+// implementing store.Namespacer keep them natively, the others are wrapped
+// by a Store that prefixes the book ids.
+package namespace
+
+import (
+	"errors"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	"strings"
+)
+
+const sep = "/"
+
+// Of returns the store of the namespace name of s. Wrappers may implement
+// store.Namespacer and return store.ErrNotSupported when the store they
+// wrap does not, Of then falls back to New.
+func Of(s store.Store, name string) (store.Store, error) {
+	if name == "" || strings.Contains(name, sep) {
+		return nil, errors.New("namespace: invalid name " + name)
+	}
+	if ns, ok := s.(store.Namespacer); ok {
+		nss, err := ns.Namespace(name)
+		if !errors.Is(err, store.ErrNotSupported) {
+			return nss, err
+		}
+	}
+	return New(s, name), nil
+}
+
+// Drop deletes the namespace name of s and all its books.
+func Drop(s store.Store, name string) error {
+	if ns, ok := s.(store.Namespacer); ok {
+		err := ns.DropNamespace(name)
+		if !errors.Is(err, store.ErrNotSupported) {
+			return err
+		}
+	}
+
+	p := New(s, name)
+	books, err := p.GetAll()
+	if err != nil {
+		return err
+	}
+	for _, b := range books {
+		if err = p.Delete(b.Id); err != nil && !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Prefixed keeps the books of a namespace in a shared store, under ids
+// prefixed by the namespace name. Only books are namespaced: Prefixed
+// hides the optional interfaces of the shared store and is not a
+// store.Wrapper, as unwrapping it would expose the other namespaces.
+type Prefixed struct {
+	s      store.Store
+	prefix string
+}
+
+// New returns the namespace name of s, keeping its books under ids
+// prefixed by name and a slash.
+func New(s store.Store, name string) *Prefixed {
+	return &Prefixed{s: s, prefix: name + sep}
+}
+
+func (p *Prefixed) in(b *store.Book) *store.Book {
+	nb := *b
+	nb.Id = p.prefix + b.Id
+	return &nb
+}
+
+func (p *Prefixed) out(b store.Book) store.Book {
+	b.Id = strings.TrimPrefix(b.Id, p.prefix)
+	return b
+}
+
+func (p *Prefixed) Create(b *store.Book) error {
+	return p.s.Create(p.in(b))
+}
+
+func (p *Prefixed) Update(b *store.Book) error {
+	return p.s.Update(p.in(b))
+}
+
+func (p *Prefixed) Get(id string) (store.Book, error) {
+	b, err := p.s.Get(p.prefix + id)
+	if err != nil {
+		return b, err
+	}
+	return p.out(b), nil
+}
+
+func (p *Prefixed) GetAll() ([]store.Book, error) {
+	all, err := p.s.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	return p.filter(all), nil
+}
+
+func (p *Prefixed) Delete(id string) error {
+	return p.s.Delete(p.prefix + id)
+}
+
+func (p *Prefixed) filter(all []store.Book) []store.Book {
+	books := make([]store.Book, 0)
+	for _, b := range all {
+		if strings.HasPrefix(b.Id, p.prefix) {
+			books = append(books, p.out(b))
+		}
+	}
+	return books
+}
+
+// Transact implements store.TxStore if the shared store does, and returns
+// store.ErrNotSupported otherwise.
+func (p *Prefixed) Transact(fn func(store.Tx) error) error {
+	ts, ok := p.s.(store.TxStore)
+	if !ok {
+		return store.ErrNotSupported
+	}
+	return ts.Transact(func(tx store.Tx) error {
+		return fn(&prefixedTx{tx: tx, p: p})
+	})
+}
+
+type prefixedTx struct {
+	tx store.Tx
+	p  *Prefixed
+}
+
+func (t *prefixedTx) Create(b *store.Book) error {
+	return t.tx.Create(t.p.in(b))
+}
+
+func (t *prefixedTx) Update(b *store.Book) error {
+	return t.tx.Update(t.p.in(b))
+}
+
+func (t *prefixedTx) Get(id string) (store.Book, error) {
+	b, err := t.tx.Get(t.p.prefix + id)
+	if err != nil {
+		return b, err
+	}
+	return t.p.out(b), nil
+}
+
+func (t *prefixedTx) GetAll() ([]store.Book, error) {
+	all, err := t.tx.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	return t.p.filter(all), nil
+}
+
+func (t *prefixedTx) Delete(id string) error {
+	return t.tx.Delete(t.p.prefix + id)
+}
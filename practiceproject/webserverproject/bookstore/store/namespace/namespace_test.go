@@ -0,0 +1,98 @@
+package namespace
+
+import (
+	memstore "github.com/Kate-liu/GoBeginner/webserverproject/bookstore/internal/store"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	"testing"
+)
+
+// plainStore hides the optional interfaces of a MemStore, so that Of falls
+// back to Prefixed.
+type plainStore struct {
+	store.Store
+}
+
+func TestIsolation(t *testing.T) {
+	providers := map[string]store.Store{
+		"mem":         memstore.NewMemStore(),
+		"sharded-mem": memstore.NewShardedMemStore(4),
+		"prefixed":    plainStore{memstore.NewMemStore()},
+	}
+	for name, s := range providers {
+		t.Run(name, func(t *testing.T) {
+			a, err := Of(s, "a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := Of(s, "b")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err = a.Create(&store.Book{Id: "1", Name: "in a"}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err = b.Get("1"); err != store.ErrNotFound {
+				t.Errorf("want %v, actual %v", store.ErrNotFound, err)
+			}
+			if books, _ := b.GetAll(); len(books) != 0 {
+				t.Errorf("want 0 books, actual %d", len(books))
+			}
+			if err = b.Delete("1"); err != store.ErrNotFound {
+				t.Errorf("want %v, actual %v", store.ErrNotFound, err)
+			}
+			if err = b.Create(&store.Book{Id: "1", Name: "in b"}); err != nil {
+				t.Errorf("want nil, actual %v", err)
+			}
+
+			book, err := a.Get("1")
+			if err != nil || book.Id != "1" || book.Name != "in a" {
+				t.Errorf("want book 1 in a, actual %v, %v", book, err)
+			}
+			books, _ := a.GetAll()
+			if len(books) != 1 || books[0].Id != "1" {
+				t.Errorf("want [1], actual %v", books)
+			}
+
+			if err = Drop(s, "a"); err != nil {
+				t.Fatal(err)
+			}
+			a, _ = Of(s, "a")
+			if books, _ = a.GetAll(); len(books) != 0 {
+				t.Errorf("want 0 books after drop, actual %d", len(books))
+			}
+			if _, err = b.Get("1"); err != nil {
+				t.Errorf("want nil, actual %v", err)
+			}
+		})
+	}
+}
+
+func TestPrefixedTransact(t *testing.T) {
+	s := memstore.NewMemStore()
+	p := New(s, "a")
+
+	err := p.Transact(func(tx store.Tx) error {
+		if err := tx.Create(&store.Book{Id: "1"}); err != nil {
+			return err
+		}
+		books, err := tx.GetAll()
+		if err != nil {
+			return err
+		}
+		if len(books) != 1 || books[0].Id != "1" {
+			t.Errorf("want [1], actual %v", books)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Get("a/1"); err != nil {
+		t.Errorf("want nil, actual %v", err)
+	}
+
+	if err = New(plainStore{s}, "a").Transact(func(store.Tx) error { return nil }); err != store.ErrNotSupported {
+		t.Errorf("want %v, actual %v", store.ErrNotSupported, err)
+	}
+}
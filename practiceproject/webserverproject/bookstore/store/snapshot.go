@@ -0,0 +1,31 @@
+package store
+
+// Snapshot is a copy of the books, authors and presses of a store, and of
+// its lending data.
+type Snapshot struct {
+	Books   []Book   `json:"books"`
+	Authors []Author `json:"authors,omitempty"`
+	Presses []Press  `json:"presses,omitempty"`
+
+	Inventories  []Inventory   `json:"inventories,omitempty"`
+	Members      []Member      `json:"members,omitempty"`
+	Loans        []Loan        `json:"loans,omitempty"`
+	Reservations []Reservation `json:"reservations,omitempty"` // 同一图书的预约按队列顺序排列
+}
+
+// Snapshotter is implemented by stores that can copy their content
+// atomically, without any concurrent mutation showing up half applied.
+type Snapshotter interface {
+	Snapshot() (Snapshot, error)
+}
+
+// Restorer is implemented by stores that can replace their whole content
+// atomically.
+type Restorer interface {
+	// Restore replaces the content of the store with the snapshot returned
+	// by fn for the current content. If fn returns an error, or the new
+	// snapshot refers to missing entries (ErrReference) or holds entries
+	// the store does not support (ErrNotSupported), the store is left
+	// unchanged.
+	Restore(fn func(current Snapshot) (Snapshot, error)) error
+}
@@ -3,17 +3,35 @@ package store
 import "errors"
 
 var (
-	ErrNotFound = errors.New("not found")
-	ErrExist    = errors.New("exist")
+	ErrNotFound  = errors.New("not found")
+	ErrExist     = errors.New("exist")
+	ErrInUse     = errors.New("in use")            // 条目仍被其他条目引用，不能删除
+	ErrReference = errors.New("invalid reference") // 引用了不存在的条目
+
+	ErrNotSupported = errors.New("not supported by the store") // 存储实现不支持该操作
+	ErrQuota        = errors.New("quota exceeded")             // 超出租户配额
 )
 
 type Book struct {
-	Id      string   `json:"id"`      // 图书ISBN ID
-	Name    string   `json:"name"`    // 图书名称
-	Authors []string `json:"authors"` // 图书作者
-	Press   string   `json:"press"`   // 出版社
+	Id        string   `json:"id"`                   // 图书ISBN ID
+	Name      string   `json:"name"`                 // 图书名称
+	Authors   []string `json:"authors"`              // 图书作者
+	Press     string   `json:"press"`                // 出版社
+	AuthorIds []string `json:"author_ids,omitempty"` // 图书作者ID，引用Author
+	PressId   string   `json:"press_id,omitempty"`   // 出版社ID，引用Press
+	CoverURL  string   `json:"cover_url,omitempty"`  // 封面图片URL
+
+	// Clear names the fields that Update empties, an empty field of the
+	// update otherwise leaves the field of the book unchanged.
+	Clear []string `json:"-"`
 }
 
+// The fields of a Book that Book.Clear can name.
+const (
+	FieldPress   = "press"
+	FieldPressId = "press_id"
+)
+
 type Store interface {
 	Create(*Book) error       // 创建一个新图书条目
 	Update(*Book) error       // 更新某图书条目
@@ -21,3 +39,45 @@ type Store interface {
 	GetAll() ([]Book, error)  // 获取所有图书信息
 	Delete(string) error      // 删除某图书条目
 }
+
+// Tx is the view of a Store inside a transaction.
+type Tx interface {
+	Store
+}
+
+// TxStore is a Store that can apply several operations atomically.
+// MemStore implements it under its lock, SQL providers implement it with
+// a database transaction (sql.DB.BeginTx).
+type TxStore interface {
+	Store
+	// Transact runs fn in a transaction. If fn returns an error, none of the
+	// changes made through the Tx are applied and the error is returned.
+	Transact(fn func(Tx) error) error
+}
+
+// Wrapper is implemented by stores that decorate another Store, so that
+// the optional interfaces of the wrapped store, such as LendingStore, can
+// still be found.
+type Wrapper interface {
+	Unwrap() Store
+}
+
+// Unwrap returns the store wrapped by s, or nil if s is not a Wrapper.
+func Unwrap(s Store) Store {
+	w, ok := s.(Wrapper)
+	if !ok {
+		return nil
+	}
+	return w.Unwrap()
+}
+
+// Namespacer is implemented by providers that can keep several independent
+// keyspaces, such as one per tenant. The store of a namespace shares
+// nothing with the others, including its optional interfaces.
+type Namespacer interface {
+	// Namespace returns the store of the namespace name, creating it if
+	// needed.
+	Namespace(name string) (Store, error)
+	// DropNamespace deletes the namespace name and all its data.
+	DropNamespace(name string) error
+}
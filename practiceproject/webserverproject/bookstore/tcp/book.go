@@ -0,0 +1,135 @@
+package tcp
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+)
+
+// ErrMalformed is returned when a packet body cannot be decoded.
+var ErrMalformed = errors.New("tcp: malformed packet")
+
+// Books are encoded as their fields in declaration order. A string is its
+// uvarint length followed by its bytes, a list of strings is its uvarint
+// length followed by its items.
+
+func appendUvarint(b []byte, n uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], n)]...)
+}
+
+func appendString(b []byte, s string) []byte {
+	b = appendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func appendStrings(b []byte, list []string) []byte {
+	b = appendUvarint(b, uint64(len(list)))
+	for _, s := range list {
+		b = appendString(b, s)
+	}
+	return b
+}
+
+// AppendBook appends the binary encoding of book to b.
+func AppendBook(b []byte, book *store.Book) []byte {
+	b = appendString(b, book.Id)
+	b = appendString(b, book.Name)
+	b = appendStrings(b, book.Authors)
+	b = appendString(b, book.Press)
+	b = appendStrings(b, book.AuthorIds)
+	b = appendString(b, book.PressId)
+	return appendString(b, book.CoverURL)
+}
+
+// reader decodes the fields of a packet body, the first error sticks.
+type reader struct {
+	b   []byte
+	err error
+}
+
+func (r *reader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	n, size := binary.Uvarint(r.b)
+	if size <= 0 {
+		r.err = ErrMalformed
+		return 0
+	}
+	r.b = r.b[size:]
+	return n
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.b) {
+		r.err = ErrMalformed
+		return nil
+	}
+	b := r.b[:n]
+	r.b = r.b[n:]
+	return b
+}
+
+func (r *reader) byte() byte {
+	b := r.bytes(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *reader) string() string {
+	n := r.uvarint()
+	if n > uint64(len(r.b)) {
+		r.err = ErrMalformed
+		return ""
+	}
+	return string(r.bytes(int(n)))
+}
+
+func (r *reader) strings() []string {
+	n := r.uvarint()
+	if n > uint64(len(r.b)) { // 每项至少占一个字节
+		r.err = ErrMalformed
+		return nil
+	}
+	if n == 0 {
+		return nil
+	}
+	list := make([]string, n)
+	for i := range list {
+		list[i] = r.string()
+	}
+	return list
+}
+
+func (r *reader) book() store.Book {
+	return store.Book{
+		Id:        r.string(),
+		Name:      r.string(),
+		Authors:   r.strings(),
+		Press:     r.string(),
+		AuthorIds: r.strings(),
+		PressId:   r.string(),
+		CoverURL:  r.string(),
+	}
+}
+
+// end returns the error of r, or ErrMalformed if bytes are left.
+func (r *reader) end() error {
+	if r.err == nil && len(r.b) > 0 {
+		r.err = ErrMalformed
+	}
+	return r.err
+}
+
+// DecodeBook decodes a book encoded by AppendBook.
+func DecodeBook(data []byte) (store.Book, error) {
+	r := &reader{b: data}
+	book := r.book()
+	return book, r.end()
+}
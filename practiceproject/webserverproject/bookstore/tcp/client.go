@@ -0,0 +1,177 @@
+package tcp
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver/frame"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver/packet"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	"net"
+	"sync"
+)
+
+var ErrClientClosed = errors.New("tcp: client closed")
+
+// Client is a store.Store whose books are kept by a remote Server. It may
+// be used by several goroutines, their requests share the connection.
+type Client struct {
+	conn  net.Conn
+	codec frame.StreamFrameCodec
+	wmu   sync.Mutex // 保证每个帧完整写出
+
+	mu      sync.Mutex
+	seq     uint32
+	pending map[string]chan *Ack // 请求ID -> 等待应答的通道
+	err     error                // 连接断开的原因
+}
+
+// Dial connects to the Server at addr.
+func Dial(addr string) (*Client, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(conn), nil
+}
+
+// NewClient returns a Client talking to a Server over conn.
+func NewClient(conn net.Conn) *Client {
+	c := &Client{
+		conn:    conn,
+		codec:   frame.NewMyFrameCodec(),
+		pending: make(map[string]chan *Ack),
+	}
+	go c.readAcks()
+	return c
+}
+
+func (c *Client) Close() error {
+	c.fail(ErrClientClosed)
+	return c.conn.Close()
+}
+
+// fail records why the connection is unusable and wakes up the pending
+// requests.
+func (c *Client) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+}
+
+func (c *Client) readAcks() {
+	for {
+		framePayload, err := c.codec.Decode(c.conn)
+		if err != nil {
+			c.fail(fmt.Errorf("tcp: connection lost: %w", err))
+			return
+		}
+		p, err := Decode(framePayload)
+		if err != nil {
+			c.fail(err)
+			c.conn.Close()
+			return
+		}
+		ack, ok := p.(*Ack)
+		if !ok {
+			c.fail(fmt.Errorf("tcp: unexpected packet %T", p))
+			c.conn.Close()
+			return
+		}
+
+		c.mu.Lock()
+		ch, ok := c.pending[ack.ID]
+		delete(c.pending, ack.ID)
+		c.mu.Unlock()
+		if ok {
+			ch <- ack
+		}
+	}
+}
+
+// nextID reserves a request id.
+func (c *Client) nextID() (string, chan *Ack, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return "", nil, c.err
+	}
+	c.seq++
+	id := fmt.Sprintf("%08x", c.seq)
+	ch := make(chan *Ack, 1)
+	c.pending[id] = ch
+	return id, ch, nil
+}
+
+// call sends the request built by newPacket and waits for its ack.
+func (c *Client) call(newPacket func(id string) packet.Packet) (*Ack, error) {
+	id, ch, err := c.nextID()
+	if err != nil {
+		return nil, err
+	}
+
+	framePayload, err := Encode(newPacket(id))
+	if err == nil {
+		c.wmu.Lock()
+		err = c.codec.Encode(c.conn, framePayload)
+		c.wmu.Unlock()
+	}
+	if err != nil {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return nil, err
+	}
+
+	ack, ok := <-ch
+	if !ok {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return nil, c.err
+	}
+	return ack, ackError(ack)
+}
+
+func (c *Client) Create(book *store.Book) error {
+	_, err := c.call(func(id string) packet.Packet { return &Create{ID: id, Book: *book} })
+	return err
+}
+
+func (c *Client) Update(book *store.Book) error {
+	_, err := c.call(func(id string) packet.Packet { return &Update{ID: id, Book: *book} })
+	return err
+}
+
+func (c *Client) Get(id string) (store.Book, error) {
+	ack, err := c.call(func(reqID string) packet.Packet { return &Get{ID: reqID, BookId: id} })
+	if err != nil {
+		return store.Book{}, err
+	}
+	if len(ack.Books) != 1 {
+		return store.Book{}, ErrMalformed
+	}
+	return ack.Books[0], nil
+}
+
+// GetAll sends a List request.
+func (c *Client) GetAll() ([]store.Book, error) {
+	ack, err := c.call(func(id string) packet.Packet { return &List{ID: id} })
+	if err != nil {
+		return nil, err
+	}
+	if ack.Books == nil {
+		return make([]store.Book, 0), nil
+	}
+	return ack.Books, nil
+}
+
+func (c *Client) Delete(id string) error {
+	_, err := c.call(func(reqID string) packet.Packet { return &Delete{ID: reqID, BookId: id} })
+	return err
+}
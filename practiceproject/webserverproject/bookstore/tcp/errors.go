@@ -0,0 +1,75 @@
+package tcp
+
+import (
+	"errors"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store/fault"
+)
+
+// The results of an Ack. Each names the store error of a failed request,
+// which the client gets back through errors.Is. Unlike the http /book
+// routes, which answer 400 to most of these errors, the result always
+// tells them apart.
+const (
+	ResultOK           = iota // 成功
+	ResultNotFound            // store.ErrNotFound
+	ResultExist               // store.ErrExist
+	ResultInUse               // store.ErrInUse
+	ResultReference           // store.ErrReference
+	ResultNotSupported        // store.ErrNotSupported
+	ResultQuota               // store.ErrQuota
+	ResultReadOnly            // ErrReadOnly，跟随者拒绝写请求
+	ResultInvalid             // 无效请求或其他存储错误
+	ResultInternal            // 服务端内部错误，如存储panic或应答超出帧长度上限
+)
+
+// ErrReadOnly is returned for writes sent to a replication follower.
+var ErrReadOnly = errors.New("read-only follower, send writes to the leader")
+
+var resultErrors = map[uint8]error{
+	ResultNotFound:     store.ErrNotFound,
+	ResultExist:        store.ErrExist,
+	ResultInUse:        store.ErrInUse,
+	ResultReference:    store.ErrReference,
+	ResultNotSupported: store.ErrNotSupported,
+	ResultQuota:        store.ErrQuota,
+	ResultReadOnly:     ErrReadOnly,
+}
+
+// resultOf maps an error of the store to the result of an Ack.
+func resultOf(err error) uint8 {
+	if err == nil {
+		return ResultOK
+	}
+	for result, target := range resultErrors {
+		if errors.Is(err, target) {
+			return result
+		}
+	}
+	if errors.Is(err, fault.ErrInjected) {
+		return ResultInternal
+	}
+	return ResultInvalid
+}
+
+// Error is the error of an Ack. It matches the store error of its result
+// with errors.Is.
+type Error struct {
+	Result  uint8
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Is(target error) bool {
+	return resultErrors[e.Result] == target
+}
+
+func ackError(ack *Ack) error {
+	if ack.Result == ResultOK {
+		return nil
+	}
+	return &Error{Result: ack.Result, Message: ack.Message}
+}
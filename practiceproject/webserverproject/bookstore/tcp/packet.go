@@ -0,0 +1,220 @@
+// Package tcp serves a store.Store over the length-prefixed frame protocol
+// of practiceproject/webtcpserver, for batch jobs that find HTTP and JSON
+// too heavy. Each frame holds a packet: a command id byte followed by the
+// packet body, as in the packet package of webtcpserver.
+package tcp
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver/packet"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+)
+
+// 请求命令，与webtcpserver中的Conn(0x01)、Submit(0x02)不重叠
+const (
+	CommandGet    = iota + 0x10 // 0x10
+	CommandCreate               // 0x11
+	CommandUpdate               // 0x12
+	CommandDelete               // 0x13
+	CommandList                 // 0x14
+)
+
+// ackFlag is set in the command id of the ack of a request.
+const ackFlag = 0x80
+
+// 响应命令
+const (
+	CommandGetAck    = CommandGet | ackFlag    // 0x90
+	CommandCreateAck = CommandCreate | ackFlag // 0x91
+	CommandUpdateAck = CommandUpdate | ackFlag // 0x92
+	CommandDeleteAck = CommandDelete | ackFlag // 0x93
+	CommandListAck   = CommandList | ackFlag   // 0x94
+)
+
+// IDLen is the length of the request ids matching acks to requests.
+const IDLen = 8
+
+// Get requests the book BookId, and Delete deletes it.
+type Get struct {
+	ID     string
+	BookId string
+}
+
+type Delete Get
+
+// Create and Update carry the book to create or update.
+type Create struct {
+	ID   string
+	Book store.Book
+}
+
+type Update Create
+
+// List requests all the books.
+type List struct {
+	ID string
+}
+
+// Ack answers the request ID of type Command. Books holds the book of a
+// Get and the books of a List when Result is ResultOK, Message the error
+// otherwise.
+type Ack struct {
+	Command uint8 // 所应答请求的命令
+	ID      string
+	Result  uint8
+	Message string
+	Books   []store.Book
+}
+
+func checkID(id string) error {
+	if len(id) != IDLen {
+		return fmt.Errorf("tcp: request id must be %d bytes, got %d", IDLen, len(id))
+	}
+	return nil
+}
+
+func (p *Get) Decode(body []byte) error {
+	r := &reader{b: body}
+	p.ID = string(r.bytes(IDLen))
+	p.BookId = r.string()
+	return r.end()
+}
+
+func (p *Get) Encode() ([]byte, error) {
+	if err := checkID(p.ID); err != nil {
+		return nil, err
+	}
+	return appendString([]byte(p.ID), p.BookId), nil
+}
+
+func (p *Delete) Decode(body []byte) error {
+	return (*Get)(p).Decode(body)
+}
+
+func (p *Delete) Encode() ([]byte, error) {
+	return (*Get)(p).Encode()
+}
+
+func (p *Create) Decode(body []byte) error {
+	r := &reader{b: body}
+	p.ID = string(r.bytes(IDLen))
+	p.Book = r.book()
+	return r.end()
+}
+
+func (p *Create) Encode() ([]byte, error) {
+	if err := checkID(p.ID); err != nil {
+		return nil, err
+	}
+	return AppendBook([]byte(p.ID), &p.Book), nil
+}
+
+func (p *Update) Decode(body []byte) error {
+	return (*Create)(p).Decode(body)
+}
+
+func (p *Update) Encode() ([]byte, error) {
+	return (*Create)(p).Encode()
+}
+
+func (p *List) Decode(body []byte) error {
+	r := &reader{b: body}
+	p.ID = string(r.bytes(IDLen))
+	return r.end()
+}
+
+func (p *List) Encode() ([]byte, error) {
+	if err := checkID(p.ID); err != nil {
+		return nil, err
+	}
+	return []byte(p.ID), nil
+}
+
+func (p *Ack) Decode(body []byte) error {
+	r := &reader{b: body}
+	p.ID = string(r.bytes(IDLen))
+	p.Result = r.byte()
+	p.Message = r.string()
+	n := r.uvarint()
+	if n > uint64(len(r.b)) {
+		return ErrMalformed
+	}
+	p.Books = nil
+	for i := uint64(0); i < n && r.err == nil; i++ {
+		p.Books = append(p.Books, r.book())
+	}
+	return r.end()
+}
+
+func (p *Ack) Encode() ([]byte, error) {
+	if err := checkID(p.ID); err != nil {
+		return nil, err
+	}
+	b := append([]byte(p.ID), p.Result)
+	b = appendString(b, p.Message)
+	b = appendUvarint(b, uint64(len(p.Books)))
+	for i := range p.Books {
+		b = AppendBook(b, &p.Books[i])
+	}
+	return b, nil
+}
+
+// Decode decodes the packet of a frame payload.
+func Decode(framePayload []byte) (packet.Packet, error) {
+	if len(framePayload) == 0 {
+		return nil, ErrMalformed
+	}
+	commandID := framePayload[0]
+	body := framePayload[1:]
+
+	var p packet.Packet
+	switch commandID {
+	case CommandGet:
+		p = &Get{}
+	case CommandCreate:
+		p = &Create{}
+	case CommandUpdate:
+		p = &Update{}
+	case CommandDelete:
+		p = &Delete{}
+	case CommandList:
+		p = &List{}
+	case CommandGetAck, CommandCreateAck, CommandUpdateAck, CommandDeleteAck, CommandListAck:
+		p = &Ack{Command: commandID &^ ackFlag}
+	default:
+		return nil, fmt.Errorf("unknown commandID [%d]", commandID)
+	}
+
+	if err := p.Decode(body); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Encode encodes p into a frame payload.
+func Encode(p packet.Packet) ([]byte, error) {
+	var commandID uint8
+	switch t := p.(type) {
+	case *Get:
+		commandID = CommandGet
+	case *Create:
+		commandID = CommandCreate
+	case *Update:
+		commandID = CommandUpdate
+	case *Delete:
+		commandID = CommandDelete
+	case *List:
+		commandID = CommandList
+	case *Ack:
+		commandID = t.Command | ackFlag
+	default:
+		return nil, fmt.Errorf("unknown type [%T]", t)
+	}
+
+	pktBody, err := p.Encode()
+	if err != nil {
+		return nil, err
+	}
+	return bytes.Join([][]byte{{commandID}, pktBody}, nil), nil
+}
@@ -0,0 +1,236 @@
+package tcp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver/frame"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	"log"
+	"net"
+	"sync"
+)
+
+var ErrServerClosed = errors.New("tcp: server closed")
+
+// Server serves the books of a store to tcp clients. Requests of a
+// connection are handled in order.
+type Server struct {
+	s        store.Store
+	readOnly bool // 跟随者只读，拒绝写请求
+	codec    frame.StreamFrameCodec
+
+	mu     sync.Mutex
+	ls     map[net.Listener]struct{}
+	conns  map[net.Conn]struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+type Option func(*Server)
+
+// ReadOnly makes the server reply ResultReadOnly to the writes, for
+// replication followers.
+func ReadOnly() Option {
+	return func(srv *Server) {
+		srv.readOnly = true
+	}
+}
+
+func NewServer(s store.Store, opts ...Option) *Server {
+	srv := &Server{
+		s:     s,
+		codec: frame.NewMyFrameCodec(),
+		ls:    make(map[net.Listener]struct{}),
+		conns: make(map[net.Conn]struct{}),
+	}
+	for _, opt := range opts {
+		opt(srv)
+	}
+	return srv
+}
+
+// Serve accepts connections on l until Close is called, it then returns
+// ErrServerClosed.
+func (srv *Server) Serve(l net.Listener) error {
+	srv.mu.Lock()
+	if srv.closed {
+		srv.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	srv.ls[l] = struct{}{}
+	srv.mu.Unlock()
+
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			srv.mu.Lock()
+			closed := srv.closed
+			delete(srv.ls, l)
+			srv.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+
+		if !srv.track(c) {
+			c.Close()
+			return ErrServerClosed
+		}
+		go srv.handleConn(c)
+	}
+}
+
+func (srv *Server) track(c net.Conn) bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.closed {
+		return false
+	}
+	srv.conns[c] = struct{}{}
+	srv.wg.Add(1)
+	return true
+}
+
+// Close stops the listeners, closes the connections and waits for their
+// handlers to return.
+func (srv *Server) Close() error {
+	srv.mu.Lock()
+	srv.closed = true
+	for l := range srv.ls {
+		l.Close()
+	}
+	for c := range srv.conns {
+		c.Close()
+	}
+	srv.mu.Unlock()
+
+	srv.wg.Wait()
+	return nil
+}
+
+func (srv *Server) handleConn(c net.Conn) {
+	defer func() {
+		srv.mu.Lock()
+		delete(srv.conns, c)
+		srv.mu.Unlock()
+		c.Close()
+		srv.wg.Done()
+	}()
+
+	rbuf := bufio.NewReader(c)
+	wbuf := bufio.NewWriter(c)
+	for {
+		framePayload, err := srv.codec.Decode(rbuf)
+		if err != nil {
+			return // 连接关闭或帧无效
+		}
+
+		ack, err := srv.handlePacket(framePayload)
+		if err != nil {
+			log.Println("tcp: closing connection from", c.RemoteAddr(), "on invalid packet:", err)
+			return
+		}
+		ackFramePayload, err := Encode(ack)
+		if err != nil {
+			log.Println("tcp: packet encode error:", err)
+			return
+		}
+		err = srv.codec.Encode(wbuf, ackFramePayload)
+		if errors.Is(err, frame.ErrFrameTooLarge) {
+			// 应答超出帧长度上限时没有写出任何字节，改为回复错误，连接仍可使用
+			ackFramePayload, err = Encode(&Ack{
+				Command: ack.Command,
+				ID:      ack.ID,
+				Result:  ResultInternal,
+				Message: "ack too large: " + err.Error(),
+			})
+			if err == nil {
+				err = srv.codec.Encode(wbuf, ackFramePayload)
+			}
+		}
+		if err != nil {
+			return
+		}
+
+		// 没有待处理的请求时才发送，批量请求的应答合并写出
+		if rbuf.Buffered() == 0 {
+			if err = wbuf.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// handlePacket returns the ack of a request. A request that cannot be
+// decoded gets a ResultInvalid ack if its command and id can be read, and
+// an error otherwise.
+func (srv *Server) handlePacket(framePayload []byte) (*Ack, error) {
+	p, err := Decode(framePayload)
+	if err != nil {
+		if len(framePayload) < 1+IDLen || !isRequest(framePayload[0]) {
+			return nil, err
+		}
+		return &Ack{
+			Command: framePayload[0],
+			ID:      string(framePayload[1 : 1+IDLen]),
+			Result:  ResultInvalid,
+			Message: err.Error(),
+		}, nil
+	}
+
+	switch p := p.(type) {
+	case *Get:
+		ack := &Ack{Command: CommandGet, ID: p.ID}
+		return srv.do(ack, func() error {
+			book, err := srv.s.Get(p.BookId)
+			ack.Books = []store.Book{book}
+			return err
+		}), nil
+	case *Create:
+		return srv.write(&Ack{Command: CommandCreate, ID: p.ID}, func() error { return srv.s.Create(&p.Book) })
+	case *Update:
+		return srv.write(&Ack{Command: CommandUpdate, ID: p.ID}, func() error { return srv.s.Update(&p.Book) })
+	case *Delete:
+		return srv.write(&Ack{Command: CommandDelete, ID: p.ID}, func() error { return srv.s.Delete(p.BookId) })
+	case *List:
+		ack := &Ack{Command: CommandList, ID: p.ID}
+		return srv.do(ack, func() error {
+			books, err := srv.s.GetAll()
+			ack.Books = books
+			return err
+		}), nil
+	}
+	return nil, fmt.Errorf("unexpected packet %T", p)
+}
+
+func isRequest(commandID byte) bool {
+	return commandID >= CommandGet && commandID <= CommandList
+}
+
+func (srv *Server) write(ack *Ack, fn func() error) (*Ack, error) {
+	if srv.readOnly {
+		ack.Result, ack.Message = ResultReadOnly, ErrReadOnly.Error()
+		return ack, nil
+	}
+	return srv.do(ack, fn), nil
+}
+
+// do runs fn and sets the result of ack from its error. A panic of the
+// store is reported as ResultInternal.
+func (srv *Server) do(ack *Ack, fn func() error) (res *Ack) {
+	res = ack
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("tcp: panic handling command %#x: %v", ack.Command, r)
+			ack.Result, ack.Message, ack.Books = ResultInternal, "internal error", nil
+		}
+	}()
+
+	if err := fn(); err != nil {
+		ack.Result, ack.Message, ack.Books = resultOf(err), err.Error(), nil
+	}
+	return ack
+}
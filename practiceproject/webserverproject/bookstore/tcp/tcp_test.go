@@ -0,0 +1,251 @@
+package tcp
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver/packet"
+	memstore "github.com/Kate-liu/GoBeginner/webserverproject/bookstore/internal/store"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store"
+	"github.com/Kate-liu/GoBeginner/webserverproject/bookstore/store/fault"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestBookEncoding(t *testing.T) {
+	books := []store.Book{
+		{},
+		{Id: "978-7-111", Name: "Go语言", Authors: []string{"a", "b"}, Press: "p",
+			AuthorIds: []string{"au1"}, PressId: "pr1", CoverURL: "/book/978-7-111/cover"},
+	}
+	for _, want := range books {
+		data := AppendBook(nil, &want)
+		got, err := DecodeBook(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("want %v, actual %v", want, got)
+		}
+
+		for i := 0; i < len(data); i++ {
+			if _, err = DecodeBook(data[:i]); err != ErrMalformed {
+				t.Errorf("truncated to %d bytes: want %v, actual %v", i, ErrMalformed, err)
+			}
+		}
+		if _, err = DecodeBook(append(data, 0)); err != ErrMalformed {
+			t.Errorf("trailing byte: want %v, actual %v", ErrMalformed, err)
+		}
+	}
+
+	// 声明的列表长度远大于数据时，不应按声明长度分配内存
+	if _, err := DecodeBook([]byte{0, 0, 0xff, 0xff, 0xff, 0xff, 0x0f}); err != ErrMalformed {
+		t.Errorf("want %v, actual %v", ErrMalformed, err)
+	}
+}
+
+func TestPacketEncoding(t *testing.T) {
+	packets := []packet.Packet{
+		&Get{ID: "00000001", BookId: "1"},
+		&Delete{ID: "00000002", BookId: "2"},
+		&Create{ID: "00000003", Book: store.Book{Id: "3", Name: "n"}},
+		&Update{ID: "00000004", Book: store.Book{Id: "4"}},
+		&List{ID: "00000005"},
+		&Ack{Command: CommandList, ID: "00000005", Books: []store.Book{{Id: "1"}, {Id: "2"}}},
+		&Ack{Command: CommandGet, ID: "00000006", Result: ResultNotFound, Message: "not found"},
+	}
+	for _, want := range packets {
+		data, err := Encode(want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Decode(data)
+		if err != nil {
+			t.Fatalf("%T: %v", want, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("want %#v, actual %#v", want, got)
+		}
+	}
+
+	if _, err := Encode(&List{ID: "short"}); err == nil {
+		t.Error("want error for a short id, actual nil")
+	}
+}
+
+func newTestClient(t *testing.T, s store.Store, opts ...Option) *Client {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(s, opts...)
+	go srv.Serve(l)
+
+	c, err := Dial(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		c.Close()
+		srv.Close()
+	})
+	return c
+}
+
+func TestClientServer(t *testing.T) {
+	s := memstore.NewMemStore()
+	c := newTestClient(t, s)
+
+	book := store.Book{Id: "1", Name: "n1", Authors: []string{"a"}}
+	if err := c.Create(&book); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Create(&book); !errors.Is(err, store.ErrExist) {
+		t.Errorf("want %v, actual %v", store.ErrExist, err)
+	}
+	if err := c.Update(&store.Book{Id: "1", Press: "p"}); err != nil {
+		t.Errorf("want nil, actual %v", err)
+	}
+
+	got, err := c.Get("1")
+	if err != nil || got.Name != "n1" || got.Press != "p" {
+		t.Errorf("want the updated book, actual %v, %v", got, err)
+	}
+	if _, err = s.Get("1"); err != nil {
+		t.Errorf("want the book in the store, actual %v", err)
+	}
+	if _, err = c.Get("2"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("want %v, actual %v", store.ErrNotFound, err)
+	}
+
+	books, err := c.GetAll()
+	if err != nil || len(books) != 1 {
+		t.Errorf("want 1 book, actual %v, %v", books, err)
+	}
+	if err = c.Delete("1"); err != nil {
+		t.Errorf("want nil, actual %v", err)
+	}
+	if books, err = c.GetAll(); err != nil || books == nil || len(books) != 0 {
+		t.Errorf("want no books, actual %v, %v", books, err)
+	}
+}
+
+func TestClientConcurrent(t *testing.T) {
+	c := newTestClient(t, memstore.NewMemStore())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := fmt.Sprint(i)
+			if err := c.Create(&store.Book{Id: id}); err != nil {
+				t.Errorf("create %s: %v", id, err)
+				return
+			}
+			if b, err := c.Get(id); err != nil || b.Id != id {
+				t.Errorf("get %s: want the book, actual %v, %v", id, b, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if books, _ := c.GetAll(); len(books) != 20 {
+		t.Errorf("want 20 books, actual %d", len(books))
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	inj := fault.NewInjector()
+	c := newTestClient(t, fault.Wrap(memstore.NewMemStore(), inj))
+
+	inj.Set(fault.OpGetAll, fault.Rule{PanicRate: 1})
+	_, err := c.GetAll()
+	var terr *Error
+	if !errors.As(err, &terr) || terr.Result != ResultInternal {
+		t.Errorf("want ResultInternal, actual %v", err)
+	}
+	inj.Set(fault.OpCreate, fault.Rule{ErrorRate: 1, Error: "quota"})
+	if err = c.Create(&store.Book{Id: "1"}); !errors.Is(err, store.ErrQuota) {
+		t.Errorf("want %v, actual %v", store.ErrQuota, err)
+	}
+
+	// 连接在出错后仍可使用
+	inj.Reset()
+	if err = c.Create(&store.Book{Id: "1"}); err != nil {
+		t.Errorf("want nil, actual %v", err)
+	}
+}
+
+func TestListTooLarge(t *testing.T) {
+	s := memstore.NewMemStore()
+	name := strings.Repeat("x", 64<<10)
+	for i := 0; i < 80; i++ {
+		s.Create(&store.Book{Id: strconv.Itoa(i), Name: name})
+	}
+	c := newTestClient(t, s)
+
+	// 应答超出4MB的帧长度上限，回复错误而不是断开连接
+	_, err := c.GetAll()
+	var terr *Error
+	if !errors.As(err, &terr) || terr.Result != ResultInternal || !strings.Contains(terr.Message, "too large") {
+		t.Errorf("want ResultInternal, actual %v", err)
+	}
+	if _, err = c.Get("1"); err != nil {
+		t.Errorf("want nil, actual %v", err)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	s := memstore.NewMemStore()
+	s.Create(&store.Book{Id: "1"})
+	c := newTestClient(t, s, ReadOnly())
+
+	if err := c.Delete("1"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("want %v, actual %v", ErrReadOnly, err)
+	}
+	if _, err := c.Get("1"); err != nil {
+		t.Errorf("want nil, actual %v", err)
+	}
+}
+
+func TestInvalidPacket(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(memstore.NewMemStore())
+	go srv.Serve(l)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// 命令与ID可读时，返回ResultInvalid，连接保持
+	if err = srv.codec.Encode(conn, []byte("\x10000000015")); err != nil {
+		t.Fatal(err)
+	}
+	framePayload, err := srv.codec.Decode(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := Decode(framePayload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ack := p.(*Ack); ack.Result != ResultInvalid || ack.ID != "00000001" {
+		t.Errorf("want ResultInvalid for 00000001, actual %+v", ack)
+	}
+
+	// 未知命令时，服务端关闭连接
+	srv.codec.Encode(conn, []byte{0x7f})
+	if _, err = srv.codec.Decode(conn); err == nil {
+		t.Error("want the connection closed, actual an ack")
+	}
+}
@@ -0,0 +1,290 @@
+package tcpserver
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver/frame"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver/packet"
+	"net"
+	"sync"
+	"time"
+)
+
+// Client sends packets to a Server and receives its acks. Send and
+// Receive may be called from different goroutines.
+type Client struct {
+	conn  net.Conn
+	r     *deadlineReader
+	codec frame.StreamFrameCodec
+	wmu   sync.Mutex // 保证每个帧完整写出
+	rmu   sync.Mutex
+
+	heartbeat time.Duration
+	inflight  chan struct{} // 已发送但未收到应答的Submit，为nil时不限制
+	done      chan struct{} // Close时关闭，停止心跳
+	closeOnce sync.Once
+
+	tlsConfig   *tls.Config // Dial时使用，为nil时不使用TLS
+	clientID    string
+	credentials []byte
+	features    uint8 // 请求的特性
+	ack         *packet.ConnAck
+}
+
+type ClientOption func(*Client)
+
+// WithClientCodec sets the codec of the frames, it must be that of the
+// server.
+func WithClientCodec(codec frame.StreamFrameCodec) ClientOption {
+	return func(c *Client) {
+		c.codec = codec
+	}
+}
+
+// WithClientTLS makes Dial connect over TLS with config. If
+// config.ServerName is empty, it is the host of the address, or localhost
+// if the address has none. NewClient ignores it, its conn may be a
+// *tls.Conn instead.
+func WithClientTLS(config *tls.Config) ClientOption {
+	return func(c *Client) {
+		c.tlsConfig = config
+	}
+}
+
+// WithClientID sets the client ID sent in the Conn. The server assigns
+// one if it is empty.
+func WithClientID(id string) ClientOption {
+	return func(c *Client) {
+		c.clientID = id
+	}
+}
+
+// WithCredentials sets the credentials sent in the Conn.
+func WithCredentials(credentials []byte) ClientOption {
+	return func(c *Client) {
+		c.credentials = credentials
+	}
+}
+
+// WithClientFeatures requests features, such as packet.FeatureChecksum,
+// from the server. The granted ones are returned by Features. The checksum
+// is not requested with a codec of another package than frame.
+func WithClientFeatures(features uint8) ClientOption {
+	return func(c *Client) {
+		c.features = features
+	}
+}
+
+// WithClientHeartbeat makes the client send a Ping every interval, so
+// that a server closing idle connections with WithHeartbeat keeps it.
+// Receive then fails with a timeout if the server sent nothing, not even
+// a Pong, for twice interval.
+func WithClientHeartbeat(interval time.Duration) ClientOption {
+	return func(c *Client) {
+		c.heartbeat = interval
+	}
+}
+
+// WithMaxInFlight makes Send block while n Submits wait for their
+// SubmitAck, so that a client sending faster than the server handles its
+// requests does not fill the queues of the connection. The acks must be
+// read with Receive.
+func WithMaxInFlight(n int) ClientOption {
+	return func(c *Client) {
+		if n > 0 {
+			c.inflight = make(chan struct{}, n)
+		}
+	}
+}
+
+// Dial connects to the server at addr and opens a session.
+func Dial(addr string, opts ...ClientOption) (*Client, error) {
+	c := newClient(opts)
+	conn, err := c.dial(addr)
+	if err != nil {
+		return nil, err
+	}
+	if err = c.open(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// NewClient opens a session with a server over conn. It returns a
+// *ConnError if the server refuses it.
+func NewClient(conn net.Conn, opts ...ClientOption) (*Client, error) {
+	c := newClient(opts)
+	if err := c.open(conn); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func newClient(opts []ClientOption) *Client {
+	c := &Client{
+		codec: frame.NewMyFrameCodec(),
+		done:  make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.features &= codecFeatures(c.codec)
+	return c
+}
+
+func (c *Client) dial(addr string) (net.Conn, error) {
+	if c.tlsConfig == nil {
+		return net.Dial("tcp", addr)
+	}
+	config := c.tlsConfig
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if host == "" {
+			host = "localhost"
+		}
+		config = config.Clone()
+		config.ServerName = host
+	}
+	return tls.Dial("tcp", addr, config)
+}
+
+// open opens the session over conn and starts the heartbeat.
+func (c *Client) open(conn net.Conn) error {
+	c.conn = conn
+	c.r = &deadlineReader{conn: conn, timeout: 2 * c.heartbeat}
+	if err := c.handshake(); err != nil {
+		return err
+	}
+	if c.heartbeat > 0 {
+		go c.ping()
+	}
+	return nil
+}
+
+// ping sends a Ping every heartbeat until the client is closed or a send
+// fails.
+func (c *Client) ping() {
+	ticker := time.NewTicker(c.heartbeat)
+	defer ticker.Stop()
+	for n := 1; ; n++ {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if err := c.Send(&packet.Ping{ID: pingID(n)}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (c *Client) handshake() error {
+	err := c.Send(&packet.Conn{
+		ID:          "00000000",
+		Version:     packet.ProtocolVersion,
+		Features:    c.features,
+		ClientID:    c.clientID,
+		Credentials: c.credentials,
+	})
+	if err != nil {
+		return err
+	}
+	p, err := c.Receive()
+	if err != nil {
+		return err
+	}
+
+	ack, ok := p.(*packet.ConnAck)
+	switch {
+	case !ok:
+		return fmt.Errorf("tcpserver: want a connack, actual %T", p)
+	case ack.Result != packet.ConnAccepted:
+		return &ConnError{Result: ack.Result}
+	case ack.Version > packet.ProtocolVersion:
+		return fmt.Errorf("tcpserver: unsupported protocol version %d", ack.Version)
+	case ack.Features&^c.features != 0:
+		return fmt.Errorf("tcpserver: features %#x granted, %#x requested", ack.Features, c.features)
+	}
+	c.ack = ack
+	c.codec = negotiatedCodec(c.codec, ack.Features)
+	return nil
+}
+
+// SessionID returns the ID the server gave to the session.
+func (c *Client) SessionID() string {
+	return c.ack.SessionID
+}
+
+// Features returns the features granted by the server.
+func (c *Client) Features() uint8 {
+	return c.ack.Features
+}
+
+// Conn returns the connection of the client, such as to set deadlines.
+func (c *Client) Conn() net.Conn {
+	return c.conn
+}
+
+// Send encodes p and writes it in a frame. With WithMaxInFlight, it
+// waits for a free slot before sending a Submit.
+func (c *Client) Send(p packet.Packet) error {
+	framePayload, err := packet.Encode(p)
+	if err != nil {
+		return err
+	}
+	if _, ok := p.(*packet.Submit); ok && c.inflight != nil {
+		select {
+		case c.inflight <- struct{}{}:
+		case <-c.done:
+			return net.ErrClosed
+		}
+	}
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	return c.codec.Encode(c.conn, framePayload)
+}
+
+// Receive reads the next frame and decodes its packet. It answers the
+// Pings of the server and skips the Pongs. A *packet.Disconnect means the
+// server is shutting down: the acks of the requests it read still follow,
+// then the server closes the connection. The client should stop sending;
+// the requests left without an ack were not handled.
+func (c *Client) Receive() (packet.Packet, error) {
+	for {
+		c.rmu.Lock()
+		framePayload, err := c.codec.Decode(c.r)
+		c.rmu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+
+		p, err := packet.Decode(framePayload)
+		switch p := p.(type) {
+		case *packet.Ping:
+			if err = c.Send(&packet.Pong{ID: p.ID}); err != nil {
+				return nil, err
+			}
+			continue
+		case *packet.Pong:
+			continue
+		case *packet.SubmitAck:
+			if c.inflight != nil {
+				select {
+				case <-c.inflight: // 释放一个发送名额
+				default:
+				}
+			}
+		}
+		return p, err
+	}
+}
+
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
+	return c.conn.Close()
+}
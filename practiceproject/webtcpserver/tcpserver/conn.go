@@ -0,0 +1,305 @@
+package tcpserver
+
+import (
+	"errors"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver/frame"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver/packet"
+	"io"
+	"log"
+	"net"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// QueuePolicy tells what a connection does with a request arriving while
+// its queue of requests is full.
+type QueuePolicy int
+
+const (
+	// BlockWhenFull stops reading the connection until a handler takes a
+	// request, TCP flow control then slows the client down.
+	BlockWhenFull QueuePolicy = iota
+	// RejectWhenFull replies to the Submit with ResultOverloaded. The
+	// other requests still wait.
+	RejectWhenFull
+)
+
+// defaultQueueSize is the number of requests and of outbound frames a
+// connection queues by default.
+const defaultQueueSize = 128
+
+// defaultHandshakeTimeout is how long a connection has to complete its
+// handshake by default.
+const defaultHandshakeTimeout = 10 * time.Second
+
+// serverConn is a connection of a Server once its handshake is done. The
+// goroutine of handleConn reads its frames into the bounded queue in, a
+// pool of workers hands them to the handlers, and a writer goroutine
+// writes the acks queued in out.
+type serverConn struct {
+	s     *Server
+	c     net.Conn
+	codec frame.StreamFrameCodec
+	in    chan []byte // 待处理的请求
+	out   chan []byte // 待写出的帧
+
+	limiters []limiter // 请求速率限制
+
+	mu     sync.Mutex
+	reason string        // 第一个断开原因
+	done   chan struct{} // abort时关闭
+	closed bool
+
+	disconnectOnce sync.Once
+	disconnecting  chan struct{} // Shutdown时关闭，writer随即发送Disconnect
+}
+
+func newServerConn(s *Server, c net.Conn, codec frame.StreamFrameCodec) *serverConn {
+	return &serverConn{
+		s:     s,
+		c:     c,
+		codec: codec,
+		in:    make(chan []byte, s.queueSize),
+		out:   make(chan []byte, s.queueSize),
+		done:  make(chan struct{}),
+
+		disconnecting: make(chan struct{}),
+	}
+}
+
+// serve reads the requests of the connection until it fails, then waits
+// for the queued requests to be handled and their acks written. It
+// returns the reason of the disconnect. Once the Disconnect of Shutdown is
+// written, the connection is no longer read, and serve returns as soon as
+// the requests already read are acked.
+func (sc *serverConn) serve(r *countingReader, dr *deadlineReader, w io.Writer, flush func() error) string {
+	var workers sync.WaitGroup
+	for i := 0; i < sc.s.workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			sc.handleLoop()
+		}()
+	}
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		sc.writeLoop(w, flush, dr.stop)
+	}()
+
+	if sc.s.register(sc) {
+		sc.disconnect() // 握手期间服务端开始关闭
+	}
+	defer sc.s.unregister(sc)
+
+	sc.setReason(sc.readLoop(r, dr))
+	close(sc.in)
+	workers.Wait()
+	close(sc.out)
+	<-written
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.reason
+}
+
+func (sc *serverConn) setReason(reason string) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.reason == "" {
+		sc.reason = reason
+	}
+}
+
+// abort closes the connection at once, the queued frames are dropped.
+func (sc *serverConn) abort(reason string) {
+	sc.setReason(reason)
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if !sc.closed {
+		sc.closed = true
+		close(sc.done)
+		sc.c.Close()
+	}
+}
+
+// disconnect makes the writer send a Disconnect to the client. The
+// requests read before it are still handled and acked, then the
+// connection is closed.
+func (sc *serverConn) disconnect() {
+	sc.disconnectOnce.Do(func() { close(sc.disconnecting) })
+}
+
+// send queues a frame for the writer. It returns false if the connection
+// was aborted.
+func (sc *serverConn) send(framePayload []byte) bool {
+	select {
+	case sc.out <- framePayload:
+		return true
+	case <-sc.done:
+		return false
+	}
+}
+
+// readLoop reads the frames of the connection, answers its heartbeats and
+// queues its requests. It returns the reason it stopped.
+func (sc *serverConn) readLoop(r *countingReader, dr *deadlineReader) string {
+	s := sc.s
+	var pings int
+	pinged := false // 是否已发送心跳且尚未收到任何帧
+	lastRequest := time.Now()
+	for {
+		// read from the connection
+		// decode the frame to get the payload
+		// the payload is undecoded packet
+		dr.timeout = s.readTimeout(lastRequest)
+		r.n = 0
+		framePayload, err := sc.codec.Decode(r)
+		if err != nil {
+			switch {
+			case err == io.EOF:
+				return reasonClosed
+			case errors.Is(err, net.ErrClosed), errors.Is(err, errStopped):
+				return reasonServerClosed
+			case isTimeout(err) && r.n == 0:
+				// 两帧之间超时：先发送心跳，仍没有应答时断开
+				reason := reasonUnresponsive
+				switch {
+				case s.idleTimeout > 0 && time.Since(lastRequest) >= s.idleTimeout:
+					reason = reasonIdle
+				case s.heartbeat > 0 && !pinged:
+					pinged = true
+					pings++
+					ping, _ := packet.Encode(&packet.Ping{ID: pingID(pings)})
+					if !sc.send(ping) {
+						return reasonError
+					}
+					continue
+				}
+				log.Printf("tcpserver: closing %s connection %v", reason, sc.c.RemoteAddr())
+				return reason
+			case isTimeout(err):
+				log.Println("tcpserver: frame decode error:", err)
+				return reasonUnresponsive
+			}
+			log.Println("tcpserver: frame decode error:", err)
+			return reasonError
+		}
+		pinged = false
+
+		if isHeartbeat(framePayload) {
+			pongFramePayload, err := pong(framePayload)
+			if err != nil {
+				log.Println("tcpserver: heartbeat error:", err)
+				return reasonError
+			}
+			if pongFramePayload != nil && !sc.send(pongFramePayload) {
+				return reasonError
+			}
+			continue
+		}
+		lastRequest = time.Now()
+		if s.metrics != nil {
+			s.metrics.ReqRecvTotal.Add(1) // 收到并解码一个消息请求
+		}
+
+		if !sc.limit(framePayload) {
+			continue
+		}
+		if !sc.queue(framePayload) {
+			return reasonError
+		}
+	}
+}
+
+// queue hands a request to the workers, following the QueuePolicy of the
+// server when they are all busy. It returns false if the connection was
+// aborted.
+func (sc *serverConn) queue(framePayload []byte) bool {
+	if sc.s.queuePolicy == RejectWhenFull {
+		select {
+		case sc.in <- framePayload:
+			return true
+		default:
+		}
+		if ack := errorAck(framePayload, packet.ResultOverloaded); ack != nil {
+			ackFramePayload, err := packet.Encode(ack)
+			return err == nil && sc.send(ackFramePayload)
+		}
+	}
+
+	select {
+	case sc.in <- framePayload:
+		return true
+	case <-sc.done:
+		return false
+	}
+}
+
+// handleLoop handles the queued requests and queues their acks.
+func (sc *serverConn) handleLoop() {
+	defer func() {
+		// 与net/http一样，一个连接的panic只关闭该连接，不影响整个服务端
+		if r := recover(); r != nil {
+			log.Printf("tcpserver: panic serving %v: %v\n%s", sc.c.RemoteAddr(), r, debug.Stack())
+			sc.abort(reasonError)
+		}
+	}()
+
+	for framePayload := range sc.in {
+		// do something with the packet
+		ackFramePayload, err := sc.s.handlePacket(framePayload)
+		if err != nil {
+			log.Println("tcpserver: handle packet error:", err)
+			sc.abort(reasonError)
+			return
+		}
+		if ackFramePayload == nil {
+			continue
+		}
+		if !sc.send(ackFramePayload) {
+			return
+		}
+		if sc.s.metrics != nil {
+			sc.s.metrics.RspSendTotal.Add(1) // 返回一个响应
+		}
+	}
+}
+
+// writeLoop writes the queued frames. It flushes w only once the queue is
+// empty, so that the acks of pipelined requests are written together.
+// After the Disconnect it calls stopReading.
+func (sc *serverConn) writeLoop(w io.Writer, flush func() error, stopReading func()) {
+	disconnecting := sc.disconnecting
+	for {
+		var framePayload []byte
+		disconnect := false
+		select {
+		case f, ok := <-sc.out:
+			if !ok {
+				return
+			}
+			framePayload = f
+		case <-disconnecting:
+			disconnecting = nil // 只发送一次
+			disconnect = true
+			framePayload, _ = packet.Encode(&packet.Disconnect{ID: "00000000", Reason: packet.DisconnectShutdown})
+		}
+
+		// write ack frame to the connection
+		err := sc.codec.Encode(w, framePayload)
+		if err == nil && (disconnect || len(sc.out) == 0) {
+			err = flush()
+		}
+		if err != nil {
+			log.Println("tcpserver: frame encode error:", err)
+			sc.abort(reasonError)
+			return
+		}
+		if disconnect {
+			// 不再读取新的请求，已读取的请求应答后关闭连接
+			stopReading()
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package tcpserver
+
+import (
+	"fmt"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver/frame"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver/packet"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// blockingHandler acks the Submits once release is closed, except those
+// of payload "fast".
+func blockingHandler(release chan struct{}) Handler {
+	return HandlerFunc(func(p packet.Packet) (packet.Packet, error) {
+		if string(p.(*packet.Submit).Payload) != "fast" {
+			<-release
+		}
+		return AckSubmit(p)
+	})
+}
+
+func submit(t *testing.T, c *Client, i int, payload string) {
+	t.Helper()
+	if err := c.Send(&packet.Submit{ID: fmt.Sprintf("%08d", i), Payload: []byte(payload)}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func receiveAck(t *testing.T, c *Client) *packet.SubmitAck {
+	t.Helper()
+	c.Conn().SetReadDeadline(time.Now().Add(5 * time.Second))
+	p, err := c.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ack, ok := p.(*packet.SubmitAck)
+	if !ok {
+		t.Fatalf("want a submit ack, actual %#v", p)
+	}
+	return ack
+}
+
+func TestServerSlowHandler(t *testing.T) {
+	release := make(chan struct{})
+	s := NewServer("", WithConcurrency(2), WithBufferedIO())
+	s.Handle(packet.CommandSubmit, blockingHandler(release))
+	c, err := Dial(startServer(t, s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// 慢请求不影响之后的请求
+	submit(t, c, 1, "slow")
+	for i := 2; i <= 5; i++ {
+		submit(t, c, i, "fast")
+	}
+	for i := 2; i <= 5; i++ {
+		if ack := receiveAck(t, c); ack.ID != fmt.Sprintf("%08d", i) {
+			t.Errorf("want the ack of %d, actual %s", i, ack.ID)
+		}
+	}
+	close(release)
+	if ack := receiveAck(t, c); ack.ID != "00000001" || ack.Result != packet.ResultOK {
+		t.Errorf("want the ack of 1, actual %#v", ack)
+	}
+}
+
+func TestServerQueuePolicy(t *testing.T) {
+	const n = 10
+	for _, policy := range []QueuePolicy{BlockWhenFull, RejectWhenFull} {
+		release := make(chan struct{})
+		s := NewServer("", WithQueue(2, policy))
+		s.Handle(packet.CommandSubmit, blockingHandler(release))
+		c, err := Dial(startServer(t, s))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 1; i <= n; i++ {
+			submit(t, c, i, "slow")
+		}
+		time.Sleep(100 * time.Millisecond)
+		close(release)
+
+		// 处理中的1个与队列中的2个请求成功，其余的请求阻塞或被拒绝
+		results := make(map[uint8]int)
+		acked := make(map[string]bool)
+		for i := 1; i <= n; i++ {
+			ack := receiveAck(t, c)
+			results[ack.Result]++
+			acked[ack.ID] = true
+		}
+		if len(acked) != n {
+			t.Errorf("%v: want %d acks, actual %v", policy, n, acked)
+		}
+		switch policy {
+		case BlockWhenFull:
+			if results[packet.ResultOK] != n {
+				t.Errorf("block: want %d ok, actual %v", n, results)
+			}
+		case RejectWhenFull:
+			if ok := results[packet.ResultOK]; ok < 2 || ok > 3 || results[packet.ResultOverloaded] != n-ok {
+				t.Errorf("reject: want 2 or 3 ok and the others overloaded, actual %v", results)
+			}
+		}
+		c.Close()
+	}
+}
+
+// TestServerFlushBatch checks that the writer flushes once for the frames
+// queued together.
+func TestServerFlushBatch(t *testing.T) {
+	s := NewServer("")
+	client, server := net.Pipe()
+	defer client.Close()
+	sc := newServerConn(s, server, frame.NewMyFrameCodec())
+
+	const n = 10
+	for i := 0; i < n; i++ {
+		framePayload, _ := packet.Encode(&packet.SubmitAck{ID: fmt.Sprintf("%08d", i)})
+		sc.out <- framePayload
+	}
+	close(sc.out)
+
+	flushes := 0
+	done := make(chan struct{})
+	go func() {
+		sc.writeLoop(io.Discard, func() error {
+			flushes++
+			return nil
+		}, func() {})
+		close(done)
+	}()
+	<-done
+	if flushes != 1 {
+		t.Errorf("want 1 flush, actual %d", flushes)
+	}
+}
+
+func TestServerHandlerPanic(t *testing.T) {
+	s := NewServer("", WithConcurrency(2))
+	s.HandleFunc(packet.CommandSubmit, func(p packet.Packet) (packet.Packet, error) {
+		if string(p.(*packet.Submit).Payload) == "panic" {
+			panic("handler panic")
+		}
+		return AckSubmit(p)
+	})
+	addr := startServer(t, s)
+
+	c, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	submit(t, c, 1, "panic")
+	if p, err := c.Receive(); err == nil {
+		t.Errorf("want the connection closed, actual %#v", p)
+	}
+
+	c2, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Close()
+	submit(t, c2, 2, "hello")
+	if ack := receiveAck(t, c2); ack.ID != "00000002" {
+		t.Errorf("want the ack of 2, actual %#v", ack)
+	}
+}
+
+func TestClientMaxInFlight(t *testing.T) {
+	release := make(chan struct{})
+	s := NewServer("")
+	s.Handle(packet.CommandSubmit, blockingHandler(release))
+	c, err := Dial(startServer(t, s), WithMaxInFlight(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	submit(t, c, 1, "slow")
+	submit(t, c, 2, "slow")
+	sent := make(chan error, 1)
+	go func() {
+		sent <- c.Send(&packet.Submit{ID: "00000003", Payload: []byte("slow")})
+	}()
+	select {
+	case err := <-sent:
+		t.Fatalf("want the third send blocked, actual %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	receiveAck(t, c)
+	if err = <-sent; err != nil {
+		t.Fatal(err)
+	}
+	receiveAck(t, c)
+	if ack := receiveAck(t, c); ack.ID != "00000003" {
+		t.Errorf("want the ack of 3, actual %#v", ack)
+	}
+}
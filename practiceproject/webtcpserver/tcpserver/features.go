@@ -0,0 +1,90 @@
+package tcpserver
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver/frame"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver/packet"
+	"io"
+	"sync"
+)
+
+// supportedFeatures are the features a server grants by default.
+const supportedFeatures = packet.FeatureCompression | packet.FeatureChecksum
+
+// negotiatedCodec returns the codec of a session with the features granted
+// by its ConnAck. With the checksum the frames are those of the CRC32C
+// version of frame.NewCodec, keeping the length encoding and the max frame
+// size of codec, so that a corrupted frame is detected before its payload
+// is decompressed. The checksum is only granted for the codecs of package
+// frame.
+func negotiatedCodec(codec frame.StreamFrameCodec, features uint8) frame.StreamFrameCodec {
+	max, ok := frame.MaxFrameSize(codec)
+	if !ok {
+		max = frame.DefaultMaxFrameSize
+	}
+	if features&packet.FeatureChecksum != 0 {
+		v, _ := frame.VersionOf(codec)
+		codec = frame.NewCodec(frame.VersionFor(v.Varint(), true), frame.WithMaxFrameSize(max))
+	}
+	if features&packet.FeatureCompression != 0 {
+		codec = flateCodec{codec, max}
+	}
+	return codec
+}
+
+// codecFeatures returns the features of supportedFeatures that codec can
+// negotiate.
+func codecFeatures(codec frame.StreamFrameCodec) uint8 {
+	if _, ok := frame.MaxFrameSize(codec); !ok {
+		return supportedFeatures &^ packet.FeatureChecksum
+	}
+	return supportedFeatures
+}
+
+var flateWriters = sync.Pool{
+	New: func() interface{} {
+		w, _ := flate.NewWriter(nil, flate.BestSpeed)
+		return w
+	},
+}
+
+// flateCodec deflates each payload. A payload inflating to more than max
+// bytes is an error, so that a small frame cannot make the reader
+// allocate without bound.
+type flateCodec struct {
+	frame.StreamFrameCodec
+	max int
+}
+
+func (c flateCodec) Encode(w io.Writer, framePayload frame.FramePayload) error {
+	var buf bytes.Buffer
+	fw := flateWriters.Get().(*flate.Writer)
+	defer flateWriters.Put(fw)
+	fw.Reset(&buf)
+	if _, err := fw.Write(framePayload); err != nil {
+		return err
+	}
+	if err := fw.Close(); err != nil {
+		return err
+	}
+	return c.StreamFrameCodec.Encode(w, buf.Bytes())
+}
+
+func (c flateCodec) Decode(r io.Reader) (frame.FramePayload, error) {
+	framePayload, err := c.StreamFrameCodec.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	fr := flate.NewReader(bytes.NewReader(framePayload))
+	defer fr.Close()
+	buf, err := io.ReadAll(io.LimitReader(fr, int64(c.max)+1))
+	if err != nil {
+		return nil, fmt.Errorf("inflate payload: %w", err)
+	}
+	if len(buf) > c.max {
+		return nil, fmt.Errorf("%w: payload inflates over %d bytes", frame.ErrFrameTooLarge, c.max)
+	}
+	return buf, nil
+}
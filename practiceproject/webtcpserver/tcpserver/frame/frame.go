@@ -0,0 +1,174 @@
+package frame
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+type FramePayload []byte
+
+type StreamFrameCodec interface {
+	Encode(io.Writer, FramePayload) error   // data -> frame，并写入io.Writer
+	Decode(io.Reader) (FramePayload, error) // 从io.Reader中提取frame payload，并返回给上层
+}
+
+var ErrShortWrite = errors.New("short write")
+var ErrShortRead = errors.New("short read")
+
+var (
+	ErrFrameTooShort = errors.New("frame length shorter than its header")
+	ErrFrameTooLarge = errors.New("frame length over the limit")
+)
+
+// headerLen is the size of the totalLen header, which counts itself.
+const headerLen = 4
+
+// DefaultMaxFrameSize is the largest frame, header included, accepted by
+// a codec made without WithMaxFrameSize.
+const DefaultMaxFrameSize = 4 << 20 // 4MB
+
+// readChunk is the size up to which a payload is read into a buffer of
+// its full length. Longer payloads grow their buffer as their bytes
+// arrive, so that a length header alone cannot make the reader allocate.
+const readChunk = 64 << 10
+
+// LengthError reports a frame whose total length is invalid. Err is
+// ErrFrameTooShort or ErrFrameTooLarge.
+type LengthError struct {
+	Length int64 // 帧的总长度，包括帧头
+	Max    int   // 允许的最大总长度
+	Err    error
+}
+
+func (e *LengthError) Error() string {
+	return fmt.Sprintf("%v: length %d, max %d", e.Err, e.Length, e.Max)
+}
+
+func (e *LengthError) Unwrap() error {
+	return e.Err
+}
+
+type myFrameCodec struct {
+	maxFrameSize int // 帧的最大总长度，包括帧头
+}
+
+// Option configures the codec returned by NewMyFrameCodec.
+type Option func(*myFrameCodec)
+
+// WithMaxFrameSize sets the largest frame, header included, that the
+// codec encodes or decodes. It is capped to the largest length the int32
+// header can hold.
+func WithMaxFrameSize(n int) Option {
+	return func(p *myFrameCodec) {
+		p.maxFrameSize = n
+	}
+}
+
+func NewMyFrameCodec(opts ...Option) StreamFrameCodec {
+	p := &myFrameCodec{maxFrameSize: DefaultMaxFrameSize}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.maxFrameSize > math.MaxInt32 || p.maxFrameSize <= 0 {
+		p.maxFrameSize = math.MaxInt32
+	}
+	if p.maxFrameSize < headerLen {
+		p.maxFrameSize = headerLen
+	}
+	return p
+}
+
+// MaxFrameSize returns the largest frame accepted by codec, and false if
+// codec is not a codec of this package.
+func MaxFrameSize(codec StreamFrameCodec) (int, bool) {
+	switch c := codec.(type) {
+	case *myFrameCodec:
+		return c.maxFrameSize, true
+	case *versionedCodec:
+		return c.maxFrameSize, true
+	}
+	return 0, false
+}
+
+// checkLength returns a *LengthError if totalLen is not a valid frame
+// length.
+func (p *myFrameCodec) checkLength(totalLen int64) error {
+	switch {
+	case totalLen < headerLen:
+		return &LengthError{Length: totalLen, Max: p.maxFrameSize, Err: ErrFrameTooShort}
+	case totalLen > int64(p.maxFrameSize):
+		return &LengthError{Length: totalLen, Max: p.maxFrameSize, Err: ErrFrameTooLarge}
+	}
+	return nil
+}
+
+func (p *myFrameCodec) Encode(w io.Writer, framePayload FramePayload) error {
+	var f = framePayload
+	if err := p.checkLength(int64(len(framePayload)) + headerLen); err != nil {
+		return err
+	}
+	var totalLen int32 = int32(len(framePayload)) + headerLen
+
+	err := binary.Write(w, binary.BigEndian, &totalLen)
+	if err != nil {
+		return err
+	}
+
+	n, err := w.Write([]byte(f)) // write the frame payload to outbound stream
+	if err != nil {
+		return err
+	}
+
+	if n != len(framePayload) {
+		return ErrShortWrite
+	}
+	return nil
+}
+
+func (p *myFrameCodec) Decode(r io.Reader) (FramePayload, error) {
+	var totalLen int32
+	err := binary.Read(r, binary.BigEndian, &totalLen)
+	if err != nil {
+		return nil, err
+	}
+	if err = p.checkLength(int64(totalLen)); err != nil {
+		return nil, err
+	}
+
+	return readPayload(r, int(totalLen)-headerLen)
+}
+
+// readPayload reads a payload of n bytes. Payloads longer than readChunk
+// grow their buffer as their bytes arrive.
+func readPayload(r io.Reader, n int) (FramePayload, error) {
+	if n <= readChunk {
+		buf := make([]byte, n)
+		rn, err := io.ReadFull(r, buf)
+		if err != nil {
+			return nil, err
+		}
+
+		if rn != n {
+			return nil, ErrShortRead
+		}
+		return FramePayload(buf), nil
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(readChunk)
+	rn, err := io.CopyN(&buf, r, int64(n))
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	if rn != int64(n) {
+		return nil, ErrShortRead
+	}
+	return FramePayload(buf.Bytes()), nil
+}
@@ -0,0 +1,249 @@
+package frame
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"runtime"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	codec := NewMyFrameCodec()
+	buf := make([]byte, 0, 128)
+	rw := bytes.NewBuffer(buf)
+
+	err := codec.Encode(rw, []byte("hello"))
+	if err != nil {
+		t.Errorf("want nil, actual %s", err.Error())
+	}
+
+	// 验证Encode的正确性
+	var totalLen int32
+	err = binary.Read(rw, binary.BigEndian, &totalLen)
+	if err != nil {
+		t.Errorf("want nil, actual %s", err.Error())
+	}
+
+	if totalLen != 9 {
+		t.Errorf("want 9, actual %d", totalLen)
+	}
+
+	left := rw.Bytes()
+	if string(left) != "hello" {
+		t.Errorf("want hello, actual %s", string(left))
+	}
+}
+
+func TestDecode(t *testing.T) {
+	codec := NewMyFrameCodec()
+	data := []byte{0x0, 0x0, 0x0, 0x9, 'h', 'e', 'l', 'l', 'o'}
+
+	payload, err := codec.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Errorf("want nil, actual %s", err.Error())
+	}
+
+	if string(payload) != "hello" {
+		t.Errorf("want hello, actual %s", string(payload))
+	}
+}
+
+type ReturnErrorWriter struct {
+	W  io.Writer
+	Wn int // 第几次调用Write返回错误
+	wc int // 写操作次数 计数
+}
+
+func (w *ReturnErrorWriter) Write(p []byte) (n int, err error) {
+	w.wc++
+	if w.wc >= w.Wn {
+		return 0, errors.New("write error")
+	}
+	return w.W.Write(p)
+}
+
+type ReturnErrorReader struct {
+	R  io.Reader
+	Rn int // 第几次调用Read返回错误
+	rc int // 读操作次数计数
+}
+
+func (r *ReturnErrorReader) Read(p []byte) (n int, err error) {
+	r.rc++
+	if r.rc >= r.Rn {
+		return 0, errors.New("read error")
+	}
+	return r.R.Read(p)
+}
+
+func TestEncodeWithWriteFail(t *testing.T) {
+	codec := NewMyFrameCodec()
+	buf := make([]byte, 0, 128)
+	w := bytes.NewBuffer(buf)
+
+	// 模拟binary.Write返回错误
+	err := codec.Encode(&ReturnErrorWriter{
+		W:  w,
+		Wn: 1,
+	}, []byte("hello"))
+	if err == nil {
+		t.Errorf("want non-nil, actual nil")
+	}
+
+	// 模拟w.Write返回错误
+	err = codec.Encode(&ReturnErrorWriter{
+		W:  w,
+		Wn: 2,
+	}, []byte("hello"))
+	if err == nil {
+		t.Errorf("want non-nil, actual nil")
+	}
+}
+
+func TestDecodeWithReadFail(t *testing.T) {
+	codec := NewMyFrameCodec()
+	data := []byte{0x0, 0x0, 0x0, 0x9, 'h', 'e', 'l', 'l', 'o'}
+
+	// 模拟binary.Read返回错误
+	_, err := codec.Decode(&ReturnErrorReader{
+		R:  bytes.NewReader(data),
+		Rn: 1,
+	})
+	if err == nil {
+		t.Errorf("want non-nil, actual nil")
+	}
+
+	// 模拟io.ReadFull返回错误
+	_, err = codec.Decode(&ReturnErrorReader{
+		R:  bytes.NewReader(data),
+		Rn: 2,
+	})
+	if err == nil {
+		t.Errorf("want non-nil, actual nil")
+	}
+}
+
+func TestDecodeInvalidLength(t *testing.T) {
+	codec := NewMyFrameCodec(WithMaxFrameSize(16))
+	tests := []struct {
+		header []byte
+		want   error
+	}{
+		{[]byte{0xff, 0xff, 0xff, 0xff}, ErrFrameTooShort}, // -1
+		{[]byte{0x80, 0x0, 0x0, 0x0}, ErrFrameTooShort},    // math.MinInt32
+		{[]byte{0x0, 0x0, 0x0, 0x0}, ErrFrameTooShort},
+		{[]byte{0x0, 0x0, 0x0, 0x3}, ErrFrameTooShort},
+		{[]byte{0x0, 0x0, 0x0, 0x11}, ErrFrameTooLarge},
+		{[]byte{0x7f, 0xff, 0xff, 0xff}, ErrFrameTooLarge},
+	}
+
+	for _, tt := range tests {
+		_, err := codec.Decode(bytes.NewReader(tt.header))
+		if !errors.Is(err, tt.want) {
+			t.Errorf("header %x: want %v, actual %v", tt.header, tt.want, err)
+		}
+		var lerr *LengthError
+		if !errors.As(err, &lerr) || lerr.Max != 16 {
+			t.Errorf("header %x: want a *LengthError with max 16, actual %#v", tt.header, err)
+		}
+	}
+
+	// 空帧只有帧头
+	payload, err := codec.Decode(bytes.NewReader([]byte{0x0, 0x0, 0x0, 0x4}))
+	if err != nil || len(payload) != 0 {
+		t.Errorf("want an empty payload, actual %q, %v", payload, err)
+	}
+}
+
+func TestEncodeTooLarge(t *testing.T) {
+	codec := NewMyFrameCodec(WithMaxFrameSize(9))
+	var buf bytes.Buffer
+
+	if err := codec.Encode(&buf, []byte("hello")); err != nil {
+		t.Errorf("want nil, actual %v", err)
+	}
+	buf.Reset()
+	if err := codec.Encode(&buf, []byte("hello!")); !errors.Is(err, ErrFrameTooLarge) {
+		t.Errorf("want %v, actual %v", ErrFrameTooLarge, err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("want nothing written, actual %d bytes", buf.Len())
+	}
+}
+
+func TestDecodeLargeFrame(t *testing.T) {
+	codec := NewMyFrameCodec()
+	payload := bytes.Repeat([]byte("0123456789"), readChunk/5) // 超过readChunk
+	var buf bytes.Buffer
+	if err := codec.Encode(&buf, payload); err != nil {
+		t.Fatal(err)
+	}
+	frame := buf.Bytes()
+
+	got, err := codec.Decode(bytes.NewReader(frame))
+	if err != nil || !bytes.Equal(got, payload) {
+		t.Errorf("want the payload back, actual %d bytes, %v", len(got), err)
+	}
+
+	// 截断的帧
+	_, err = codec.Decode(bytes.NewReader(frame[:len(frame)-1]))
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("want %v, actual %v", io.ErrUnexpectedEOF, err)
+	}
+	_, err = codec.Decode(bytes.NewReader(frame[:readChunk]))
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("want %v, actual %v", io.ErrUnexpectedEOF, err)
+	}
+}
+
+func TestDecodeNoAllocationForLength(t *testing.T) {
+	codec := NewMyFrameCodec(WithMaxFrameSize(1 << 30))
+	header := []byte{0x3f, 0xff, 0xff, 0xff} // 约1GB，但后面没有数据
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	before := ms.TotalAlloc
+	_, err := codec.Decode(bytes.NewReader(header))
+	runtime.ReadMemStats(&ms)
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("want %v, actual %v", io.ErrUnexpectedEOF, err)
+	}
+	if grown := ms.TotalAlloc - before; grown > 1<<20 {
+		t.Errorf("want less than 1MB allocated, actual %d bytes", grown)
+	}
+}
+
+// FuzzDecode checks that Decode never panics, and that the frames it
+// accepts are within the limit and encode back to the bytes it read.
+func FuzzDecode(f *testing.F) {
+	f.Add([]byte{0x0, 0x0, 0x0, 0x9, 'h', 'e', 'l', 'l', 'o'})
+	f.Add([]byte{0x0, 0x0, 0x0, 0x4})
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff})
+	f.Add([]byte{0x0, 0x0, 0x0, 0x2, 'x'})
+	f.Add([]byte{0x7f, 0xff, 0xff, 0xff, 'x'})
+	f.Add([]byte{0x0, 0x0, 0x1, 0x0, 'x'})
+
+	const max = 1 << 10
+	codec := NewMyFrameCodec(WithMaxFrameSize(max))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r := bytes.NewReader(data)
+		payload, err := codec.Decode(r)
+		if err != nil {
+			return
+		}
+		if len(payload)+headerLen > max {
+			t.Fatalf("decoded a frame of %d bytes over the limit %d", len(payload)+headerLen, max)
+		}
+
+		var buf bytes.Buffer
+		if err = codec.Encode(&buf, payload); err != nil {
+			t.Fatal(err)
+		}
+		consumed := len(data) - r.Len()
+		if !bytes.Equal(buf.Bytes(), data[:consumed]) {
+			t.Fatalf("want %x, actual %x", data[:consumed], buf.Bytes())
+		}
+	})
+}
@@ -0,0 +1,269 @@
+package frame
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+// Version is the first byte of each frame of the codecs returned by
+// NewCodec. It tells how the length of the frame is encoded and whether a
+// CRC32C checksum follows the payload, so that the two ends can tell which
+// framing the other uses.
+//
+// A frame is the version byte, the length of the payload, the payload and,
+// for the CRC32C versions, the big-endian CRC32C of all the preceding bytes
+// of the frame.
+type Version uint8
+
+const (
+	VersionFixed        Version = iota + 0x01 // 0x01 4字节大端长度
+	VersionFixedCRC32C                        // 0x02 4字节大端长度，CRC32C校验
+	VersionVarint                             // 0x03 uvarint长度，适合小消息
+	VersionVarintCRC32C                       // 0x04 uvarint长度，CRC32C校验
+)
+
+var (
+	ErrVersion  = errors.New("unexpected frame version")
+	ErrChecksum = errors.New("frame checksum mismatch")
+	ErrVarint   = errors.New("frame length not a minimal uvarint")
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// VersionFor returns the version of the framing with a uvarint length if
+// varint is true, and with a CRC32C trailer if checksum is true.
+func VersionFor(varint, checksum bool) Version {
+	v := VersionFixed
+	if varint {
+		v = VersionVarint
+	}
+	if checksum {
+		v++
+	}
+	return v
+}
+
+// Valid reports whether v is a known version.
+func (v Version) Valid() bool {
+	return v >= VersionFixed && v <= VersionVarintCRC32C
+}
+
+// Varint reports whether the frames of v have a uvarint length.
+func (v Version) Varint() bool {
+	return v == VersionVarint || v == VersionVarintCRC32C
+}
+
+// Checksum reports whether the frames of v end with a CRC32C.
+func (v Version) Checksum() bool {
+	return v == VersionFixedCRC32C || v == VersionVarintCRC32C
+}
+
+func (v Version) String() string {
+	switch v {
+	case VersionFixed:
+		return "fixed"
+	case VersionFixedCRC32C:
+		return "fixed+crc32c"
+	case VersionVarint:
+		return "varint"
+	case VersionVarintCRC32C:
+		return "varint+crc32c"
+	}
+	return fmt.Sprintf("version(%#x)", uint8(v))
+}
+
+// ParseVersion returns the version named s, as returned by String.
+func ParseVersion(s string) (Version, error) {
+	for v := VersionFixed; v.Valid(); v++ {
+		if v.String() == s {
+			return v, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %q", ErrVersion, s)
+}
+
+// VersionError reports a frame of another version than that of the codec.
+type VersionError struct {
+	Got  Version
+	Want Version
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("%v: got %v, want %v", ErrVersion, e.Got, e.Want)
+}
+
+func (e *VersionError) Unwrap() error {
+	return ErrVersion
+}
+
+type versionedCodec struct {
+	version      Version
+	maxFrameSize int // 帧的最大总长度，包括版本、长度与校验和
+}
+
+// NewCodec returns the codec of the frames of version v. The options are
+// those of NewMyFrameCodec. It panics if v is not a valid version.
+func NewCodec(v Version, opts ...Option) StreamFrameCodec {
+	if !v.Valid() {
+		panic(fmt.Sprintf("frame: unknown version %#x", uint8(v)))
+	}
+	p := NewMyFrameCodec(opts...).(*myFrameCodec)
+	return &versionedCodec{version: v, maxFrameSize: p.maxFrameSize}
+}
+
+// VersionOf returns the version of the frames of codec, and false if codec
+// was not returned by NewCodec.
+func VersionOf(codec StreamFrameCodec) (Version, bool) {
+	if c, ok := codec.(*versionedCodec); ok {
+		return c.version, true
+	}
+	return 0, false
+}
+
+// overhead returns the size of a frame of payloadLen bytes minus the
+// payload.
+func (c *versionedCodec) overhead(payloadLen uint64) int64 {
+	n := int64(1 + 4) // 版本 + 长度
+	if c.version.Varint() {
+		var buf [binary.MaxVarintLen64]byte
+		n = int64(1 + binary.PutUvarint(buf[:], payloadLen))
+	}
+	if c.version.Checksum() {
+		n += 4
+	}
+	return n
+}
+
+func (c *versionedCodec) checkLength(payloadLen uint64) error {
+	if payloadLen > math.MaxInt32 {
+		return &LengthError{Length: math.MaxInt64, Max: c.maxFrameSize, Err: ErrFrameTooLarge}
+	}
+	if total := c.overhead(payloadLen) + int64(payloadLen); total > int64(c.maxFrameSize) {
+		return &LengthError{Length: total, Max: c.maxFrameSize, Err: ErrFrameTooLarge}
+	}
+	return nil
+}
+
+func (c *versionedCodec) Encode(w io.Writer, framePayload FramePayload) error {
+	if err := c.checkLength(uint64(len(framePayload))); err != nil {
+		return err
+	}
+
+	header := make([]byte, 1, 1+binary.MaxVarintLen64)
+	header[0] = byte(c.version)
+	if c.version.Varint() {
+		var buf [binary.MaxVarintLen64]byte
+		header = append(header, buf[:binary.PutUvarint(buf[:], uint64(len(framePayload)))]...)
+	} else {
+		header = append(header, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(header[1:], uint32(len(framePayload)))
+	}
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	n, err := w.Write(framePayload) // write the frame payload to outbound stream
+	if err != nil {
+		return err
+	}
+	if n != len(framePayload) {
+		return ErrShortWrite
+	}
+
+	if c.version.Checksum() {
+		h := crc32.New(castagnoli)
+		h.Write(header)
+		h.Write(framePayload)
+		var trailer [4]byte
+		binary.BigEndian.PutUint32(trailer[:], h.Sum32())
+		if _, err = w.Write(trailer[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *versionedCodec) Decode(r io.Reader) (FramePayload, error) {
+	var h hash.Hash32
+	if c.version.Checksum() {
+		h = crc32.New(castagnoli)
+		r = io.TeeReader(r, h) // 校验和覆盖帧尾之前的所有字节
+	}
+
+	var version [1]byte
+	if _, err := io.ReadFull(r, version[:]); err != nil {
+		return nil, err
+	}
+	if Version(version[0]) != c.version {
+		return nil, &VersionError{Got: Version(version[0]), Want: c.version}
+	}
+
+	payloadLen, err := c.readLength(r)
+	if err != nil {
+		return nil, err
+	}
+	if err = c.checkLength(payloadLen); err != nil {
+		return nil, err
+	}
+	payload, err := readPayload(r, int(payloadLen))
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	if h != nil {
+		sum := h.Sum32()
+		var trailer [4]byte
+		if _, err = io.ReadFull(r, trailer[:]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if got := binary.BigEndian.Uint32(trailer[:]); got != sum {
+			return nil, fmt.Errorf("%w: got %08x, want %08x", ErrChecksum, got, sum)
+		}
+	}
+	return payload, nil
+}
+
+// readLength reads the payload length that follows the version byte.
+func (c *versionedCodec) readLength(r io.Reader) (uint64, error) {
+	var buf [binary.MaxVarintLen64]byte
+	if !c.version.Varint() {
+		if _, err := io.ReadFull(r, buf[:4]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		return uint64(binary.BigEndian.Uint32(buf[:4])), nil
+	}
+
+	for i := 0; i < len(buf); i++ {
+		if _, err := io.ReadFull(r, buf[i:i+1]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		if buf[i] < 0x80 {
+			if i > 0 && buf[i] == 0 {
+				return 0, ErrVarint // 同一长度只有一种编码
+			}
+			n, m := binary.Uvarint(buf[:i+1])
+			if m <= 0 {
+				break
+			}
+			return n, nil
+		}
+	}
+	return 0, &LengthError{Length: math.MaxInt64, Max: c.maxFrameSize, Err: ErrFrameTooLarge}
+}
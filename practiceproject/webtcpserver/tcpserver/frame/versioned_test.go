@@ -0,0 +1,311 @@
+package frame
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+var versions = []Version{VersionFixed, VersionFixedCRC32C, VersionVarint, VersionVarintCRC32C}
+
+func TestVersionedEncode(t *testing.T) {
+	tests := []struct {
+		version Version
+		want    []byte
+	}{
+		{VersionFixed, []byte{0x01, 0x0, 0x0, 0x0, 0x5, 'h', 'e', 'l', 'l', 'o'}},
+		// CRC32C("\x02\x00\x00\x00\x05hello") = 0xf25be0c7
+		{VersionFixedCRC32C, []byte{0x02, 0x0, 0x0, 0x0, 0x5, 'h', 'e', 'l', 'l', 'o', 0xf2, 0x5b, 0xe0, 0xc7}},
+		{VersionVarint, []byte{0x03, 0x5, 'h', 'e', 'l', 'l', 'o'}},
+		// CRC32C("\x04\x05hello") = 0x9c183eab
+		{VersionVarintCRC32C, []byte{0x04, 0x5, 'h', 'e', 'l', 'l', 'o', 0x9c, 0x18, 0x3e, 0xab}},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		err := NewCodec(tt.version).Encode(&buf, []byte("hello"))
+		if err != nil {
+			t.Errorf("%v: want nil, actual %s", tt.version, err.Error())
+		}
+		if !bytes.Equal(buf.Bytes(), tt.want) {
+			t.Errorf("%v: want %x, actual %x", tt.version, tt.want, buf.Bytes())
+		}
+
+		payload, err := NewCodec(tt.version).Decode(bytes.NewReader(tt.want))
+		if err != nil {
+			t.Errorf("%v: want nil, actual %s", tt.version, err.Error())
+		}
+		if string(payload) != "hello" {
+			t.Errorf("%v: want hello, actual %s", tt.version, string(payload))
+		}
+	}
+}
+
+func TestVersionedRoundTrip(t *testing.T) {
+	payloads := [][]byte{
+		{},
+		[]byte("hello"),
+		bytes.Repeat([]byte{0xab}, 127), // 1字节uvarint的最大长度
+		bytes.Repeat([]byte{0xcd}, 128),
+		bytes.Repeat([]byte("0123456789"), readChunk/5),
+	}
+
+	for _, v := range versions {
+		codec := NewCodec(v)
+		var buf bytes.Buffer
+		for _, p := range payloads {
+			if err := codec.Encode(&buf, p); err != nil {
+				t.Fatalf("%v: %v", v, err)
+			}
+		}
+		for _, p := range payloads {
+			got, err := codec.Decode(&buf)
+			if err != nil || !bytes.Equal(got, p) {
+				t.Errorf("%v: want %d bytes, actual %d bytes, %v", v, len(p), len(got), err)
+			}
+		}
+		if _, err := codec.Decode(&buf); err != io.EOF {
+			t.Errorf("%v: want %v, actual %v", v, io.EOF, err)
+		}
+	}
+}
+
+func TestVersionedChecksum(t *testing.T) {
+	for _, v := range []Version{VersionFixedCRC32C, VersionVarintCRC32C} {
+		codec := NewCodec(v)
+		var buf bytes.Buffer
+		codec.Encode(&buf, []byte("hello"))
+		frame := buf.Bytes()
+
+		// 依次翻转版本以外的每个字节
+		for i := 1; i < len(frame); i++ {
+			corrupted := append([]byte(nil), frame...)
+			corrupted[i] ^= 0x01
+			payload, err := codec.Decode(bytes.NewReader(corrupted))
+			if err == nil {
+				t.Errorf("%v: byte %d flipped, want an error, actual %q", v, i, payload)
+			}
+		}
+
+		corrupted := append([]byte(nil), frame...)
+		corrupted[len(frame)-5] = 'O' // 帧尾前的最后一个payload字节
+		if _, err := codec.Decode(bytes.NewReader(corrupted)); !errors.Is(err, ErrChecksum) {
+			t.Errorf("%v: want %v, actual %v", v, ErrChecksum, err)
+		}
+	}
+}
+
+func TestVersionedMismatch(t *testing.T) {
+	var buf bytes.Buffer
+	NewCodec(VersionVarint).Encode(&buf, []byte("hello"))
+
+	_, err := NewCodec(VersionFixedCRC32C).Decode(&buf)
+	var verr *VersionError
+	if !errors.As(err, &verr) || verr.Got != VersionVarint || verr.Want != VersionFixedCRC32C {
+		t.Errorf("want a *VersionError, actual %v", err)
+	}
+	if !errors.Is(err, ErrVersion) {
+		t.Errorf("want %v, actual %v", ErrVersion, err)
+	}
+
+	// 旧的无版本帧以长度的高位字节开头
+	_, err = NewCodec(VersionFixed).Decode(bytes.NewReader([]byte{0x0, 0x0, 0x0, 0x9, 'h', 'e', 'l', 'l', 'o'}))
+	if !errors.Is(err, ErrVersion) {
+		t.Errorf("want %v, actual %v", ErrVersion, err)
+	}
+}
+
+func TestVersionedLength(t *testing.T) {
+	codec := NewCodec(VersionVarintCRC32C, WithMaxFrameSize(16))
+	var buf bytes.Buffer
+	if err := codec.Encode(&buf, bytes.Repeat([]byte("x"), 10)); err != nil { // 1 + 1 + 10 + 4
+		t.Errorf("want nil, actual %v", err)
+	}
+	if err := codec.Encode(&buf, bytes.Repeat([]byte("x"), 11)); !errors.Is(err, ErrFrameTooLarge) {
+		t.Errorf("want %v, actual %v", ErrFrameTooLarge, err)
+	}
+
+	tests := map[string][]byte{
+		"too large":       {0x04, 0x0b},
+		"fixed too large": {0x02, 0xff, 0xff, 0xff, 0xff},
+		"varint overflow": {0x04, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01},
+		"varint too long": {0x04, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80},
+	}
+	if _, err := codec.Decode(bytes.NewReader([]byte{0x04, 0x85, 0x00, 'h', 'e', 'l', 'l', 'o'})); err != ErrVarint {
+		t.Errorf("want %v, actual %v", ErrVarint, err)
+	}
+
+	for name, data := range tests {
+		c := codec
+		if data[0] == byte(VersionFixedCRC32C) {
+			c = NewCodec(VersionFixedCRC32C, WithMaxFrameSize(16))
+		}
+		_, err := c.Decode(bytes.NewReader(data))
+		var lerr *LengthError
+		if !errors.As(err, &lerr) || !errors.Is(err, ErrFrameTooLarge) {
+			t.Errorf("%s: want %v, actual %v", name, ErrFrameTooLarge, err)
+		}
+	}
+}
+
+func TestVersionedEncodeWithWriteFail(t *testing.T) {
+	for _, v := range versions {
+		codec := NewCodec(v)
+		writes := 2
+		if v.Checksum() {
+			writes = 3
+		}
+		// 模拟帧头、payload与校验和的写入依次返回错误
+		for wn := 1; wn <= writes; wn++ {
+			err := codec.Encode(&ReturnErrorWriter{
+				W:  io.Discard,
+				Wn: wn,
+			}, []byte("hello"))
+			if err == nil {
+				t.Errorf("%v: write %d failed, want non-nil, actual nil", v, wn)
+			}
+		}
+	}
+}
+
+func TestVersionedDecodeWithReadFail(t *testing.T) {
+	for _, v := range versions {
+		codec := NewCodec(v)
+		var buf bytes.Buffer
+		codec.Encode(&buf, []byte("hello"))
+
+		// 截断在帧的任意位置都返回错误
+		for n := 0; n < buf.Len(); n++ {
+			_, err := codec.Decode(bytes.NewReader(buf.Bytes()[:n]))
+			if err == nil {
+				t.Errorf("%v: %d of %d bytes, want non-nil, actual nil", v, n, buf.Len())
+			}
+		}
+
+		_, err := codec.Decode(&ReturnErrorReader{
+			R:  bytes.NewReader(buf.Bytes()),
+			Rn: 2,
+		})
+		if err == nil {
+			t.Errorf("%v: want non-nil, actual nil", v)
+		}
+	}
+}
+
+func TestVersionFor(t *testing.T) {
+	for _, v := range versions {
+		if got := VersionFor(v.Varint(), v.Checksum()); got != v {
+			t.Errorf("want %v, actual %v", v, got)
+		}
+	}
+	if Version(0).Valid() || Version(0x05).Valid() {
+		t.Errorf("want invalid versions")
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	for _, v := range versions {
+		if got, err := ParseVersion(v.String()); err != nil || got != v {
+			t.Errorf("want %v, actual %v, %v", v, got, err)
+		}
+	}
+	if _, err := ParseVersion("crc32c"); !errors.Is(err, ErrVersion) {
+		t.Errorf("want %v, actual %v", ErrVersion, err)
+	}
+}
+
+func TestVersionOf(t *testing.T) {
+	for _, v := range versions {
+		codec := NewCodec(v, WithMaxFrameSize(1024))
+		if got, ok := VersionOf(codec); !ok || got != v {
+			t.Errorf("want %v, actual %v, %v", v, got, ok)
+		}
+		if n, ok := MaxFrameSize(codec); !ok || n != 1024 {
+			t.Errorf("want 1024, actual %d, %v", n, ok)
+		}
+	}
+	if _, ok := VersionOf(NewMyFrameCodec()); ok {
+		t.Errorf("want no version for NewMyFrameCodec")
+	}
+	if n, ok := MaxFrameSize(NewMyFrameCodec()); !ok || n != DefaultMaxFrameSize {
+		t.Errorf("want %d, actual %d, %v", DefaultMaxFrameSize, n, ok)
+	}
+}
+
+// FuzzVersionedDecode checks that the versioned codecs never panic, and
+// that the frames they accept encode back to the bytes they read.
+func FuzzVersionedDecode(f *testing.F) {
+	for _, v := range versions {
+		var buf bytes.Buffer
+		NewCodec(v).Encode(&buf, []byte("hello"))
+		f.Add(buf.Bytes())
+	}
+	f.Add([]byte{0x04, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if len(data) == 0 || !Version(data[0]).Valid() {
+			return
+		}
+		codec := NewCodec(Version(data[0]), WithMaxFrameSize(1<<10))
+		r := bytes.NewReader(data)
+		payload, err := codec.Decode(r)
+		if err != nil {
+			return
+		}
+
+		var buf bytes.Buffer
+		if err = codec.Encode(&buf, payload); err != nil {
+			t.Fatal(err)
+		}
+		consumed := len(data) - r.Len()
+		if !bytes.Equal(buf.Bytes(), data[:consumed]) {
+			t.Fatalf("want %x, actual %x", data[:consumed], buf.Bytes())
+		}
+	})
+}
+
+func benchmarkCodecs() map[string]StreamFrameCodec {
+	codecs := map[string]StreamFrameCodec{"legacy": NewMyFrameCodec()}
+	for _, v := range versions {
+		codecs[v.String()] = NewCodec(v)
+	}
+	return codecs
+}
+
+func BenchmarkEncode(b *testing.B) {
+	for name, codec := range benchmarkCodecs() {
+		for _, size := range []int{16, 1024, 64 << 10} {
+			payload := bytes.Repeat([]byte("x"), size)
+			b.Run(fmt.Sprintf("%s/%d", name, size), func(b *testing.B) {
+				b.SetBytes(int64(size))
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					codec.Encode(io.Discard, payload)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	for name, codec := range benchmarkCodecs() {
+		for _, size := range []int{16, 1024, 64 << 10} {
+			var buf bytes.Buffer
+			codec.Encode(&buf, bytes.Repeat([]byte("x"), size))
+			frame := buf.Bytes()
+			b.Run(fmt.Sprintf("%s/%d", name, size), func(b *testing.B) {
+				b.SetBytes(int64(size))
+				b.ReportAllocs()
+				r := bytes.NewReader(frame)
+				for i := 0; i < b.N; i++ {
+					r.Reset(frame)
+					if _, err := codec.Decode(r); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
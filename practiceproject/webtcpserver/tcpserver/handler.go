@@ -0,0 +1,69 @@
+package tcpserver
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver/packet"
+)
+
+// Handler handles a request packet and returns the packet to reply with,
+// or nil for none. The server replies to a Submit that failed with a
+// SubmitAck of the result matching the error, ResultInternal if it is none
+// of those below. An error closes the connection of other packets.
+type Handler interface {
+	ServePacket(p packet.Packet) (packet.Packet, error)
+}
+
+// Errors a Handler returns for the SubmitAck results other than
+// ResultInternal.
+var (
+	ErrMalformed    = errors.New("tcpserver: malformed request")
+	ErrUnauthorized = errors.New("tcpserver: unauthorized request")
+	ErrOverloaded   = errors.New("tcpserver: server overloaded")
+)
+
+// resultOf returns the SubmitAck result of the error of a handler.
+func resultOf(err error) uint8 {
+	switch {
+	case errors.Is(err, ErrMalformed):
+		return packet.ResultMalformed
+	case errors.Is(err, ErrUnauthorized):
+		return packet.ResultUnauthorized
+	case errors.Is(err, ErrOverloaded):
+		return packet.ResultOverloaded
+	}
+	return packet.ResultInternal
+}
+
+// HandlerFunc lets an ordinary function be used as a Handler.
+type HandlerFunc func(p packet.Packet) (packet.Packet, error)
+
+// ServePacket calls f(p).
+func (f HandlerFunc) ServePacket(p packet.Packet) (packet.Packet, error) {
+	return f(p)
+}
+
+// AckSubmit acks every Submit with ResultOK and returns it to
+// packet.SubmitPool. It is the handler of the demo servers.
+var AckSubmit = HandlerFunc(func(p packet.Packet) (packet.Packet, error) {
+	submit, ok := p.(*packet.Submit)
+	if !ok {
+		return nil, fmt.Errorf("unknown packet type %T", p)
+	}
+	submitAck := &packet.SubmitAck{
+		ID:     submit.ID,
+		Result: packet.ResultOK,
+	}
+	packet.SubmitPool.Put(submit) // 将submit对象归还给Pool池
+	return submitAck, nil
+})
+
+// LogSubmits prints the Submits before handing them to h.
+func LogSubmits(h Handler) Handler {
+	return HandlerFunc(func(p packet.Packet) (packet.Packet, error) {
+		if submit, ok := p.(*packet.Submit); ok {
+			fmt.Printf("recv submit: id = %s, payload=%s\n", submit.ID, string(submit.Payload))
+		}
+		return h.ServePacket(p)
+	})
+}
@@ -0,0 +1,142 @@
+package tcpserver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver/frame"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver/packet"
+	"io"
+	"net"
+	"unicode"
+	"unicode/utf8"
+)
+
+var errNoHandshake = errors.New("first packet is not a conn")
+
+// ConnError is returned by Dial when the server refuses the session.
+type ConnError struct {
+	Result uint8 // ConnAck的结果
+}
+
+func (e *ConnError) Error() string {
+	switch e.Result {
+	case packet.ConnRefusedVersion:
+		return "tcpserver: connection refused: unsupported protocol version"
+	case packet.ConnRefusedClientID:
+		return "tcpserver: connection refused: invalid client id"
+	case packet.ConnRefusedCredentials:
+		return "tcpserver: connection refused: bad credentials"
+	case packet.ConnRefusedServerBusy:
+		return "tcpserver: connection refused: server busy"
+	}
+	return fmt.Sprintf("tcpserver: connection refused: result %d", e.Result)
+}
+
+// session is the state of a connection negotiated by its handshake.
+type session struct {
+	id       string
+	clientID string
+	features uint8
+	codec    frame.StreamFrameCodec // 按协商的特性包装后的codec
+	limiters []limiter
+}
+
+// handshake reads the Conn that opens the connection c and writes its
+// ConnAck. It returns a *ConnError if it refused the session.
+func (s *Server) handshake(c net.Conn, r io.Reader, w io.Writer, flush func() error) (*session, error) {
+	framePayload, err := s.codec.Decode(r) // 同时完成TLS握手
+	if err != nil {
+		return nil, err
+	}
+	if len(framePayload) == 0 || framePayload[0] != packet.CommandConn {
+		// 握手之前的Submit以ResultUnauthorized应答，随后关闭连接
+		if ack := errorAck(framePayload, packet.ResultUnauthorized); ack != nil {
+			if framePayload, err = packet.Encode(ack); err == nil && s.codec.Encode(w, framePayload) == nil {
+				flush()
+			}
+		}
+		return nil, errNoHandshake
+	}
+	p, err := packet.Decode(framePayload)
+	if err != nil {
+		return nil, err
+	}
+
+	sess, ack := s.accept(p.(*packet.Conn), s.peerClientID(c))
+	if framePayload, err = packet.Encode(ack); err == nil {
+		if err = s.codec.Encode(w, framePayload); err == nil {
+			err = flush()
+		}
+	}
+	if err != nil {
+		if sess != nil {
+			s.release(sess)
+		}
+		return nil, err
+	}
+	if ack.Result != packet.ConnAccepted {
+		return nil, &ConnError{Result: ack.Result}
+	}
+	return sess, nil
+}
+
+// accept negotiates the session of conn. certID is the client ID given by
+// the certificate of the client, if any. The session it returns must be
+// released once its connection is closed.
+func (s *Server) accept(conn *packet.Conn, certID string) (*session, *packet.ConnAck) {
+	ack := &packet.ConnAck{ID: conn.ID, Version: packet.ProtocolVersion}
+	switch {
+	case conn.Version < packet.ProtocolVersion:
+		ack.Result = packet.ConnRefusedVersion
+		return nil, ack
+	case !validClientID(conn.ClientID),
+		certID != "" && conn.ClientID != "" && conn.ClientID != certID:
+		ack.Result = packet.ConnRefusedClientID
+		return nil, ack
+	}
+
+	sess := &session{id: newSessionID(), clientID: conn.ClientID}
+	if certID != "" {
+		sess.clientID = certID // 以证书为准
+	}
+	if sess.clientID == "" {
+		sess.clientID = sess.id // 由服务端分配客户端ID
+	}
+	s.admit(sess)
+	if s.auth != nil {
+		if err := s.auth(sess.clientID, conn.Credentials); err != nil {
+			s.release(sess)
+			ack.Result = packet.ConnRefusedCredentials
+			return nil, ack
+		}
+	}
+
+	sess.features = conn.Features & s.features
+	sess.codec = negotiatedCodec(s.codec, sess.features)
+	ack.Features = sess.features
+	ack.SessionID = sess.id
+	return sess, ack
+}
+
+// validClientID reports whether id is printable UTF-8.
+func validClientID(id string) bool {
+	if !utf8.ValidString(id) {
+		return false
+	}
+	for _, r := range id {
+		if !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func newSessionID() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,125 @@
+package tcpserver
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver/packet"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Reasons of the disconnects counted by metrics.Disconnects.
+const (
+	reasonClosed       = "closed"        // 客户端关闭连接
+	reasonIdle         = "idle"          // 超过空闲时间没有请求
+	reasonUnresponsive = "unresponsive"  // 未应答心跳，或发送到一半的帧停止发送
+	reasonHandshake    = "handshake"     // 握手失败或超时
+	reasonError        = "error"         // 协议错误或写失败
+	reasonServerClosed = "server_closed" // 服务端关闭
+)
+
+// errStopped is returned by the reads of a deadlineReader once stop was
+// called.
+var errStopped = errors.New("tcpserver: reading stopped")
+
+// deadlineReader sets the read deadline of conn before each read, so
+// that a read fails once the peer has sent nothing for timeout.
+type deadlineReader struct {
+	conn    net.Conn
+	timeout time.Duration // 为0时不设置超时
+
+	mu      sync.Mutex
+	stopped bool
+}
+
+func (r *deadlineReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	if r.stopped {
+		r.mu.Unlock()
+		return 0, errStopped
+	}
+	if r.timeout > 0 {
+		if err := r.conn.SetReadDeadline(time.Now().Add(r.timeout)); err != nil {
+			r.mu.Unlock()
+			return 0, err
+		}
+	}
+	r.mu.Unlock()
+
+	n, err := r.conn.Read(p)
+	if err != nil && isTimeout(err) {
+		r.mu.Lock()
+		if r.stopped {
+			err = errStopped
+		}
+		r.mu.Unlock()
+	}
+	return n, err
+}
+
+// stop makes the pending and the next reads fail with errStopped, without
+// closing conn, so that what is queued can still be written.
+func (r *deadlineReader) stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stopped = true
+	r.conn.SetReadDeadline(time.Now()) // 唤醒阻塞中的读
+}
+
+// countingReader counts the bytes read through it, to tell a timeout
+// between two frames from one in the middle of a frame.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += n
+	return n, err
+}
+
+func isTimeout(err error) bool {
+	var nerr net.Error
+	return errors.As(err, &nerr) && nerr.Timeout()
+}
+
+// readTimeout returns how long the server waits for the next frame of a
+// connection whose last request was at lastRequest, 0 for ever.
+func (s *Server) readTimeout(lastRequest time.Time) time.Duration {
+	timeout := s.heartbeat
+	if s.idleTimeout > 0 {
+		idle := s.idleTimeout - time.Since(lastRequest)
+		if idle <= 0 {
+			idle = time.Nanosecond // 已经空闲，下次读取立即超时
+		}
+		if timeout == 0 || idle < timeout {
+			timeout = idle
+		}
+	}
+	return timeout
+}
+
+// pong returns the encoded Pong answering the Ping of framePayload, nil
+// for a Pong.
+func pong(framePayload []byte) ([]byte, error) {
+	p, err := packet.Decode(framePayload)
+	if err != nil {
+		return nil, err
+	}
+	if ping, ok := p.(*packet.Ping); ok {
+		return packet.Encode(&packet.Pong{ID: ping.ID})
+	}
+	return nil, nil
+}
+
+func isHeartbeat(framePayload []byte) bool {
+	return len(framePayload) > 0 &&
+		(framePayload[0] == packet.CommandPing || framePayload[0] == packet.CommandPong)
+}
+
+func pingID(n int) string {
+	return fmt.Sprintf("%08d", n%100000000)
+}
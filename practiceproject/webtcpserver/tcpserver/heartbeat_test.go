@@ -0,0 +1,243 @@
+package tcpserver
+
+import (
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver/frame"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver/metrics"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver/packet"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// waitDisconnects waits until m has counted n disconnects of reason.
+func waitDisconnects(t *testing.T, m *metrics.Metrics, reason string, n float64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for testutil.ToFloat64(m.Disconnects.WithLabelValues(reason)) != n && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if v := testutil.ToFloat64(m.Disconnects.WithLabelValues(reason)); v != n {
+		t.Errorf("want %v %s disconnects, actual %v", n, reason, v)
+	}
+}
+
+// readPacket reads the next packet sent on conn.
+func readPacket(t *testing.T, conn net.Conn) (packet.Packet, error) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	framePayload, err := frame.NewMyFrameCodec().Decode(conn)
+	if err != nil {
+		return nil, err
+	}
+	return packet.Decode(framePayload)
+}
+
+func writePacket(t *testing.T, conn net.Conn, p packet.Packet) {
+	t.Helper()
+	framePayload, err := packet.Encode(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = frame.NewMyFrameCodec().Encode(conn, framePayload); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServerHeartbeat(t *testing.T) {
+	m := metrics.New("test")
+	s := NewServer("", WithMetrics(m, ""), WithHeartbeat(50*time.Millisecond))
+	s.Handle(packet.CommandSubmit, AckSubmit)
+	addr := startServer(t, s)
+
+	// 应答心跳的连接保持打开
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	rawHandshake(t, conn)
+	for i := 0; i < 3; i++ {
+		p, err := readPacket(t, conn)
+		ping, ok := p.(*packet.Ping)
+		if !ok {
+			t.Fatalf("want a ping, actual %#v, %v", p, err)
+		}
+		writePacket(t, conn, &packet.Pong{ID: ping.ID})
+	}
+	writePacket(t, conn, &packet.Ping{ID: "00000001"})
+	writePacket(t, conn, &packet.Submit{ID: "00000002", Payload: []byte("hello")})
+	if p, err := readPacket(t, conn); err != nil || p.(*packet.Pong).ID != "00000001" {
+		t.Errorf("want the pong of 00000001, actual %#v, %v", p, err)
+	}
+	if p, err := readPacket(t, conn); err != nil || p.(*packet.SubmitAck).ID != "00000002" {
+		t.Errorf("want the ack of 00000002, actual %#v, %v", p, err)
+	}
+
+	// 不应答心跳的连接被断开
+	if p, err := readPacket(t, conn); err != nil {
+		t.Fatalf("want a ping, actual %v", err)
+	} else if _, ok := p.(*packet.Ping); !ok {
+		t.Fatalf("want a ping, actual %#v", p)
+	}
+	if p, err := readPacket(t, conn); err != io.EOF {
+		t.Errorf("want the connection closed, actual %#v, %v", p, err)
+	}
+	waitDisconnects(t, m, reasonUnresponsive, 1)
+}
+
+func TestServerStalledPeers(t *testing.T) {
+	m := metrics.New("test")
+	s := NewServer("", WithMetrics(m, ""), WithHeartbeat(50*time.Millisecond))
+	s.Handle(packet.CommandSubmit, AckSubmit)
+	addr := startServer(t, s)
+
+	// 没有握手
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if p, err := readPacket(t, conn); err != io.EOF {
+		t.Errorf("want the connection closed, actual %#v, %v", p, err)
+	}
+	waitDisconnects(t, m, reasonHandshake, 1)
+
+	// 帧发送到一半
+	conn2, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn2.Close()
+	rawHandshake(t, conn2)
+	conn2.Write([]byte{0x0, 0x0, 0x0, 0x10, packet.CommandSubmit})
+	if p, err := readPacket(t, conn2); err != io.EOF {
+		t.Errorf("want the connection closed, actual %#v, %v", p, err)
+	}
+	waitDisconnects(t, m, reasonUnresponsive, 1)
+
+	// 客户端主动关闭
+	c, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	waitDisconnects(t, m, reasonClosed, 1)
+}
+
+func TestServerHandshakeTimeout(t *testing.T) {
+	m := metrics.New("test")
+	s := NewServer("", WithMetrics(m, ""), WithHandshakeTimeout(50*time.Millisecond))
+	s.Handle(packet.CommandSubmit, AckSubmit)
+	addr := startServer(t, s)
+
+	// 未启用心跳时，没有握手的连接同样被断开
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if p, err := readPacket(t, conn); err != io.EOF {
+		t.Errorf("want the connection closed, actual %#v, %v", p, err)
+	}
+	waitDisconnects(t, m, reasonHandshake, 1)
+
+	// 握手之后不再受其超时限制
+	c, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	time.Sleep(100 * time.Millisecond)
+	submit(t, c, 1, "hello")
+	if ack := receiveAck(t, c); ack.Result != packet.ResultOK {
+		t.Errorf("want ok, actual %#v", ack)
+	}
+}
+
+func TestServerIdleTimeout(t *testing.T) {
+	m := metrics.New("test")
+	s := NewServer("", WithMetrics(m, ""),
+		WithHeartbeat(20*time.Millisecond), WithIdleTimeout(200*time.Millisecond))
+	s.Handle(packet.CommandSubmit, AckSubmit)
+	addr := startServer(t, s)
+
+	c, err := Dial(addr, WithClientHeartbeat(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// 心跳不算作请求，请求重置空闲时间
+	start := time.Now()
+	time.Sleep(100 * time.Millisecond)
+	if err = c.Send(&packet.Submit{ID: "00000001", Payload: []byte("hello")}); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := c.Receive(); err != nil {
+		t.Fatalf("want an ack, actual %v", err)
+	} else if _, ok := p.(*packet.SubmitAck); !ok {
+		t.Fatalf("want an ack, actual %#v", p)
+	}
+	// 客户端的心跳可能使关闭表现为RST
+	if p, err := c.Receive(); err == nil {
+		t.Errorf("want the connection closed, actual %#v", p)
+	}
+	if d := time.Since(start); d < 300*time.Millisecond {
+		t.Errorf("want the connection closed after 300ms, actual %v", d)
+	}
+	waitDisconnects(t, m, reasonIdle, 1)
+	waitDisconnects(t, m, reasonUnresponsive, 0)
+}
+
+// TestClientHeartbeat checks that the client answers the pings of the
+// server, and detects a server that stopped answering its own.
+func TestClientHeartbeat(t *testing.T) {
+	s := NewServer("", WithHeartbeat(20*time.Millisecond))
+	s.Handle(packet.CommandSubmit, AckSubmit)
+	c, err := Dial(startServer(t, s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	acks := make(chan packet.Packet, 1)
+	go func() {
+		p, _ := c.Receive() // 接收应答之前，应答服务端的心跳
+		acks <- p
+	}()
+	time.Sleep(200 * time.Millisecond)
+	if err = c.Send(&packet.Submit{ID: "00000001", Payload: []byte("hello")}); err != nil {
+		t.Fatal(err)
+	}
+	if p, ok := (<-acks).(*packet.SubmitAck); !ok || p.ID != "00000001" {
+		t.Errorf("want the ack of 00000001, actual %#v", p)
+	}
+
+	// 握手之后不再应答的服务端
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		codec := frame.NewMyFrameCodec()
+		codec.Decode(conn)
+		framePayload, _ := packet.Encode(&packet.ConnAck{ID: "00000000", Version: packet.ProtocolVersion})
+		codec.Encode(conn, framePayload)
+		io.Copy(io.Discard, conn)
+	}()
+	c2, err := Dial(l.Addr().String(), WithClientHeartbeat(20*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Close()
+	if p, err := c2.Receive(); !isTimeout(err) {
+		t.Errorf("want a timeout, actual %#v, %v", p, err)
+	}
+}
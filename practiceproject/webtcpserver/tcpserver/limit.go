@@ -0,0 +1,258 @@
+package tcpserver
+
+import (
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver/packet"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// Reasons of the rejections counted by metrics.Rejections.
+const (
+	rejectMaxConns   = "max_conns"   // 连接数已达上限
+	rejectAddress    = "address"     // 客户端地址不在允许列表中或在拒绝列表中
+	rejectConnRate   = "conn_rate"   // 超过单个连接的请求速率
+	rejectClientRate = "client_rate" // 超过同一客户端ID的请求速率
+)
+
+// rateLimit is a number of requests per second, with bursts of up to
+// burst requests.
+type rateLimit struct {
+	rate  float64 // 为0时不限制
+	burst int
+}
+
+// tokenBucket holds up to burst tokens and gains rate tokens per second,
+// each request takes one.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(l rateLimit) *tokenBucket {
+	burst := float64(l.burst)
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: l.rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// refill adds the tokens gained since the last call, b.mu must be held.
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+// take takes a token, it reports false if there is none left.
+func (b *tokenBucket) take(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// put gives back a token taken by take.
+func (b *tokenBucket) put() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens++; b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+// reserve takes a token even if there is none left, and returns how long
+// the caller must wait before using it.
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(now)
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// limiter is a token bucket limiting the requests of a connection, reason
+// is the label of the requests it rejects.
+type limiter struct {
+	bucket *tokenBucket
+	reason string
+}
+
+// clientBucket is the token bucket shared by the connections of a client
+// ID.
+type clientBucket struct {
+	bucket *tokenBucket
+	conns  int // 使用该令牌桶的连接数，为0时删除
+}
+
+// allowed reports whether the allow and deny lists of the server let addr
+// connect. The deny list wins over the allow list.
+func (s *Server) allowed(addr net.Addr) bool {
+	if len(s.allow) == 0 && len(s.deny) == 0 {
+		return true
+	}
+	ap, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return false
+	}
+	ip := ap.Addr().Unmap()
+	for _, p := range s.deny {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	if len(s.allow) == 0 {
+		return true
+	}
+	for _, p := range s.allow {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// admit sets the rate limiters of sess. The limit of WithMaxConns is
+// enforced by track, as soon as a connection is accepted.
+func (s *Server) admit(sess *session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.connRate.rate > 0 {
+		sess.limiters = append(sess.limiters, limiter{newTokenBucket(s.connRate), rejectConnRate})
+	}
+	if s.clientRate.rate > 0 {
+		cb, ok := s.clients[sess.clientID]
+		if !ok {
+			cb = &clientBucket{bucket: newTokenBucket(s.clientRate)}
+			s.clients[sess.clientID] = cb
+		}
+		cb.conns++
+		sess.limiters = append(sess.limiters, limiter{cb.bucket, rejectClientRate})
+	}
+}
+
+// release frees the client bucket shared through admit.
+func (s *Server) release(sess *session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cb, ok := s.clients[sess.clientID]; ok && s.clientRate.rate > 0 {
+		if cb.conns--; cb.conns == 0 {
+			delete(s.clients, sess.clientID)
+		}
+	}
+}
+
+// maxRefusing is the number of connections over the limit of WithMaxConns
+// that are told ConnRefusedServerBusy at once, the others are closed at
+// once. They do not count against the limit.
+const maxRefusing = 16
+
+// refuseTimeout bounds reading the Conn and writing the ConnAck of a
+// refused connection.
+const refuseTimeout = time.Second
+
+// refuse answers the Conn of c with ConnRefusedServerBusy and closes c,
+// within refuseTimeout. If maxRefusing connections are being refused
+// already, c is closed at once.
+func (s *Server) refuse(c net.Conn) {
+	s.mu.Lock()
+	if s.closed || len(s.refusing) >= maxRefusing {
+		s.mu.Unlock()
+		c.Close()
+		return
+	}
+	s.refusing[c] = struct{}{}
+	s.wg.Add(1)
+	s.mu.Unlock()
+
+	go func() {
+		defer func() {
+			s.mu.Lock()
+			delete(s.refusing, c)
+			s.mu.Unlock()
+			c.Close()
+			s.wg.Done()
+		}()
+
+		// 先读取连接请求包再回复：关闭时接收缓冲区中仍有未读的数据会发送RST，客户端可能收不到ConnAck
+		c.SetDeadline(time.Now().Add(refuseTimeout))
+		framePayload, err := s.codec.Decode(c)
+		if err != nil {
+			return
+		}
+		ack := &packet.ConnAck{ID: "00000000", Version: packet.ProtocolVersion, Result: packet.ConnRefusedServerBusy}
+		if p, err := packet.Decode(framePayload); err == nil {
+			if conn, ok := p.(*packet.Conn); ok {
+				ack.ID = conn.ID
+			}
+		}
+		if framePayload, err = packet.Encode(ack); err == nil {
+			s.codec.Encode(c, framePayload)
+		}
+	}()
+}
+
+func (s *Server) reject(reason string) {
+	if s.metrics != nil {
+		s.metrics.Rejections.WithLabelValues(reason).Inc()
+	}
+}
+
+// limit applies the rate limits of the connection to a request. A Submit
+// over a limit is answered with ResultRateLimited and limit returns false,
+// other requests wait for a token. It also returns false if the
+// connection was aborted while waiting.
+func (sc *serverConn) limit(framePayload []byte) bool {
+	if len(sc.limiters) == 0 {
+		return true
+	}
+	now := time.Now()
+	ack := errorAck(framePayload, packet.ResultRateLimited)
+	if ack == nil {
+		var wait time.Duration
+		for _, l := range sc.limiters {
+			if d := l.bucket.reserve(now); d > wait {
+				wait = d
+			}
+		}
+		if wait == 0 {
+			return true
+		}
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			return true
+		case <-sc.done:
+			return false
+		}
+	}
+
+	for i, l := range sc.limiters {
+		if l.bucket.take(now) {
+			continue
+		}
+		for _, taken := range sc.limiters[:i] {
+			taken.bucket.put() // 归还已取得的令牌
+		}
+		sc.s.reject(l.reason)
+		if ackFramePayload, err := packet.Encode(ack); err == nil {
+			sc.send(ackFramePayload)
+		}
+		return false
+	}
+	return true
+}
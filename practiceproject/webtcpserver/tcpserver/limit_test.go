@@ -0,0 +1,258 @@
+package tcpserver
+
+import (
+	"errors"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver/metrics"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver/packet"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+// waitRejections waits until m has counted n rejections of reason.
+func waitRejections(t *testing.T, m *metrics.Metrics, reason string, n float64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for testutil.ToFloat64(m.Rejections.WithLabelValues(reason)) != n && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if v := testutil.ToFloat64(m.Rejections.WithLabelValues(reason)); v != n {
+		t.Errorf("want %v %s rejections, actual %v", n, reason, v)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	b := newTokenBucket(rateLimit{rate: 10, burst: 2})
+	now := b.last
+	if !b.take(now) || !b.take(now) {
+		t.Fatal("want the burst taken")
+	}
+	if b.take(now) {
+		t.Error("want the bucket empty")
+	}
+	if !b.take(now.Add(100 * time.Millisecond)) {
+		t.Error("want a token after 100ms")
+	}
+	b.put()
+	if !b.take(now.Add(100 * time.Millisecond)) {
+		t.Error("want the token put back")
+	}
+
+	// reserve预支令牌，返回需要等待的时间
+	if d := b.reserve(now.Add(100 * time.Millisecond)); d != 100*time.Millisecond {
+		t.Errorf("want 100ms, actual %v", d)
+	}
+	if d := b.reserve(now.Add(100 * time.Millisecond)); d != 200*time.Millisecond {
+		t.Errorf("want 200ms, actual %v", d)
+	}
+	if d := b.reserve(now.Add(time.Second)); d != 0 {
+		t.Errorf("want 0, actual %v", d)
+	}
+}
+
+func TestServerMaxConns(t *testing.T) {
+	m := metrics.New("test")
+	s := NewServer("", WithMetrics(m, ""), WithMaxConns(1))
+	s.Handle(packet.CommandSubmit, AckSubmit)
+	addr := startServer(t, s)
+
+	c, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Dial(addr)
+	var cerr *ConnError
+	if !errors.As(err, &cerr) || cerr.Result != packet.ConnRefusedServerBusy {
+		t.Errorf("want server busy, actual %v", err)
+	}
+	waitRejections(t, m, rejectMaxConns, 1)
+
+	// 连接关闭后释放名额
+	c.Close()
+	waitDisconnects(t, m, reasonClosed, 1)
+	c, err = Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	submit(t, c, 1, "hello")
+	if ack := receiveAck(t, c); ack.Result != packet.ResultOK {
+		t.Errorf("want ok, actual %#v", ack)
+	}
+}
+
+// TestServerMaxConnsHandshake checks that the connections count against
+// WithMaxConns before their handshake.
+func TestServerMaxConnsHandshake(t *testing.T) {
+	m := metrics.New("test")
+	s := NewServer("", WithMetrics(m, ""), WithMaxConns(1))
+	s.Handle(packet.CommandSubmit, AckSubmit)
+	addr := startServer(t, s)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Dial(addr)
+	var cerr *ConnError
+	if !errors.As(err, &cerr) || cerr.Result != packet.ConnRefusedServerBusy {
+		t.Errorf("want server busy, actual %v", err)
+	}
+	waitRejections(t, m, rejectMaxConns, 1)
+
+	conn.Close()
+	waitDisconnects(t, m, reasonClosed, 1)
+	c, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+}
+
+// TestServerRefuseBudget checks that the refused connections that send
+// nothing are answered by at most maxRefusing goroutines.
+func TestServerRefuseBudget(t *testing.T) {
+	m := metrics.New("test")
+	s := NewServer("", WithMetrics(m, ""), WithMaxConns(1))
+	addr := startServer(t, s)
+
+	var conns []net.Conn
+	for i := 0; i < maxRefusing+2; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conns = append(conns, conn)
+	}
+	waitRejections(t, m, rejectMaxConns, maxRefusing+1)
+
+	// 超出预算的连接立即关闭，不等待refuseTimeout
+	last := conns[len(conns)-1]
+	last.SetReadDeadline(time.Now().Add(refuseTimeout / 2))
+	if _, err := last.Read(make([]byte, 1)); err == nil || isTimeout(err) {
+		t.Errorf("want the connection closed, actual %v", err)
+	}
+	s.mu.Lock()
+	refusing := len(s.refusing)
+	s.mu.Unlock()
+	if refusing != maxRefusing {
+		t.Errorf("want %d, actual %d", maxRefusing, refusing)
+	}
+}
+
+func TestServerRateLimit(t *testing.T) {
+	m := metrics.New("test")
+	s := NewServer("", WithMetrics(m, ""), WithConnRateLimit(1, 3), WithClientRateLimit(1, 4))
+	s.Handle(packet.CommandSubmit, AckSubmit)
+	addr := startServer(t, s)
+
+	// 单个连接最多突发3个请求
+	c, err := Dial(addr, WithClientID("client-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	for i := 1; i <= 5; i++ {
+		submit(t, c, i, "hello")
+	}
+	results := make(map[uint8]int)
+	for i := 1; i <= 5; i++ {
+		results[receiveAck(t, c).Result]++
+	}
+	if results[packet.ResultOK] != 3 || results[packet.ResultRateLimited] != 2 {
+		t.Errorf("want 3 ok and 2 rate limited, actual %v", results)
+	}
+	waitRejections(t, m, rejectConnRate, 2)
+
+	// 同一客户端ID的连接共享剩余的1个令牌
+	c2, err := Dial(addr, WithClientID("client-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Close()
+	submit(t, c2, 6, "hello")
+	submit(t, c2, 7, "hello")
+	results = make(map[uint8]int) // 被拒绝的应答可能先于其他应答写出
+	for i := 6; i <= 7; i++ {
+		results[receiveAck(t, c2).Result]++
+	}
+	if results[packet.ResultOK] != 1 || results[packet.ResultRateLimited] != 1 {
+		t.Errorf("want 1 ok and 1 rate limited, actual %v", results)
+	}
+	waitRejections(t, m, rejectClientRate, 1)
+
+	// 其他客户端ID不受影响
+	c3, err := Dial(addr, WithClientID("client-2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c3.Close()
+	submit(t, c3, 8, "hello")
+	if ack := receiveAck(t, c3); ack.Result != packet.ResultOK {
+		t.Errorf("want ok, actual %#v", ack)
+	}
+}
+
+// TestServerRateLimitDelay checks that the requests other than Submit
+// wait for a token instead of being rejected.
+func TestServerRateLimitDelay(t *testing.T) {
+	s := NewServer("", WithConnRateLimit(20, 1))
+	s.HandleFunc(commandEcho, func(p packet.Packet) (packet.Packet, error) {
+		return p, nil
+	})
+	c, err := Dial(startServer(t, s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err = c.Send(&echo{Body: []byte("hi")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if p, err := c.Receive(); err != nil {
+			t.Fatal(err)
+		} else if _, ok := p.(*echo); !ok {
+			t.Fatalf("want an echo, actual %#v", p)
+		}
+	}
+	if d := time.Since(start); d < 100*time.Millisecond {
+		t.Errorf("want the echoes delayed 100ms, actual %v", d)
+	}
+}
+
+func TestServerAddressLists(t *testing.T) {
+	loopback := netip.MustParsePrefix("127.0.0.0/8")
+	tests := map[string]struct {
+		opts    []Option
+		allowed bool
+	}{
+		"no list":          {nil, true},
+		"allowed":          {[]Option{WithAllow(netip.MustParsePrefix("127.0.0.1/32"))}, true},
+		"not allowed":      {[]Option{WithAllow(netip.MustParsePrefix("10.0.0.0/8"))}, false},
+		"denied":           {[]Option{WithDeny(loopback)}, false},
+		"allowed, denied":  {[]Option{WithAllow(loopback), WithDeny(netip.MustParsePrefix("127.0.0.1/32"))}, false},
+		"other one denied": {[]Option{WithDeny(netip.MustParsePrefix("10.0.0.0/8"))}, true},
+	}
+
+	for name, tt := range tests {
+		m := metrics.New("test")
+		s := NewServer("", append(tt.opts, WithMetrics(m, ""))...)
+		c, err := Dial(startServer(t, s))
+		if (err == nil) != tt.allowed {
+			t.Errorf("%s: want allowed %v, actual %v", name, tt.allowed, err)
+		}
+		if err == nil {
+			c.Close()
+		}
+		if v := testutil.ToFloat64(m.Rejections.WithLabelValues(rejectAddress)); (v == 0) != tt.allowed {
+			t.Errorf("%s: want allowed %v, actual %v rejections", name, tt.allowed, v)
+		}
+	}
+}
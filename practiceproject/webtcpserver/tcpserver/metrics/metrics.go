@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+)
+
+// Metrics are the counters of a server, in a registry of their own so
+// that several servers can run in one process, such as in tests.
+type Metrics struct {
+	ClientConnected prometheus.Gauge   // 当前连接数
+	ReqRecvTotal    prometheus.Counter // 收到的请求数
+	RspSendTotal    prometheus.Counter // 发送的响应数
+
+	// Disconnects counts the closed connections by the reason label,
+	// such as idle or unresponsive.
+	Disconnects *prometheus.CounterVec
+	// Rejections counts the refused connections and requests by the
+	// reason label, such as max_conns or conn_rate.
+	Rejections *prometheus.CounterVec
+
+	registry *prometheus.Registry
+}
+
+// New returns the metrics of a server, named with the prefix namespace,
+// such as tcp_server_demo2_req_recv_total. The registry also holds the
+// go runtime and process metrics.
+func New(namespace string) *Metrics {
+	m := &Metrics{
+		ClientConnected: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "client_connected",
+		}),
+		ReqRecvTotal: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "req_recv_total",
+		}),
+		RspSendTotal: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rsp_send_total",
+		}),
+		Disconnects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "client_disconnected_total",
+		}, []string{"reason"}),
+		Rejections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "client_rejected_total",
+		}, []string{"reason"}),
+		registry: prometheus.NewRegistry(),
+	}
+	m.registry.MustRegister(m.ClientConnected, m.ReqRecvTotal, m.RspSendTotal, m.Disconnects, m.Rejections,
+		collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	return m
+}
+
+// Registerer lets callers add their own metrics next to those of the
+// server.
+func (m *Metrics) Registerer() prometheus.Registerer {
+	return m.registry
+}
+
+// Handler serves the metrics in the prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
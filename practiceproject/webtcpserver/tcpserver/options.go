@@ -0,0 +1,171 @@
+package tcpserver
+
+import (
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver/frame"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver/metrics"
+	"net/http"
+	"net/http/pprof"
+	"net/netip"
+	"time"
+)
+
+type Option func(*Server)
+
+// WithCodec sets the codec of the frames, frame.NewMyFrameCodec by
+// default.
+func WithCodec(codec frame.StreamFrameCodec) Option {
+	return func(s *Server) {
+		s.codec = codec
+	}
+}
+
+// WithMetrics counts the connections, requests and responses of the
+// server in m. If addr is not empty, ListenAndServe also serves them at
+// http://addr/metrics for prometheus.
+func WithMetrics(m *metrics.Metrics, addr string) Option {
+	return func(s *Server) {
+		s.metrics = m
+		s.metricsAddr = addr
+	}
+}
+
+// WithPprof makes ListenAndServe serve the profiles of net/http/pprof at
+// http://addr/debug/pprof/.
+func WithPprof(addr string) Option {
+	return func(s *Server) {
+		s.pprofAddr = addr
+	}
+}
+
+// WithBufferedIO reads and writes the connections through bufio. The
+// writer of a connection flushes once it has written all its queued
+// frames, so the acks of pipelined requests are written together.
+func WithBufferedIO() Option {
+	return func(s *Server) {
+		s.bufferedIO = true
+	}
+}
+
+// WithAuth makes the server check the client ID and credentials of each
+// Conn with auth, the session is refused if it returns an error. The
+// client ID is that assigned by the server if the client sent none.
+func WithAuth(auth func(clientID string, credentials []byte) error) Option {
+	return func(s *Server) {
+		s.auth = auth
+	}
+}
+
+// WithFeatures sets the features, such as packet.FeatureCompression, that
+// the server grants to the clients requesting them. All the supported
+// features are granted by default. The checksum is only granted with a
+// codec of package frame.
+func WithFeatures(features uint8) Option {
+	return func(s *Server) {
+		s.features = features & supportedFeatures
+	}
+}
+
+// WithHeartbeat makes the server send a Ping to the connections that sent
+// nothing for interval, and close those still silent interval later. A
+// frame stalled for interval also closes its connection, as does a
+// handshake that takes longer.
+func WithHeartbeat(interval time.Duration) Option {
+	return func(s *Server) {
+		s.heartbeat = interval
+	}
+}
+
+// WithHandshakeTimeout closes the connections that did not complete their
+// handshake within d, 10 seconds by default, with or without WithHeartbeat.
+func WithHandshakeTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		if d > 0 {
+			s.handshakeTimeout = d
+		}
+	}
+}
+
+// WithIdleTimeout makes the server close the connections that sent no
+// request other than Ping and Pong for d.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.idleTimeout = d
+	}
+}
+
+// WithQueue sets the number of requests each connection reads ahead of
+// its handlers, and of frames it queues for writing, 128 by default.
+// policy tells what happens once the requests queue is full.
+func WithQueue(size int, policy QueuePolicy) Option {
+	return func(s *Server) {
+		if size > 0 {
+			s.queueSize = size
+		}
+		s.queuePolicy = policy
+	}
+}
+
+// WithConcurrency lets n handlers serve the requests of each connection
+// at once, 1 by default. With more than one, the acks of a connection may
+// be written in another order than its requests.
+func WithConcurrency(n int) Option {
+	return func(s *Server) {
+		if n > 0 {
+			s.workers = n
+		}
+	}
+}
+
+// WithMaxConns limits the server to n connections at once, including those
+// that did not complete their handshake. Further connections get a ConnAck
+// with packet.ConnRefusedServerBusy, or are closed at once if many are
+// being refused already.
+func WithMaxConns(n int) Option {
+	return func(s *Server) {
+		s.maxConns = n
+	}
+}
+
+// WithConnRateLimit limits each connection to rate requests per second,
+// with bursts of up to burst requests. The Submits over the limit are
+// answered with packet.ResultRateLimited, other requests are delayed.
+func WithConnRateLimit(rate float64, burst int) Option {
+	return func(s *Server) {
+		s.connRate = rateLimit{rate: rate, burst: burst}
+	}
+}
+
+// WithClientRateLimit limits the connections of each client ID to rate
+// requests per second in total, as WithConnRateLimit does for one
+// connection.
+func WithClientRateLimit(rate float64, burst int) Option {
+	return func(s *Server) {
+		s.clientRate = rateLimit{rate: rate, burst: burst}
+	}
+}
+
+// WithAllow only accepts the connections of the addresses in prefixes,
+// such as netip.MustParsePrefix("10.0.0.0/8").
+func WithAllow(prefixes ...netip.Prefix) Option {
+	return func(s *Server) {
+		s.allow = append(s.allow, prefixes...)
+	}
+}
+
+// WithDeny closes at once the connections of the addresses in prefixes,
+// even if WithAllow accepts them.
+func WithDeny(prefixes ...netip.Prefix) Option {
+	return func(s *Server) {
+		s.deny = append(s.deny, prefixes...)
+	}
+}
+
+func pprofMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
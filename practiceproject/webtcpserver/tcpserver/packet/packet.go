@@ -0,0 +1,362 @@
+package packet
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+const (
+	CommandConn       = iota + 0x01 // 0x01
+	CommandSubmit                   // 0x02
+	CommandPing                     // 0x03
+	CommandDisconnect               // 0x04
+)
+
+const (
+	CommandConnAck   = iota + 0x80 // 0x80
+	CommandSubmitAck               // 0x81
+	CommandPong                    // 0x82
+)
+
+// ProtocolVersion is the latest version of the protocol, the one sent in
+// the Conn of the clients and accepted by the servers.
+const ProtocolVersion = 1
+
+// Features of a connection, requested by the Conn and granted by the
+// ConnAck.
+const (
+	FeatureCompression = 1 << iota // payload压缩
+	FeatureChecksum                // payload校验和
+)
+
+// Result of a ConnAck.
+const (
+	ConnAccepted           = iota // 0，握手成功
+	ConnRefusedVersion            // 1，不支持的协议版本
+	ConnRefusedClientID           // 2，非法的客户端ID
+	ConnRefusedCredentials        // 3，认证失败
+	ConnRefusedServerBusy         // 4，连接数已达上限
+)
+
+// Reason of a Disconnect.
+const (
+	DisconnectShutdown = iota // 0，服务端正在关闭
+)
+
+// Result of a SubmitAck.
+const (
+	ResultOK           = iota // 0，成功
+	ResultMalformed           // 1，请求包格式错误
+	ResultUnauthorized        // 2，未握手或无权限
+	ResultOverloaded          // 3，服务端过载，稍后重试
+	ResultInternal            // 4，服务端内部错误
+	ResultRateLimited         // 5，超过请求速率限制，稍后重试
+)
+
+// IDLen is the length of the ID of every packet.
+const IDLen = 8
+
+var (
+	ErrEmptyPacket    = errors.New("empty packet")
+	ErrUnknownCommand = errors.New("unknown command")
+	ErrShortPacket    = errors.New("packet body too short")
+	ErrLongPacket     = errors.New("packet body too long")
+	ErrIDLength       = errors.New("packet id is not 8 bytes")
+	ErrClientIDLength = errors.New("client id longer than 255 bytes")
+)
+
+// Error reports a packet that Decode or Encode failed on. Err is one of
+// the errors above, possibly wrapped with details.
+type Error struct {
+	Op        string // "decode"或"encode"
+	CommandID uint8
+	Err       error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("packet: %s command [%d]: %v", e.Op, e.CommandID, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// checkLen returns an error wrapping ErrShortPacket if pktBody is shorter
+// than min bytes.
+func checkLen(pktBody []byte, min int) error {
+	if len(pktBody) < min {
+		return fmt.Errorf("%w: %d bytes, want at least %d", ErrShortPacket, len(pktBody), min)
+	}
+	return nil
+}
+
+func checkID(id string) error {
+	if len(id) != IDLen {
+		return fmt.Errorf("%w: %q", ErrIDLength, id)
+	}
+	return nil
+}
+
+var SubmitPool = sync.Pool{
+	New: func() interface{} {
+		return &Submit{}
+	},
+}
+
+type Packet interface {
+	Decode([]byte) error     // []byte -> struct
+	Encode() ([]byte, error) // struct -> []byte
+}
+
+// Conn opens a session. It must be the first packet of a connection.
+type Conn struct {
+	ID          string
+	Version     uint8  // 客户端支持的最高协议版本
+	Features    uint8  // 请求的特性
+	ClientID    string // 不超过255字节，为空时由服务端分配
+	Credentials []byte
+}
+
+func (c *Conn) Decode(pktBody []byte) error {
+	if err := checkLen(pktBody, IDLen+3); err != nil {
+		return err
+	}
+	n := IDLen + 3 + int(pktBody[IDLen+2])
+	if err := checkLen(pktBody, n); err != nil {
+		return err
+	}
+	c.ID = string(pktBody[:IDLen])
+	c.Version = pktBody[IDLen]
+	c.Features = pktBody[IDLen+1]
+	c.ClientID = string(pktBody[IDLen+3 : n])
+	c.Credentials = pktBody[n:]
+	return nil
+}
+
+func (c *Conn) Encode() ([]byte, error) {
+	if err := checkID(c.ID); err != nil {
+		return nil, err
+	}
+	if len(c.ClientID) > 255 {
+		return nil, ErrClientIDLength
+	}
+	header := []byte{c.Version, c.Features, uint8(len(c.ClientID))}
+	return bytes.Join([][]byte{[]byte(c.ID), header, []byte(c.ClientID), c.Credentials}, nil), nil
+}
+
+// ConnAck answers a Conn. The session is open if Result is ConnAccepted,
+// otherwise the server closes the connection.
+type ConnAck struct {
+	ID        string
+	Version   uint8 // 双方使用的协议版本
+	Result    uint8
+	Features  uint8 // 服务端同意的特性
+	SessionID string
+}
+
+func (c *ConnAck) Decode(pktBody []byte) error {
+	if err := checkLen(pktBody, IDLen+3); err != nil {
+		return err
+	}
+	c.ID = string(pktBody[:IDLen])
+	c.Version = pktBody[IDLen]
+	c.Result = pktBody[IDLen+1]
+	c.Features = pktBody[IDLen+2]
+	c.SessionID = string(pktBody[IDLen+3:])
+	return nil
+}
+
+func (c *ConnAck) Encode() ([]byte, error) {
+	if err := checkID(c.ID); err != nil {
+		return nil, err
+	}
+	return bytes.Join([][]byte{[]byte(c.ID), {c.Version, c.Result, c.Features}, []byte(c.SessionID)}, nil), nil
+}
+
+type Submit struct {
+	ID      string
+	Payload []byte
+}
+
+func (s *Submit) Decode(pktBody []byte) error {
+	if err := checkLen(pktBody, IDLen); err != nil {
+		return err
+	}
+	s.ID = string(pktBody[:IDLen])
+	s.Payload = pktBody[IDLen:]
+	return nil
+}
+
+func (s *Submit) Encode() ([]byte, error) {
+	if err := checkID(s.ID); err != nil {
+		return nil, err
+	}
+	return bytes.Join([][]byte{[]byte(s.ID), s.Payload}, nil), nil
+}
+
+// SubmitAck answers a Submit with one of the Result codes above.
+type SubmitAck struct {
+	ID     string
+	Result uint8
+}
+
+func (s *SubmitAck) Decode(pktBody []byte) error {
+	if err := checkLen(pktBody, IDLen+1); err != nil {
+		return err
+	}
+	if len(pktBody) > IDLen+1 {
+		return fmt.Errorf("%w: %d bytes, want %d", ErrLongPacket, len(pktBody), IDLen+1)
+	}
+	s.ID = string(pktBody[:IDLen])
+	s.Result = pktBody[IDLen]
+	return nil
+}
+
+func (s *SubmitAck) Encode() ([]byte, error) {
+	if err := checkID(s.ID); err != nil {
+		return nil, err
+	}
+	return bytes.Join([][]byte{[]byte(s.ID), {s.Result}}, nil), nil
+}
+
+// Ping checks that the peer is alive, it answers with a Pong of the same
+// ID. Either end of a connection may send it once the handshake is done.
+type Ping struct {
+	ID string
+}
+
+func (p *Ping) Decode(pktBody []byte) error {
+	return decodeID(&p.ID, pktBody)
+}
+
+func (p *Ping) Encode() ([]byte, error) {
+	return []byte(p.ID), checkID(p.ID)
+}
+
+// Pong answers a Ping.
+type Pong struct {
+	ID string
+}
+
+func (p *Pong) Decode(pktBody []byte) error {
+	return decodeID(&p.ID, pktBody)
+}
+
+func (p *Pong) Encode() ([]byte, error) {
+	return []byte(p.ID), checkID(p.ID)
+}
+
+// decodeID decodes a body made of an ID only.
+func decodeID(id *string, pktBody []byte) error {
+	if err := checkLen(pktBody, IDLen); err != nil {
+		return err
+	}
+	if len(pktBody) > IDLen {
+		return fmt.Errorf("%w: %d bytes, want %d", ErrLongPacket, len(pktBody), IDLen)
+	}
+	*id = string(pktBody)
+	return nil
+}
+
+// Disconnect tells the client that the server is closing the connection.
+// The server acks the requests it read before the Disconnect and closes
+// the connection, the client should send no more and resend the requests
+// left without an ack to another server.
+type Disconnect struct {
+	ID     string
+	Reason uint8
+}
+
+func (d *Disconnect) Decode(pktBody []byte) error {
+	if err := checkLen(pktBody, IDLen+1); err != nil {
+		return err
+	}
+	if len(pktBody) > IDLen+1 {
+		return fmt.Errorf("%w: %d bytes, want %d", ErrLongPacket, len(pktBody), IDLen+1)
+	}
+	d.ID = string(pktBody[:IDLen])
+	d.Reason = pktBody[IDLen]
+	return nil
+}
+
+func (d *Disconnect) Encode() ([]byte, error) {
+	if err := checkID(d.ID); err != nil {
+		return nil, err
+	}
+	return bytes.Join([][]byte{[]byte(d.ID), {d.Reason}}, nil), nil
+}
+
+var (
+	mu        sync.RWMutex
+	factories = make(map[uint8]func() Packet) // 命令ID -> 创建packet
+	commands  = make(map[reflect.Type]uint8)  // packet类型 -> 命令ID
+)
+
+func init() {
+	Register(CommandConn, func() Packet { return &Conn{} })
+	Register(CommandConnAck, func() Packet { return &ConnAck{} })
+	Register(CommandSubmit, func() Packet {
+		return SubmitPool.Get().(*Submit) // 从SubmitPool池中获取一个Submit内存对象
+	})
+	Register(CommandSubmitAck, func() Packet { return &SubmitAck{} })
+	Register(CommandPing, func() Packet { return &Ping{} })
+	Register(CommandPong, func() Packet { return &Pong{} })
+	Register(CommandDisconnect, func() Packet { return &Disconnect{} })
+}
+
+// Register makes Decode create the packets of the command commandID with
+// newPacket, and Encode write commandID before the packets of its type.
+// It panics if commandID is already registered.
+func Register(commandID uint8, newPacket func() Packet) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, ok := factories[commandID]; ok {
+		panic(fmt.Sprintf("packet: command [%d] registered twice", commandID))
+	}
+	factories[commandID] = newPacket
+	commands[reflect.TypeOf(newPacket())] = commandID
+}
+
+// Decode decodes the packet of a frame payload, its command ID followed by
+// its body. It returns a *Error if the payload is not a valid packet.
+func Decode(packet []byte) (Packet, error) {
+	if len(packet) == 0 {
+		return nil, &Error{Op: "decode", Err: ErrEmptyPacket}
+	}
+	commandID := packet[0]
+	pktBody := packet[1:]
+
+	mu.RLock()
+	newPacket, ok := factories[commandID]
+	mu.RUnlock()
+	if !ok {
+		return nil, &Error{Op: "decode", CommandID: commandID, Err: ErrUnknownCommand}
+	}
+
+	p := newPacket()
+	if err := p.Decode(pktBody); err != nil {
+		return nil, &Error{Op: "decode", CommandID: commandID, Err: err}
+	}
+	return p, nil
+}
+
+// Encode encodes p after its command ID. It returns a *Error if the type
+// of p is not registered or p is not valid.
+func Encode(p Packet) ([]byte, error) {
+	mu.RLock()
+	commandID, ok := commands[reflect.TypeOf(p)]
+	mu.RUnlock()
+	if !ok {
+		return nil, &Error{Op: "encode", Err: fmt.Errorf("%w: type %T", ErrUnknownCommand, p)}
+	}
+
+	pktBody, err := p.Encode()
+	if err != nil {
+		return nil, &Error{Op: "encode", CommandID: commandID, Err: err}
+	}
+	return bytes.Join([][]byte{[]byte{commandID}, pktBody}, nil), nil
+}
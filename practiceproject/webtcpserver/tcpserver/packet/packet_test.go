@@ -0,0 +1,122 @@
+package packet
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	packets := []Packet{
+		&Conn{ID: "00000000", Version: ProtocolVersion, Features: FeatureChecksum, ClientID: "demo-1", Credentials: []byte("secret")},
+		&Conn{ID: "00000000", Version: ProtocolVersion, Credentials: []byte{}},
+		&ConnAck{ID: "00000000", Version: ProtocolVersion, Result: ConnAccepted, Features: FeatureChecksum, SessionID: "0123456789abcdef"},
+		&Submit{ID: "00000001", Payload: []byte("hello")},
+		&SubmitAck{ID: "00000001", Result: ResultOverloaded},
+		&Ping{ID: "00000002"},
+		&Pong{ID: "00000002"},
+		&Disconnect{ID: "00000000", Reason: DisconnectShutdown},
+	}
+
+	for _, p := range packets {
+		data, err := Encode(p)
+		if err != nil {
+			t.Fatalf("%T: %v", p, err)
+		}
+		got, err := Decode(data)
+		if err != nil {
+			t.Fatalf("%T: %v", p, err)
+		}
+		if !reflect.DeepEqual(got, p) {
+			t.Errorf("want %#v, actual %#v", p, got)
+		}
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	tests := map[string]struct {
+		packet []byte
+		want   error
+	}{
+		"empty":             {[]byte{}, ErrEmptyPacket},
+		"unknown command":   {[]byte{0x55, 'x'}, ErrUnknownCommand},
+		"short submit":      {[]byte{CommandSubmit, '1', '2'}, ErrShortPacket},
+		"short submit ack":  {append([]byte{CommandSubmitAck}, "00000001"...), ErrShortPacket},
+		"long submit ack":   {append([]byte{CommandSubmitAck}, "00000001\x00\x00"...), ErrLongPacket},
+		"short conn":        {[]byte("\x0100000000\x01\x00"), ErrShortPacket},
+		"short client id":   {[]byte("\x0100000000\x01\x00\x05demo"), ErrShortPacket},
+		"short conn ack":    {append([]byte{CommandConnAck}, "00000000\x01"...), ErrShortPacket},
+		"submit without id": {[]byte{CommandSubmit}, ErrShortPacket},
+		"short ping":        {[]byte{CommandPing, '1'}, ErrShortPacket},
+		"long pong":         {append([]byte{CommandPong}, "000000001"...), ErrLongPacket},
+		"short disconnect":  {[]byte("\x0400000000"), ErrShortPacket},
+	}
+
+	for name, tt := range tests {
+		p, err := Decode(tt.packet)
+		var perr *Error
+		if !errors.As(err, &perr) || perr.Op != "decode" || !errors.Is(err, tt.want) {
+			t.Errorf("%s: want %v, actual %#v, %v", name, tt.want, p, err)
+		}
+	}
+}
+
+func TestEncodeInvalid(t *testing.T) {
+	tests := map[string]struct {
+		packet Packet
+		want   error
+	}{
+		"short submit id":     {&Submit{ID: "1", Payload: []byte("hello")}, ErrIDLength},
+		"empty submit ack id": {&SubmitAck{}, ErrIDLength},
+		"long conn id":        {&Conn{ID: "000000001"}, ErrIDLength},
+		"long client id":      {&Conn{ID: "00000000", ClientID: string(make([]byte, 256))}, ErrClientIDLength},
+		"short conn ack id":   {&ConnAck{ID: "0"}, ErrIDLength},
+		"empty ping id":       {&Ping{}, ErrIDLength},
+		"unregistered type":   {&unregistered{}, ErrUnknownCommand},
+	}
+
+	for name, tt := range tests {
+		data, err := Encode(tt.packet)
+		var perr *Error
+		if !errors.As(err, &perr) || perr.Op != "encode" || !errors.Is(err, tt.want) {
+			t.Errorf("%s: want %v, actual %x, %v", name, tt.want, data, err)
+		}
+	}
+}
+
+type unregistered struct{}
+
+func (*unregistered) Decode([]byte) error     { return nil }
+func (*unregistered) Encode() ([]byte, error) { return nil, nil }
+
+// FuzzDecode checks that Decode never panics, and that the packets it
+// returns encode back to the bytes they were decoded from.
+func FuzzDecode(f *testing.F) {
+	f.Add([]byte("\x0100000000\x01\x03\x06demo-1secret"))
+	f.Add(append([]byte{CommandConnAck}, "00000000\x01\x00\x030123456789abcdef"...))
+	f.Add([]byte("\x0200000001hello"))
+	f.Add(append([]byte{CommandSubmitAck}, "00000001\x00"...))
+	f.Add([]byte{CommandSubmit, '1'})
+	f.Add([]byte("\x0300000002"))
+	f.Add([]byte("\x0400000000\x00"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		p, err := Decode(data)
+		if err != nil {
+			var perr *Error
+			if !errors.As(err, &perr) {
+				t.Fatalf("want a *Error, actual %v", err)
+			}
+			return
+		}
+
+		encoded, err := Encode(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(encoded, data) {
+			t.Fatalf("want %x, actual %x", data, encoded)
+		}
+	})
+}
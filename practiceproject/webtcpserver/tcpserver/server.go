@@ -0,0 +1,405 @@
+// Package tcpserver serves the frame and packet protocol of webtcpserver.
+// A Server reads the frames of its connections, decodes their packets and
+// replies with the ack returned by the Handler registered for the command
+// of each packet. The demo servers are configurations of it.
+//
+// Each connection opens with a handshake: the client sends a Conn with its
+// protocol version, client ID, credentials and the features it wants, and
+// the server replies with a ConnAck carrying the result, the session ID
+// and the features it granted. Any other packet before it closes the
+// connection.
+package tcpserver
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver/frame"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver/metrics"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver/packet"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+var ErrServerClosed = errors.New("tcpserver: server closed")
+
+var errMaxConns = errors.New("tcpserver: too many connections")
+
+type Server struct {
+	addr        string
+	codec       frame.StreamFrameCodec
+	metrics     *metrics.Metrics // 为nil时不统计
+	metricsAddr string           // 为空时不提供/metrics
+	pprofAddr   string           // 为空时不提供/debug/pprof
+	bufferedIO  bool             // 是否使用带缓存的网络I/O
+	tlsConfig   *tls.Config      // 为nil时不使用TLS
+
+	auth         func(clientID string, credentials []byte) error // 为nil时不认证
+	certClientID func(subject pkix.Name) string                  // 客户端证书主题 -> 客户端ID
+	features     uint8                                           // 允许协商的特性
+
+	heartbeat        time.Duration // 连接静默多久后发送心跳，为0时不发送
+	idleTimeout      time.Duration // 多久没有请求后断开，为0时不断开
+	handshakeTimeout time.Duration // 连接须在多久内完成握手
+
+	queueSize   int         // 每个连接的请求队列与发送队列的长度
+	queuePolicy QueuePolicy // 请求队列满时的行为
+	workers     int         // 每个连接并发处理请求的goroutine数
+
+	maxConns   int            // 连接数上限，包括尚未握手的连接，为0时不限制
+	connRate   rateLimit      // 每个连接的请求速率
+	clientRate rateLimit      // 同一客户端ID的所有连接的请求速率
+	allow      []netip.Prefix // 为空时允许所有地址
+	deny       []netip.Prefix
+
+	hmu      sync.RWMutex
+	handlers map[uint8]Handler // 命令ID -> 处理器
+
+	mu       sync.Mutex
+	ls       map[net.Listener]struct{}
+	conns    map[net.Conn]struct{}
+	refusing map[net.Conn]struct{}    // 超出连接数上限、正在回复ConnRefusedServerBusy的连接
+	active   map[*serverConn]struct{} // 已握手的连接
+	clients  map[string]*clientBucket // 客户端ID -> 令牌桶
+	httpSrvs []*http.Server
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// NewServer returns a server listening on addr once ListenAndServe is
+// called. It has no handler: packets of unregistered commands close their
+// connection.
+func NewServer(addr string, opts ...Option) *Server {
+	s := &Server{
+		addr:             addr,
+		codec:            frame.NewMyFrameCodec(),
+		features:         supportedFeatures,
+		handshakeTimeout: defaultHandshakeTimeout,
+		queueSize:        defaultQueueSize,
+		workers:          1,
+		handlers:         make(map[uint8]Handler),
+		ls:               make(map[net.Listener]struct{}),
+		conns:            make(map[net.Conn]struct{}),
+		refusing:         make(map[net.Conn]struct{}),
+		active:           make(map[*serverConn]struct{}),
+		clients:          make(map[string]*clientBucket),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.features &= codecFeatures(s.codec)
+	return s
+}
+
+// Handle registers h for the packets of the command commandID, replacing
+// the previous handler of the command.
+func (s *Server) Handle(commandID uint8, h Handler) {
+	s.hmu.Lock()
+	defer s.hmu.Unlock()
+	s.handlers[commandID] = h
+}
+
+// HandleFunc registers fn for the packets of the command commandID.
+func (s *Server) HandleFunc(commandID uint8, fn func(packet.Packet) (packet.Packet, error)) {
+	s.Handle(commandID, HandlerFunc(fn))
+}
+
+func (s *Server) handler(commandID uint8) (Handler, bool) {
+	s.hmu.RLock()
+	defer s.hmu.RUnlock()
+	h, ok := s.handlers[commandID]
+	return h, ok
+}
+
+// ListenAndServe starts the metrics and pprof http servers if configured,
+// then listens on the address of s and serves its connections until Close
+// or Shutdown is called.
+func (s *Server) ListenAndServe() error {
+	if s.metrics != nil && s.metricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", s.metrics.Handler())
+		s.startHTTP(s.metricsAddr, mux, "metrics")
+	}
+	if s.pprofAddr != "" {
+		s.startHTTP(s.pprofAddr, pprofMux(), "pprof")
+	}
+
+	l, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("tcpserver: server start ok(on %s)", l.Addr())
+	return s.Serve(l)
+}
+
+func (s *Server) startHTTP(addr string, h http.Handler, name string) {
+	srv := &http.Server{Addr: addr, Handler: h}
+	s.mu.Lock()
+	s.httpSrvs = append(s.httpSrvs, srv)
+	s.mu.Unlock()
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("tcpserver: %s http server start failed: %v", name, err)
+		}
+	}()
+	log.Printf("tcpserver: %s server start ok(%s)", name, addr)
+}
+
+// Serve accepts connections on l until Close or Shutdown is called, it
+// then returns ErrServerClosed. With WithTLS, the connections are served
+// over TLS.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	if s.tlsConfig != nil {
+		l = tls.NewListener(l, s.tlsConfig)
+	}
+	s.ls[l] = struct{}{}
+	s.mu.Unlock()
+
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			delete(s.ls, l)
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+
+		if !s.allowed(c.RemoteAddr()) {
+			s.reject(rejectAddress)
+			c.Close()
+			continue
+		}
+		if err := s.track(c); err != nil {
+			if err == errMaxConns {
+				s.reject(rejectMaxConns)
+				s.refuse(c)
+				continue
+			}
+			c.Close()
+			return err
+		}
+		// start a new goroutine to handle the new connection.
+		go s.handleConn(c)
+	}
+}
+
+// track adds c to the connections of s. It returns ErrServerClosed once s
+// is closed, and errMaxConns if s already has the connections allowed by
+// WithMaxConns, handshaken or not.
+func (s *Server) track(c net.Conn) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case s.closed:
+		return ErrServerClosed
+	case s.maxConns > 0 && len(s.conns) >= s.maxConns:
+		return errMaxConns
+	}
+	s.conns[c] = struct{}{}
+	s.wg.Add(1)
+	return nil
+}
+
+// register adds sc to the connections Shutdown disconnects. It reports
+// whether the server is already shutting down.
+func (s *Server) register(sc *serverConn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active[sc] = struct{}{}
+	return s.closed
+}
+
+func (s *Server) unregister(sc *serverConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.active, sc)
+}
+
+// Shutdown stops the listeners, sends a Disconnect to the clients and
+// stops reading their connections. The requests already read are still
+// served and acked, then the connections are closed, without waiting for
+// the clients. Connections that did not complete their handshake are
+// closed at once. Once ctx is done, Shutdown closes
+// the remaining connections as Close does and returns the error of ctx.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	for l := range s.ls {
+		l.Close()
+	}
+	handshaken := make(map[net.Conn]bool)
+	for sc := range s.active {
+		handshaken[sc.c] = true
+		sc.disconnect()
+	}
+	for c := range s.conns {
+		if !handshaken[c] {
+			c.Close()
+		}
+	}
+	for c := range s.refusing {
+		c.Close()
+	}
+	s.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		return s.Close()
+	case <-ctx.Done():
+		s.Close() // 强制关闭剩余的连接
+		return ctx.Err()
+	}
+}
+
+// Close stops the listeners and the http servers, closes the connections
+// and waits for their handlers to return.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for l := range s.ls {
+		l.Close()
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	for c := range s.refusing {
+		c.Close()
+	}
+	for _, srv := range s.httpSrvs {
+		srv.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return nil
+}
+
+func (s *Server) handleConn(c net.Conn) {
+	if s.metrics != nil {
+		s.metrics.ClientConnected.Inc() // 连接建立，ClientConnected加1
+	}
+	reason := reasonError
+	defer func() {
+		// 与net/http一样，一个连接的panic只关闭该连接，不影响整个服务端
+		if r := recover(); r != nil {
+			log.Printf("tcpserver: panic serving %v: %v\n%s", c.RemoteAddr(), r, debug.Stack())
+		}
+		if s.metrics != nil {
+			s.metrics.ClientConnected.Dec() // 连接断开，ClientConnected减1
+			s.metrics.Disconnects.WithLabelValues(reason).Inc()
+		}
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		c.Close()
+		s.wg.Done()
+	}()
+
+	// 握手须在handshakeTimeout内完成，心跳间隔更短时以心跳为准
+	timeout := s.handshakeTimeout
+	if t := s.readTimeout(time.Now()); t > 0 && t < timeout {
+		timeout = t
+	}
+	dr := &deadlineReader{conn: c, timeout: timeout}
+	var r io.Reader = dr
+	var w io.Writer = c
+	flush := func() error { return nil }
+	if s.bufferedIO {
+		wbuf := bufio.NewWriter(c)
+		r, w = bufio.NewReader(dr), wbuf
+		flush = wbuf.Flush
+	}
+	cr := &countingReader{r: r}
+
+	sess, err := s.handshake(c, cr, w, flush)
+	if err != nil {
+		switch {
+		case err == io.EOF:
+			reason = reasonClosed
+		case errors.Is(err, net.ErrClosed):
+			reason = reasonServerClosed
+		default:
+			reason = reasonHandshake
+			log.Printf("tcpserver: handshake with %v failed: %v", c.RemoteAddr(), err)
+		}
+		return
+	}
+
+	defer s.release(sess)
+	c.SetReadDeadline(time.Time{}) // 此后由readLoop按心跳与空闲时间设置
+
+	sc := newServerConn(s, c, sess.codec)
+	sc.limiters = sess.limiters
+	reason = sc.serve(cr, dr, w, flush)
+}
+
+// handlePacket decodes the packet of framePayload, hands it to the handler
+// of its command and returns the encoded ack, nil if there is none.
+func (s *Server) handlePacket(framePayload []byte) ([]byte, error) {
+	if len(framePayload) == 0 {
+		return nil, packet.ErrEmptyPacket
+	}
+	h, ok := s.handler(framePayload[0])
+	if !ok {
+		return nil, fmt.Errorf("no handler for commandID [%d]", framePayload[0])
+	}
+
+	p, err := packet.Decode(framePayload)
+	if err == nil {
+		var ack packet.Packet
+		if ack, err = h.ServePacket(p); err == nil {
+			if ack == nil {
+				return nil, nil
+			}
+			return packet.Encode(ack)
+		}
+	}
+	// 请求包可以应答时，以结果码应答，连接可继续使用
+	ack := errorAck(framePayload, packet.ResultMalformed)
+	if ack == nil {
+		return nil, err
+	}
+	var perr *packet.Error
+	if !errors.As(err, &perr) {
+		ack.Result = resultOf(err)
+	}
+	log.Printf("tcpserver: submit %q failed with result %d: %v", ack.ID, ack.Result, err)
+	return packet.Encode(ack)
+}
+
+// errorAck returns the SubmitAck with result of the request in
+// framePayload, nil if it is not a Submit. Its ID is padded with zero
+// bytes if the request was too short to hold one.
+func errorAck(framePayload []byte, result uint8) *packet.SubmitAck {
+	if len(framePayload) == 0 || framePayload[0] != packet.CommandSubmit {
+		return nil
+	}
+	id := make([]byte, packet.IDLen)
+	copy(id, framePayload[1:])
+	return &packet.SubmitAck{ID: string(id), Result: result}
+}
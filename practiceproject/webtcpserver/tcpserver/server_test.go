@@ -0,0 +1,637 @@
+package tcpserver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver/frame"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver/metrics"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver/packet"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// startServer serves s on a random local port until the test ends.
+func startServer(t *testing.T, s *Server) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(l) }()
+	t.Cleanup(func() {
+		s.Close()
+		if err := <-done; err != ErrServerClosed {
+			t.Errorf("want %v, actual %v", ErrServerClosed, err)
+		}
+	})
+	return l.Addr().String()
+}
+
+func TestServerSubmit(t *testing.T) {
+	for _, buffered := range []bool{false, true} {
+		t.Run(fmt.Sprintf("buffered=%v", buffered), func(t *testing.T) {
+			m := metrics.New("test")
+			opts := []Option{WithMetrics(m, "")}
+			if buffered {
+				opts = append(opts, WithBufferedIO())
+			}
+			s := NewServer("", opts...)
+			s.Handle(packet.CommandSubmit, AckSubmit)
+			c, err := Dial(startServer(t, s))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			// 先连续发送，再读取应答
+			const n = 10
+			for i := 0; i < n; i++ {
+				err = c.Send(&packet.Submit{ID: fmt.Sprintf("%08d", i), Payload: []byte("hello")})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i := 0; i < n; i++ {
+				p, err := c.Receive()
+				if err != nil {
+					t.Fatal(err)
+				}
+				ack, ok := p.(*packet.SubmitAck)
+				if !ok || ack.ID != fmt.Sprintf("%08d", i) || ack.Result != 0 {
+					t.Errorf("want the ack of submit %d, actual %#v", i, p)
+				}
+			}
+
+			if v := testutil.ToFloat64(m.ReqRecvTotal); v != n {
+				t.Errorf("want %d requests, actual %v", n, v)
+			}
+			if v := testutil.ToFloat64(m.RspSendTotal); v != n {
+				t.Errorf("want %d responses, actual %v", n, v)
+			}
+			if v := testutil.ToFloat64(m.ClientConnected); v != 1 {
+				t.Errorf("want 1 client, actual %v", v)
+			}
+		})
+	}
+}
+
+// echo is a packet registered by the tests, to check that the handlers
+// are found by command id.
+type echo struct {
+	Body []byte
+}
+
+const commandEcho = 0x7f
+
+func (e *echo) Decode(body []byte) error {
+	e.Body = append([]byte(nil), body...)
+	return nil
+}
+
+func (e *echo) Encode() ([]byte, error) {
+	return e.Body, nil
+}
+
+func init() {
+	packet.Register(commandEcho, func() packet.Packet { return &echo{} })
+}
+
+func TestServerHandlers(t *testing.T) {
+	s := NewServer("")
+	s.HandleFunc(commandEcho, func(p packet.Packet) (packet.Packet, error) {
+		return &echo{Body: append([]byte("echo "), p.(*echo).Body...)}, nil
+	})
+	addr := startServer(t, s)
+
+	c, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err = c.Send(&echo{Body: []byte("hi")}); err != nil {
+		t.Fatal(err)
+	}
+	p, err := c.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, ok := p.(*echo); !ok || string(e.Body) != "echo hi" {
+		t.Errorf("want echo hi, actual %#v", p)
+	}
+
+	// Submit没有注册处理器，连接被关闭
+	if err = c.Send(&packet.Submit{ID: "00000001"}); err != nil {
+		t.Fatal(err)
+	}
+	if p, err = c.Receive(); err == nil {
+		t.Errorf("want the connection closed, actual %#v", p)
+	}
+}
+
+func TestServerClose(t *testing.T) {
+	s := NewServer("")
+	s.Handle(packet.CommandSubmit, AckSubmit)
+	c, err := Dial(startServer(t, s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	s.Close()
+	if p, err := c.Receive(); err == nil {
+		t.Errorf("want the connection closed, actual %#v", p)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Serve(l); err != ErrServerClosed {
+		t.Errorf("want %v, actual %v", ErrServerClosed, err)
+	}
+}
+
+// TestServerShutdown checks that Shutdown acks the requests already read,
+// then closes the connections without waiting for the clients.
+func TestServerShutdown(t *testing.T) {
+	release := make(chan struct{})
+	s := NewServer("")
+	s.Handle(packet.CommandSubmit, blockingHandler(release))
+	addr := startServer(t, s)
+	c, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	submit(t, c, 1, "slow")
+	submit(t, c, 2, "slow")
+
+	// 没有握手的连接被立即关闭
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	shutdown := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdown <- s.Shutdown(ctx)
+	}()
+	if p, err := readPacket(t, conn); err != io.EOF {
+		t.Errorf("want the connection closed, actual %#v, %v", p, err)
+	}
+	if p, err := c.Receive(); err != nil {
+		t.Fatal(err)
+	} else if d, ok := p.(*packet.Disconnect); !ok || d.Reason != packet.DisconnectShutdown {
+		t.Fatalf("want a disconnect, actual %#v", p)
+	}
+	if _, err = Dial(addr); err == nil {
+		t.Errorf("want the listener closed")
+	}
+
+	close(release)
+	for i := 1; i <= 2; i++ {
+		if ack := receiveAck(t, c); ack.ID != fmt.Sprintf("%08d", i) || ack.Result != packet.ResultOK {
+			t.Errorf("want the ack of %d, actual %#v", i, ack)
+		}
+	}
+
+	// 客户端不关闭连接时，服务端在应答后关闭，Shutdown不必等到ctx到期
+	select {
+	case err := <-shutdown:
+		if err != nil {
+			t.Errorf("want nil, actual %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("want shutdown done once the requests are acked")
+	}
+	if p, err := c.Receive(); err == nil {
+		t.Errorf("want the connection closed, actual %#v", p)
+	}
+}
+
+// TestServerShutdownIgnored checks that a client still sending after the
+// Disconnect does not keep Shutdown waiting.
+func TestServerShutdownIgnored(t *testing.T) {
+	s := NewServer("")
+	s.Handle(packet.CommandSubmit, AckSubmit)
+	c, err := Dial(startServer(t, s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for i := 1; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if c.Send(&packet.Submit{ID: fmt.Sprintf("%08d", i), Payload: []byte("x")}) != nil {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err = s.Shutdown(ctx); err != nil {
+		t.Errorf("want nil, actual %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("want shutdown done at once, actual %v", d)
+	}
+}
+
+func TestServerShutdownTimeout(t *testing.T) {
+	release := make(chan struct{})
+	s := NewServer("")
+	s.Handle(packet.CommandSubmit, blockingHandler(release))
+	c, err := Dial(startServer(t, s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	submit(t, c, 1, "slow")
+	time.Sleep(50 * time.Millisecond)
+
+	// 处理器返回前，Shutdown等待其返回
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		close(release)
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err = s.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("want %v, actual %v", context.DeadlineExceeded, err)
+	}
+	if p, err := c.Receive(); err != nil {
+		t.Fatal(err)
+	} else if _, ok := p.(*packet.Disconnect); !ok {
+		t.Fatalf("want a disconnect, actual %#v", p)
+	}
+	if p, err := c.Receive(); err == nil {
+		t.Errorf("want the connection closed, actual %#v", p)
+	}
+}
+
+// TestServerMaliciousClients sends invalid frames and checks that they
+// only close their own connection.
+func TestServerMaliciousClients(t *testing.T) {
+	m := metrics.New("test")
+	s := NewServer("",
+		WithMetrics(m, ""),
+		WithBufferedIO(),
+		WithCodec(frame.NewMyFrameCodec(frame.WithMaxFrameSize(1024))),
+	)
+	s.Handle(packet.CommandSubmit, AckSubmit)
+	addr := startServer(t, s)
+
+	attacks := map[string][]byte{
+		"negative length":  {0xff, 0xff, 0xff, 0xff},
+		"short length":     {0x0, 0x0, 0x0, 0x2},
+		"huge length":      {0x7f, 0xff, 0xff, 0xff},
+		"over the limit":   {0x0, 0x0, 0x4, 0x1},
+		"empty packet":     {0x0, 0x0, 0x0, 0x4},
+		"unknown command":  {0x0, 0x0, 0x0, 0x5, 0x55},
+		"truncated frame":  {0x0, 0x0, 0x4, 0x0, 0x2, 'x'},
+		"short conn":       {0x0, 0x0, 0x0, 0x6, packet.CommandConn, '1'},
+		"length then idle": {0x0, 0x0, 0x4, 0x0},
+	}
+	// 在握手之后发送的攻击
+	afterHandshake := map[string]bool{
+		"empty packet":    true,
+		"unknown command": true,
+		"short conn":      true,
+	}
+	for name, data := range attacks {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if afterHandshake[name] {
+			rawHandshake(t, conn)
+		}
+		conn.Write(data)
+		if name == "truncated frame" || name == "length then idle" {
+			conn.Close() // 服务端等待帧的剩余部分，直到连接关闭
+			continue
+		}
+
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if n, err := conn.Read(make([]byte, 16)); err != io.EOF {
+			t.Errorf("%s: want the connection closed, actual %d bytes, %v", name, n, err)
+		}
+		conn.Close()
+	}
+
+	// 服务端仍可正常服务
+	c, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err = c.Send(&packet.Submit{ID: "00000001", Payload: []byte("hello")}); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := c.Receive(); err != nil {
+		t.Errorf("want an ack, actual %v", err)
+	} else if ack, ok := p.(*packet.SubmitAck); !ok || ack.ID != "00000001" {
+		t.Errorf("want the ack of 00000001, actual %#v", p)
+	}
+
+	// 其他连接都已关闭
+	deadline := time.Now().Add(5 * time.Second)
+	for testutil.ToFloat64(m.ClientConnected) != 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if v := testutil.ToFloat64(m.ClientConnected); v != 1 {
+		t.Errorf("want 1 client, actual %v", v)
+	}
+}
+
+// rawHandshake opens a session without features on conn.
+func rawHandshake(t *testing.T, conn net.Conn) {
+	codec := frame.NewMyFrameCodec()
+	framePayload, _ := packet.Encode(&packet.Conn{ID: "00000000", Version: packet.ProtocolVersion})
+	if err := codec.Encode(conn, framePayload); err != nil {
+		t.Fatal(err)
+	}
+	framePayload, err := codec.Decode(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, err := packet.Decode(framePayload); err != nil || p.(*packet.ConnAck).Result != packet.ConnAccepted {
+		t.Fatalf("want an accepted connack, actual %#v, %v", p, err)
+	}
+}
+
+func TestServerHandshake(t *testing.T) {
+	var clientIDs []string
+	s := NewServer("", WithAuth(func(clientID string, credentials []byte) error {
+		clientIDs = append(clientIDs, clientID)
+		if string(credentials) != "secret" {
+			return errors.New("bad credentials")
+		}
+		return nil
+	}))
+	s.Handle(packet.CommandSubmit, AckSubmit)
+	addr := startServer(t, s)
+
+	c, err := Dial(addr, WithClientID("demo-1"), WithCredentials([]byte("secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if len(c.SessionID()) != 16 || c.Features() != 0 {
+		t.Errorf("want a session without features, actual %q, %#x", c.SessionID(), c.Features())
+	}
+	if err = c.Send(&packet.Submit{ID: "00000001", Payload: []byte("hello")}); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := c.Receive(); err != nil {
+		t.Errorf("want an ack, actual %v", err)
+	} else if ack, ok := p.(*packet.SubmitAck); !ok || ack.ID != "00000001" {
+		t.Errorf("want the ack of 00000001, actual %#v", p)
+	}
+
+	_, err = Dial(addr, WithClientID("demo-2"), WithCredentials([]byte("wrong")))
+	var cerr *ConnError
+	if !errors.As(err, &cerr) || cerr.Result != packet.ConnRefusedCredentials {
+		t.Errorf("want %d, actual %v", packet.ConnRefusedCredentials, err)
+	}
+	_, err = Dial(addr, WithClientID("demo\n3"), WithCredentials([]byte("secret")))
+	if !errors.As(err, &cerr) || cerr.Result != packet.ConnRefusedClientID {
+		t.Errorf("want %d, actual %v", packet.ConnRefusedClientID, err)
+	}
+
+	// 未提供客户端ID时，以会话ID作为客户端ID
+	c2, err := Dial(addr, WithCredentials([]byte("secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Close()
+	if want := []string{"demo-1", "demo-2", c2.SessionID()}; fmt.Sprint(clientIDs) != fmt.Sprint(want) {
+		t.Errorf("want %v, actual %v", want, clientIDs)
+	}
+}
+
+func TestServerHandshakeVersion(t *testing.T) {
+	s := NewServer("")
+	conn, err := net.Dial("tcp", startServer(t, s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	codec := frame.NewMyFrameCodec()
+	framePayload, _ := packet.Encode(&packet.Conn{ID: "00000000", Version: 0})
+	codec.Encode(conn, framePayload)
+	framePayload, err = codec.Decode(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := packet.Decode(framePayload)
+	if ack, ok := p.(*packet.ConnAck); !ok || ack.Result != packet.ConnRefusedVersion || ack.Version != packet.ProtocolVersion {
+		t.Errorf("want %d, actual %#v, %v", packet.ConnRefusedVersion, p, err)
+	}
+	if _, err = codec.Decode(conn); err != io.EOF {
+		t.Errorf("want the connection closed, actual %v", err)
+	}
+}
+
+func TestServerFeatures(t *testing.T) {
+	all := uint8(packet.FeatureCompression | packet.FeatureChecksum)
+	tests := []struct {
+		server, client, want uint8
+	}{
+		{all, 0, 0},
+		{all, packet.FeatureCompression, packet.FeatureCompression},
+		{all, packet.FeatureChecksum, packet.FeatureChecksum},
+		{all, all, all},
+		{packet.FeatureChecksum, all, packet.FeatureChecksum},
+		{0, all, 0},
+	}
+
+	for _, tt := range tests {
+		s := NewServer("", WithFeatures(tt.server), WithBufferedIO())
+		s.HandleFunc(commandEcho, func(p packet.Packet) (packet.Packet, error) {
+			return p, nil
+		})
+		c, err := Dial(startServer(t, s), WithClientFeatures(tt.client))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Features() != tt.want {
+			t.Errorf("server %#x, client %#x: want %#x, actual %#x", tt.server, tt.client, tt.want, c.Features())
+		}
+
+		body := bytes.Repeat([]byte("hello "), 1000)
+		if err = c.Send(&echo{Body: body}); err != nil {
+			t.Fatal(err)
+		}
+		if p, err := c.Receive(); err != nil || !bytes.Equal(p.(*echo).Body, body) {
+			t.Errorf("server %#x, client %#x: want the echo, actual %v", tt.server, tt.client, err)
+		}
+		c.Close()
+	}
+}
+
+// plainCodec is a codec of another package than frame.
+type plainCodec struct {
+	frame.StreamFrameCodec
+}
+
+func TestServerFeaturesCodec(t *testing.T) {
+	all := uint8(packet.FeatureCompression | packet.FeatureChecksum)
+	codec := plainCodec{frame.NewMyFrameCodec()}
+	s := NewServer("", WithCodec(codec))
+	s.HandleFunc(commandEcho, func(p packet.Packet) (packet.Packet, error) {
+		return p, nil
+	})
+	c, err := Dial(startServer(t, s), WithClientCodec(codec), WithClientFeatures(all))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if c.Features() != packet.FeatureCompression {
+		t.Errorf("want %#x, actual %#x", packet.FeatureCompression, c.Features())
+	}
+	if err = c.Send(&echo{Body: []byte("hello")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Receive(); err != nil {
+		t.Errorf("want the echo, actual %v", err)
+	}
+}
+
+func TestNegotiatedCodec(t *testing.T) {
+	all := uint8(packet.FeatureCompression | packet.FeatureChecksum)
+	codec := negotiatedCodec(frame.NewMyFrameCodec(), all)
+	var buf bytes.Buffer
+	payload := bytes.Repeat([]byte("hello "), 1000)
+	if err := codec.Encode(&buf, payload); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() > len(payload)/10 {
+		t.Errorf("want the payload compressed, actual %d bytes", buf.Len())
+	}
+
+	data := buf.Bytes()
+	data[len(data)-5] ^= 0x01
+	if _, err := codec.Decode(bytes.NewReader(data)); !errors.Is(err, frame.ErrChecksum) {
+		t.Errorf("want %v, actual %v", frame.ErrChecksum, err)
+	}
+
+	// 校验和由frame.NewCodec的CRC32C版本完成，保留原codec的长度编码
+	for _, tt := range []struct {
+		codec frame.StreamFrameCodec
+		want  frame.Version
+	}{
+		{frame.NewMyFrameCodec(), frame.VersionFixedCRC32C},
+		{frame.NewCodec(frame.VersionVarint), frame.VersionVarintCRC32C},
+	} {
+		buf.Reset()
+		negotiatedCodec(tt.codec, packet.FeatureChecksum).Encode(&buf, payload)
+		if v := frame.Version(buf.Bytes()[0]); v != tt.want {
+			t.Errorf("want %v, actual %v", tt.want, v)
+		}
+	}
+
+	// 解压的上限为原codec的最大帧长
+	buf.Reset()
+	small := frame.NewMyFrameCodec(frame.WithMaxFrameSize(1024))
+	negotiatedCodec(frame.NewMyFrameCodec(), all).Encode(&buf, make([]byte, 2048))
+	if _, err := negotiatedCodec(small, all).Decode(&buf); !errors.Is(err, frame.ErrFrameTooLarge) {
+		t.Errorf("want %v, actual %v", frame.ErrFrameTooLarge, err)
+	}
+
+	// 解压后超过上限的payload
+	buf.Reset()
+	bomb := flateCodec{frame.NewMyFrameCodec(), 1 << 20}
+	bomb.Encode(&buf, make([]byte, 2<<20))
+	if _, err := (flateCodec{frame.NewMyFrameCodec(), 1 << 20}).Decode(&buf); !errors.Is(err, frame.ErrFrameTooLarge) {
+		t.Errorf("want %v, actual %v", frame.ErrFrameTooLarge, err)
+	}
+}
+
+// TestServerResults checks the results of the Submits that fail.
+func TestServerResults(t *testing.T) {
+	s := NewServer("")
+	s.HandleFunc(packet.CommandSubmit, func(p packet.Packet) (packet.Packet, error) {
+		switch submit := p.(*packet.Submit); string(submit.Payload) {
+		case "bad":
+			return nil, fmt.Errorf("payload %q: %w", submit.Payload, ErrMalformed)
+		case "busy":
+			return nil, ErrOverloaded
+		case "fail":
+			return nil, errors.New("store unavailable")
+		}
+		return AckSubmit(p)
+	})
+	addr := startServer(t, s)
+	codec := frame.NewMyFrameCodec()
+
+	// 握手之前的Submit
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	framePayload, _ := packet.Encode(&packet.Submit{ID: "00000001", Payload: []byte("hello")})
+	codec.Encode(conn, framePayload)
+	framePayload, err = codec.Decode(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := packet.Decode(framePayload)
+	if ack, ok := p.(*packet.SubmitAck); !ok || ack.ID != "00000001" || ack.Result != packet.ResultUnauthorized {
+		t.Errorf("want %d, actual %#v, %v", packet.ResultUnauthorized, p, err)
+	}
+	if _, err = codec.Decode(conn); err != io.EOF {
+		t.Errorf("want the connection closed, actual %v", err)
+	}
+
+	// 握手之后，失败的Submit不影响连接
+	conn2, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn2.Close()
+	rawHandshake(t, conn2)
+	tests := []struct {
+		framePayload []byte
+		id           string
+		result       uint8
+	}{
+		{[]byte{packet.CommandSubmit, '1'}, "1\x00\x00\x00\x00\x00\x00\x00", packet.ResultMalformed},
+		{[]byte("\x0200000002bad"), "00000002", packet.ResultMalformed},
+		{[]byte("\x0200000003busy"), "00000003", packet.ResultOverloaded},
+		{[]byte("\x0200000004fail"), "00000004", packet.ResultInternal},
+		{[]byte("\x0200000005hello"), "00000005", packet.ResultOK},
+	}
+	for _, tt := range tests {
+		codec.Encode(conn2, tt.framePayload)
+		framePayload, err := codec.Decode(conn2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := packet.Decode(framePayload)
+		if ack, ok := p.(*packet.SubmitAck); !ok || ack.ID != tt.id || ack.Result != tt.result {
+			t.Errorf("%q: want %d, actual %#v, %v", tt.framePayload, tt.result, p, err)
+		}
+	}
+}
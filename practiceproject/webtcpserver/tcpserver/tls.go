@@ -0,0 +1,101 @@
+package tcpserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"net"
+	"os"
+)
+
+// WithTLS makes the server accept TLS connections only, with config. The
+// client certificates are verified if config.ClientAuth asks for it.
+func WithTLS(config *tls.Config) Option {
+	return func(s *Server) {
+		s.tlsConfig = config
+	}
+}
+
+// WithCertClientID sets the client ID of the sessions from the subject of
+// the verified certificate of the client, with mapping. The clients then
+// have to send that ID or none in their Conn, others are refused with
+// packet.ConnRefusedClientID. A mapping returning "" leaves the client ID
+// to the Conn.
+func WithCertClientID(mapping func(subject pkix.Name) string) Option {
+	return func(s *Server) {
+		s.certClientID = mapping
+	}
+}
+
+// SubjectCommonName is a mapping for WithCertClientID that uses the common
+// name of the certificate as the client ID.
+func SubjectCommonName(subject pkix.Name) string {
+	return subject.CommonName
+}
+
+// peerClientID returns the client ID mapped from the verified certificate
+// of c, "" if there is none.
+func (s *Server) peerClientID(c net.Conn) string {
+	tc, ok := c.(*tls.Conn)
+	if !ok || s.certClientID == nil {
+		return ""
+	}
+	chains := tc.ConnectionState().VerifiedChains
+	if len(chains) == 0 || len(chains[0]) == 0 {
+		return ""
+	}
+	return s.certClientID(chains[0][0].Subject)
+}
+
+// LoadServerTLS returns the TLS config of a server from the PEM files of
+// its certificate and key. If clientCAFile is not empty, the clients must
+// present a certificate signed by one of the CAs it holds.
+func LoadServerTLS(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if clientCAFile != "" {
+		if config.ClientCAs, err = loadCertPool(clientCAFile); err != nil {
+			return nil, err
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// LoadClientTLS returns the TLS config of a client. The server certificate
+// is verified with the CAs of caFile, or those of the system if it is
+// empty. If certFile is not empty, the client presents the certificate of
+// certFile and keyFile to the server.
+func LoadClientTLS(caFile, certFile, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	var err error
+	if caFile != "" {
+		if config.RootCAs, err = loadCertPool(caFile); err != nil {
+			return nil, err
+		}
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("tcpserver: no certificate in %s", file)
+	}
+	return pool, nil
+}
@@ -0,0 +1,221 @@
+package tcpserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver/packet"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCA signs the certificates of the tests, generated in memory.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+// issue returns a certificate of the CA for commonName, valid for the
+// server of 127.0.0.1 and for clients.
+func (ca *testCA) issue(t *testing.T, commonName string) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestServerTLS(t *testing.T) {
+	ca := newTestCA(t)
+	s := NewServer("", WithTLS(&tls.Config{Certificates: []tls.Certificate{ca.issue(t, "server")}}))
+	s.Handle(packet.CommandSubmit, AckSubmit)
+	addr := startServer(t, s)
+
+	c, err := Dial(addr, WithClientTLS(&tls.Config{RootCAs: ca.pool}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, ok := c.Conn().(*tls.Conn); !ok {
+		t.Errorf("want a tls connection, actual %T", c.Conn())
+	}
+	submit(t, c, 1, "hello")
+	if ack := receiveAck(t, c); ack.ID != "00000001" || ack.Result != packet.ResultOK {
+		t.Errorf("want the ack of 1, actual %#v", ack)
+	}
+
+	// 明文客户端与不信任该CA的客户端无法连接
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(time.Second))
+	if c, err := NewClient(conn); err == nil {
+		c.Close()
+		t.Errorf("want a plaintext client refused")
+	}
+	conn.Close()
+	if _, err = Dial(addr, WithClientTLS(&tls.Config{})); err == nil {
+		t.Errorf("want the server certificate refused")
+	}
+}
+
+func TestServerMutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	clientIDs := make(chan string, 2)
+	s := NewServer("",
+		WithTLS(&tls.Config{
+			Certificates: []tls.Certificate{ca.issue(t, "server")},
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			ClientCAs:    ca.pool,
+		}),
+		WithCertClientID(SubjectCommonName),
+		WithAuth(func(clientID string, credentials []byte) error {
+			clientIDs <- clientID
+			return nil
+		}),
+	)
+	s.Handle(packet.CommandSubmit, AckSubmit)
+	addr := startServer(t, s)
+	config := &tls.Config{RootCAs: ca.pool, Certificates: []tls.Certificate{ca.issue(t, "client-1")}}
+
+	// 客户端ID取自证书主题
+	for _, id := range []string{"", "client-1"} {
+		c, err := Dial(addr, WithClientTLS(config), WithClientID(id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if clientID := <-clientIDs; clientID != "client-1" {
+			t.Errorf("want client-1, actual %q", clientID)
+		}
+		submit(t, c, 1, "hello")
+		receiveAck(t, c)
+		c.Close()
+	}
+
+	// 与证书不符的客户端ID被拒绝
+	_, err := Dial(addr, WithClientTLS(config), WithClientID("client-2"))
+	var cerr *ConnError
+	if !errors.As(err, &cerr) || cerr.Result != packet.ConnRefusedClientID {
+		t.Errorf("want invalid client id, actual %v", err)
+	}
+
+	// 没有证书或证书不是该CA签发的客户端无法连接
+	other := newTestCA(t)
+	for name, config := range map[string]*tls.Config{
+		"no certificate":    {RootCAs: ca.pool},
+		"other certificate": {RootCAs: ca.pool, Certificates: []tls.Certificate{other.issue(t, "client-1")}},
+	} {
+		if c, err := Dial(addr, WithClientTLS(config)); err == nil {
+			c.Close()
+			t.Errorf("%s: want the client refused", name)
+		}
+	}
+}
+
+func TestLoadTLS(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	writePEM := func(name, typ string, der []byte) string {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+	writeCert := func(name string, cert tls.Certificate) (certFile, keyFile string) {
+		key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return writePEM(name+".pem", "CERTIFICATE", cert.Certificate[0]),
+			writePEM(name+"-key.pem", "PRIVATE KEY", key)
+	}
+	caFile := writePEM("ca.pem", "CERTIFICATE", ca.cert.Raw)
+	serverCert, serverKey := writeCert("server", ca.issue(t, "server"))
+	clientCert, clientKey := writeCert("client", ca.issue(t, "client-1"))
+
+	serverConfig, err := LoadServerTLS(serverCert, serverKey, caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serverConfig.ClientAuth != tls.RequireAndVerifyClientCert {
+		t.Errorf("want the client certificates verified, actual %v", serverConfig.ClientAuth)
+	}
+	clientConfig, err := LoadClientTLS(caFile, clientCert, clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer("", WithTLS(serverConfig))
+	s.Handle(packet.CommandSubmit, AckSubmit)
+	c, err := Dial(startServer(t, s), WithClientTLS(clientConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	submit(t, c, 1, "hello")
+	receiveAck(t, c)
+
+	if _, err = LoadClientTLS(serverKey, "", ""); err == nil {
+		t.Errorf("want an error for a file without certificate")
+	}
+	if _, err = LoadServerTLS(filepath.Join(dir, "missing.pem"), serverKey, ""); err == nil {
+		t.Errorf("want an error for a missing file")
+	}
+}
@@ -1,95 +1,63 @@
 package main
 
 import (
-	"bufio"
+	"context"
+	"flag"
 	"fmt"
-	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/webtcpservermetricscache/frame"
-	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/webtcpservermetricscache/metrics"
-	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/webtcpservermetricscache/packet"
-	"net"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver/metrics"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver/packet"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
-func handlePacket(framePayload []byte) (ackFramePayload []byte, err error) {
-	var p packet.Packet
-	p, err = packet.Decode(framePayload)
-	if err != nil {
-		fmt.Println("handleConn: packet decode error:", err)
-		return
+// 使用带缓存的网络I/O，减少系统调用
+func main() {
+	certFile := flag.String("cert", "", "TLS certificate file, plaintext if empty")
+	keyFile := flag.String("key", "", "TLS key file")
+	clientCAFile := flag.String("client-ca", "", "CA file verifying the client certificates, not verified if empty")
+	flag.Parse()
+
+	opts := []tcpserver.Option{
+		tcpserver.WithMetrics(metrics.New("tcp_server_demo2"), ":8889"), // for prometheus to connect
+		tcpserver.WithBufferedIO(),
 	}
-
-	switch p.(type) {
-	case *packet.Submit:
-		submit := p.(*packet.Submit)
-		fmt.Printf("recv submit: id = %s, payload=%s\n", submit.ID, string(submit.Payload))
-		submitAck := &packet.SubmitAck{
-			ID:     submit.ID,
-			Result: 0,
-		}
-		ackFramePayload, err = packet.Encode(submitAck)
+	if *certFile != "" {
+		config, err := tcpserver.LoadServerTLS(*certFile, *keyFile, *clientCAFile)
 		if err != nil {
-			fmt.Println("handleConn: packet encode error:", err)
-			return nil, err
+			fmt.Println("tls config error:", err)
+			return
 		}
-		return ackFramePayload, nil
-	default:
-		return nil, fmt.Errorf("unknown packet type")
+		// 验证客户端证书时，以证书的CN作为客户端ID
+		opts = append(opts, tcpserver.WithTLS(config), tcpserver.WithCertClientID(tcpserver.SubjectCommonName))
 	}
-}
+	s := tcpserver.NewServer(":8888", opts...)
+	s.Handle(packet.CommandSubmit, tcpserver.LogSubmits(tcpserver.AckSubmit))
 
-func handleConn(c net.Conn) {
-	metrics.ClientConnected.Inc()
-	defer func() {
-		metrics.ClientConnected.Dec()
-		c.Close()
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- s.ListenAndServe()
 	}()
-	frameCodec := frame.NewMyFrameCodec()
-	rbuf := bufio.NewReader(c)
-	wbuf := bufio.NewWriter(c)
-
-	defer wbuf.Flush()
-
-	for {
-		// read from the connection
-		// decode the frame to get the payload
-		// the payload is undecoded packet
-		framePayload, err := frameCodec.Decode(rbuf)
-		if err != nil {
-			fmt.Println("handleConn: frame decode error:", err)
-			return
-		}
-		metrics.ReqRecvTotal.Add(1)
-
-		// do something with the packet
-		ackFramePayload, err := handlePacket(framePayload)
-		if err != nil {
-			fmt.Println("handleConn: handle packet error:", err)
-			return
-		}
 
-		// write ack frame to the connection
-		err = frameCodec.Encode(wbuf, ackFramePayload)
-		if err != nil {
-			fmt.Println("handleConn: frame encode error:", err)
-			return
-		}
-		metrics.RspSendTotal.Add(1)
-	}
-}
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
 
-func main() {
-	l, err := net.Listen("tcp", ":8888")
-	if err != nil {
-		fmt.Println("listen error:", err)
+	select { // 监视来自errChan以及c的事件
+	case err := <-errChan:
+		fmt.Println("server error:", err)
 		return
+	case <-c:
+		fmt.Println("server is exiting...")
 	}
 
-	for {
-		c, err := l.Accept()
-		if err != nil {
-			fmt.Println("accept error:", err)
-			break
-		}
-		// start a new goroutine to handle the new connection.
-		go handleConn(c)
+	// 通知客户端断开，最多等待5秒处理完已收到的请求
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		fmt.Println("server exit error:", err)
+		return
 	}
+	fmt.Println("server exit ok")
 }
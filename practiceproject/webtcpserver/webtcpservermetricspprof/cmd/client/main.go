@@ -1,22 +1,22 @@
 package main
 
 import (
+	"flag"
 	"fmt"
-	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/webtcpservermetricspprof/frame"
-	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/webtcpservermetricspprof/packet"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver/packet"
 	"github.com/lucasepe/codename"
 	"log"
-	"net"
 	"sync"
 )
 
-func startNewConn() {
-	conn, err := net.Dial("tcp", ":8888")
+func startNewConn(opts []tcpserver.ClientOption) {
+	c, err := tcpserver.Dial(":8888", opts...)
 	if err != nil {
 		log.Println("dial error:", err)
 		return
 	}
-	defer conn.Close()
+	defer c.Close()
 	log.Println("dial ok")
 
 	rng, err := codename.DefaultRNG()
@@ -24,32 +24,46 @@ func startNewConn() {
 		panic(err)
 	}
 
-	frameCodec := frame.NewMyFrameCodec()
 	var counter int
+	disconnected := make(chan struct{}) // 服务端关闭时关闭
 
 	go func() {
 		for {
 			// handle ack
 			// read from the connection
-			ackFramePayLoad, err := frameCodec.Decode(conn)
+			p, err := c.Receive()
 			if err != nil {
+				select {
+				case <-disconnected:
+					return // 服务端关闭后连接被关闭
+				default:
+				}
 				panic(err)
 			}
 
-			p, err := packet.Decode(ackFramePayLoad)
-
-			_, ok := p.(*packet.SubmitAck)
-			if !ok {
+			switch p.(type) {
+			case *packet.SubmitAck:
+				// fmt.Printf("the result of submit ack[%s] is %d\n", submitAck.ID, submitAck.Result)
+			case *packet.Disconnect:
+				// 继续接收已发送请求的应答，释放发送名额
+				log.Println("server is shutting down")
+				close(disconnected)
+			default:
 				panic("not submitack")
 			}
-			// fmt.Printf("the result of submit ack[%s] is %d\n", submitAck.ID, submitAck.Result)
 		}
 	}()
 
 	for {
+		select {
+		case <-disconnected:
+			return
+		default:
+		}
+
 		// send submit
 		counter++
-		id := fmt.Sprintf("%08d", counter) // 8 byte string
+		id := fmt.Sprintf("%08d", counter%100000000) // 8 byte string，循环使用
 		payload := codename.Generate(rng, 4)
 		s := &packet.Submit{
 			ID:      id,
@@ -57,25 +71,35 @@ func startNewConn() {
 		}
 		// fmt.Printf("send submit id = %s, payload=%s\n", s.ID, s.Payload)
 
-		framePayload, err := packet.Encode(s)
+		err = c.Send(s)
 		if err != nil {
 			panic(err)
 		}
+	}
+}
 
-		err = frameCodec.Encode(conn, framePayload)
+func main() {
+	caFile := flag.String("ca", "", "CA file verifying the server certificate, plaintext if empty")
+	certFile := flag.String("cert", "", "TLS client certificate file, none if empty")
+	keyFile := flag.String("key", "", "TLS client key file")
+	flag.Parse()
+
+	// 最多1000个Submit等待应答，避免发送速度超过服务端的处理速度
+	opts := []tcpserver.ClientOption{tcpserver.WithMaxInFlight(1000)}
+	if *caFile != "" {
+		config, err := tcpserver.LoadClientTLS(*caFile, *certFile, *keyFile)
 		if err != nil {
-			panic(err)
+			log.Println("tls config error:", err)
+			return
 		}
-
+		opts = append(opts, tcpserver.WithClientTLS(config))
 	}
-}
 
-func main() {
 	var wg sync.WaitGroup
 	wg.Add(100)
 	for i := 0; i < 100; i++ {
 		go func() {
-			startNewConn()
+			startNewConn(opts)
 			wg.Done()
 		}()
 	}
@@ -1,100 +1,63 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
-	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/webtcpservermetricspprof/frame"
-	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/webtcpservermetricspprof/metrics"
-	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/webtcpservermetricspprof/packet"
-	"net"
-	"net/http"
-	_ "net/http/pprof"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver/metrics"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver/packet"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
-func handlePacket(framePayload []byte) (ackFramePayload []byte, err error) {
-	var p packet.Packet
-	p, err = packet.Decode(framePayload)
-	if err != nil {
-		fmt.Println("handleConn: packet decode error:", err)
-		return
-	}
-
-	switch p.(type) {
-	case *packet.Submit:
-		submit := p.(*packet.Submit)
-		// fmt.Printf("recv submit: id = %s, payload=%s\n", submit.ID, string(submit.Payload))
-		submitAck := &packet.SubmitAck{
-			ID:     submit.ID,
-			Result: 0,
-		}
-		ackFramePayload, err = packet.Encode(submitAck)
-		if err != nil {
-			fmt.Println("handleConn: packet encode error:", err)
-			return nil, err
-		}
-		return ackFramePayload, nil
-	default:
-		return nil, fmt.Errorf("unknown packet type")
+// 在度量数据的基础上，提供pprof剖析，不再打印Submit
+func main() {
+	certFile := flag.String("cert", "", "TLS certificate file, plaintext if empty")
+	keyFile := flag.String("key", "", "TLS key file")
+	clientCAFile := flag.String("client-ca", "", "CA file verifying the client certificates, not verified if empty")
+	flag.Parse()
+
+	opts := []tcpserver.Option{
+		tcpserver.WithMetrics(metrics.New("tcp_server_demo2"), ":8889"), // for prometheus to connect
+		tcpserver.WithPprof(":6060"),
 	}
-}
-
-func handleConn(c net.Conn) {
-	metrics.ClientConnected.Inc()
-	defer func() {
-		metrics.ClientConnected.Dec()
-		c.Close()
-	}()
-	frameCodec := frame.NewMyFrameCodec()
-
-	for {
-		// read from the connection
-
-		// decode the frame to get the payload
-		// the payload is undecoded packet
-		framePayload, err := frameCodec.Decode(c)
+	if *certFile != "" {
+		config, err := tcpserver.LoadServerTLS(*certFile, *keyFile, *clientCAFile)
 		if err != nil {
-			fmt.Println("handleConn: frame decode error:", err)
+			fmt.Println("tls config error:", err)
 			return
 		}
-		metrics.ReqRecvTotal.Add(1)
-
-		// do something with the packet
-		ackFramePayload, err := handlePacket(framePayload)
-		if err != nil {
-			fmt.Println("handleConn: handle packet error:", err)
-			return
-		}
-
-		// write ack frame to the connection
-		err = frameCodec.Encode(c, ackFramePayload)
-		if err != nil {
-			fmt.Println("handleConn: frame encode error:", err)
-			return
-		}
-		metrics.RspSendTotal.Add(1)
+		// 验证客户端证书时，以证书的CN作为客户端ID
+		opts = append(opts, tcpserver.WithTLS(config), tcpserver.WithCertClientID(tcpserver.SubjectCommonName))
 	}
-}
+	s := tcpserver.NewServer(":8888", opts...)
+	s.Handle(packet.CommandSubmit, tcpserver.AckSubmit)
 
-func main() {
+	errChan := make(chan error, 1)
 	go func() {
-		http.ListenAndServe(":6060", nil)
+		errChan <- s.ListenAndServe()
 	}()
 
-	l, err := net.Listen("tcp", ":8888")
-	if err != nil {
-		fmt.Println("listen error:", err)
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+
+	select { // 监视来自errChan以及c的事件
+	case err := <-errChan:
+		fmt.Println("server error:", err)
 		return
+	case <-c:
+		fmt.Println("server is exiting...")
 	}
 
-	fmt.Println("server start ok(on *:8888)")
-
-	for {
-		c, err := l.Accept()
-		if err != nil {
-			fmt.Println("accept error:", err)
-			break
-		}
-		// start a new goroutine to handle
-		// the new connection.
-		go handleConn(c)
+	// 通知客户端断开，最多等待5秒处理完已收到的请求
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		fmt.Println("server exit error:", err)
+		return
 	}
+	fmt.Println("server exit ok")
 }
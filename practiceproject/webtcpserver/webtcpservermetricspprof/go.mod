@@ -3,8 +3,8 @@ module github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/webtcpserverm
 go 1.17
 
 require (
+	github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver v0.0.0
 	github.com/lucasepe/codename v0.2.0
-	github.com/prometheus/client_golang v1.12.1
 )
 
 require (
@@ -12,9 +12,12 @@ require (
 	github.com/cespare/xxhash/v2 v2.1.2 // indirect
 	github.com/golang/protobuf v1.5.2 // indirect
 	github.com/matttproud/golang_protobuf_extensions v1.0.1 // indirect
+	github.com/prometheus/client_golang v1.12.1 // indirect
 	github.com/prometheus/client_model v0.2.0 // indirect
 	github.com/prometheus/common v0.32.1 // indirect
 	github.com/prometheus/procfs v0.7.3 // indirect
 	golang.org/x/sys v0.0.0-20220114195835-da31bd327af9 // indirect
 	google.golang.org/protobuf v1.26.0 // indirect
 )
+
+replace github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver => ../tcpserver
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"crypto/tls"
+	"flag"
 	"fmt"
-	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/webtcpserversimple/frame"
-	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/webtcpserversimple/packet"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver/frame"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver/packet"
 	"github.com/lucasepe/codename"
 	"net"
 	"sync"
@@ -11,6 +14,31 @@ import (
 )
 
 func main() {
+	caFile := flag.String("ca", "", "CA file verifying the server certificate, plaintext if empty")
+	certFile := flag.String("cert", "", "TLS client certificate file, none if empty")
+	keyFile := flag.String("key", "", "TLS client key file")
+	framing := flag.String("frame", "", "versioned framing of the frames, that of the server; unversioned if empty")
+	flag.Parse()
+
+	var codec frame.StreamFrameCodec
+	if *framing != "" {
+		v, err := frame.ParseVersion(*framing)
+		if err != nil {
+			fmt.Println("frame error:", err)
+			return
+		}
+		codec = frame.NewCodec(v)
+	}
+
+	var config *tls.Config
+	if *caFile != "" {
+		var err error
+		if config, err = tcpserver.LoadClientTLS(*caFile, *certFile, *keyFile); err != nil {
+			fmt.Println("tls config error:", err)
+			return
+		}
+	}
+
 	var wg sync.WaitGroup
 	var num int = 5
 
@@ -19,22 +47,34 @@ func main() {
 	for i := 0; i < num; i++ {
 		go func(i int) {
 			defer wg.Done()
-			startClient(i)
+			startClient(i, config, codec)
 		}(i + 1)
 	}
 	wg.Wait()
 }
 
-func startClient(i int) {
+func startClient(i int, config *tls.Config, codec frame.StreamFrameCodec) {
 	quit := make(chan struct{})
 	done := make(chan struct{})
-	conn, err := net.Dial("tcp", ":8888")
+	disconnected := make(chan struct{}) // 服务端关闭时关闭
+	var opts []tcpserver.ClientOption
+	if codec != nil {
+		opts = append(opts, tcpserver.WithClientCodec(codec))
+	}
+	if config != nil {
+		opts = append(opts, tcpserver.WithClientTLS(config))
+	}
+	if config == nil || len(config.Certificates) == 0 {
+		// 使用客户端证书时，服务端从证书中取得客户端ID
+		opts = append(opts, tcpserver.WithClientID(fmt.Sprintf("client-%d", i)))
+	}
+	c, err := tcpserver.Dial(":8888", opts...)
 	if err != nil {
 		fmt.Println("dial error:", err)
 		return
 	}
-	defer conn.Close()
-	fmt.Printf("[client %d]: dial ok", i)
+	defer c.Close()
+	fmt.Printf("[client %d]: dial ok, session %s", i, c.SessionID())
 
 	// 生成payload
 	rng, err := codename.DefaultRNG()
@@ -42,7 +82,6 @@ func startClient(i int) {
 		panic(err)
 	}
 
-	frameCodec := frame.NewMyFrameCodec()
 	var counter int
 
 	go func() {
@@ -55,23 +94,31 @@ func startClient(i int) {
 			default:
 			}
 
-			conn.SetReadDeadline(time.Now().Add(time.Second * 1))
-			ackFramePayLoad, err := frameCodec.Decode(conn)
+			c.Conn().SetReadDeadline(time.Now().Add(time.Second * 1))
+			p, err := c.Receive()
 			if err != nil {
 				if e, ok := err.(net.Error); ok {
 					if e.Timeout() {
 						continue
 					}
 				}
+				select {
+				case <-disconnected:
+					return // 服务端关闭后连接被关闭
+				default:
+				}
 				panic(err)
 			}
 
-			p, err := packet.Decode(ackFramePayLoad)
-			submitAck, ok := p.(*packet.SubmitAck)
-			if !ok {
+			switch p := p.(type) {
+			case *packet.SubmitAck:
+				fmt.Printf("[client %d]: the result of submit ack[%s] is %d\n", i, p.ID, p.Result)
+			case *packet.Disconnect:
+				fmt.Printf("[client %d]: server is shutting down\n", i)
+				close(disconnected)
+			default:
 				panic("not submitack")
 			}
-			fmt.Printf("[client %d]: the result of submit ack[%s] is %d\n", i, submitAck.ID, submitAck.Result)
 		}
 	}()
 
@@ -85,20 +132,21 @@ func startClient(i int) {
 			Payload: []byte(payload),
 		}
 
-		framePayload, err := packet.Encode(s)
-		if err != nil {
-			panic(err)
-		}
-
-		fmt.Printf("[client %d]: send submit id = %s, payload=%s, frame length = %d\n",
-			i, s.ID, s.Payload, len(framePayload)+4)
+		fmt.Printf("[client %d]: send submit id = %s, payload=%s\n", i, s.ID, s.Payload)
 
-		err = frameCodec.Encode(conn, framePayload)
+		err = c.Send(s)
 		if err != nil {
 			panic(err)
 		}
 
 		time.Sleep(1 * time.Second)
+		select {
+		case <-disconnected:
+			// 服务端等待客户端关闭连接
+			fmt.Printf("[client %d]: exit ok", i)
+			return
+		default:
+		}
 		if counter >= 10 {
 			quit <- struct{}{}
 			<-done
@@ -1,81 +1,74 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
-	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/webtcpserversimple/frame"
-	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/webtcpserversimple/packet"
-	"net"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver/frame"
+	"github.com/Kate-liu/GoBeginner/practiceproject/webtcpserver/tcpserver/packet"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
-func handlePacket(framePayload []byte) (ackFramePayload []byte, err error) {
-	var p packet.Packet
-	p, err = packet.Decode(framePayload)
-	if err != nil {
-		fmt.Println("handleConn: packet decode error:", err)
-		return
-	}
+// 最简单的服务端：无缓存的网络I/O，打印每个Submit，断开失去响应的客户端，
+// 并限制连接数与每个连接的请求速率
+func main() {
+	certFile := flag.String("cert", "", "TLS certificate file, plaintext if empty")
+	keyFile := flag.String("key", "", "TLS key file")
+	clientCAFile := flag.String("client-ca", "", "CA file verifying the client certificates, not verified if empty")
+	framing := flag.String("frame", "", "versioned framing of the frames: fixed, fixed+crc32c, varint or varint+crc32c, the clients must use the same; unversioned if empty")
+	flag.Parse()
 
-	switch p.(type) {
-	case *packet.Submit:
-		submit := p.(*packet.Submit)
-		fmt.Printf("recv submit: id = %s, payload=%s\n", submit.ID, string(submit.Payload))
-		submitAck := &packet.SubmitAck{
-			ID:     submit.ID,
-			Result: 0,
-		}
-		ackFramePayload, err = packet.Encode(submitAck)
-		if err != nil {
-			fmt.Println("handleConn: packet encode error:", err)
-			return nil, err
-		}
-		return ackFramePayload, nil
-	default:
-		return nil, fmt.Errorf("unknown packet type")
+	opts := []tcpserver.Option{
+		tcpserver.WithHeartbeat(30 * time.Second),
+		tcpserver.WithMaxConns(100),
+		tcpserver.WithConnRateLimit(10, 20), // 每秒10个请求，最多突发20个
 	}
-}
-
-func handleConn(c net.Conn) {
-	defer c.Close()
-	frameCodec := frame.NewMyFrameCodec()
-
-	for {
-		// decode the frame to get the payload
-		framePayload, err := frameCodec.Decode(c)
-		if err != nil {
-			fmt.Println("handleConn: frame decode error:", err)
-			return
-		}
-
-		// do something with the packet
-		ackFramePayload, err := handlePacket(framePayload)
+	if *framing != "" {
+		v, err := frame.ParseVersion(*framing)
 		if err != nil {
-			fmt.Println("handleConn: handle packet error:", err)
+			fmt.Println("frame error:", err)
 			return
 		}
-
-		// write ack frame to the connection
-		err = frameCodec.Encode(c, ackFramePayload)
+		opts = append(opts, tcpserver.WithCodec(frame.NewCodec(v)))
+	}
+	if *certFile != "" {
+		config, err := tcpserver.LoadServerTLS(*certFile, *keyFile, *clientCAFile)
 		if err != nil {
-			fmt.Println("handleConn: frame encode error:", err)
+			fmt.Println("tls config error:", err)
 			return
 		}
+		// 验证客户端证书时，以证书的CN作为客户端ID
+		opts = append(opts, tcpserver.WithTLS(config), tcpserver.WithCertClientID(tcpserver.SubjectCommonName))
 	}
-}
+	s := tcpserver.NewServer(":8888", opts...)
+	s.Handle(packet.CommandSubmit, tcpserver.LogSubmits(tcpserver.AckSubmit))
 
-func main() {
-	l, err := net.Listen("tcp", ":8888")
-	if err != nil {
-		fmt.Println("listen error:", err)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- s.ListenAndServe()
+	}()
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+
+	select { // 监视来自errChan以及c的事件
+	case err := <-errChan:
+		fmt.Println("server error:", err)
 		return
+	case <-c:
+		fmt.Println("server is exiting...")
 	}
 
-	for {
-		c, err := l.Accept()
-		if err != nil {
-			fmt.Println("accept error:", err)
-			break
-		}
-		// start a new goroutine to handle the new connection.
-		go handleConn(c)
+	// 通知客户端断开，最多等待5秒处理完已收到的请求
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		fmt.Println("server exit error:", err)
+		return
 	}
+	fmt.Println("server exit ok")
 }